@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// Name of the access log inside the output directory
+	accessLogFileName = "access.jsonl"
+	// Name of the access log in anonymized mode, encrypted like the catalog
+	encryptedAccessLogFileName = "access.enc"
+)
+
+// accessRecord tells who exported, fetched, moved or removed a segment file
+// and when, for evidence handling
+type accessRecord struct {
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	Machine string    `json:"machine"`
+	Action  string    `json:"action"` // export, frames, fetch, tier, remove, view or backup
+	File    string    `json:"file"`
+	Detail  string    `json:"detail,omitempty"`
+}
+
+// accessLogMu serializes writes to the access log
+var accessLogMu sync.Mutex
+
+// accessLogPath returns the path of the access log
+func accessLogPath() string {
+	if anonymize {
+		return filepath.Join(outputDir, encryptedAccessLogFileName)
+	}
+	return filepath.Join(outputDir, accessLogFileName)
+}
+
+// logAccess records that the user running screen-vibe did something with
+// segment files, given as in the catalog
+func logAccess(action, detail string, files ...string) {
+	logAccessAs(loginUser(), action, detail, files...)
+}
+
+// logAccessAs records an access of another user, like a reviewer of the
+// view command
+func logAccessAs(user, action, detail string, files ...string) {
+	now, machine := time.Now(), machineName()
+	records := make([]accessRecord, 0, len(files))
+	for _, f := range files {
+		records = append(records, accessRecord{Time: now, User: user, Machine: machine, Action: action, File: f, Detail: detail})
+	}
+	accessLogMu.Lock()
+	defer accessLogMu.Unlock()
+	if err := appendRecords(accessLogPath(), records); err != nil {
+		consoleError("Could not write the access log: %v", err)
+	}
+}
+
+// runAccessLogCommand prints who accessed which segments
+func runAccessLogCommand(args []string) int {
+	fs := flag.NewFlagSet("access-log", flag.ExitOnError)
+	daysFlag := fs.Int("days", 0, "Only include the last N days (default: all)")
+	userFlag := fs.String("user", "", "Only include the accesses of this user")
+	actionFlag := fs.String("action", "", "Only include this action: export, frames, fetch, tier, remove, view or backup")
+	jsonFlag := fs.Bool("json", false, "Print records as JSON lines")
+	outputDirFlag := fs.String("output", outputDir, "Directory that holds the catalog")
+	envUsage(fs)
+	if err := applyFlagEnv(fs); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	fs.Parse(args)
+	outputDir = *outputDirFlag
+
+	// Prefer the encrypted catalog when it exists
+	if err := openCatalog(); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	records, err := readRecords[accessRecord](accessLogPath())
+	if err != nil {
+		consoleError("Could not read the access log: %v", err)
+		return 1
+	}
+	var since time.Time
+	if *daysFlag > 0 {
+		y, m, d := time.Now().Date()
+		since = time.Date(y, m, d-*daysFlag+1, 0, 0, 0, 0, time.Local)
+	}
+	var files []string
+	for _, f := range fs.Args() {
+		files = append(files, filepath.ToSlash(relativeToOutput(f)), filepath.ToSlash(f))
+	}
+
+	for _, r := range records {
+		switch {
+		case r.Time.Before(since),
+			*userFlag != "" && r.User != *userFlag,
+			*actionFlag != "" && r.Action != *actionFlag,
+			len(files) > 0 && !slices.Contains(files, r.File):
+			continue
+		}
+		if *jsonFlag {
+			data, _ := json.Marshal(r)
+			fmt.Println(string(data))
+			continue
+		}
+		fmt.Printf("%s  %-7s %-12s %-12s %s", r.Time.Local().Format("2006-01-02 15:04:05"), r.Action, r.User, r.Machine, r.File)
+		if r.Detail != "" {
+			fmt.Printf("  (%s)", r.Detail)
+		}
+		fmt.Println()
+	}
+	return 0
+}
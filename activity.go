@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Screen changes below this noise level do not count as activity
+	activityNoise = "-60dB"
+	// Shortest time without screen changes stored as inactive period
+	activityMinInactive = 10 * time.Second
+	// Width of the timeline bar printed by the catalog command
+	activityBarWidth = 40
+)
+
+// activityAnalysis is set when finished segments are analyzed for activity
+var activityAnalysis bool
+
+var freezeRe = regexp.MustCompile(`lavfi\.freezedetect\.freeze_(start|end): ([0-9.]+)`)
+
+// segmentActivity summarizes how much of a segment shows screen changes, so
+// reviewers can skip dead time
+type segmentActivity struct {
+	ActivePercent float64          `json:"active_percent"`
+	Inactive      []inactivePeriod `json:"inactive,omitempty"`
+}
+
+// inactivePeriod is a time without screen changes, in seconds from the
+// start of the segment
+type inactivePeriod struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// analyzeActivity finds the periods without screen changes in a finished
+// segment with ffmpeg's freezedetect filter
+func analyzeActivity(file string, duration time.Duration) (*segmentActivity, error) {
+	cmd := exec.Command("ffmpeg", "-hide_banner", "-nostats", "-i", file, "-map", "0:v:0",
+		"-vf", fmt.Sprintf("freezedetect=n=%s:d=%g", activityNoise, activityMinInactive.Seconds()),
+		"-f", "null", "-")
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	total := duration.Seconds()
+	activity := &segmentActivity{}
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		m := freezeRe.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		t, _ := strconv.ParseFloat(m[2], 64)
+		if m[1] == "start" {
+			activity.Inactive = append(activity.Inactive, inactivePeriod{Start: t, End: -1})
+		} else if n := len(activity.Inactive); n > 0 {
+			activity.Inactive[n-1].End = t
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %v", err)
+	}
+
+	// A freeze lasting until the end of the segment has no end time
+	inactive := 0.0
+	for i, p := range activity.Inactive {
+		if p.End < 0 {
+			activity.Inactive[i].End = total
+		}
+		inactive += activity.Inactive[i].End - p.Start
+	}
+	if total > 0 {
+		activity.ActivePercent = math.Round(math.Max(0, 100*(1-inactive/total))*10) / 10
+	}
+	return activity, nil
+}
+
+// activityBar renders the activity of a segment as a timeline bar, with #
+// for active and . for inactive parts
+func activityBar(a *segmentActivity, duration time.Duration, width int) string {
+	total := duration.Seconds()
+	if total <= 0 {
+		return strings.Repeat("?", width)
+	}
+	bar := []byte(strings.Repeat("#", width))
+	for _, p := range a.Inactive {
+		from := int(math.Round(p.Start / total * float64(width)))
+		to := int(math.Round(p.End / total * float64(width)))
+		for i := max(from, 0); i < min(to, width); i++ {
+			bar[i] = '.'
+		}
+	}
+	return string(bar)
+}
+
+// activitySpan is an inactive period of a segment on the timeline of the
+// view page, in percent of the segment
+type activitySpan struct {
+	From, Width float64
+	Start, End  time.Duration
+}
+
+// activitySpans returns the inactive periods of a segment for the timeline
+// bar of the view page
+func activitySpans(e catalogEntry) []activitySpan {
+	total := e.End.Sub(e.Start).Seconds()
+	if e.Activity == nil || total <= 0 {
+		return nil
+	}
+	var spans []activitySpan
+	for _, p := range e.Activity.Inactive {
+		from, to := math.Max(p.Start, 0), math.Min(p.End, total)
+		if to <= from {
+			continue
+		}
+		spans = append(spans, activitySpan{
+			From:  math.Round(from/total*1000) / 10,
+			Width: math.Round((to-from)/total*1000) / 10,
+			Start: time.Duration(from) * time.Second,
+			End:   time.Duration(to) * time.Second,
+		})
+	}
+	return spans
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// Encoding slower than this share of real time over a whole window
+	// lowers the quality of the next segment
+	adaptiveMinSpeed = 0.95
+	// Window the encode speed is measured over
+	adaptiveSpeedWindow = time.Minute
+	// Progress older than this belongs to a stalled ffmpeg, which is left
+	// to -stall-timeout
+	adaptiveStaleProgress = 10 * time.Second
+)
+
+// adaptiveQuality lowers preset, frame rate and bitrate of new segments
+// while encoding cannot keep up with real time
+var adaptiveQuality bool
+
+// adaptiveState holds what -adaptive lowered so far. It only ever goes
+// down, until the recorder is restarted.
+var adaptiveState struct {
+	sync.Mutex
+	presetSteps int // presets faster than -preset
+	fps         int // highest frame rate of new segments, 0 for no limit
+	bitrate     int // bitrate of new segments, 0 for -bitrate
+}
+
+// segmentPreset returns the -preset for new segments, made faster by -adaptive
+func segmentPreset() string {
+	adaptiveState.Lock()
+	defer adaptiveState.Unlock()
+	if adaptiveState.presetSteps == 0 {
+		return preset
+	}
+	for i, name := range presetNames {
+		if name == preset {
+			return presetNames[max(i-adaptiveState.presetSteps, 0)]
+		}
+	}
+	return preset
+}
+
+// segmentBitrate returns the bitrate for new segments, from the flags or
+// the application profile and limited by -adaptive
+func segmentBitrate() int {
+	kbps := profileBitrate()
+	adaptiveState.Lock()
+	defer adaptiveState.Unlock()
+	if adaptiveState.bitrate > 0 {
+		return min(kbps, adaptiveState.bitrate)
+	}
+	return kbps
+}
+
+// adaptiveFPS limits a frame rate to what -adaptive lowered it to
+func adaptiveFPS(n int) int {
+	adaptiveState.Lock()
+	defer adaptiveState.Unlock()
+	if adaptiveState.fps > 0 {
+		return min(n, adaptiveState.fps)
+	}
+	return n
+}
+
+// lowerQuality takes the next step down for new segments and returns what
+// changed, or "" if there is nothing left to lower. A faster preset costs
+// the least quality, then a lower frame rate frees the most encoding time
+// and a lower bitrate the rest.
+func lowerQuality(encoder string) string {
+	current, fps, kbps := segmentPreset(), captureFPS(), segmentBitrate()
+	adaptiveState.Lock()
+	defer adaptiveState.Unlock()
+	if presetArgs(encoder, current) != nil && current != presetNames[0] {
+		adaptiveState.presetSteps++
+		for i, name := range presetNames {
+			if name == current {
+				return fmt.Sprintf("preset %s", presetNames[i-1])
+			}
+		}
+	}
+	if fps > minFPS {
+		adaptiveState.fps = max(fps*3/4, minFPS)
+		return fmt.Sprintf("%d fps", adaptiveState.fps)
+	}
+	if kbps > minBitrate {
+		adaptiveState.bitrate = max(kbps*3/4, minBitrate)
+		return fmt.Sprintf("%d kbit/s", adaptiveState.bitrate)
+	}
+	return ""
+}
+
+// watchEncodeSpeed measures how fast ffmpeg encodes compared to real time
+// until finished is closed. Below adaptiveMinSpeed for a whole window the
+// next segment is recorded at a lower quality, the running one keeps its
+// settings.
+func watchEncodeSpeed(encoder string, progress *segmentProgress, finished chan struct{}, log *slog.Logger) {
+	if !adaptiveQuality {
+		return
+	}
+	ticker := time.NewTicker(checkInterval * time.Second)
+	defer ticker.Stop()
+
+	var windowStart time.Time
+	var windowMedia time.Duration
+	for {
+		select {
+		case <-finished:
+			return
+		case <-ticker.C:
+		}
+		p, updated := progress.snapshot()
+		if updated.IsZero() || time.Since(updated) > adaptiveStaleProgress {
+			windowStart = time.Time{}
+			continue
+		}
+		if windowStart.IsZero() {
+			windowStart, windowMedia = updated, p.time
+			continue
+		}
+		elapsed := updated.Sub(windowStart)
+		if elapsed < adaptiveSpeedWindow {
+			continue
+		}
+		speed := (p.time - windowMedia).Seconds() / elapsed.Seconds()
+		if speed >= adaptiveMinSpeed {
+			windowStart, windowMedia = updated, p.time
+			continue
+		}
+
+		change := lowerQuality(encoder)
+		if change == "" {
+			log.Warn("Encoding cannot keep up with real time, quality is already at its lowest", "speed", speed)
+			consoleWarn("Encoding runs at %.2fx of real time, the quality cannot be lowered further", speed)
+			alertFailure(fmt.Sprintf("Encoding runs at %.2fx of real time at the lowest quality, the recording stutters", speed))
+			return
+		}
+		log.Warn("Encoding cannot keep up with real time, lowering the quality of the next segment", "speed", speed, "change", change)
+		consoleWarn("Encoding runs at %.2fx of real time, the next segment uses %s", speed, change)
+		alertFailure(fmt.Sprintf("Encoding runs at %.2fx of real time, lowered the next segment to %s", speed, change))
+		return
+	}
+}
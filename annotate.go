@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Name of the annotation log inside the output directory
+	annotationsFileName = "annotations.jsonl"
+	// Name of the annotation log in anonymized mode, encrypted like the
+	// catalog
+	encryptedAnnotationsFileName = "annotations.enc"
+)
+
+// annotation is a change to the tags or notes of a segment. Annotations are
+// only ever appended, so the log also tells who marked what and when.
+type annotation struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	File   string    `json:"file"`
+	Action string    `json:"action"` // tag, untag, note, hold or release
+	Value  string    `json:"value"`
+}
+
+// segmentNote is a free-form note on a segment
+type segmentNote struct {
+	Time time.Time `json:"time"`
+	User string    `json:"user"`
+	Text string    `json:"text"`
+}
+
+// annotationsMu serializes writes to the annotation log
+var annotationsMu sync.Mutex
+
+// annotationsPath returns the path of the annotation log
+func annotationsPath() string {
+	if anonymize {
+		return filepath.Join(outputDir, encryptedAnnotationsFileName)
+	}
+	return filepath.Join(outputDir, annotationsFileName)
+}
+
+// appendAnnotations adds annotations to the log. The log is separate from
+// the catalog, so reviewers can annotate while the recorder appends
+// segments.
+func appendAnnotations(annotations []annotation) error {
+	annotationsMu.Lock()
+	defer annotationsMu.Unlock()
+	return appendRecords(annotationsPath(), annotations)
+}
+
+// readAnnotations returns all annotations in the order they were made
+func readAnnotations() ([]annotation, error) {
+	return readRecords[annotation](annotationsPath())
+}
+
+// appendRecords appends records to a JSON lines log, encrypted like the
+// catalog in anonymized mode. All records are written at once, so a log
+// shared by several processes never gets half of a change, and synced to
+// disk.
+func appendRecords[T any](path string, records []T) error {
+	var buf []byte
+	for _, r := range records {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if anonymize {
+			if data, err = encryptCatalogLine(data); err != nil {
+				return err
+			}
+		}
+		buf = append(append(buf, data...), '\n')
+	}
+	unlock, err := lockCatalogFiles()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return appendSynced(path, buf)
+}
+
+// readRecords returns the records of a log written by appendRecords, none
+// if it does not exist yet
+func readRecords[T any](path string) ([]T, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []T
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		data := scanner.Bytes()
+		if len(data) == 0 {
+			continue
+		}
+		if anonymize {
+			if data, err = decryptCatalogLine(data); err != nil {
+				return records, fmt.Errorf("%s line %d: %w", path, line, err)
+			}
+		}
+		var r T
+		if err := json.Unmarshal(data, &r); err != nil {
+			return records, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// readAnnotatedCatalog returns the catalog entries with the tags, notes and
+// legal holds of the annotation log
+func readAnnotatedCatalog() ([]catalogEntry, error) {
+	entries, err := readCatalog()
+	if err != nil {
+		return entries, err
+	}
+	annotations, err := readAnnotations()
+	if err != nil {
+		return entries, err
+	}
+	index := map[string]int{}
+	for i, e := range entries {
+		index[e.File] = i
+	}
+	for _, a := range annotations {
+		i, ok := index[a.File]
+		if !ok {
+			continue
+		}
+		e := &entries[i]
+		switch a.Action {
+		case "tag":
+			if !e.hasTag(a.Value) {
+				e.Tags = append(e.Tags, a.Value)
+			}
+		case "untag":
+			e.Tags = slices.DeleteFunc(e.Tags, func(t string) bool { return strings.EqualFold(t, a.Value) })
+		case "note":
+			e.Notes = append(e.Notes, segmentNote{Time: a.Time, User: a.User, Text: a.Value})
+		case "hold":
+			e.Hold = &legalHold{Time: a.Time, User: a.User, Reason: a.Value}
+		case "release":
+			e.Hold = nil
+		}
+	}
+	return entries, nil
+}
+
+// hasTag reports whether a segment carries a tag, ignoring case
+func (e catalogEntry) hasTag(tag string) bool {
+	return slices.ContainsFunc(e.Tags, func(t string) bool { return strings.EqualFold(t, tag) })
+}
+
+// runAnnotateCommand tags segments and adds notes to them, e.g. to mark
+// them as reviewed or as part of an incident
+func runAnnotateCommand(args []string) int {
+	fs := flag.NewFlagSet("annotate", flag.ExitOnError)
+	var tags, untags []string
+	collect := func(list *[]string) func(string) error {
+		return func(value string) error {
+			if strings.TrimSpace(value) == "" {
+				return fmt.Errorf("empty tag")
+			}
+			*list = append(*list, strings.TrimSpace(value))
+			return nil
+		}
+	}
+	fs.Func("tag", "Add a tag like incident or reviewed, can be repeated", collect(&tags))
+	fs.Func("untag", "Remove a tag, can be repeated", collect(&untags))
+	noteFlag := fs.String("note", "", "Add a free-form note")
+	outputDirFlag := fs.String("output", outputDir, "Directory that holds the catalog")
+	envUsage(fs)
+	if err := applyFlagEnv(fs); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	fs.Parse(args)
+	outputDir = *outputDirFlag
+	note := strings.TrimSpace(*noteFlag)
+	if fs.NArg() == 0 || len(tags) == 0 && len(untags) == 0 && note == "" {
+		consoleInfo("Usage: screen-vibe annotate [-tag tag]... [-untag tag]... [-note text] <file>...")
+		return 2
+	}
+
+	// Prefer the encrypted catalog when it exists
+	if err := openCatalog(); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	entries, err := readCatalog()
+	if err != nil {
+		consoleError("Could not read catalog: %v", err)
+		return 1
+	}
+	segments, err := exportSelection(entries, fs.Args(), time.Time{}, time.Time{})
+	if err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+
+	now, user := time.Now(), loginUser()
+	var annotations []annotation
+	for _, e := range segments {
+		for _, t := range tags {
+			annotations = append(annotations, annotation{Time: now, User: user, File: e.File, Action: "tag", Value: t})
+		}
+		for _, t := range untags {
+			annotations = append(annotations, annotation{Time: now, User: user, File: e.File, Action: "untag", Value: t})
+		}
+		if note != "" {
+			annotations = append(annotations, annotation{Time: now, User: user, File: e.File, Action: "note", Value: note})
+		}
+	}
+	if err := appendAnnotations(annotations); err != nil {
+		consoleError("Could not write annotations: %v", err)
+		return 1
+	}
+	consoleInfo("Annotated %d segments", len(segments))
+	return 0
+}
+
+// annotate tags a segment, removes tags from it or adds a note to it, from
+// the form of the view page or a client of the API: file names the
+// segment, tag and untag can be repeated. The user name of the login goes
+// to the annotation log. It returns the annotated segment as JSON, or
+// sends the browser back to the page the form was on.
+func (h *viewHandler) annotate(w http.ResponseWriter, r *http.Request) {
+	if crossOrigin(r) {
+		http.Error(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	trimmed := func(values []string) []string {
+		var kept []string
+		for _, v := range values {
+			if v = strings.TrimSpace(v); v != "" {
+				kept = append(kept, v)
+			}
+		}
+		return kept
+	}
+	file := r.PostForm.Get("file")
+	tags, untags := trimmed(r.PostForm["tag"]), trimmed(r.PostForm["untag"])
+	note := strings.TrimSpace(r.PostForm.Get("note"))
+	if len(tags) == 0 && len(untags) == 0 && note == "" {
+		http.Error(w, "Send a tag, untag or note for the file", http.StatusBadRequest)
+		return
+	}
+	entries, err := readCatalog()
+	if err != nil {
+		http.Error(w, "Could not read catalog: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if file == "" || !slices.ContainsFunc(entries, func(e catalogEntry) bool { return e.File == file }) {
+		http.Error(w, fmt.Sprintf("%q is not in the catalog", file), http.StatusNotFound)
+		return
+	}
+
+	user, _, _ := r.BasicAuth()
+	if user == "" {
+		user = "anonymous"
+	}
+	now := time.Now()
+	var annotations []annotation
+	for _, t := range tags {
+		annotations = append(annotations, annotation{Time: now, User: user, File: file, Action: "tag", Value: t})
+	}
+	for _, t := range untags {
+		annotations = append(annotations, annotation{Time: now, User: user, File: file, Action: "untag", Value: t})
+	}
+	if note != "" {
+		annotations = append(annotations, annotation{Time: now, User: user, File: file, Action: "note", Value: note})
+	}
+	if err := appendAnnotations(annotations); err != nil {
+		http.Error(w, "Could not write annotations: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.PostForm.Has("return") {
+		// Only the query of the page, so the form cannot send the browser
+		// to another site
+		query, _ := url.ParseQuery(r.PostForm.Get("return"))
+		http.Redirect(w, r, "/?"+query.Encode(), http.StatusSeeOther)
+		return
+	}
+	entries, err = readAnnotatedCatalog()
+	if err != nil {
+		http.Error(w, "Could not read catalog: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	i := slices.IndexFunc(entries, func(e catalogEntry) bool { return e.File == file })
+	if i < 0 {
+		http.Error(w, fmt.Sprintf("%q is not in the catalog", file), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries[i])
+}
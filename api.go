@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Environment variable with the password of the -listen API, clients log
+// in with any user name, which goes to the access log for downloads
+const listenPasswordEnv = "SCREEN_VIBE_LISTEN_PASSWORD"
+
+// apiServer serves the HTTP API of -listen, nil if not listening
+var apiServer *http.Server
+
+// newAPIHandler returns the handler of the -listen API on listen: POST
+// /start, /stop and /pause control the recorder like the ctl command, GET
+// /status returns its status, /recordings and /files/ serve the catalog
+// like the view command and POST /annotate tags segments like annotate
+func newAPIHandler(password, listen string) http.Handler {
+	view := &viewHandler{password: password}
+	mux := http.NewServeMux()
+	for _, action := range []string{"start", "stop", "pause"} {
+		mux.HandleFunc("POST /"+action, func(w http.ResponseWriter, r *http.Request) {
+			apiControl(w, r, action)
+		})
+	}
+	mux.HandleFunc("GET /status", apiStatus)
+	mux.HandleFunc("POST /annotate", view.annotate)
+	mux.HandleFunc("GET /recordings", view.recordings)
+	mux.HandleFunc("GET /files/{file...}", view.file)
+	if live != nil {
+		mux.HandleFunc("GET /live", live.page)
+		mux.HandleFunc("POST /live", live.offer)
+	}
+	return restrictHost(listen, view.authenticate(mux))
+}
+
+// restrictHost refuses requests whose Host does not name the listener on
+// listen: its host, localhost, an IP address or the name of the machine. A
+// page that rebinds its domain name to the listener is same-origin with
+// itself, so the Origin does not tell, but it sends its own domain name.
+func restrictHost(listen string, next http.Handler) http.Handler {
+	listenHost, _, _ := net.SplitHostPort(listen)
+	machine, _ := os.Hostname()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+		switch {
+		case net.ParseIP(host) != nil, strings.EqualFold(host, "localhost"):
+		case listenHost != "" && strings.EqualFold(host, listenHost):
+		case machine != "" && strings.EqualFold(host, machine):
+		default:
+			http.Error(w, "Unknown host name, use the address of the listener or the name of the machine", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// crossOrigin reports whether a browser sent r from the page of another
+// site, like a cross-site form, which must not steer the recorder
+func crossOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin != "" && origin != "http://"+r.Host && origin != "https://"+r.Host
+}
+
+// apiControl requests a recorder action
+func apiControl(w http.ResponseWriter, r *http.Request, action string) {
+	if crossOrigin(r) {
+		http.Error(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+		return
+	}
+	if err := controlRecording(action); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	io.WriteString(w, "ok\n")
+}
+
+// apiStatus returns the status of the recorder as JSON, like ctl status
+func apiStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(currentStatus())
+}
+
+// startAPIServer serves the -listen API on addr
+func startAPIServer(addr string) error {
+	password := os.Getenv(listenPasswordEnv)
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid -listen address %q: %v", addr, err)
+	}
+	if ip := net.ParseIP(host); password == "" && (ip == nil || !ip.IsLoopback()) {
+		consoleWarn("Anyone who can reach %s can control the recorder and watch the recordings, set a password in %s", addr, listenPasswordEnv)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("could not listen on %s: %v", addr, err)
+	}
+	apiServer = &http.Server{Handler: newAPIHandler(password, addr), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := apiServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			consoleWarn("HTTP API stopped: %v", err)
+		}
+	}()
+	consoleInfo("HTTP API on http://%s: POST /start, /stop, /pause, /annotate, GET /status, /recordings", listener.Addr())
+	if live != nil {
+		consoleInfo("WebRTC live view on http://%s/live (experimental)", listener.Addr())
+	}
+	return nil
+}
+
+// stopAPIServer gives open requests, like downloads, time to finish
+func stopAPIServer() {
+	if apiServer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), viewShutdownTimeout)
+	defer cancel()
+	apiServer.Shutdown(ctx)
+}
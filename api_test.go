@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestRestrictHost(t *testing.T) {
+	machine, _ := os.Hostname()
+	handler := restrictHost("recorder.lan:8090", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for host, want := range map[string]int{
+		"127.0.0.1:8090":         http.StatusOK,
+		"[::1]:8090":             http.StatusOK,
+		"localhost:8090":         http.StatusOK,
+		"192.168.1.20:8090":      http.StatusOK,
+		"recorder.lan:8090":      http.StatusOK,
+		"RECORDER.LAN.":          http.StatusOK,
+		machine + ":8090":        http.StatusOK,
+		"rebind.example.com":     http.StatusForbidden,
+		"127.0.0.1.nip.io:8090":  http.StatusForbidden,
+		"localhost.example:8090": http.StatusForbidden,
+	} {
+		r := httptest.NewRequest("POST", "/stop", nil)
+		r.Host = host
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != want {
+			t.Errorf("Host %s: got %d, want %d", host, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Time the focus has to stay on an application of another profile before
+// the recorder switches to it, so a quick Alt+Tab does not start a segment
+const appProfileSettle = 5 * time.Second
+
+// Capture regions like 1280x720+0+0, as width x height + x + y
+var regionRe = regexp.MustCompile(`^(\d+)x(\d+)\+(\d+)\+(\d+)$`)
+
+// appProfileConfig is the -app-profiles file
+type appProfileConfig struct {
+	Profiles []*appProfile `yaml:"profiles"`
+}
+
+// appProfile holds the settings for new segments while an application has
+// the focus. App and title are regular expressions matched against the
+// process name and the window title, settings left out keep the flags.
+type appProfile struct {
+	Name    string `yaml:"name"`
+	App     string `yaml:"app"`
+	Title   string `yaml:"title"`
+	FPS     int    `yaml:"fps"`
+	Bitrate int    `yaml:"bitrate"`
+	Region  string `yaml:"region"`
+
+	appRe, titleRe *regexp.Regexp
+	crop           string
+}
+
+// appProfiles are the profiles of -app-profiles in file order, the first
+// matching one applies
+var appProfiles []*appProfile
+
+// appProfileState tracks the profile of new segments and the one the
+// focus is switching to
+var appProfileState struct {
+	sync.Mutex
+	active    *appProfile // nil records with the flags
+	pending   *appProfile
+	switching bool
+	since     time.Time
+}
+
+// loadAppProfiles reads and checks an -app-profiles file
+func loadAppProfiles(path string) ([]*appProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// Unknown keys are mistakes, like a misspelled bitrate
+	var config appProfileConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(config.Profiles) == 0 {
+		return nil, fmt.Errorf("%s defines no profiles", path)
+	}
+	names := map[string]bool{}
+	for i, p := range config.Profiles {
+		switch {
+		case p == nil || p.Name == "":
+			return nil, fmt.Errorf("%s: profile %d has no name", path, i+1)
+		case names[p.Name]:
+			return nil, fmt.Errorf("%s: profile %q is defined twice", path, p.Name)
+		case p.App == "" && p.Title == "":
+			return nil, fmt.Errorf("%s: profile %q matches no application, set app or title", path, p.Name)
+		case p.FPS == 0 && p.Bitrate == 0 && p.Region == "":
+			return nil, fmt.Errorf("%s: profile %q changes nothing, set fps, bitrate or region", path, p.Name)
+		}
+		names[p.Name] = true
+		if err := p.compile(); err != nil {
+			return nil, fmt.Errorf("%s: profile %q: %v", path, p.Name, err)
+		}
+	}
+	return config.Profiles, nil
+}
+
+// compile checks the settings of a profile and prepares its patterns and
+// crop filter
+func (p *appProfile) compile() error {
+	var err error
+	if p.App != "" {
+		if p.appRe, err = regexp.Compile("(?i)" + p.App); err != nil {
+			return fmt.Errorf("invalid app pattern: %v", err)
+		}
+	}
+	if p.Title != "" {
+		if p.titleRe, err = regexp.Compile("(?i)" + p.Title); err != nil {
+			return fmt.Errorf("invalid title pattern: %v", err)
+		}
+	}
+	if p.FPS != 0 {
+		if err := checkFPS(p.FPS); err != nil {
+			return err
+		}
+	}
+	if p.Bitrate != 0 {
+		if err := checkBitrate(p.Bitrate); err != nil {
+			return err
+		}
+	}
+	if p.Region != "" {
+		if p.crop, err = parseRegion(p.Region); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseRegion turns a region like 1280x720+0+0 into a crop filter
+func parseRegion(region string) (string, error) {
+	r, err := regionRect(region)
+	if err != nil {
+		return "", err
+	}
+	return regionCrop(r), nil
+}
+
+// regionRect parses a region like 1280x720+0+0. The size must be even, the
+// encoders cannot handle odd ones.
+func regionRect(region string) (screenRect, error) {
+	m := regionRe.FindStringSubmatch(region)
+	if m == nil {
+		return screenRect{}, fmt.Errorf("invalid region %q, use <width>x<height>+<x>+<y> like 1280x720+0+0", region)
+	}
+	var r screenRect
+	r.width, _ = strconv.Atoi(m[1])
+	r.height, _ = strconv.Atoi(m[2])
+	r.x, _ = strconv.Atoi(m[3])
+	r.y, _ = strconv.Atoi(m[4])
+	if r.width == 0 || r.height == 0 || r.width%2 != 0 || r.height%2 != 0 {
+		return screenRect{}, fmt.Errorf("invalid region %q, width and height must be even and not 0", region)
+	}
+	return r, nil
+}
+
+// regionCrop returns the crop filter that cuts region r out of the picture
+func regionCrop(r screenRect) string {
+	return fmt.Sprintf("crop=w=%d:h=%d:x=%d:y=%d", r.width, r.height, r.x, r.y)
+}
+
+// matchAppProfile returns the first profile matching the focused window,
+// nil if none does
+func matchAppProfile(app, title string) *appProfile {
+	for _, p := range appProfiles {
+		if p.appRe != nil && !p.appRe.MatchString(app) || p.titleRe != nil && !p.titleRe.MatchString(title) {
+			continue
+		}
+		return p
+	}
+	return nil
+}
+
+// startAppProfile sets the profile of the first segment without waiting
+func startAppProfile(app, title string) {
+	appProfileState.Lock()
+	appProfileState.active = matchAppProfile(app, title)
+	appProfileState.Unlock()
+}
+
+// appProfileFocus is called with the focused window on every poll and
+// switches new segments to its profile once it kept the focus for
+// appProfileSettle
+func appProfileFocus(app, title string, now time.Time) {
+	p := matchAppProfile(app, title)
+	s := &appProfileState
+	s.Lock()
+	switch {
+	case p == s.active:
+		s.switching = false
+		s.Unlock()
+		return
+	case !s.switching || p != s.pending:
+		s.switching, s.pending, s.since = true, p, now
+		s.Unlock()
+		return
+	case now.Sub(s.since) < appProfileSettle:
+		s.Unlock()
+		return
+	}
+	s.active, s.switching = p, false
+	s.Unlock()
+
+	if p == nil {
+		requestRotation("no application profile matches the focused window, recording with the flags")
+	} else {
+		requestRotation(fmt.Sprintf("%s has the focus, recording with profile %s", focusChange{app: app, title: title}.label(), p.Name))
+	}
+}
+
+// activeAppProfile returns the name of the profile of new segments, "" if
+// they record with the flags
+func activeAppProfile() string {
+	appProfileState.Lock()
+	defer appProfileState.Unlock()
+	if appProfileState.active == nil {
+		return ""
+	}
+	return appProfileState.active.Name
+}
+
+// profileFPS returns the frame rate of the profile of new segments, the
+// one of -schedule or -fps if it sets none
+func profileFPS() int {
+	appProfileState.Lock()
+	defer appProfileState.Unlock()
+	if p := appProfileState.active; p != nil && p.FPS > 0 {
+		return p.FPS
+	}
+	return scheduleFPS()
+}
+
+// profileBitrate returns the bitrate of the profile of new segments, the
+// one of -schedule or -bitrate if it sets none
+func profileBitrate() int {
+	appProfileState.Lock()
+	defer appProfileState.Unlock()
+	if p := appProfileState.active; p != nil && p.Bitrate > 0 {
+		return p.Bitrate
+	}
+	return scheduleBitrate()
+}
+
+// profileCrop returns the crop filter of the region of the profile of new
+// segments, "" to record the whole screen
+func profileCrop() string {
+	appProfileState.Lock()
+	defer appProfileState.Unlock()
+	if p := appProfileState.active; p != nil {
+		return p.crop
+	}
+	return ""
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Audio devices to record, "" for none
+var (
+	audioMic    string
+	audioSystem string
+)
+
+// Encoding of the audio tracks: aac or opus, and the bitrate of every
+// track in kbit/s
+var (
+	audioCodec = "aac"
+	audioKbps  = 128
+)
+
+// selectAudio sets the devices of -audio mic, system or both to the
+// defaults of goos where -audio-mic and -audio-system do not name them
+func selectAudio(goos, sources string) error {
+	mic, system := defaultAudioDevices(goos)
+	switch sources {
+	case "mic":
+		system = ""
+	case "system":
+		mic = ""
+	case "both":
+	default:
+		return fmt.Errorf("unknown -audio %q, use mic, system or both", sources)
+	}
+	if audioMic == "" {
+		audioMic = mic
+	}
+	if audioSystem == "" {
+		audioSystem = system
+	}
+	if sources != "system" && audioMic == "" || sources != "mic" && audioSystem == "" {
+		return fmt.Errorf("-audio %s needs -audio-mic and -audio-system on this OS, the system audio through a loopback device like VB-CABLE or BlackHole", sources)
+	}
+	return nil
+}
+
+// defaultAudioDevices returns the microphone and the system audio of goos
+// when the OS has names for them. PulseAudio and PipeWire call the output
+// of the default sink its monitor, Windows and macOS need a loopback
+// driver whose name only the user knows.
+func defaultAudioDevices(goos string) (mic, system string) {
+	if goos == "linux" {
+		return "default", "@DEFAULT_MONITOR@"
+	}
+	return "", ""
+}
+
+// audioInputArgs returns the ffmpeg input of an audio device on goos. On
+// Linux alsa:hw:1,0 reads an ALSA device, for systems without PulseAudio or
+// PipeWire.
+func audioInputArgs(goos, device string) []string {
+	// Audio arrives in small packets, a short queue drops them while the
+	// video encoder is busy
+	args := []string{"-thread_queue_size", "1024"}
+	switch goos {
+	case "darwin":
+		return append(args, "-f", "avfoundation", "-i", ":"+device)
+	case "windows":
+		if !strings.HasPrefix(device, "audio=") {
+			device = "audio=" + device
+		}
+		return append(args, "-f", "dshow", "-i", device)
+	}
+	if alsa, ok := strings.CutPrefix(device, "alsa:"); ok {
+		return append(args, "-f", "alsa", "-i", alsa)
+	}
+	return append(args, "-f", "pulse", "-i", device)
+}
+
+// audioTrack is an audio device recorded to its own track
+type audioTrack struct {
+	device string
+	title  string
+}
+
+// audioTracks returns the configured audio devices
+func audioTracks() []audioTrack {
+	var tracks []audioTrack
+	if audioSystem != "" {
+		tracks = append(tracks, audioTrack{audioSystem, "System audio"})
+	}
+	if audioMic != "" {
+		tracks = append(tracks, audioTrack{audioMic, "Microphone"})
+	}
+	return tracks
+}
+
+// addAudioArgs records the audio devices, ffmpeg inputs from firstInput on.
+// With both devices the first track mixes them, for players and transcripts
+// that only use one, and every device follows on its own labeled track.
+func addAudioArgs(a *ffmpegArgs, goos string, firstInput int) {
+	tracks := audioTracks()
+	if len(tracks) == 0 {
+		return
+	}
+	for _, t := range tracks {
+		a.extraInputs = append(a.extraInputs, audioInputArgs(goos, t.device)...)
+	}
+	if len(a.filter) == 0 {
+		a.filter = []string{"-map", "0:v"}
+	}
+	n := 0
+	if len(tracks) > 1 {
+		mix := fmt.Sprintf("[%d:a][%d:a]amix=inputs=2:normalize=0[sv_mix]", firstInput, firstInput+1)
+		if a.filter[0] == "-filter_complex" {
+			a.filter[1] += ";" + mix
+		} else {
+			a.filter = append([]string{"-filter_complex", mix}, a.filter...)
+		}
+		a.filter = append(a.filter, "-map", "[sv_mix]", "-metadata:s:a:0", "title=Mix")
+		n++
+	}
+	for i, t := range tracks {
+		a.filter = append(a.filter, "-map", fmt.Sprintf("%d:a", firstInput+i), fmt.Sprintf("-metadata:s:a:%d", n), "title="+t.title)
+		n++
+	}
+
+	// Replace -an of the encoder options
+	codec := a.codec[:0:0]
+	for _, arg := range a.codec {
+		if arg != "-an" {
+			codec = append(codec, arg)
+		}
+	}
+	codecName := "aac"
+	if audioCodec == "opus" {
+		codecName = "libopus"
+	}
+	a.codec = append(codec, "-c:a", codecName, "-b:a", fmt.Sprintf("%dk", audioKbps))
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Environment variable with the password of backups, they hold the
+	// catalog key and the other secrets of the environment
+	backupPasswordEnv = "SCREEN_VIBE_BACKUP_PASSWORD"
+	// Names in a backup: the files of the output directory, the
+	// SCREEN_VIBE_* environment and the files of -include
+	backupOutputDir   = "output"
+	backupEnvName     = "environment"
+	backupIncludeDir  = "config"
+	backupCustodyName = "backed up"
+)
+
+// backupStateFiles returns the catalog and the logs of the output
+// directory, the state of a recorder without its recordings
+func backupStateFiles() []string {
+	return []string{catalogFileName, encryptedCatalogFileName, annotationsFileName, encryptedAnnotationsFileName,
+		accessLogFileName, encryptedAccessLogFileName, focusLogFileName}
+}
+
+// backupEnvironment returns the SCREEN_VIBE_* variables, which configure the
+// recorder, as KEY=VALUE lines for a systemd EnvironmentFile or docker
+// --env-file. The backup password is left out, whoever restores has it.
+func backupEnvironment() []byte {
+	var lines []string
+	for _, kv := range os.Environ() {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(k, envFlagPrefix) || k == backupPasswordEnv || strings.ContainsAny(v, "\r\n") {
+			continue
+		}
+		lines = append(lines, k+"="+v)
+	}
+	sort.Strings(lines)
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// backupFiles returns the files of the output directory to back up,
+// relative to it: the state files, and with recordings every other file
+// except the temporary ones of writes in progress
+func backupFiles(recordings bool) ([]string, error) {
+	var files []string
+	if !recordings {
+		for _, name := range backupStateFiles() {
+			if _, err := os.Stat(filepath.Join(outputDir, name)); err == nil {
+				files = append(files, name)
+			}
+		}
+		return files, nil
+	}
+	err := filepath.WalkDir(outputDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if ext := filepath.Ext(p); ext == ".part" || ext == ".tmp" || !d.Type().IsRegular() {
+			return nil
+		}
+		files = append(files, relativeToOutput(p))
+		return nil
+	})
+	return files, err
+}
+
+// packageDataFile returns the checksum of a file written by the backup
+// itself
+func packageDataFile(name string, data []byte) packageFile {
+	sum := sha256.Sum256(data)
+	return packageFile{Name: name, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}
+}
+
+// writeBackup writes the state of the recorder into an encrypted package in
+// the format of export packages, so export -verify also checks a backup.
+// The catalog entries go into the manifest like the segments of an export.
+func writeBackup(out, password string, files, includes []string, entries []catalogEntry) (err error) {
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(out)
+		}
+	}()
+	pw, err := newPackageWriter(f, password)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(pw)
+
+	manifest := packageManifest{
+		Format:   1,
+		Note:     "backup of " + outputDir,
+		Segments: entries,
+		Files:    []packageFile{},
+		Custody: []custodyEvent{{
+			Time:    time.Now().UTC(),
+			Action:  backupCustodyName,
+			User:    loginUser(),
+			Machine: machineName(),
+			Program: "screen-vibe " + version,
+			Source:  outputDir,
+		}},
+	}
+	add := func(name, src string) error {
+		file, err := addPackageFile(tw, name, src)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, file)
+		consoleEvent("Added %s (%s)", name, formatFileSize(file.Size))
+		return nil
+	}
+	for _, name := range files {
+		if err := add(path.Join(backupOutputDir, name), filepath.Join(outputDir, filepath.FromSlash(name))); err != nil {
+			return err
+		}
+	}
+	for _, src := range includes {
+		if err := add(path.Join(backupIncludeDir, filepath.Base(src)), src); err != nil {
+			return err
+		}
+	}
+	if env := backupEnvironment(); env != nil {
+		if err := addPackageData(tw, backupEnvName, env); err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, packageDataFile(backupEnvName, env))
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := addPackageData(tw, packageManifestName, data); err != nil {
+		return err
+	}
+	var sums strings.Builder
+	for _, file := range manifest.Files {
+		fmt.Fprintf(&sums, "%s  %s\n", file.SHA256, file.Name)
+	}
+	sums.WriteString(packageDataFile(packageManifestName, data).SHA256 + "  " + packageManifestName + "\n")
+	if err := addPackageData(tw, packageSumsName, []byte(sums.String())); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := pw.Close(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// restoreBackup checks a backup and moves its files into place: the output
+// directory, the environment file and the directory of the included files.
+// Nothing is moved unless the whole backup verified.
+func restoreBackup(pkg, password, envFile, includeDir string) (*packageManifest, error) {
+	absOutput, err := filepath.Abs(outputDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(absOutput), 0755); err != nil {
+		return nil, err
+	}
+	// Next to the output directory, so the files are renamed, not copied
+	staging, err := os.MkdirTemp(filepath.Dir(absOutput), ".screen-vibe-restore-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+	manifest, err := verifyPackage(pkg, password, staging)
+	if err != nil {
+		return manifest, err
+	}
+	if len(manifest.Custody) == 0 || manifest.Custody[0].Action != backupCustodyName {
+		return manifest, errors.New("not a backup, open export packages with export -verify")
+	}
+
+	targets := map[string]string{}
+	for _, file := range manifest.Files {
+		dir, name, _ := strings.Cut(file.Name, "/")
+		switch {
+		case file.Name == backupEnvName:
+			targets[file.Name] = envFile
+		case dir == backupOutputDir:
+			targets[file.Name] = filepath.Join(absOutput, filepath.FromSlash(name))
+		case dir == backupIncludeDir:
+			targets[file.Name] = filepath.Join(includeDir, filepath.FromSlash(name))
+		}
+	}
+	for _, target := range targets {
+		if _, err := os.Lstat(target); err == nil {
+			return manifest, fmt.Errorf("%s already exists", target)
+		}
+	}
+	for name, target := range targets {
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return manifest, err
+		}
+		src := filepath.Join(staging, filepath.FromSlash(name))
+		if name == backupEnvName {
+			os.Chmod(src, 0600)
+		}
+		if err := os.Rename(src, target); err != nil {
+			// The environment file or included files may be on another
+			// file system
+			if err = copyImport(src, target); err != nil {
+				return manifest, err
+			}
+			if name == backupEnvName {
+				os.Chmod(target, 0600)
+			}
+		}
+	}
+	syncDir(absOutput)
+	return manifest, nil
+}
+
+// runBackupCommand writes the state of a recorder into one encrypted file,
+// or restores it, to move the recorder to new hardware with its history
+func runBackupCommand(args []string) int {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	var includes []string
+	fs.Func("include", "Also back up this file, like the YAML of the supervisor or a -policy script, can be repeated", func(value string) error {
+		if info, err := os.Stat(value); err != nil {
+			return err
+		} else if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s is not a file", value)
+		}
+		for _, included := range includes {
+			if filepath.Base(included) == filepath.Base(value) {
+				return fmt.Errorf("%s and %s have the same name", included, value)
+			}
+		}
+		includes = append(includes, value)
+		return nil
+	})
+	recordingsFlag := fs.Bool("recordings", false, "Also back up the recordings of the output directory, not only the catalog and logs")
+	restoreFlag := fs.String("restore", "", "Restore this backup into the output directory, which must not have a catalog yet")
+	envFileFlag := fs.String("env-file", "screen-vibe.env", "With -restore: file to write the SCREEN_VIBE_* environment to")
+	includeDirFlag := fs.String("include-dir", ".", "With -restore: directory to write the files of -include to")
+	instanceFlag := fs.String("instance", "default", "Recorder instance that writes to the output directory, it must not be running")
+	outputDirFlag := fs.String("output", outputDir, "Directory that holds the recordings and the catalog")
+	envUsage(fs)
+	if err := applyFlagEnv(fs); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	fs.Parse(args)
+	outputDir = *outputDirFlag
+
+	password := os.Getenv(backupPasswordEnv)
+	if password == "" {
+		consoleError("Set the backup password in %s", backupPasswordEnv)
+		return 2
+	}
+	// The recorder would write to the catalog while it is copied
+	if conn, err := dialControl(controlSocketPath(*instanceFlag), time.Second); err == nil {
+		conn.Close()
+		consoleError("Instance %q is running, stop it first", *instanceFlag)
+		return 1
+	}
+
+	if *restoreFlag != "" {
+		for _, name := range []string{catalogFileName, encryptedCatalogFileName} {
+			if _, err := os.Stat(filepath.Join(outputDir, name)); err == nil {
+				consoleError("%s already has a catalog, restore into a new output directory", outputDir)
+				return 1
+			}
+		}
+		manifest, err := restoreBackup(*restoreFlag, password, *envFileFlag, *includeDirFlag)
+		if manifest != nil {
+			printCustody(manifest)
+		}
+		if err != nil {
+			consoleError("Restore failed: %v", err)
+			return 1
+		}
+		consoleInfo("Restored %d files into %s", len(manifest.Files), outputDir)
+		for _, file := range manifest.Files {
+			if file.Name == backupEnvName {
+				consoleInfo("The configuration and keys are in %s, load it before starting the recorder, e.g. as the EnvironmentFile of its systemd unit", *envFileFlag)
+			}
+		}
+		return 0
+	}
+
+	if fs.NArg() != 1 {
+		consoleInfo("Usage: screen-vibe backup [-recordings] [-include file]... out.svbak")
+		consoleInfo("       screen-vibe backup -restore in.svbak [-env-file file] [-include-dir dir]")
+		return 2
+	}
+	if len(password) < minExportPasswordLength {
+		consoleError("The backup password must have at least %d characters", minExportPasswordLength)
+		return 2
+	}
+	if err := openCatalog(); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	files, err := backupFiles(*recordingsFlag)
+	if err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	if len(files) == 0 {
+		consoleError("No catalog or recordings in %s", outputDir)
+		return 1
+	}
+	entries, err := readCatalog()
+	if err != nil {
+		consoleError("Could not read catalog: %v", err)
+		return 1
+	}
+	out := fs.Arg(0)
+	consoleInfo("Backing up %d files of %s to %s", len(files), outputDir, out)
+	if err := writeBackup(out, password, files, includes, entries); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	if *recordingsFlag {
+		// Footage left the machine, like with an export
+		var backedUp []string
+		for _, e := range entries {
+			if _, err := os.Stat(filepath.Join(outputDir, filepath.FromSlash(e.File))); err == nil && e.File != "" {
+				backedUp = append(backedUp, e.File)
+			}
+		}
+		logAccess("backup", "backup "+filepath.Base(out), backedUp...)
+	}
+	consoleInfo("Wrote %s, restore it with screen-vibe backup -restore %s", out, out)
+	return 0
+}
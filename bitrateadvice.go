@@ -0,0 +1,130 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// Encoding time the quantizer is averaged over before advising
+	bitrateAdviceWindow = 3 * time.Minute
+	// Average quantizers outside of these look starved or wasteful, H.264
+	// and HEVC encoders use the same scale
+	bitrateAdviceHighQ = 34.0
+	bitrateAdviceLowQ  = 22.0
+	// Quantizer the advised bitrate aims at
+	bitrateAdviceTargetQ = 28.0
+	// Lowering the quantizer by this doubles the bitrate it takes
+	bitrateAdviceQPerDoubling = 6.0
+)
+
+// bitrateAdvice is what happens with the bitrate the first minutes of a
+// session suggest: off, suggest or adopt
+var bitrateAdvice = "suggest"
+
+// bitrateAdviceState holds the advice of this session. It is given once,
+// an adopted bitrate replaces -bitrate until the recorder is restarted.
+var bitrateAdviceState struct {
+	sync.Mutex
+	done    bool
+	bitrate int // adopted bitrate, 0 for -bitrate
+}
+
+// flagBitrate returns -bitrate, or the bitrate adopted from the advice
+func flagBitrate() int {
+	bitrateAdviceState.Lock()
+	defer bitrateAdviceState.Unlock()
+	if bitrateAdviceState.bitrate > 0 {
+		return bitrateAdviceState.bitrate
+	}
+	return bitrate
+}
+
+// advisedBitrate returns the bitrate that brings an average quantizer q at
+// kbps to the target quantizer, in steps of 100 kbit/s within the -bitrate
+// range
+func advisedBitrate(kbps int, q float64) int {
+	advised := float64(kbps) * math.Pow(2, (q-bitrateAdviceTargetQ)/bitrateAdviceQPerDoubling)
+	return min(max(int(math.Round(advised/100))*100, minBitrate), maxBitrate)
+}
+
+// watchBitrateAdvice averages the quantizer ffmpeg reports over the first
+// bitrateAdviceWindow of encoding at the -bitrate of the flags. A high
+// quantizer means the bitrate is too low for the screen, like 700 kbit/s
+// for 4K, a low one that bits are wasted, like on a static 1366x768
+// desktop. The advice is logged, or adopted by the next segment. Segments
+// of an application profile or -schedule window are not measured, and
+// encoders that report no quantizer get no advice.
+func watchBitrateAdvice(kbps int, progress *segmentProgress, finished chan struct{}, log *slog.Logger) {
+	bitrateAdviceState.Lock()
+	done := bitrateAdviceState.done
+	bitrateAdviceState.Unlock()
+	if bitrateAdvice == "off" || done || kbps != flagBitrate() {
+		return
+	}
+	ticker := time.NewTicker(checkInterval * time.Second)
+	defer ticker.Stop()
+
+	var sum float64
+	var samples int
+	start := time.Duration(-1)
+	for {
+		select {
+		case <-finished:
+			return
+		case <-ticker.C:
+		}
+		p, updated := progress.snapshot()
+		if updated.IsZero() {
+			continue
+		}
+		// The quantizer is 0 until the first frame is encoded
+		if p.q > 0 {
+			sum += p.q
+			samples++
+		}
+		if start < 0 {
+			start = p.time
+		}
+		if p.time-start >= bitrateAdviceWindow {
+			break
+		}
+	}
+
+	bitrateAdviceState.Lock()
+	if bitrateAdviceState.done {
+		bitrateAdviceState.Unlock()
+		return
+	}
+	bitrateAdviceState.done = true
+	if samples == 0 {
+		bitrateAdviceState.Unlock()
+		log.Debug("No bitrate advice, the encoder reports no quantizer")
+		return
+	}
+	q := sum / float64(samples)
+	advised := advisedBitrate(kbps, q)
+	if q <= bitrateAdviceHighQ && q >= bitrateAdviceLowQ || advised == kbps {
+		bitrateAdviceState.Unlock()
+		log.Info("The bitrate suits the screen", "bitrate", kbps, "quantizer", math.Round(q*10)/10)
+		return
+	}
+	if bitrateAdvice == "adopt" {
+		bitrateAdviceState.bitrate = advised
+	}
+	bitrateAdviceState.Unlock()
+
+	reason := "the picture loses detail"
+	if q < bitrateAdviceLowQ {
+		reason = "bits are wasted"
+	}
+	log.Info("Bitrate advice", "bitrate", kbps, "quantizer", math.Round(q*10)/10, "advised", advised, "adopted", bitrateAdvice == "adopt")
+	if bitrateAdvice == "adopt" {
+		consoleEvent("At %d kbit/s %s (average quantizer %.1f), recording at %d kbit/s from now on", kbps, reason, q, advised)
+		requestRotation("adopted the advised bitrate")
+		return
+	}
+	consoleWarn("At %d kbit/s %s (average quantizer %.1f), -bitrate %d would suit this screen", kbps, reason, q, advised)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Interval between two lookups of the blurred windows, a window dragged
+// faster than this shows its edges for a moment
+const blurPollInterval = 200 * time.Millisecond
+
+// Size of the blur of a window that was not found when the segment
+// started, it is kept outside of the picture until the window shows up
+const blurPlaceholderSize = 64
+
+// blurWindowTitles are the windows blurred with -blur-window, matched
+// case-insensitively against a part of the window title
+var blurWindowTitles []string
+
+// screenRect is an area in desktop coordinates
+type screenRect struct {
+	x, y          int
+	width, height int
+}
+
+// blurRegion is the blurred area of a window in the captured picture. The
+// size is fixed for a segment, the position follows the window.
+type blurRegion struct {
+	title         string
+	name          string // filter instance name, for the commands that move it
+	width, height int
+	x, y          int
+	visible       bool
+}
+
+// newBlurRegions looks up the -blur-window windows for a new segment of
+// the capture area of device
+func newBlurRegions(device string, log *slog.Logger) ([]*blurRegion, screenRect) {
+	if len(blurWindowTitles) == 0 {
+		return nil, screenRect{}
+	}
+	area, err := captureArea(device)
+	if err != nil {
+		log.Warn("Could not determine the capture area, blurs follow the windows from the top left", "error", err)
+	}
+	if r := captureRegion; r != nil {
+		area = screenRect{x: area.x + r.x, y: area.y + r.y, width: r.width, height: r.height}
+	}
+	regions := make([]*blurRegion, len(blurWindowTitles))
+	for i, title := range blurWindowTitles {
+		b := &blurRegion{title: title, name: fmt.Sprintf("sv_blur%d", i), width: blurPlaceholderSize, height: blurPlaceholderSize}
+		r, found, err := findWindow(title)
+		if err != nil {
+			log.Warn("Could not look up the blurred window", "window", title, "error", err)
+		}
+		if found {
+			b.width, b.height = blurSize(r, area)
+			b.x, b.y = b.position(r, area)
+			b.visible = true
+			log.Info("Blurring window", "window", title, "x", b.x, "y", b.y, "width", b.width, "height", b.height)
+		} else {
+			log.Info("Blurred window not found, it is blurred once it shows up", "window", title)
+		}
+		regions[i] = b
+	}
+	return regions, area
+}
+
+// blurSize returns the size of the blur over window r, at most the capture
+// area and even for the chroma planes
+func blurSize(r, area screenRect) (int, int) {
+	w, h := r.width, r.height
+	if area.width > 0 {
+		w, h = min(w, area.width), min(h, area.height)
+	}
+	return max(w&^1, 2), max(h&^1, 2)
+}
+
+// position returns where the blur over window r goes in the captured
+// picture. A window partly outside of the picture gets the blur moved
+// inside, which still covers all of the window that is visible.
+func (b *blurRegion) position(r, area screenRect) (int, int) {
+	x, y := r.x-area.x, r.y-area.y
+	if area.width > 0 {
+		x = max(0, min(x, area.width-b.width))
+		y = max(0, min(y, area.height-b.height))
+	}
+	return x, y
+}
+
+// overlayX returns the x position of the overlay, outside of the picture
+// while the window is hidden
+func (b *blurRegion) overlayX() int {
+	if !b.visible {
+		return -b.width - 1
+	}
+	return b.x
+}
+
+// blurGraph returns the filter graph that blurs the regions of the picture
+// labeled input, and the label of its output. crop cuts out the region,
+// overlay puts it back blurred, both are moved by commands.
+func blurGraph(regions []*blurRegion, input string) ([]string, string) {
+	var graph []string
+	label := input
+	for i, b := range regions {
+		graph = append(graph,
+			fmt.Sprintf("%ssplit[sv_base%d][sv_cut%d]", label, i, i),
+			fmt.Sprintf("[sv_cut%d]crop@%s=w=%d:h=%d:x=%d:y=%d,boxblur=luma_radius='min(w,h)/6':luma_power=3:chroma_radius='min(cw,ch)/6':chroma_power=3[sv_blurred%d]",
+				i, b.name, b.width, b.height, b.x, b.y, i),
+			fmt.Sprintf("[sv_base%d][sv_blurred%d]overlay@%s=x=%d:y=%d[sv_out%d]", i, i, b.name, b.overlayX(), b.y, i))
+		label = fmt.Sprintf("[sv_out%d]", i)
+	}
+	return graph, label
+}
+
+// trackBlurRegions moves the blurs with their windows until done is closed.
+// The new positions are sent to ffmpeg as filter commands on its stdin,
+// like the q that stops it. A window that changed its size needs a new
+// filter graph, so the segment is rotated.
+func trackBlurRegions(regions []*blurRegion, area screenRect, stdin io.Writer, done chan struct{}, log *slog.Logger) {
+	ticker := time.NewTicker(blurPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		for _, b := range regions {
+			r, found, err := findWindow(b.title)
+			if err != nil {
+				log.Debug("Could not look up the blurred window", "window", b.title, "error", err)
+				continue
+			}
+			if !found {
+				if b.visible {
+					b.visible = false
+					b.move(stdin)
+					log.Info("Blurred window hidden", "window", b.title)
+				}
+				continue
+			}
+			if w, h := blurSize(r, area); w != b.width || h != b.height {
+				// Keep the old blur where it is until the new segment starts
+				requestRotation(fmt.Sprintf("blurred window %q changed its size", b.title))
+				continue
+			}
+			x, y := b.position(r, area)
+			if !b.visible || x != b.x || y != b.y {
+				b.x, b.y, b.visible = x, y, true
+				b.move(stdin)
+			}
+		}
+	}
+}
+
+// move sends the position of the blur to ffmpeg. Each "c" command line
+// goes to the filter instance it names, all of them in one write so they
+// do not interleave with a q.
+func (b *blurRegion) move(stdin io.Writer) {
+	var cmds strings.Builder
+	fmt.Fprintf(&cmds, "ccrop@%s -1 x %d\n", b.name, b.x)
+	fmt.Fprintf(&cmds, "ccrop@%s -1 y %d\n", b.name, b.y)
+	fmt.Fprintf(&cmds, "coverlay@%s -1 x %d\n", b.name, b.overlayX())
+	fmt.Fprintf(&cmds, "coverlay@%s -1 y %d\n", b.name, b.y)
+	io.WriteString(stdin, cmds.String())
+}
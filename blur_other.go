@@ -0,0 +1,76 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Windows in the output of xwininfo -tree, like
+	// 0x3a00007 "Inbox - Outlook": ("outlook" "Outlook")  1200x800+0+0  +110+70
+	x11TreeWindowRe = regexp.MustCompile(`(?m)^\s*(0x[0-9a-fA-F]+) "(.*)": `)
+	x11GeometryRe   = regexp.MustCompile(`(Absolute upper-left X|Absolute upper-left Y|Width|Height):\s+(-?\d+)`)
+)
+
+// findWindow returns the bounds of the first viewable X11 window whose
+// title contains title, ignoring case
+func findWindow(title string) (screenRect, bool, error) {
+	out, err := exec.Command("xwininfo", "-root", "-tree").Output()
+	if err != nil {
+		return screenRect{}, false, fmt.Errorf("xwininfo: %v", err)
+	}
+	want := strings.ToLower(title)
+	for _, m := range x11TreeWindowRe.FindAllStringSubmatch(string(out), -1) {
+		if !strings.Contains(strings.ToLower(m[2]), want) {
+			continue
+		}
+		info, err := exec.Command("xwininfo", "-id", m[1]).Output()
+		if err != nil || !strings.Contains(string(info), "IsViewable") {
+			// Closed in between, minimized or on another workspace
+			continue
+		}
+		return x11Geometry(string(info)), true, nil
+	}
+	return screenRect{}, false, nil
+}
+
+// x11Geometry reads the absolute position and size from xwininfo output
+func x11Geometry(info string) screenRect {
+	var r screenRect
+	for _, m := range x11GeometryRe.FindAllStringSubmatch(info, -1) {
+		n, _ := strconv.Atoi(m[2])
+		switch m[1] {
+		case "Absolute upper-left X":
+			r.x = n
+		case "Absolute upper-left Y":
+			r.y = n
+		case "Width":
+			r.width = n
+		case "Height":
+			r.height = n
+		}
+	}
+	return r
+}
+
+// captureArea returns the part of the X11 screen x11grab captures, from
+// the display offset to the bottom right corner
+func captureArea(device string) (screenRect, error) {
+	out, err := exec.Command("xwininfo", "-root").Output()
+	if err != nil {
+		return screenRect{}, fmt.Errorf("xwininfo: %v", err)
+	}
+	area := x11Geometry(string(out))
+	if m := x11OffsetRe.FindStringSubmatch(x11DisplayInput()); m != nil {
+		area.x, _ = strconv.Atoi(m[1])
+		area.y, _ = strconv.Atoi(m[2])
+		area.width -= area.x
+		area.height -= area.y
+	}
+	return area, nil
+}
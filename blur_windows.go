@@ -0,0 +1,67 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procEnumWindows     = moduser32.NewProc("EnumWindows")
+	procIsWindowVisible = moduser32.NewProc("IsWindowVisible")
+	procIsIconic        = moduser32.NewProc("IsIconic")
+	procGetWindowRect   = moduser32.NewProc("GetWindowRect")
+)
+
+// findWindow returns the bounds of the topmost visible window whose title
+// contains title, ignoring case
+func findWindow(title string) (screenRect, bool, error) {
+	want := strings.ToLower(title)
+	var found screenRect
+	var ok bool
+	callback := syscall.NewCallback(func(hwnd, lparam uintptr) uintptr {
+		if r, _, _ := procIsWindowVisible.Call(hwnd); r == 0 {
+			return 1 // continue enumeration
+		}
+		if r, _, _ := procIsIconic.Call(hwnd); r != 0 {
+			return 1
+		}
+		buf := make([]uint16, 512)
+		n, _, _ := procGetWindowTextW.Call(hwnd, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+		if n == 0 || !strings.Contains(strings.ToLower(syscall.UTF16ToString(buf[:n])), want) {
+			return 1
+		}
+		var wr rect
+		if r, _, _ := procGetWindowRect.Call(hwnd, uintptr(unsafe.Pointer(&wr))); r == 0 {
+			return 1
+		}
+		found = screenRect{x: int(wr.left), y: int(wr.top), width: int(wr.right - wr.left), height: int(wr.bottom - wr.top)}
+		ok = true
+		return 0 // windows come in z-order, the first match is on top
+	})
+	// EnumWindows also fails when the callback stops the enumeration
+	if r, _, e := procEnumWindows.Call(callback, 0); r == 0 && !ok && e != syscall.Errno(0) {
+		return screenRect{}, false, fmt.Errorf("EnumWindows failed: %v", e)
+	}
+	return found, ok, nil
+}
+
+// captureArea returns the part of the desktop gdigrab captures for device
+func captureArea(device string) (screenRect, error) {
+	var m monitorInfo
+	var err error
+	if idx, isMonitor := parseMonitorDisplay(device); isMonitor {
+		_, m, err = monitorCaptureArgs(idx)
+	} else if device == "desktop" {
+		m, err = virtualScreen()
+	} else {
+		return screenRect{}, fmt.Errorf("cannot blur windows in the capture of %s", device)
+	}
+	if err != nil {
+		return screenRect{}, err
+	}
+	return screenRect{x: m.x, y: m.y, width: m.width, height: m.height}, nil
+}
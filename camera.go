@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Global variables for the camera settings
+var cameraSource string
+var cameraLayout string
+
+// cameraInputArgs returns the ffmpeg input of the -camera source on goos:
+// a network stream like rtsp://, or a camera device of the OS
+func cameraInputArgs(goos, source string) []string {
+	if strings.Contains(source, "://") {
+		if strings.HasPrefix(source, "rtsp://") || strings.HasPrefix(source, "rtsps://") {
+			// UDP loses packets, and with them whole frames, on busy networks
+			return []string{"-rtsp_transport", "tcp", "-i", source}
+		}
+		return []string{"-i", source}
+	}
+	switch goos {
+	case "darwin":
+		// An AVFoundation device index or name, without audio
+		return []string{"-f", "avfoundation", "-i", source + ":none"}
+	case "windows":
+		if !strings.HasPrefix(source, "video=") {
+			source = "video=" + source
+		}
+		return []string{"-f", "dshow", "-i", source}
+	}
+	return []string{"-f", "v4l2", "-i", source}
+}
+
+// cameraGraph places the camera, ffmpeg input number input, beside the
+// output label of graph. The camera is scaled to the height of the screen
+// and follows its frame rate.
+func cameraGraph(graph []string, label string, input, fps int) ([]string, string) {
+	return append(graph,
+		fmt.Sprintf("[%d:v]fps=%d[sv_cam]", input, fps),
+		fmt.Sprintf("[sv_cam]%sscale2ref=w=trunc(oh*mdar/2)*2:h=ih[sv_camscaled][sv_screen]", label),
+		"[sv_camscaled]format=yuv420p[sv_camfmt]",
+		"[sv_screen]format=yuv420p[sv_screenfmt]",
+		"[sv_screenfmt][sv_camfmt]hstack=inputs=2[sv_camera]",
+	), "[sv_camera]"
+}
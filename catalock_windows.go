@@ -0,0 +1,24 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var procLockFileEx = modkernel32.NewProc("LockFileEx")
+
+// LockFileEx flag for an exclusive lock
+const lockfileExclusiveLock = 2
+
+// lockFile waits for an exclusive lock on f, which is released when f is
+// closed
+func lockFile(f *os.File) error {
+	var overlapped syscall.Overlapped
+	if r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock, 0, 1, 0, uintptr(unsafe.Pointer(&overlapped))); r == 0 {
+		return err
+	}
+	return nil
+}
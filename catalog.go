@@ -0,0 +1,726 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Name of the catalog file inside the output directory
+	catalogFileName = "catalog.jsonl"
+	// Name of the encrypted catalog used in anonymized mode
+	encryptedCatalogFileName = "catalog.enc"
+	// Lock file of the processes that write the catalog and its logs
+	catalogLockFileName = "catalog.lock"
+	// Environment variable holding the catalog passphrase
+	catalogKeyEnv = "SCREEN_VIBE_CATALOG_KEY"
+	// Start of the first line of the encrypted catalog, followed by the
+	// salt and the PBKDF2 iterations of the catalog key and its check value
+	catalogMagic = "SVCAT1"
+	// Segment files are named after their start time in this layout
+	segmentNameLayout = "2006-01-02_15-04-05"
+)
+
+// catalogEntry describes one finished recording segment. Paths are relative
+// to the output directory so the catalog stays valid if the tree is moved.
+type catalogEntry struct {
+	File    string    `json:"file"`
+	Log     string    `json:"log"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Size    int64     `json:"size"`
+	User    string    `json:"user,omitempty"`
+	Session string    `json:"session,omitempty"`
+	Tag     string    `json:"tag,omitempty"`
+	Display string    `json:"display,omitempty"`
+	Encoder string    `json:"encoder,omitempty"`
+	// Title of the window of a -window recording
+	Window string `json:"window,omitempty"`
+	// Wall clock time of the first frame and how far the media time lagged
+	// behind the wall clock at the end, only set with -wallclock
+	FirstFrame   *time.Time `json:"first_frame,omitempty"`
+	DriftSeconds *float64   `json:"drift_seconds,omitempty"`
+	// Shared clock time of the first frame and sync markers, only set with
+	// -sync-clock
+	Sync *syncInfo `json:"sync,omitempty"`
+	// Command recorded with "screen-vibe run", the exit code is set on the
+	// segment that ended with the command
+	Command  string `json:"command,omitempty"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+	// Time without user input during the segment, only set with -idle
+	IdleSeconds float64 `json:"idle_seconds,omitempty"`
+	// Screen activity of the segment, only set with -activity
+	Activity *segmentActivity `json:"activity,omitempty"`
+	// Application profile the segment was recorded with, only set with
+	// -app-profiles
+	Profile string `json:"profile,omitempty"`
+	// Time window of -schedule the segment was recorded in
+	Schedule string `json:"schedule,omitempty"`
+	// Frame rate, bitrate and load ffmpeg achieved for the segment
+	Stats *segmentStats `json:"stats,omitempty"`
+	// Frames skipped on a static screen, only set with -dedupe
+	Dedupe *dedupeStats `json:"dedupe,omitempty"`
+	// Backlog of the copy from the spill directory, only set with -spill-dir
+	Spill *spillStats `json:"spill,omitempty"`
+	// Set when the segment ended because ffmpeg stopped encoding frames
+	Stalled bool `json:"stalled,omitempty"`
+	// Meetings of the segment, also its chapters, and the consent notice
+	// shown at their start, only set with -meetings
+	Meetings      []meetingChapter `json:"meetings,omitempty"`
+	ConsentNotice string           `json:"consent_notice,omitempty"`
+	// Speech-to-text transcript of the audio, only set with -transcribe
+	Transcript string `json:"transcript,omitempty"`
+	// Tags and notes of reviewers, from the annotation log
+	Tags  []string      `json:"tags,omitempty"`
+	Notes []segmentNote `json:"notes,omitempty"`
+	// Set while the segment is under legal hold
+	Hold *legalHold `json:"hold,omitempty"`
+	// Where -tier-after moved the video file, the local file is gone
+	// unless it was fetched back
+	Remote string `json:"remote,omitempty"`
+	// Where the segment was recorded to with -o <URL>, it never was in the
+	// output directory
+	Storage string `json:"storage,omitempty"`
+	// Set when the recorder found the segment file at startup without a
+	// catalog entry, e.g. after a power loss; only the times and size are
+	// known
+	Recovered bool `json:"recovered,omitempty"`
+	// Set while the file of the segment is missing from the output
+	// directory, checked when the recorder starts
+	Lost bool `json:"lost,omitempty"`
+	// Original path of a recording added with the import command
+	Imported string `json:"imported,omitempty"`
+}
+
+// catalogMu serializes writes to the catalog file
+var catalogMu sync.Mutex
+
+// catalogLock is the lock file of the output directory while writes of
+// this process hold it, see lockCatalogFiles
+var catalogLock struct {
+	sync.Mutex
+	file    *os.File
+	holders int
+}
+
+// lockCatalogFiles takes the lock file of the output directory before the
+// catalog, the annotations or the access log are written, so the writes of
+// the recorder and of commands like import, annotate and view on the same
+// directory do not interleave, and a rewrite does not drop what another
+// process appended meanwhile. The mutexes of the files order the writes
+// within the process, which share the lock: it is taken by the first and
+// released by the last of them.
+func lockCatalogFiles() (unlock func(), err error) {
+	catalogLock.Lock()
+	defer catalogLock.Unlock()
+	if catalogLock.holders == 0 {
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(filepath.Join(outputDir, catalogLockFileName), os.O_CREATE|os.O_RDWR, 0600)
+		if err != nil {
+			return nil, err
+		}
+		if err := lockFile(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("could not lock %s: %v", f.Name(), err)
+		}
+		catalogLock.file = f
+	}
+	catalogLock.holders++
+	return func() {
+		catalogLock.Lock()
+		defer catalogLock.Unlock()
+		if catalogLock.holders--; catalogLock.holders == 0 {
+			catalogLock.file.Close()
+			catalogLock.file = nil
+		}
+	}, nil
+}
+
+// catalogKey is the AES-256 key for the encrypted catalog, nil if unset
+var catalogKey []byte
+
+// catalogHeader is the first line of the encrypted catalog with the salt
+// and iterations of catalogKey, nil for a catalog of the old format, whose
+// key is the unsalted SHA-256 of the passphrase
+var catalogHeader []byte
+
+// catalogPassphrase returns the passphrase of the encrypted catalog. The
+// janitor of the supervisor reads it from the environment of the pipeline
+// whose catalog it opens.
+var catalogPassphrase = func() string {
+	return os.Getenv(catalogKeyEnv)
+}
+
+// legacyCatalogKey is the unsalted key of the old format while an upgrade
+// to catalogKey is unfinished, records may still be encrypted with it
+var legacyCatalogKey []byte
+
+// loadCatalogKey derives the catalog key from the passphrase in the
+// environment with PBKDF2, like the key of export packages, and the salt
+// and iterations in the header of the encrypted catalog. A new catalog gets
+// a header with a random salt. A wrong passphrase fails the check value of
+// the header.
+func loadCatalogKey() error {
+	passphrase := catalogPassphrase()
+	if passphrase == "" {
+		return fmt.Errorf("the encrypted catalog needs a passphrase in %s", catalogKeyEnv)
+	}
+	legacyCatalogKey = nil
+	// An upgrade that was interrupted left the header of the new key
+	if pending, err := os.ReadFile(catalogUpgradePath()); err == nil {
+		key, err := parseCatalogHeader(pending, passphrase)
+		if err != nil {
+			return fmt.Errorf("%s: %v", catalogUpgradePath(), err)
+		}
+		legacy := sha256.Sum256([]byte(passphrase))
+		catalogKey, catalogHeader, legacyCatalogKey = key, pending, legacy[:]
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	path := filepath.Join(outputDir, encryptedCatalogFileName)
+	first, err := readFirstLine(path)
+	if err != nil {
+		return err
+	}
+	if len(first) == 0 {
+		// Of processes starting on a new catalog at once, the one that
+		// gets the lock first writes the header
+		unlock, err := lockCatalogFiles()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		if first, err = readFirstLine(path); err != nil {
+			return err
+		}
+		if len(first) == 0 {
+			header, key, err := newCatalogHeader(passphrase)
+			if err != nil {
+				return err
+			}
+			if err := replaceFile(path, header, 0600); err != nil {
+				return err
+			}
+			catalogKey, catalogHeader = key, header
+			return nil
+		}
+	}
+	if !bytes.HasPrefix(first, []byte(catalogMagic)) {
+		sum := sha256.Sum256([]byte(passphrase))
+		catalogKey, catalogHeader = sum[:], nil
+		return nil
+	}
+	key, err := parseCatalogHeader(first, passphrase)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	catalogKey, catalogHeader = key, first
+	return nil
+}
+
+// readFirstLine returns the first line of the file at path, nothing if it
+// does not exist
+func readFirstLine(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	first, _ := bufio.NewReader(f).ReadBytes('\n')
+	return first, nil
+}
+
+// newCatalogHeader returns a catalog header with a random salt and its key
+func newCatalogHeader(passphrase string) (header, key []byte, err error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, nil, err
+	}
+	key, err = pbkdf2.Key(sha256.New, passphrase, salt, packageKDFIterations, 32)
+	if err != nil {
+		return nil, nil, err
+	}
+	header = fmt.Appendf(nil, "%s %s %d %s\n", catalogMagic, base64.StdEncoding.EncodeToString(salt), packageKDFIterations,
+		base64.StdEncoding.EncodeToString(catalogKeyCheck(key)))
+	return header, key, nil
+}
+
+// catalogKeyCheck returns the check value of a catalog key, which tells a
+// wrong passphrase apart before anything is written with its key
+func catalogKeyCheck(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(catalogMagic + " key check"))
+	return mac.Sum(nil)[:16]
+}
+
+// parseCatalogHeader derives the catalog key of a header and checks it
+// against the check value. The iterations are checked like those of an
+// export package.
+func parseCatalogHeader(header []byte, passphrase string) ([]byte, error) {
+	fields := strings.Fields(string(header))
+	if len(fields) != 4 || fields[0] != catalogMagic {
+		return nil, errors.New("damaged catalog header")
+	}
+	salt, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil || len(salt) < 16 {
+		return nil, errors.New("damaged catalog header")
+	}
+	iterations, err := strconv.Atoi(fields[2])
+	if err != nil || iterations < minPackageKDFIterations || iterations > maxPackageKDFIterations {
+		return nil, errors.New("damaged catalog header")
+	}
+	check, err := base64.StdEncoding.DecodeString(fields[3])
+	if err != nil {
+		return nil, errors.New("damaged catalog header")
+	}
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(check, catalogKeyCheck(key)) {
+		return nil, fmt.Errorf("wrong passphrase in %s", catalogKeyEnv)
+	}
+	return key, nil
+}
+
+// catalogUpgradePath returns the file that holds the header of the new key
+// while upgradeCatalogKey rewrites the encrypted files
+func catalogUpgradePath() string {
+	return filepath.Join(outputDir, encryptedCatalogFileName+".upgrade")
+}
+
+// upgradeCatalogKey rewrites a catalog of the old format, and the
+// annotation and access logs encrypted with its key, with a salted key and
+// a header. The recorder does it at startup, before it appends to them.
+//
+// The header of the new key is written to its own file first, so a crash
+// in between leaves the key of every record on disk: loadCatalogKey then
+// sets legacyCatalogKey and the next call finishes the upgrade, reading
+// each record with whichever key it was written with.
+func upgradeCatalogKey() error {
+	if catalogHeader != nil && legacyCatalogKey == nil {
+		return nil
+	}
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	unlock, err := lockCatalogFiles()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	// Another process may have upgraded the catalog meanwhile
+	if err := loadCatalogKey(); err != nil {
+		return err
+	}
+	if catalogHeader != nil && legacyCatalogKey == nil {
+		return nil
+	}
+	if catalogHeader == nil {
+		// A wrong passphrase must fail before its key is written
+		for _, path := range []string{annotationsPath(), accessLogPath(), catalogPath()} {
+			if _, err := readRecords[json.RawMessage](path); err != nil {
+				return err
+			}
+		}
+		header, key, err := newCatalogHeader(catalogPassphrase())
+		if err != nil {
+			return err
+		}
+		if err := replaceFile(catalogUpgradePath(), header, 0600); err != nil {
+			return err
+		}
+		catalogKey, catalogHeader, legacyCatalogKey = key, header, catalogKey
+	}
+
+	// The catalog goes last, its header alone does not finish the upgrade
+	for _, path := range []string{annotationsPath(), accessLogPath(), catalogPath()} {
+		var header []byte
+		if path == catalogPath() {
+			header = catalogHeader
+		}
+		if err := reencryptRecords(path, header); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(catalogUpgradePath()); err != nil {
+		return err
+	}
+	syncDir(outputDir)
+	legacyCatalogKey = nil
+	return nil
+}
+
+// reencryptRecords rewrites an encrypted log with catalogKey, after header,
+// from records encrypted with catalogKey or legacyCatalogKey
+func reencryptRecords(path string, header []byte) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && header == nil {
+		return nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	buf := slices.Clone(header)
+	for n, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 || n == 0 && bytes.HasPrefix(line, []byte(catalogMagic)) {
+			continue
+		}
+		record, err := decryptCatalogLine(line)
+		if err != nil && legacyCatalogKey != nil {
+			record, err = decryptWithKey(legacyCatalogKey, line)
+		}
+		if err != nil {
+			return fmt.Errorf("%s line %d: %w", path, n+1, err)
+		}
+		if record, err = encryptCatalogLine(record); err != nil {
+			return err
+		}
+		buf = append(append(buf, record...), '\n')
+	}
+	return replaceFile(path, buf, 0600)
+}
+
+// openCatalog prepares the commands that read or change the catalog of
+// outputDir: they use the encrypted catalog when it exists, which needs the
+// passphrase in the environment
+func openCatalog() error {
+	if _, err := os.Stat(filepath.Join(outputDir, encryptedCatalogFileName)); err != nil {
+		return nil
+	}
+	anonymize = true
+	if err := loadCatalogKey(); err != nil {
+		return err
+	}
+	if legacyCatalogKey != nil {
+		// Finish an upgrade of the recorder that was interrupted
+		return upgradeCatalogKey()
+	}
+	return nil
+}
+
+// catalogPath returns the location of the catalog file
+func catalogPath() string {
+	if anonymize {
+		return filepath.Join(outputDir, encryptedCatalogFileName)
+	}
+	return filepath.Join(outputDir, catalogFileName)
+}
+
+// relativeToOutput returns path relative to the output directory
+func relativeToOutput(path string) string {
+	rel, err := filepath.Rel(outputDir, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// catalogAEAD returns the cipher used for encrypted catalog lines
+func catalogAEAD() (cipher.AEAD, error) {
+	if catalogKey == nil {
+		return nil, fmt.Errorf("no catalog key, set %s", catalogKeyEnv)
+	}
+	return keyAEAD(catalogKey)
+}
+
+// keyAEAD returns the cipher of encrypted catalog lines with key
+func keyAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptCatalogLine seals one JSON record as base64(nonce + ciphertext)
+func encryptCatalogLine(data []byte) ([]byte, error) {
+	aead, err := catalogAEAD()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := aead.Seal(nonce, nonce, data, nil)
+	return []byte(base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// decryptCatalogLine opens a line written by encryptCatalogLine
+func decryptCatalogLine(line []byte) ([]byte, error) {
+	if catalogKey == nil {
+		return nil, fmt.Errorf("no catalog key, set %s", catalogKeyEnv)
+	}
+	return decryptWithKey(catalogKey, line)
+}
+
+// decryptWithKey opens an encrypted catalog line with key
+func decryptWithKey(key, line []byte) ([]byte, error) {
+	aead, err := keyAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(line))
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encrypted record too short")
+	}
+	data, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("cannot decrypt record, wrong catalog key?")
+	}
+	return data, nil
+}
+
+// appendCatalogEntry adds a finished segment to the catalog and syncs it
+// to disk
+func appendCatalogEntry(entry catalogEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if anonymize {
+		if data, err = encryptCatalogLine(data); err != nil {
+			return err
+		}
+	}
+
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	unlock, err := lockCatalogFiles()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	data = append(data, '\n')
+	if _, err := os.Stat(catalogPath()); anonymize && catalogHeader != nil && os.IsNotExist(err) {
+		data = append(slices.Clone(catalogHeader), data...)
+	}
+	return appendSynced(catalogPath(), data)
+}
+
+// updateCatalog rewrites the catalog with the entries returned by update.
+// The new catalog replaces the old one in a single rename, so a crash
+// or power loss leaves either of them.
+func updateCatalog(update func([]catalogEntry) []catalogEntry) error {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	unlock, err := lockCatalogFiles()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := readCatalog()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if anonymize {
+		buf.Write(catalogHeader)
+	}
+	for _, entry := range update(entries) {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if anonymize {
+			if data, err = encryptCatalogLine(data); err != nil {
+				return err
+			}
+		}
+		buf.Write(append(data, '\n'))
+	}
+	return replaceFile(catalogPath(), buf.Bytes(), 0600)
+}
+
+// readCatalog returns all catalog entries in the order they were added
+func readCatalog() ([]catalogEntry, error) {
+	f, err := os.Open(catalogPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []catalogEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		data := scanner.Bytes()
+		if len(data) == 0 || line == 1 && anonymize && bytes.HasPrefix(data, []byte(catalogMagic)) {
+			continue
+		}
+		if anonymize {
+			if data, err = decryptCatalogLine(data); err != nil {
+				return entries, fmt.Errorf("%s line %d: %w", catalogPath(), line, err)
+			}
+		}
+		var entry catalogEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return entries, fmt.Errorf("%s line %d: %w", catalogPath(), line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// runCatalogCommand prints the catalog, decrypting it if needed
+func runCatalogCommand(args []string) int {
+	fs := flag.NewFlagSet("catalog", flag.ExitOnError)
+	jsonFlag := fs.Bool("json", false, "Print entries as JSON lines")
+	searchFlag := fs.String("search", "", "Only print segments whose transcript or notes contain this text, with the matching lines")
+	tagFlag := fs.String("tag", "", "Only print segments with this tag")
+	heldFlag := fs.Bool("held", false, "Only print segments under legal hold")
+	coverageFlag := fs.Bool("coverage", false, "Print a grid of the recorded time per day and hour instead of the segments, to spot gaps")
+	daysFlag := fs.Int("days", 0, "Only include the last N days (default: all, 7 with -coverage)")
+	outputDirFlag := fs.String("output", outputDir, "Directory that holds the catalog")
+	envUsage(fs)
+	if err := applyFlagEnv(fs); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	fs.Parse(args)
+	outputDir = *outputDirFlag
+
+	// Prefer the encrypted catalog when it exists
+	if err := openCatalog(); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+
+	entries, err := readAnnotatedCatalog()
+	if err != nil {
+		consoleError("Could not read catalog: %v", err)
+		return 1
+	}
+	if *coverageFlag {
+		days := *daysFlag
+		if days <= 0 {
+			days = defaultCoverageDays
+		}
+		printCoverage(entries, days)
+		return 0
+	}
+	var since time.Time
+	if *daysFlag > 0 {
+		y, m, d := time.Now().Date()
+		since = time.Date(y, m, d-*daysFlag+1, 0, 0, 0, 0, time.Local)
+	}
+
+	for _, e := range entries {
+		if e.End.Before(since) || *tagFlag != "" && !e.hasTag(*tagFlag) || *heldFlag && e.Hold == nil {
+			continue
+		}
+		var matches []subtitleCue
+		if *searchFlag != "" {
+			query := strings.ToLower(*searchFlag)
+			if e.Transcript != "" {
+				cues, err := readSubtitleCues(filepath.Join(outputDir, e.Transcript))
+				if err != nil {
+					consoleWarn("Could not read transcript: %v", err)
+				}
+				for _, c := range cues {
+					if strings.Contains(strings.ToLower(c.text), query) {
+						matches = append(matches, c)
+					}
+				}
+			}
+			noted := slices.ContainsFunc(e.Notes, func(n segmentNote) bool { return strings.Contains(strings.ToLower(n.Text), query) })
+			if len(matches) == 0 && !noted {
+				continue
+			}
+		}
+		if *jsonFlag {
+			data, _ := json.Marshal(e)
+			fmt.Println(string(data))
+			continue
+		}
+		fmt.Printf("%s  %s  %10s  %-20s %-10s %s\n",
+			e.Start.Local().Format("2006-01-02 15:04:05"),
+			e.End.Sub(e.Start).Round(time.Second),
+			formatFileSize(e.Size), e.User, e.Display, e.File)
+		if e.Remote != "" {
+			fmt.Printf("    in cold storage: %s\n", e.Remote)
+		}
+		if e.Storage != "" {
+			fmt.Printf("    recorded to: %s\n", e.Storage)
+		}
+		if e.Lost {
+			fmt.Printf("    lost: the file is missing from the output directory\n")
+		}
+		if e.Recovered {
+			fmt.Printf("    recovered: found without a catalog entry after the recorder ended abruptly\n")
+		}
+		if e.Imported != "" {
+			fmt.Printf("    imported from %s\n", e.Imported)
+		}
+		if h := e.Hold; h != nil {
+			fmt.Printf("    legal hold by %s since %s: %s\n", h.User, h.Time.Local().Format("2006-01-02 15:04"), h.Reason)
+		}
+		if len(e.Tags) > 0 {
+			fmt.Printf("    tags: %s\n", strings.Join(e.Tags, ", "))
+		}
+		for _, n := range e.Notes {
+			fmt.Printf("    note by %s on %s: %s\n", n.User, n.Time.Local().Format("2006-01-02 15:04"), n.Text)
+		}
+		if s := e.Stats; s != nil {
+			fmt.Printf("    %.1f/%d fps, %.0f/%d kbit/s, %d dropped, %.2fx speed, %.1fs CPU\n",
+				s.FPS, s.TargetFPS, s.Bitrate, s.TargetBitrate, s.Dropped, s.Speed, s.CPUSeconds)
+		}
+		if d := e.Dedupe; d != nil {
+			var static float64
+			for _, p := range d.Static {
+				static += p.End - p.Start
+			}
+			fmt.Printf("    %d frames written, %d unchanged frames skipped, static for %s\n",
+				d.Written, d.Skipped, time.Duration(static*float64(time.Second)).Round(time.Second))
+		}
+		if e.Activity != nil {
+			fmt.Printf("    [%s] %.0f%% active\n", activityBar(e.Activity, e.End.Sub(e.Start), activityBarWidth), e.Activity.ActivePercent)
+		}
+		for _, c := range matches {
+			fmt.Printf("    %s  %s\n", c.start, c.text)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useEncryptedCatalog switches the test to an empty encrypted catalog in a
+// temporary output directory
+func useEncryptedCatalog(t *testing.T, passphrase string) {
+	t.Setenv(catalogKeyEnv, passphrase)
+	setGlobal(t, &outputDir, t.TempDir())
+	setGlobal(t, &anonymize, true)
+	setGlobal(t, &catalogKey, nil)
+	setGlobal(t, &catalogHeader, nil)
+	setGlobal(t, &legacyCatalogKey, nil)
+}
+
+// writeLegacyCatalog writes a catalog, annotation and access log of the old
+// format, keyed by the unsalted hash of the passphrase
+func writeLegacyCatalog(t *testing.T) {
+	sum := sha256.Sum256([]byte(os.Getenv(catalogKeyEnv)))
+	catalogKey, catalogHeader = sum[:], nil
+	start := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+	for i, name := range []string{"a.mkv", "b.mkv"} {
+		begin := start.Add(time.Duration(i) * time.Hour)
+		if err := appendCatalogEntry(catalogEntry{File: name, Start: begin, End: begin.Add(time.Minute), Size: 100}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := appendAnnotations([]annotation{{Time: start, User: "rev", File: "a.mkv", Action: "tag", Value: "incident"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendRecords(accessLogPath(), []accessRecord{{Time: start, User: "rev", Action: "export", File: "b.mkv"}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkUpgradedCatalog loads the key like a restart and checks that the
+// catalog and the logs were rewritten with the salted key
+func checkUpgradedCatalog(t *testing.T) {
+	t.Helper()
+	if err := loadCatalogKey(); err != nil {
+		t.Fatal(err)
+	}
+	if catalogHeader == nil || legacyCatalogKey != nil {
+		t.Fatalf("the catalog is not upgraded: header %q, upgrade pending %v", catalogHeader, legacyCatalogKey != nil)
+	}
+	if _, err := os.Stat(catalogUpgradePath()); !os.IsNotExist(err) {
+		t.Errorf("%s is left: %v", catalogUpgradePath(), err)
+	}
+	entries, err := readCatalog()
+	if err != nil || len(entries) != 2 || entries[0].File != "a.mkv" || entries[1].File != "b.mkv" {
+		t.Fatalf("catalog after the upgrade: %+v, %v", entries, err)
+	}
+	annotations, err := readAnnotations()
+	if err != nil || len(annotations) != 1 || annotations[0].Value != "incident" {
+		t.Fatalf("annotations after the upgrade: %+v, %v", annotations, err)
+	}
+	accesses, err := readRecords[accessRecord](accessLogPath())
+	if err != nil || len(accesses) != 1 || accesses[0].File != "b.mkv" {
+		t.Fatalf("access log after the upgrade: %+v, %v", accesses, err)
+	}
+}
+
+func TestCatalogKeyUpgrade(t *testing.T) {
+	useEncryptedCatalog(t, "correct horse")
+	writeLegacyCatalog(t)
+	if err := loadCatalogKey(); err != nil {
+		t.Fatal(err)
+	}
+	if catalogHeader != nil {
+		t.Fatalf("a catalog of the old format got the header %q", catalogHeader)
+	}
+	if err := upgradeCatalogKey(); err != nil {
+		t.Fatal(err)
+	}
+	checkUpgradedCatalog(t)
+}
+
+// A crash after the logs were rewritten, before the catalog got its header,
+// must not lose the key of the logs
+func TestCatalogKeyUpgradeInterrupted(t *testing.T) {
+	useEncryptedCatalog(t, "correct horse")
+	writeLegacyCatalog(t)
+	if err := loadCatalogKey(); err != nil {
+		t.Fatal(err)
+	}
+	// The catalog cannot be replaced while its temporary file is a directory
+	blocked := catalogPath() + ".tmp"
+	if err := os.Mkdir(blocked, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := upgradeCatalogKey(); err == nil {
+		t.Fatal("the upgrade replaced a catalog it could not write")
+	}
+	if _, err := os.Stat(catalogUpgradePath()); err != nil {
+		t.Fatalf("the interrupted upgrade left no key: %v", err)
+	}
+	os.Remove(blocked)
+
+	// A command reading the catalog meanwhile finishes the upgrade
+	setGlobal(t, &catalogKey, nil)
+	setGlobal(t, &catalogHeader, nil)
+	if err := openCatalog(); err != nil {
+		t.Fatal(err)
+	}
+	checkUpgradedCatalog(t)
+}
+
+func TestCatalogWrongKey(t *testing.T) {
+	useEncryptedCatalog(t, "correct horse")
+	if err := loadCatalogKey(); err != nil {
+		t.Fatal(err)
+	}
+	header, err := os.ReadFile(catalogPath())
+	if err != nil || !strings.HasPrefix(string(header), catalogMagic+" ") {
+		t.Fatalf("new catalog starts with %q: %v", header, err)
+	}
+
+	// The catalog has no records yet, the header alone tells the key apart
+	t.Setenv(catalogKeyEnv, "battery staple")
+	if err := loadCatalogKey(); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Fatalf("a wrong passphrase was accepted: %v", err)
+	}
+	if data, _ := os.ReadFile(catalogPath()); string(data) != string(header) {
+		t.Errorf("the catalog changed after a wrong passphrase")
+	}
+
+	// Neither may it continue an interrupted upgrade
+	if err := os.WriteFile(catalogUpgradePath(), header, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadCatalogKey(); err == nil {
+		t.Fatal("a wrong passphrase continued the upgrade")
+	}
+	os.Remove(catalogUpgradePath())
+
+	// A catalog of the old format fails its upgrade instead
+	useEncryptedCatalog(t, "correct horse")
+	writeLegacyCatalog(t)
+	t.Setenv(catalogKeyEnv, "battery staple")
+	if err := loadCatalogKey(); err != nil {
+		t.Fatal(err)
+	}
+	if err := upgradeCatalogKey(); err == nil {
+		t.Fatal("a catalog of the old format was upgraded with a wrong passphrase")
+	}
+	if _, err := os.Stat(catalogUpgradePath()); !os.IsNotExist(err) {
+		t.Fatalf("the key of the wrong passphrase was written: %v", err)
+	}
+	t.Setenv(catalogKeyEnv, "correct horse")
+	if err := loadCatalogKey(); err != nil || catalogHeader != nil {
+		t.Fatalf("the catalog of the old format changed: %v", err)
+	}
+	if err := upgradeCatalogKey(); err != nil {
+		t.Fatal(err)
+	}
+	checkUpgradedCatalog(t)
+}
+
+// Another process waits for the lock file until the last write of this one
+// released it
+func TestCatalogLock(t *testing.T) {
+	setGlobal(t, &outputDir, t.TempDir())
+	unlock, err := lockCatalogFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Writes of this process share the lock
+	unlockNested, err := lockCatalogFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(outputDir, catalogLockFileName), os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	locked := make(chan error, 1)
+	go func() { locked <- lockFile(f) }()
+	for _, release := range []func(){unlockNested, unlock} {
+		select {
+		case err := <-locked:
+			t.Fatalf("the lock file was taken while this process held it: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+		release()
+	}
+	select {
+	case err := <-locked:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lock file was not released")
+	}
+}
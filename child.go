@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// childCommand is a command recorded by "screen-vibe run" or
+// -virtual-display-command. Recording stops when it exits.
+var childCommand struct {
+	sync.Mutex
+	name     string // command line, stored in the catalog
+	started  time.Time
+	ended    time.Time
+	exited   bool
+	exitCode int
+}
+
+// childCommandTag returns the command line and, once it exited, the exit
+// code of the recorded command for the catalog
+func childCommandTag() (string, *int) {
+	childCommand.Lock()
+	defer childCommand.Unlock()
+	if !childCommand.exited {
+		return childCommand.name, nil
+	}
+	code := childCommand.exitCode
+	return childCommand.name, &code
+}
+
+// childExitCode returns the exit code of the recorded command, 0 if none ran
+func childExitCode() int {
+	childCommand.Lock()
+	defer childCommand.Unlock()
+	return childCommand.exitCode
+}
+
+// startChildCommand runs args once the first segment is recording and
+// stops the recorder when the command exits
+func startChildCommand(args []string, sigs chan os.Signal) {
+	name := strings.Join(args, " ")
+	if len(args) == 3 && args[0] == "sh" && args[1] == "-c" {
+		name = args[2]
+	}
+	childCommand.Lock()
+	childCommand.name = name
+	childCommand.Unlock()
+
+	var once sync.Once
+	stateHooks = append(stateHooks, func(status recorderStatus) {
+		if status.State != "recording" {
+			return
+		}
+		once.Do(func() {
+			go runChildCommand(name, args, sigs)
+		})
+	})
+}
+
+func runChildCommand(name string, args []string, sigs chan os.Signal) {
+	cmd := exec.Command(args[0], args[1:]...)
+	// Stdin belongs to the recorder while it reads commands from it
+	if !stdinCommands {
+		cmd.Stdin = os.Stdin
+	}
+	cmd.Stdout = consoleOut
+	cmd.Stderr = consoleOut
+
+	consoleEvent("Running %s", name)
+	childCommand.Lock()
+	childCommand.started = time.Now()
+	childCommand.Unlock()
+	err := cmd.Run()
+	code := 0
+	if cmd.ProcessState != nil {
+		code = cmd.ProcessState.ExitCode()
+		consoleEvent("%s exited with code %d, stopping recording", name, code)
+	} else {
+		code = 127
+		consoleError("Could not run %s: %v", name, err)
+	}
+
+	childCommand.Lock()
+	childCommand.ended = time.Now()
+	childCommand.exited = true
+	childCommand.exitCode = code
+	childCommand.Unlock()
+	sigs <- os.Interrupt
+}
+
+// splitRunArgs splits the arguments of "screen-vibe run" into recorder
+// flags and the command after "--"
+func splitRunArgs(args []string) (flags, command []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[:i], args[i+1:]
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// clipboardTarget is what is copied to the clipboard when a segment is
+// finished: "path" for its file path, or the base URL of a view command
+// serving the output directory for a link to it. Empty copies nothing.
+var clipboardTarget string
+
+// parseClipboardTarget checks the value of -clipboard
+func parseClipboardTarget(value string) (string, error) {
+	if value == "" || value == "path" {
+		return value, nil
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("use path or the http(s) URL of a view command, not %q", value)
+	}
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+// clipboardText returns what is copied for the segment file: its path, or
+// its URL below /files/ of the view command
+func clipboardText(file string) string {
+	if clipboardTarget == "" || clipboardTarget == "path" {
+		return file
+	}
+	absOutput, _ := filepath.Abs(outputDir)
+	rel, err := filepath.Rel(absOutput, file)
+	if err != nil || !filepath.IsLocal(rel) {
+		// The view command only serves the output directory
+		return file
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return clipboardTarget + "/files/" + strings.Join(parts, "/")
+}
+
+// copySegment copies the path or URL of a finished segment to the clipboard
+func copySegment(file string) error {
+	text := clipboardText(file)
+	if err := copyToClipboard(text); err != nil {
+		return err
+	}
+	consoleEvent("Copied %s to the clipboard", text)
+	return nil
+}
+
+// copyLastSegment copies the last finished segment to the clipboard, for the
+// copy command that a desktop shortcut can run
+func copyLastSegment() error {
+	last := lastSegmentFile.Load()
+	if last == nil {
+		return errors.New("no segment finished yet")
+	}
+	return copySegment(*last)
+}
+
+// clipboardCommand returns the command that puts its input on the
+// clipboard of goos: pbcopy on macOS, PowerShell on Windows (clip.exe
+// mangles non-ASCII text) and wl-copy, xclip or xsel on Linux
+func clipboardCommand(goos string) (*exec.Cmd, error) {
+	switch goos {
+	case "darwin":
+		return exec.Command("pbcopy"), nil
+	case "windows":
+		return exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", "$input | Set-Clipboard"), nil
+	}
+	var candidates [][]string
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		candidates = append(candidates, []string{"wl-copy"})
+	}
+	candidates = append(candidates, []string{"xclip", "-selection", "clipboard"}, []string{"xsel", "--clipboard", "--input"})
+	for _, c := range candidates {
+		if _, err := exec.LookPath(c[0]); err == nil {
+			return exec.Command(c[0], c[1:]...), nil
+		}
+	}
+	return nil, errors.New("no clipboard tool found, install wl-copy, xclip or xsel")
+}
+
+// copyToClipboard puts text on the clipboard
+func copyToClipboard(text string) error {
+	cmd, err := clipboardCommand(runtime.GOOS)
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = strings.NewReader(text)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %v %s", cmd.Args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Name of the directory inside the output directory that holds marker clips
+const clipsDirName = "clips"
+
+// markerClipSeconds is how many seconds before and after a marker are
+// exported as a clip, 0 disables clip export
+var markerClipSeconds int
+
+// segmentJobs tracks work on finished segments that runs in the
+// background, like clip exports, so it completes before exiting
+var segmentJobs sync.WaitGroup
+
+// segmentMarkers returns the markers dropped while file was recorded
+func segmentMarkers(file string) []manifestMarker {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil
+	}
+	manifest.Lock()
+	defer manifest.Unlock()
+	var markers []manifestMarker
+	for _, m := range manifest.markers {
+		if m.File == abs {
+			markers = append(markers, m)
+		}
+	}
+	return markers
+}
+
+// exportMarkerClips cuts a clip around every marker of a finished segment
+// into the clips directory. The clips are copied without re-encoding, so
+// they start at the keyframe before the requested time.
+func exportMarkerClips(videoFile string, start, end time.Time) {
+	markers := segmentMarkers(videoFile)
+	if markerClipSeconds <= 0 || len(markers) == 0 {
+		return
+	}
+	dir := filepath.Join(outputDir, clipsDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		consoleWarn("Could not create %s: %v", dir, err)
+		return
+	}
+
+	segmentJobs.Add(1)
+	go func() {
+		defer segmentJobs.Done()
+		span := time.Duration(markerClipSeconds) * time.Second
+		base := strings.TrimSuffix(filepath.Base(videoFile), filepath.Ext(videoFile))
+		for _, m := range markers {
+			// Clips do not reach into neighboring segments
+			from := time.Duration(m.Offset*float64(time.Second)) - span
+			if from < 0 {
+				from = 0
+			}
+			length := min(from+2*span, end.Sub(start)) - from
+
+			name := fmt.Sprintf("%s_%ds_%s.mkv", base, int(m.Offset), fileTag(m.Label))
+			if anonymize {
+				name = newUUID() + ".mkv"
+			}
+			clip := filepath.Join(dir, name)
+			cmd := exec.Command("ffmpeg", "-hide_banner", "-loglevel", "error", "-y",
+				"-ss", fmt.Sprintf("%.3f", from.Seconds()), "-i", videoFile,
+				"-t", fmt.Sprintf("%.3f", length.Seconds()), "-map", "0", "-c", "copy", clip)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				consoleWarn("Could not export the clip of marker %q: %v %s", m.Label, err, strings.TrimSpace(string(out)))
+				continue
+			}
+			consoleEvent("Exported clip %s", clip)
+		}
+	}()
+}
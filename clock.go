@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// Interval between two clock jump checks
+	clockCheckInterval = 5 * time.Second
+	// Wall clock jumps larger than this are reported
+	clockJumpThreshold = 2 * time.Second
+	// Interval between two NTP offset checks
+	ntpCheckInterval = time.Hour
+	// NTP offsets larger than this are reported
+	ntpMaxOffset = time.Second
+	// Seconds between the NTP epoch (1900) and the Unix epoch (1970)
+	ntpEpochOffset = 2208988800
+)
+
+// Global variable for the NTP server setting
+var ntpServer string
+
+// checkClockSanity warns if the system clock is obviously not set
+func checkClockSanity() {
+	if time.Now().Year() < 2024 {
+		consoleWarn("System clock looks wrong (%s), recording timestamps will not be trustworthy",
+			time.Now().Format("2006-01-02 15:04:05"))
+	}
+}
+
+// queryNTPOffset asks an NTP server how far the local clock is off.
+// A positive offset means the local clock is behind.
+func queryNTPOffset(server string) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	conn, err := net.DialTimeout("udp", server, 5*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// SNTP request: LI = 0, version = 4, mode = 3 (client)
+	req := make([]byte, 48)
+	req[0] = 0x23
+	t1 := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+	resp := make([]byte, 48)
+	if _, err := conn.Read(resp); err != nil {
+		return 0, err
+	}
+	t4 := time.Now()
+
+	if resp[0]&0x07 != 4 || resp[1] == 0 {
+		return 0, fmt.Errorf("invalid NTP response from %s", server)
+	}
+	t2 := ntpTime(resp[32:40]) // server receive time
+	t3 := ntpTime(resp[40:48]) // server transmit time
+
+	return (t2.Sub(t1) + t3.Sub(t4)) / 2, nil
+}
+
+// ntpTime converts a 64 bit NTP timestamp to a time
+func ntpTime(b []byte) time.Time {
+	seconds := binary.BigEndian.Uint32(b[0:4])
+	fraction := binary.BigEndian.Uint32(b[4:8])
+	nanos := (int64(fraction) * 1e9) >> 32
+	return time.Unix(int64(seconds)-ntpEpochOffset, nanos)
+}
+
+// checkNTPOffset queries the NTP server and reports the clock offset
+func checkNTPOffset() {
+	offset, err := queryNTPOffset(ntpServer)
+	if err != nil {
+		consoleWarn("Could not check clock against %s: %v", ntpServer, err)
+		currentLog().Warn("NTP check failed", "server", ntpServer, "error", err)
+		return
+	}
+
+	currentLog().Info("NTP clock offset", "server", ntpServer, "offset", offset)
+	if offset > ntpMaxOffset || offset < -ntpMaxOffset {
+		consoleWarn("System clock is off by %s compared to %s", offset.Round(time.Millisecond), ntpServer)
+		currentLog().Warn("System clock is off", "server", ntpServer, "offset", offset)
+		alertFailure(fmt.Sprintf("System clock is off by %s compared to %s", offset.Round(time.Millisecond), ntpServer))
+	} else {
+		consoleInfo("System clock offset to %s: %s", ntpServer, offset.Round(time.Millisecond))
+	}
+}
+
+// watchClock reports wall clock jumps and periodically checks the NTP offset.
+// Jumps are found by comparing the wall clock with the monotonic clock, large
+// forward jumps are resumes from suspend.
+func watchClock() {
+	go func() {
+		ticker := time.NewTicker(clockCheckInterval)
+		defer ticker.Stop()
+
+		last := time.Now()
+		lastNTP := last
+		for now := range ticker.C {
+			// Round(0) strips the monotonic reading to compare wall clock times
+			jump := now.Round(0).Sub(last.Round(0)) - now.Sub(last)
+			if jump >= suspendMinGap {
+				systemResumed(jump)
+			} else if jump > clockJumpThreshold || jump < -clockJumpThreshold {
+				consoleWarn("System clock jumped by %s", jump.Round(time.Millisecond))
+				currentLog().Warn("System clock jumped", "jump", jump)
+				alertFailure(fmt.Sprintf("System clock jumped by %s during recording", jump.Round(time.Millisecond)))
+			}
+			last = now
+
+			if ntpServer != "" && now.Sub(lastNTP) >= ntpCheckInterval {
+				lastNTP = now
+				checkNTPOffset()
+			}
+		}
+	}()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Prefix of the environment variables that set command line flags
+const envFlagPrefix = "SCREEN_VIBE_"
+
+// flagEnvName returns the environment variable of a flag, e.g.
+// SCREEN_VIBE_EMAIL_TO for -email-to
+func flagEnvName(name string) string {
+	return envFlagPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyFlagEnv sets flags from SCREEN_VIBE_* environment variables, so the
+// recorder can be configured entirely through the environment (e.g. in a
+// container). Flags given on the command line take precedence.
+func applyFlagEnv(fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(flagEnvName(f.Name))
+		if !ok || err != nil {
+			return
+		}
+		if e := fs.Set(f.Name, value); e != nil {
+			err = fmt.Errorf("invalid value %q for %s: %v", value, flagEnvName(f.Name), e)
+		}
+	})
+	return err
+}
+
+// envUsage adds a note about the environment variables to the usage of fs
+func envUsage(fs *flag.FlagSet) {
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of %s:\n", fs.Name())
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\nEvery flag can also be set with an environment variable, e.g. %s=5 for -fps.\n", flagEnvName("fps"))
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ANSI escape sequences used for console colors
+const (
+	colorReset  = "\x1b[0m"
+	colorDim    = "\x1b[2m"
+	colorRed    = "\x1b[31m"
+	colorYellow = "\x1b[33m"
+	colorCyan   = "\x1b[36m"
+)
+
+// consoleOut receives all console output of the recorder
+var consoleOut io.Writer = os.Stdout
+
+// colorEnabled is set when consoleOut is a terminal that supports colors
+var colorEnabled bool
+
+// setupConsole enables colors when writing to a terminal, unless disabled
+// through the NO_COLOR convention or a dumb terminal
+func setupConsole() {
+	colorEnabled = false
+	f, ok := consoleOut.(*os.File)
+	if !ok || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return
+	}
+	fileInfo, err := f.Stat()
+	if err != nil || fileInfo.Mode()&os.ModeCharDevice == 0 {
+		return
+	}
+	colorEnabled = enableTerminalColors(f)
+}
+
+// consolePrint writes a line to the console in the given color
+func consolePrint(color, line string) {
+	line = scrubLogLine(line)
+	if colorEnabled && color != "" {
+		fmt.Fprintln(consoleOut, color+line+colorReset)
+		return
+	}
+	fmt.Fprintln(consoleOut, line)
+}
+
+// The console messages below are translated into the -lang language
+
+// consoleInfo prints an informational message
+func consoleInfo(format string, args ...any) {
+	consolePrint("", fmt.Sprintf(tr(format), args...))
+}
+
+// consoleEvent prints a recording event like a segment rotation
+func consoleEvent(format string, args ...any) {
+	consolePrint(colorYellow, fmt.Sprintf(tr(format), args...))
+}
+
+// consoleWarn prints a warning
+func consoleWarn(format string, args ...any) {
+	consolePrint(colorYellow, fmt.Sprintf(tr("Warning: %s"), fmt.Sprintf(tr(format), args...)))
+}
+
+// consoleError prints an error
+func consoleError(format string, args ...any) {
+	consolePrint(colorRed, fmt.Sprintf(tr("Error: %s"), fmt.Sprintf(tr(format), args...)))
+}
+
+// consoleFFmpegLine prints a line of ffmpeg output, dimming the progress
+// updates so errors and warnings stand out
+func consoleFFmpegLine(line string) {
+	lower := strings.ToLower(line)
+	switch {
+	case strings.HasPrefix(line, "Enter command: ") || strings.HasPrefix(line, "Command reply for stream"):
+		// Echo of the filter commands that move the -blur-window blurs
+		return
+	case strings.HasPrefix(strings.TrimSpace(line), "frame="):
+		consolePrint(colorDim, line)
+	case strings.Contains(lower, "error") || strings.Contains(lower, "failed") || strings.Contains(lower, "invalid"):
+		consolePrint(colorRed, line)
+	case strings.Contains(lower, "warning") || strings.Contains(lower, "deprecated"):
+		consolePrint(colorYellow, line)
+	case strings.HasPrefix(line, "Input #") || strings.HasPrefix(line, "Output #"):
+		consolePrint(colorCyan, line)
+	default:
+		consolePrint("", line)
+	}
+}
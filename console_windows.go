@@ -0,0 +1,32 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procGetConsoleMode = modkernel32.NewProc("GetConsoleMode")
+	procSetConsoleMode = modkernel32.NewProc("SetConsoleMode")
+)
+
+// ENABLE_VIRTUAL_TERMINAL_PROCESSING console mode flag
+const enableVirtualTerminalProcessing = 0x0004
+
+// enableTerminalColors turns on ANSI escape sequence support of the
+// Windows console, which is available since Windows 10
+func enableTerminalColors(f *os.File) bool {
+	var mode uint32
+	handle := uintptr(syscall.Handle(f.Fd()))
+	if r, _, _ := procGetConsoleMode.Call(handle, uintptr(unsafe.Pointer(&mode))); r == 0 {
+		return false
+	}
+	if mode&enableVirtualTerminalProcessing != 0 {
+		return true
+	}
+	r, _, _ := procSetConsoleMode.Call(handle, uintptr(mode|enableVirtualTerminalProcessing))
+	return r != 0
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Number of log lines sent before following a log
+const logTailLines = 20
+
+// Global variable for the instance name, used to find the control socket
+var instanceName string
+
+// controlListener accepts control connections, nil if not listening
+var controlListener net.Listener
+
+// quitSignals receives the interrupt of the quit command, like Ctrl+C
+var quitSignals chan os.Signal
+
+// recorderStatus is returned by the status command
+type recorderStatus struct {
+	Instance string    `json:"instance"`
+	State    string    `json:"state"`
+	File     string    `json:"file,omitempty"`
+	Log      string    `json:"log,omitempty"`
+	Started  time.Time `json:"started,omitzero"`
+	Size     int64     `json:"size"`
+	// Seconds since the segment started
+	Elapsed  int64   `json:"elapsed_seconds,omitempty"`
+	Encoder  string  `json:"encoder,omitempty"`
+	FPS      float64 `json:"fps,omitempty"` // frames per second ffmpeg captures
+	Display  string  `json:"display,omitempty"`
+	LastFile string  `json:"last_file,omitempty"`
+	// When ffmpeg last encoded a new frame
+	LastFrame time.Time `json:"last_frame,omitzero"`
+	// Free space in the output directory, in bytes
+	DiskFree int64 `json:"disk_free,omitempty"`
+	// Viewers of the -live view
+	LiveViewers int    `json:"live_viewers,omitempty"`
+	Version     string `json:"version"`
+}
+
+// logHub copies segment log output to control clients following the log
+type logHub struct {
+	sync.Mutex
+	subscribers map[chan []byte]struct{}
+}
+
+// segmentLogs receives the log output of every recording segment
+var segmentLogs = &logHub{subscribers: make(map[chan []byte]struct{})}
+
+// Write sends log output to all subscribers, dropping it for slow ones
+func (h *logHub) Write(p []byte) (int, error) {
+	h.Lock()
+	defer h.Unlock()
+	for ch := range h.subscribers {
+		b := append([]byte(nil), p...)
+		select {
+		case ch <- b:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+func (h *logHub) subscribe() chan []byte {
+	ch := make(chan []byte, 256)
+	h.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.Unlock()
+	return ch
+}
+
+func (h *logHub) unsubscribe(ch chan []byte) {
+	h.Lock()
+	delete(h.subscribers, ch)
+	h.Unlock()
+}
+
+// startControlServer listens on the control socket of this instance
+func startControlServer() error {
+	path := controlSocketPath(instanceName)
+
+	// Refuse to take over the socket of a running instance
+	if conn, err := dialControl(path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("instance %q is already running (%s)", instanceName, path)
+	}
+
+	ln, err := listenControl(path)
+	if err != nil {
+		return err
+	}
+	controlListener = ln
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				continue
+			}
+			go handleControlConn(conn)
+		}
+	}()
+	return nil
+}
+
+// stopControlServer closes the control socket, which also removes it
+func stopControlServer() {
+	if controlListener != nil {
+		controlListener.Close()
+	}
+}
+
+// handleControlConn runs a single command sent by a control client
+func handleControlConn(conn net.Conn) {
+	defer conn.Close()
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && line == "" {
+		return
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+
+	switch fields[0] {
+	case "status":
+		data, _ := json.Marshal(currentStatus())
+		conn.Write(append(data, '\n'))
+	case "logs":
+		follow := len(fields) > 1 && fields[1] == "-f"
+		streamLogs(conn, follow)
+	case "start", "stop", "pause":
+		if err := controlRecording(fields[0]); err != nil {
+			fmt.Fprintf(conn, "error: %v\n", err)
+			return
+		}
+		io.WriteString(conn, "ok\n")
+	case "quit":
+		// Where signals cannot be sent, like to a recorder in another
+		// Windows session
+		select {
+		case quitSignals <- os.Interrupt:
+		default:
+		}
+		io.WriteString(conn, "ok\n")
+	case "upgrade":
+		if err := requestUpgrade(); err != nil {
+			fmt.Fprintf(conn, "error: %v\n", err)
+			return
+		}
+		io.WriteString(conn, "ok\n")
+	case "fetch":
+		name := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "fetch"))
+		if name == "" {
+			io.WriteString(conn, "error: fetch needs a segment file\n")
+			return
+		}
+		file, err := fetchSegment(name)
+		if err != nil {
+			fmt.Fprintf(conn, "error: %v\n", err)
+			return
+		}
+		fmt.Fprintf(conn, "%s\n", file)
+	case "last":
+		last := lastSegmentFile.Load()
+		if last == nil {
+			io.WriteString(conn, "error: no segment finished yet\n")
+			return
+		}
+		fmt.Fprintf(conn, "%s\n", *last)
+	case "copy":
+		// Runs in the session of the recorder, whose clipboard the user sees
+		if err := copyLastSegment(); err != nil {
+			fmt.Fprintf(conn, "error: %v\n", err)
+			return
+		}
+		io.WriteString(conn, "ok\n")
+	default:
+		fmt.Fprintf(conn, "error: unknown command %q\n", fields[0])
+	}
+}
+
+// currentStatus describes what the recorder is doing right now
+func currentStatus() recorderStatus {
+	status := recorderStatus{Instance: instanceName, State: "idle", Version: version}
+	if free, err := diskFree(outputDir); err == nil {
+		status.DiskFree = free
+	}
+	if hold := recorderHold(); hold != "" {
+		status.State = hold
+	}
+	if last := lastSegmentFile.Load(); last != nil {
+		status.LastFile = *last
+	}
+	if seg := activeSegment.Load(); seg != nil {
+		status.State = "recording"
+		status.File = seg.file
+		status.Log = seg.log
+		status.Started = seg.start
+		status.Encoder = seg.encoder
+		status.Display = seg.display
+		if fileInfo, err := os.Stat(seg.file); err == nil {
+			status.Size = fileInfo.Size()
+		}
+		status.LastFrame = seg.progress.lastFrameTime()
+		status.Elapsed = int64(time.Since(seg.start).Seconds())
+		progress, _ := seg.progress.snapshot()
+		status.FPS = progress.fps
+	}
+	if live != nil {
+		status.LiveViewers = live.viewers()
+	}
+	return status
+}
+
+// streamLogs sends the log of the current segment. When following, new log
+// lines are sent as they are written, across segment rotations, until the
+// client disconnects.
+func streamLogs(conn net.Conn, follow bool) {
+	var ch chan []byte
+	if follow {
+		ch = segmentLogs.subscribe()
+		defer segmentLogs.unsubscribe(ch)
+	}
+
+	if seg := activeSegment.Load(); seg != nil {
+		if data, err := os.ReadFile(seg.log); err == nil {
+			lines := strings.SplitAfter(string(data), "\n")
+			if follow && len(lines) > logTailLines {
+				lines = lines[len(lines)-logTailLines:]
+			}
+			if _, err := io.WriteString(conn, strings.Join(lines, "")); err != nil {
+				return
+			}
+		}
+	} else if !follow {
+		io.WriteString(conn, "Not recording\n")
+	}
+
+	if !follow {
+		return
+	}
+
+	// Notice when the client goes away even while no log output arrives
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, conn)
+		close(closed)
+	}()
+	for {
+		select {
+		case b := <-ch:
+			if _, err := conn.Write(b); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// sendControlCommand runs a command on a running instance and copies the
+// response to out
+func sendControlCommand(instance, command string, out io.Writer) error {
+	conn, err := openControl(instance)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(conn, "%s\n", command); err != nil {
+		conn.Close()
+		return err
+	}
+	_, err = io.Copy(out, conn)
+	if closeErr := conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// openControl connects to the control socket of an instance, on controlSSH
+// if set
+func openControl(instance string) (io.ReadWriteCloser, error) {
+	if controlSSH != "" {
+		return dialSSHControl(controlSSH, remoteBinary, instance)
+	}
+	path := controlSocketPath(instance)
+	conn, err := dialControl(path, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("instance %q is not running (%s)", instance, path)
+	}
+	return conn, nil
+}
+
+// runLogsCommand prints (and optionally follows) the log of the segment
+// that a running instance is recording
+func runLogsCommand(args []string) int {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	followFlag := fs.Bool("f", false, "Follow the log, including the logs of new segments")
+	instanceFlag := fs.String("instance", "default", "Name of the recorder instance")
+	sshFlag := fs.String("ssh", "", "Read the log of a recorder on this [user@]host over SSH")
+	remoteBinaryFlag := fs.String("remote-binary", remoteBinary, "screen-vibe binary on the -ssh host")
+	fs.Parse(args)
+	controlSSH, remoteBinary = *sshFlag, *remoteBinaryFlag
+
+	command := "logs"
+	if *followFlag {
+		command = "logs -f"
+	}
+	if err := sendControlCommand(*instanceFlag, command, os.Stdout); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	return 0
+}
+
+// runCtlCommand sends a single control command to a running instance. The
+// plain text output suits shell scripts, AppleScript (do shell script) and
+// the macOS Shortcuts "Run Shell Script" action.
+func runCtlCommand(args []string) int {
+	fs := flag.NewFlagSet("ctl", flag.ExitOnError)
+	instanceFlag := fs.String("instance", "default", "Name of the recorder instance")
+	sshFlag := fs.String("ssh", "", "Control a recorder on this [user@]host over SSH, without a listening port")
+	remoteBinaryFlag := fs.String("remote-binary", remoteBinary, "screen-vibe binary on the -ssh host")
+	stdioFlag := fs.Bool("stdio", false, "Connect stdin and stdout to the control socket, the remote end of -ssh")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: screen-vibe ctl [-instance name] [-ssh [user@]host] start|stop|pause|status|last|copy|upgrade|quit")
+		fmt.Fprintln(fs.Output(), "       screen-vibe ctl [-instance name] [-ssh [user@]host] fetch <segment file>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	controlSSH, remoteBinary = *sshFlag, *remoteBinaryFlag
+	if *stdioFlag {
+		return relayControl(*instanceFlag)
+	}
+
+	if fs.NArg() == 0 || fs.NArg() > 1 && fs.Arg(0) != "fetch" {
+		fs.Usage()
+		return 2
+	}
+	command := fs.Arg(0)
+	switch command {
+	case "start", "stop", "pause", "status", "last", "copy", "upgrade", "quit":
+	case "fetch":
+		if fs.NArg() != 2 {
+			fs.Usage()
+			return 2
+		}
+		command += " " + fs.Arg(1)
+	default:
+		consoleError("Unknown command %q", command)
+		fs.Usage()
+		return 2
+	}
+
+	var out strings.Builder
+	if err := sendControlCommand(*instanceFlag, command, &out); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	if msg, failed := strings.CutPrefix(out.String(), "error: "); failed {
+		consoleError("%s", strings.TrimSpace(msg))
+		return 1
+	}
+	fmt.Print(out.String())
+	return 0
+}
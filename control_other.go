@@ -0,0 +1,70 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// controlSocketPath returns the control socket of an instance, in
+// XDG_RUNTIME_DIR or else in a directory of the user in the shared
+// temporary directory
+func controlSocketPath(instance string) string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), fmt.Sprintf("screen-vibe-%d", os.Getuid()))
+	}
+	return filepath.Join(dir, "screen-vibe-"+instance+".sock")
+}
+
+// privateDir creates dir if needed and makes sure that only the user can
+// enter it, so nobody else can reach a socket in it, not even in the moment
+// before its mode is set. A directory of somebody else, or a symlink to
+// one, is refused.
+func privateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); !info.IsDir() || !ok || int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("%s is not a directory of the user", dir)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		if err := os.Chmod(dir, 0700); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listenControl creates the control socket, only accessible by the user
+// running the recorder. A stale socket left behind by a recorder that
+// crashed is removed first.
+func listenControl(path string) (net.Listener, error) {
+	if err := privateDir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// dialControl connects to the control socket of a running instance
+func dialControl(path string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout("unix", path, timeout)
+}
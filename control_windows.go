@@ -0,0 +1,279 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	modadvapi32                                              = syscall.NewLazyDLL("advapi32.dll")
+	procConvertStringSecurityDescriptorToSecurityDescriptorW = modadvapi32.NewProc("ConvertStringSecurityDescriptorToSecurityDescriptorW")
+	procCreateNamedPipeW                                     = modkernel32.NewProc("CreateNamedPipeW")
+	procConnectNamedPipe                                     = modkernel32.NewProc("ConnectNamedPipe")
+	procDisconnectNamedPipe                                  = modkernel32.NewProc("DisconnectNamedPipe")
+	procWaitNamedPipeW                                       = modkernel32.NewProc("WaitNamedPipeW")
+	procCreateEventW                                         = modkernel32.NewProc("CreateEventW")
+	procGetOverlappedResult                                  = modkernel32.NewProc("GetOverlappedResult")
+)
+
+const (
+	pipeAccessDuplex          = 0x3
+	fileFlagFirstPipeInstance = 0x00080000
+	fileFlagOverlapped        = 0x40000000
+	pipeRejectRemoteClients   = 0x8
+	pipeUnlimitedInstances    = 255
+	pipeBufferSize            = 4096
+	sddlRevision1             = 1
+
+	errorPipeBusy         = syscall.Errno(231)
+	errorPipeNotConnected = syscall.Errno(233)
+	errorPipeConnected    = syscall.Errno(535)
+)
+
+// controlSocketPath returns the named pipe of an instance
+func controlSocketPath(instance string) string {
+	return `\\.\pipe\screen-vibe-` + instance
+}
+
+// pipeSecurityAttributes only grants access to the user running the
+// recorder, administrators and SYSTEM
+func pipeSecurityAttributes() (*syscall.SecurityAttributes, error) {
+	token, err := syscall.OpenCurrentProcessToken()
+	if err != nil {
+		return nil, err
+	}
+	defer token.Close()
+	user, err := token.GetTokenUser()
+	if err != nil {
+		return nil, err
+	}
+	sid, err := user.User.Sid.String()
+	if err != nil {
+		return nil, err
+	}
+
+	// Protected DACL, nothing is inherited from the pipe namespace
+	sddl, err := syscall.UTF16PtrFromString("D:P(A;;GA;;;" + sid + ")(A;;GA;;;BA)(A;;GA;;;SY)")
+	if err != nil {
+		return nil, err
+	}
+	var sd uintptr
+	if r, _, e := procConvertStringSecurityDescriptorToSecurityDescriptorW.Call(
+		uintptr(unsafe.Pointer(sddl)), sddlRevision1, uintptr(unsafe.Pointer(&sd)), 0); r == 0 {
+		return nil, fmt.Errorf("could not create pipe security descriptor: %v", e)
+	}
+	sa := &syscall.SecurityAttributes{SecurityDescriptor: sd}
+	sa.Length = uint32(unsafe.Sizeof(*sa))
+	return sa, nil
+}
+
+// pipeIO runs an overlapped operation on h and waits until it completes
+func pipeIO(h syscall.Handle, op func(*syscall.Overlapped) error) (uint32, error) {
+	event, _, e := procCreateEventW.Call(0, 1, 0, 0)
+	if event == 0 {
+		return 0, e
+	}
+	defer syscall.CloseHandle(syscall.Handle(event))
+
+	ov := &syscall.Overlapped{HEvent: syscall.Handle(event)}
+	if err := op(ov); err != nil && err != syscall.ERROR_IO_PENDING {
+		if err == errorPipeConnected {
+			// A client connected before ConnectNamedPipe was called
+			return 0, nil
+		}
+		return 0, err
+	}
+	var n uint32
+	if r, _, e := procGetOverlappedResult.Call(uintptr(h), uintptr(unsafe.Pointer(ov)), uintptr(unsafe.Pointer(&n)), 1); r == 0 {
+		return n, e
+	}
+	return n, nil
+}
+
+// pipeAddr is the address of a named pipe
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// pipeListener accepts control clients on a named pipe
+type pipeListener struct {
+	path string
+	sa   *syscall.SecurityAttributes
+
+	mu     sync.Mutex
+	handle syscall.Handle // pipe instance waiting for the next client
+	closed bool
+}
+
+// listenControl creates the named pipe of the control server. It fails if
+// another process already owns the pipe.
+func listenControl(path string) (net.Listener, error) {
+	sa, err := pipeSecurityAttributes()
+	if err != nil {
+		return nil, err
+	}
+	l := &pipeListener{path: path, sa: sa}
+	if l.handle, err = l.createInstance(true); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *pipeListener) createInstance(first bool) (syscall.Handle, error) {
+	name, err := syscall.UTF16PtrFromString(l.path)
+	if err != nil {
+		return syscall.InvalidHandle, err
+	}
+	openMode := uint32(pipeAccessDuplex | fileFlagOverlapped)
+	if first {
+		openMode |= fileFlagFirstPipeInstance
+	}
+	h, _, e := procCreateNamedPipeW.Call(uintptr(unsafe.Pointer(name)), uintptr(openMode),
+		pipeRejectRemoteClients, pipeUnlimitedInstances, pipeBufferSize, pipeBufferSize, 0,
+		uintptr(unsafe.Pointer(l.sa)))
+	if syscall.Handle(h) == syscall.InvalidHandle {
+		return syscall.InvalidHandle, fmt.Errorf("could not create named pipe %s: %v", l.path, e)
+	}
+	return syscall.Handle(h), nil
+}
+
+// Accept waits for a client and hands out the connected pipe instance
+func (l *pipeListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil, net.ErrClosed
+	}
+	if l.handle == syscall.InvalidHandle {
+		h, err := l.createInstance(false)
+		if err != nil {
+			l.mu.Unlock()
+			time.Sleep(time.Second) // do not spin if the pipe cannot be created
+			return nil, err
+		}
+		l.handle = h
+	}
+	h := l.handle
+	l.mu.Unlock()
+
+	_, err := pipeIO(h, func(ov *syscall.Overlapped) error {
+		if r, _, e := procConnectNamedPipe.Call(uintptr(h), uintptr(unsafe.Pointer(ov))); r == 0 {
+			return e
+		}
+		return nil
+	})
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil, net.ErrClosed
+	}
+	// The next client connects to a new instance
+	l.handle = syscall.InvalidHandle
+	if err != nil {
+		syscall.CloseHandle(h)
+		return nil, err
+	}
+	return &pipeConn{handle: h, addr: pipeAddr(l.path), server: true}, nil
+}
+
+// Close stops accepting clients, connected clients are not affected
+func (l *pipeListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return net.ErrClosed
+	}
+	l.closed = true
+	if l.handle != syscall.InvalidHandle {
+		syscall.CancelIoEx(l.handle, nil)
+		syscall.CloseHandle(l.handle)
+	}
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr { return pipeAddr(l.path) }
+
+// dialControl connects to the control pipe of a running instance
+func dialControl(path string, timeout time.Duration) (net.Conn, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		h, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil,
+			syscall.OPEN_EXISTING, fileFlagOverlapped, 0)
+		if err == nil {
+			return &pipeConn{handle: h, addr: pipeAddr(path)}, nil
+		}
+		remaining := time.Until(deadline)
+		if err != errorPipeBusy || remaining <= 0 {
+			return nil, err
+		}
+		// All instances are busy, wait for the server to create the next one
+		procWaitNamedPipeW.Call(uintptr(unsafe.Pointer(name)), uintptr(remaining.Milliseconds()))
+	}
+}
+
+// pipeConn is a connected named pipe. Reads and writes use overlapped I/O
+// so that following a log can write while a read waits for the client to
+// disconnect.
+type pipeConn struct {
+	handle    syscall.Handle
+	addr      pipeAddr
+	server    bool
+	closeOnce sync.Once
+}
+
+func (c *pipeConn) Read(b []byte) (int, error) {
+	n, err := pipeIO(c.handle, func(ov *syscall.Overlapped) error {
+		var done uint32
+		return syscall.ReadFile(c.handle, b, &done, ov)
+	})
+	if err == syscall.ERROR_BROKEN_PIPE || err == errorPipeNotConnected || err == syscall.ERROR_OPERATION_ABORTED {
+		return int(n), io.EOF
+	}
+	return int(n), err
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) {
+	n, err := pipeIO(c.handle, func(ov *syscall.Overlapped) error {
+		var done uint32
+		return syscall.WriteFile(c.handle, b, &done, ov)
+	})
+	return int(n), err
+}
+
+// Close cancels pending reads and, on the server side, waits until the
+// client has read everything before disconnecting it
+func (c *pipeConn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		syscall.CancelIoEx(c.handle, nil)
+		if c.server {
+			syscall.FlushFileBuffers(c.handle)
+			procDisconnectNamedPipe.Call(uintptr(c.handle))
+		}
+		err = syscall.CloseHandle(c.handle)
+	})
+	return err
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return c.addr }
+func (c *pipeConn) RemoteAddr() net.Addr { return c.addr }
+
+var errPipeDeadline = errors.New("deadlines are not supported on named pipes")
+
+func (c *pipeConn) SetDeadline(t time.Time) error      { return errPipeDeadline }
+func (c *pipeConn) SetReadDeadline(t time.Time) error  { return errPipeDeadline }
+func (c *pipeConn) SetWriteDeadline(t time.Time) error { return errPipeDeadline }
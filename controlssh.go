@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Words that need no quoting in a shell command
+var plainWordRe = regexp.MustCompile(`^[A-Za-z0-9_./:@%+=-]+$`)
+
+// controlSSH is the [user@]host whose recorder the ctl and logs commands
+// reach over SSH, "" for a recorder on this machine
+var controlSSH string
+
+// remoteBinary is the screen-vibe binary ssh runs on controlSSH
+var remoteBinary = "screen-vibe"
+
+// sshConn is a control connection tunneled through ssh. The remote
+// screen-vibe relays it to the control socket there, so the recorder needs
+// no listening port.
+type sshConn struct {
+	host   string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+}
+
+// dialSSHControl connects to the control socket of an instance on host,
+// running the screen-vibe binary there
+func dialSSHControl(host, binary, instance string) (*sshConn, error) {
+	// BatchMode fails instead of asking for a password nobody can type in
+	c := &sshConn{host: host, cmd: exec.Command("ssh", "-T", "-o", "BatchMode=yes", "-o", "ConnectTimeout=10", "--", host,
+		shellQuote(binary), "ctl", "-instance", shellQuote(instance), "-stdio")}
+	c.cmd.Stderr = &c.stderr
+	var err error
+	if c.stdin, err = c.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	if c.stdout, err = c.cmd.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	if err := c.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not run ssh: %w", err)
+	}
+	return c, nil
+}
+
+func (c *sshConn) Read(b []byte) (int, error)  { return c.stdout.Read(b) }
+func (c *sshConn) Write(b []byte) (int, error) { return c.stdin.Write(b) }
+
+// Close ends the tunnel. Exit status 255 is an error of ssh itself, like an
+// unknown host or a rejected key; the remote errors are in the response.
+func (c *sshConn) Close() error {
+	c.stdin.Close()
+	err := c.cmd.Wait()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 255 {
+		return fmt.Errorf("ssh %s: %s", c.host, strings.TrimSpace(c.stderr.String()))
+	}
+	return nil
+}
+
+// relayControl connects stdin and stdout to the control socket of an
+// instance, the remote end of dialSSHControl. Failures are reported like
+// the errors of the control protocol.
+func relayControl(instance string) int {
+	path := controlSocketPath(instance)
+	conn, err := dialControl(path, 5*time.Second)
+	if err != nil {
+		fmt.Printf("error: instance %q is not running (%s)\n", instance, path)
+		return 1
+	}
+	defer conn.Close()
+	go io.Copy(conn, os.Stdin)
+	io.Copy(os.Stdout, conn)
+	return 0
+}
+
+// shellQuote quotes s for the POSIX shell that runs ssh's remote command.
+// Plain words stay unquoted, so Windows hosts, whose ssh runs cmd.exe, can
+// be reached as long as the names are plain.
+func shellQuote(s string) string {
+	if plainWordRe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// Days shown by catalog -coverage and the coverage page without -days
+	defaultCoverageDays = 7
+	// Most days the coverage page of view shows at once
+	maxCoverageDays = 92
+)
+
+// Characters of the coverage grid, from no recording to a fully recorded hour
+const coverageLevels = ".:+#"
+
+// hourCoverage returns how much of each hour of the day starting at day was
+// recorded. Segments of -window recordings are left out, they do not cover
+// the screen.
+func hourCoverage(entries []catalogEntry, day time.Time) [24]time.Duration {
+	var hours [24]time.Duration
+	for h := range hours {
+		from := time.Date(day.Year(), day.Month(), day.Day(), h, 0, 0, 0, time.Local)
+		to := from.Add(time.Hour)
+		for _, e := range entries {
+			if e.Window != "" || !e.End.After(from) || !e.Start.Before(to) {
+				continue
+			}
+			start, end := e.Start, e.End
+			if start.Before(from) {
+				start = from
+			}
+			if end.After(to) {
+				end = to
+			}
+			hours[h] += end.Sub(start)
+		}
+		// Segments of several displays overlap
+		hours[h] = min(hours[h], time.Hour)
+	}
+	return hours
+}
+
+// coverageLevel returns the level of an hour recorded for d, from 0 for
+// none to 3 for the full hour
+func coverageLevel(d time.Duration) int {
+	switch {
+	case d <= 0:
+		return 0
+	case d < 30*time.Minute:
+		return 1
+	case d < 59*time.Minute:
+		return 2
+	}
+	return 3
+}
+
+// coverageChar returns the grid character of an hour recorded for d
+func coverageChar(d time.Duration) byte {
+	return coverageLevels[coverageLevel(d)]
+}
+
+// formatCoverage formats the recorded time of a day like 7h05m
+func formatCoverage(d time.Duration) string {
+	return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// printCoverage prints a grid of the recorded time per day and hour for the
+// last days, so gaps stand out at a glance
+func printCoverage(entries []catalogEntry, days int) {
+	fmt.Printf("Recorded time per hour of the last %d days (%c none, %c less than half, %c more than half, %c full)\n\n",
+		days, coverageLevels[0], coverageLevels[1], coverageLevels[2], coverageLevels[3])
+	var header strings.Builder
+	for h := 0; h < 24; h += 3 {
+		fmt.Fprintf(&header, "%02d ", h)
+	}
+	fmt.Printf("%-14s %s\n", "", strings.TrimSpace(header.String()))
+
+	y, m, d := time.Now().Date()
+	for i := days - 1; i >= 0; i-- {
+		day := time.Date(y, m, d-i, 0, 0, 0, 0, time.Local)
+		var row [24]byte
+		var total time.Duration
+		for h, recorded := range hourCoverage(entries, day) {
+			row[h] = coverageChar(recorded)
+			total += recorded
+		}
+		fmt.Printf("%-14s %s  %s\n", day.Format("Mon 2006-01-02"), row[:], formatCoverage(total))
+	}
+}
+
+// coverageDay is a row of the coverage page of view
+type coverageDay struct {
+	Day     time.Time
+	Hours   [24]coverageHour
+	Total   string
+	Weekday string
+}
+
+// coverageHour is a cell of the coverage page
+type coverageHour struct {
+	Hour     int
+	Level    int
+	Recorded time.Duration
+}
+
+// coverageCalendar returns the recorded time per hour of the last days,
+// oldest day first
+func coverageCalendar(entries []catalogEntry, days int) []coverageDay {
+	y, m, d := time.Now().Date()
+	since := time.Date(y, m, d-days+1, 0, 0, 0, 0, time.Local)
+	var recent []catalogEntry
+	for _, e := range entries {
+		if e.End.After(since) {
+			recent = append(recent, e)
+		}
+	}
+	calendar := make([]coverageDay, days)
+	for i := range calendar {
+		day := time.Date(y, m, d-days+1+i, 0, 0, 0, 0, time.Local)
+		var total time.Duration
+		for h, recorded := range hourCoverage(recent, day) {
+			calendar[i].Hours[h] = coverageHour{Hour: h, Level: coverageLevel(recorded), Recorded: recorded.Round(time.Minute)}
+			total += recorded
+		}
+		calendar[i].Day, calendar[i].Weekday, calendar[i].Total = day, day.Format("Mon"), formatCoverage(total)
+	}
+	return calendar
+}
@@ -0,0 +1,152 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+const (
+	dbusInterface = "org.screenvibe.Recorder"
+	dbusPath      = dbus.ObjectPath("/org/screenvibe/Recorder")
+)
+
+// dbusRecorder implements the methods of the org.screenvibe.Recorder interface
+type dbusRecorder struct{}
+
+// Start resumes recording after Stop or Pause
+func (dbusRecorder) Start() *dbus.Error {
+	return dbusError(controlRecording("start"))
+}
+
+// Stop finishes the current segment and stops recording
+func (dbusRecorder) Stop() *dbus.Error {
+	return dbusError(controlRecording("stop"))
+}
+
+// Pause finishes the current segment and pauses recording
+func (dbusRecorder) Pause() *dbus.Error {
+	return dbusError(controlRecording("pause"))
+}
+
+// Status returns the state, file, start time (Unix seconds) and size of the
+// segment being recorded
+func (dbusRecorder) Status() (map[string]dbus.Variant, *dbus.Error) {
+	status := currentStatus()
+	var started int64
+	if !status.Started.IsZero() {
+		started = status.Started.Unix()
+	}
+	return map[string]dbus.Variant{
+		"Instance": dbus.MakeVariant(status.Instance),
+		"State":    dbus.MakeVariant(status.State),
+		"File":     dbus.MakeVariant(status.File),
+		"Started":  dbus.MakeVariant(started),
+		"Size":     dbus.MakeVariant(status.Size),
+		"Encoder":  dbus.MakeVariant(status.Encoder),
+		"Display":  dbus.MakeVariant(status.Display),
+	}, nil
+}
+
+func dbusError(err error) *dbus.Error {
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+// dbusBusName returns the bus name of this instance, instances other than
+// the default one get their name as a suffix
+func dbusBusName() string {
+	if instanceName == "" || instanceName == "default" {
+		return dbusInterface
+	}
+	suffix := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, instanceName)
+	if suffix[0] >= '0' && suffix[0] <= '9' {
+		suffix = "_" + suffix
+	}
+	return dbusInterface + "." + suffix
+}
+
+// startDBusService exposes the recorder on the session bus and emits
+// PropertiesChanged whenever the recording state changes. It returns the
+// bus name of the recorder.
+func startDBusService() (string, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return "", fmt.Errorf("could not connect to the session bus: %w", err)
+	}
+
+	name := dbusBusName()
+	reply, err := conn.RequestName(name, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		conn.Close()
+		return "", fmt.Errorf("could not request bus name %s: %w", name, err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		conn.Close()
+		return "", fmt.Errorf("bus name %s is already taken", name)
+	}
+
+	recorder := dbusRecorder{}
+	if err := conn.Export(recorder, dbusPath, dbusInterface); err != nil {
+		conn.Close()
+		return "", err
+	}
+
+	status := currentStatus()
+	props, err := prop.Export(conn, dbusPath, prop.Map{
+		dbusInterface: {
+			"State": {Value: status.State, Emit: prop.EmitTrue},
+			"File":  {Value: status.File, Emit: prop.EmitTrue},
+		},
+	})
+	if err != nil {
+		conn.Close()
+		return "", err
+	}
+
+	node := &introspect.Node{
+		Name: string(dbusPath),
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name:       dbusInterface,
+				Methods:    introspect.Methods(recorder),
+				Properties: props.Introspection(dbusInterface),
+			},
+		},
+	}
+	if err := conn.Export(introspect.NewIntrospectable(node), dbusPath, "org.freedesktop.DBus.Introspectable"); err != nil {
+		conn.Close()
+		return "", err
+	}
+
+	// Only changed values are sent, segment rotations emit the new file
+	var mu sync.Mutex
+	last := status
+	stateHooks = append(stateHooks, func(status recorderStatus) {
+		mu.Lock()
+		defer mu.Unlock()
+		if status.State != last.State {
+			props.SetMust(dbusInterface, "State", status.State)
+		}
+		if status.File != last.File {
+			props.SetMust(dbusInterface, "File", status.File)
+		}
+		last = status
+	})
+	return name, nil
+}
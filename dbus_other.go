@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+// startDBusService is only available on Linux
+func startDBusService() (string, error) {
+	return "", fmt.Errorf("D-Bus is only supported on Linux")
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// Longest time without a written frame while the screen does not
+	// change, so players can still seek and -stall-timeout sees progress
+	dedupeKeepalive = 30 * time.Second
+	// Shortest static period listed in the catalog
+	dedupeMinGap = 5 * time.Second
+)
+
+// dedupeFrames skips frames that look the same as the previous one, for
+// kiosks and dashboards whose screen does not change for hours
+var dedupeFrames bool
+
+// dedupeFilter returns the filter that drops frames matching the previous
+// one. mpdecimate compares 8x8 blocks, so noise like a blinking cursor
+// does not count as a change, and keeps at least one frame per keepalive.
+func dedupeFilter(fps int) string {
+	return fmt.Sprintf("mpdecimate=max=%d", fps*int(dedupeKeepalive/time.Second))
+}
+
+// dedupeStats tells how many frames -dedupe skipped in a segment and when
+// the screen did not change, in seconds from the start of the segment
+type dedupeStats struct {
+	Written int64            `json:"written"`
+	Skipped int64            `json:"skipped"`
+	Static  []inactivePeriod `json:"static,omitempty"`
+}
+
+// staticTracker finds the periods in which ffmpeg wrote at most one new
+// frame per progress line, which is a static screen with -dedupe
+type staticTracker struct {
+	started    bool
+	lastFrame  int64
+	lastUpdate time.Time
+	quietSince time.Time
+	periods    [][2]time.Time
+}
+
+// update records the frame count of a progress line read at now
+func (t *staticTracker) update(frame int64, now time.Time) {
+	if !t.started {
+		t.started = true
+		t.lastFrame, t.lastUpdate, t.quietSince = frame, now, now
+		return
+	}
+	// A single frame is the keepalive or a change too small to matter
+	if frame-t.lastFrame > 1 {
+		t.close()
+		t.quietSince = now
+	}
+	t.lastFrame, t.lastUpdate = frame, now
+}
+
+// close ends the current static period at the last progress line
+func (t *staticTracker) close() {
+	if t.lastUpdate.Sub(t.quietSince) >= dedupeMinGap {
+		t.periods = append(t.periods, [2]time.Time{t.quietSince, t.lastUpdate})
+	}
+}
+
+// dedupeStats returns what -dedupe skipped in the segment recorded from
+// start to end at fps, nil without -dedupe or progress
+func (sp *segmentProgress) dedupeStats(start, end time.Time, fps int) *dedupeStats {
+	if !dedupeFrames {
+		return nil
+	}
+	sp.Lock()
+	defer sp.Unlock()
+	if !sp.static.started {
+		return nil
+	}
+	sp.static.close()
+	s := &dedupeStats{Written: sp.last.frame}
+	s.Skipped = max(int64(end.Sub(start).Seconds()*float64(fps))-s.Written, 0)
+	for _, p := range sp.static.periods {
+		s.Static = append(s.Static, inactivePeriod{
+			Start: math.Round(p[0].Sub(start).Seconds()*10) / 10,
+			End:   math.Round(p[1].Sub(start).Seconds()*10) / 10,
+		})
+	}
+	return s
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+// enableDPIAwareness is only needed on Windows
+func enableDPIAwareness() error {
+	return nil
+}
+
+// virtualScreen is only implemented on Windows
+func virtualScreen() (monitorInfo, error) {
+	return monitorInfo{}, errors.New("virtual screen is only supported on Windows")
+}
+
+// dpiAwareEnv is only needed on Windows
+func dpiAwareEnv(env []string) []string {
+	return env
+}
@@ -0,0 +1,75 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+var (
+	procSetProcessDpiAwarenessContext = moduser32.NewProc("SetProcessDpiAwarenessContext")
+	procSetProcessDPIAware            = moduser32.NewProc("SetProcessDPIAware")
+	procGetSystemMetrics              = moduser32.NewProc("GetSystemMetrics")
+	modshcore                         = syscall.NewLazyDLL("shcore.dll")
+	procSetProcessDpiAwareness        = modshcore.NewProc("SetProcessDpiAwareness")
+)
+
+const (
+	// DPI_AWARENESS_CONTEXT_PER_MONITOR_AWARE_V2
+	dpiAwarenessPerMonitorV2 = ^uintptr(3) // -4
+	// PROCESS_PER_MONITOR_DPI_AWARE
+	processPerMonitorDPIAware = 2
+	// GetSystemMetrics indexes of the virtual screen
+	smXVirtualScreen  = 76
+	smYVirtualScreen  = 77
+	smCXVirtualScreen = 78
+	smCYVirtualScreen = 79
+)
+
+// enableDPIAwareness makes Windows report physical pixels to this process
+// instead of coordinates scaled by the display scaling factor. It tries the
+// Windows 10 API first and falls back to the older ones.
+func enableDPIAwareness() error {
+	if procSetProcessDpiAwarenessContext.Find() == nil {
+		if r, _, _ := procSetProcessDpiAwarenessContext.Call(dpiAwarenessPerMonitorV2); r != 0 {
+			return nil
+		}
+	}
+	if procSetProcessDpiAwareness.Find() == nil {
+		// Returns S_OK (0) on success
+		if r, _, _ := procSetProcessDpiAwareness.Call(processPerMonitorDPIAware); r == 0 {
+			return nil
+		}
+	}
+	if r, _, e := procSetProcessDPIAware.Call(); r == 0 {
+		return fmt.Errorf("SetProcessDPIAware failed: %v", e)
+	}
+	return nil
+}
+
+// virtualScreen returns the bounds of the whole desktop in physical pixels
+func virtualScreen() (monitorInfo, error) {
+	metric := func(index uintptr) int {
+		r, _, _ := procGetSystemMetrics.Call(index)
+		return int(int32(r))
+	}
+	screen := monitorInfo{
+		name:   "desktop",
+		x:      metric(smXVirtualScreen),
+		y:      metric(smYVirtualScreen),
+		width:  metric(smCXVirtualScreen),
+		height: metric(smCYVirtualScreen),
+	}
+	if screen.width <= 0 || screen.height <= 0 {
+		return monitorInfo{}, fmt.Errorf("could not query the virtual screen size")
+	}
+	return screen, nil
+}
+
+// dpiAwareEnv returns the environment for ffmpeg. The compatibility layer
+// makes ffmpeg itself DPI aware, otherwise gdigrab works with scaled
+// coordinates and captures a cropped or blurry image on scaled displays.
+func dpiAwareEnv(env []string) []string {
+	return append(env, "__COMPAT_LAYER=HighDpiAware")
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Minimum time between two alert emails with the same subject
+	alertCooldown = 15 * time.Minute
+	// Pauses between segments shorter than this are not reported as coverage gaps
+	digestGapThreshold = time.Minute
+	// Time span covered by the daily digest
+	digestPeriod = 24 * time.Hour
+	// Time an email gets to reach the SMTP server, from connecting to the
+	// end of the message
+	smtpTimeout = 30 * time.Second
+)
+
+// Global variables for email settings
+var smtpServer string
+var smtpUser string
+var smtpPassword string
+var emailFrom string
+var emailTo []string
+var digestTime string
+
+// segmentRecord describes a finished recording segment for the daily digest
+type segmentRecord struct {
+	file  string
+	start time.Time
+	end   time.Time
+	size  int64
+}
+
+// errorRecord describes a failure reported during recording
+type errorRecord struct {
+	time    time.Time
+	message string
+}
+
+// digestStats collects segments and failures for the daily digest, only
+// with -digest, and the times of the last alerts. Nothing is kept longer
+// than the digest period or the cooldown needs.
+var digestStats struct {
+	sync.Mutex
+	segments   []segmentRecord
+	errors     []errorRecord
+	current    time.Time // start of the segment being recorded, zero if none
+	lastAlerts map[string]time.Time
+}
+
+// emailEnabled reports whether enough settings are present to send emails
+func emailEnabled() bool {
+	return smtpServer != "" && len(emailTo) > 0
+}
+
+// digestEnabled reports whether the daily digest is sent, and so whether
+// segments and failures are collected for it
+func digestEnabled() bool {
+	return emailEnabled() && digestTime != ""
+}
+
+// pruneDigestStats drops the segments and failures before the digest
+// period and the alerts past their cooldown. The caller holds digestStats.
+func pruneDigestStats(now time.Time) {
+	periodStart := now.Add(-digestPeriod)
+	segments := digestStats.segments[:0]
+	for _, s := range digestStats.segments {
+		if s.end.After(periodStart) {
+			segments = append(segments, s)
+		}
+	}
+	digestStats.segments = segments
+	errors := digestStats.errors[:0]
+	for _, e := range digestStats.errors {
+		if e.time.After(periodStart) {
+			errors = append(errors, e)
+		}
+	}
+	digestStats.errors = errors
+	for message, last := range digestStats.lastAlerts {
+		if now.Sub(last) >= alertCooldown {
+			delete(digestStats.lastAlerts, message)
+		}
+	}
+}
+
+// parseEmailList splits a comma separated list of addresses
+func parseEmailList(list string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(list, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// sendEmail sends a plain text email to all configured recipients
+func sendEmail(subject, body string) error {
+	from := emailFrom
+	if from == "" {
+		from = "screen-vibe@" + machineName()
+	}
+
+	var auth smtp.Auth
+	if smtpUser != "" {
+		host, _, err := net.SplitHostPort(smtpServer)
+		if err != nil {
+			return fmt.Errorf("invalid SMTP server address %q: %w", smtpServer, err)
+		}
+		auth = smtp.PlainAuth("", smtpUser, smtpPassword, host)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(emailTo, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return sendMail(smtpServer, auth, from, emailTo, []byte(msg.String()))
+}
+
+// sendMail works like smtp.SendMail, but gives up after smtpTimeout or when
+// the recorder exits, so a server that does not answer cannot hold a
+// goroutine forever
+func sendMail(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP server address %q: %w", addr, err)
+	}
+	dialer := net.Dialer{Timeout: smtpTimeout}
+	conn, err := dialer.DialContext(shutdownCtx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+	stop := context.AfterFunc(shutdownCtx, func() { conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("the SMTP server %s does not support authentication", addr)
+		}
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// machineName returns the host name used to identify this machine in emails
+func machineName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "unknown-host"
+	}
+	return host
+}
+
+// alertFailure records a failure for the digest and sends an alert email
+// unless the same alert was already sent within the cooldown period
+func alertFailure(message string) {
+	now := time.Now()
+	lastFailure.Store(&failureRecord{Time: now, Message: message})
+
+	emitStatus(statusEvent{Event: "error", Time: now, Message: message})
+
+	digestStats.Lock()
+	pruneDigestStats(now)
+	if digestEnabled() {
+		digestStats.errors = append(digestStats.errors, errorRecord{time: now, message: message})
+	}
+	if digestStats.lastAlerts == nil {
+		digestStats.lastAlerts = make(map[string]time.Time)
+	}
+	last, seen := digestStats.lastAlerts[message]
+	throttled := seen && now.Sub(last) < alertCooldown
+	if !throttled {
+		digestStats.lastAlerts[message] = now
+	}
+	digestStats.Unlock()
+
+	if throttled {
+		return
+	}
+	subject := fmt.Sprintf("[screen-vibe] Recording failure on %s", machineName())
+	extensionsNotify(subject, message)
+	if !emailEnabled() {
+		return
+	}
+
+	go func() {
+		body := fmt.Sprintf("Screen Vibe reported a failure on %s at %s:\n\n%s\n",
+			machineName(), now.Format("2006-01-02 15:04:05"), message)
+		if err := sendEmail(subject, body); err != nil {
+			consoleWarn("Could not send alert email: %v", err)
+		}
+	}()
+}
+
+// recordSegmentStart marks the beginning of a recording segment
+func recordSegmentStart(start time.Time) {
+	digestStats.Lock()
+	digestStats.current = start
+	digestStats.Unlock()
+}
+
+// recordSegmentEnd stores a finished recording segment for the digest
+func recordSegmentEnd(file string, start, end time.Time) {
+	if !digestEnabled() {
+		return
+	}
+	var size int64
+	if fileInfo, err := os.Stat(file); err == nil {
+		size = fileInfo.Size()
+	}
+
+	digestStats.Lock()
+	pruneDigestStats(time.Now())
+	digestStats.segments = append(digestStats.segments, segmentRecord{file: file, start: start, end: end, size: size})
+	// With -overlap the next segment may have started already
+	if digestStats.current.Equal(start) {
+		digestStats.current = time.Time{}
+	}
+	digestStats.Unlock()
+}
+
+// startDigestScheduler sends the daily digest email at the configured time
+// of day, until the recorder exits
+func startDigestScheduler() {
+	go func() {
+		for {
+			next, err := nextDigestTime(time.Now())
+			if err != nil {
+				consoleWarn("Daily digest disabled: %v", err)
+				return
+			}
+			if !sleepOrShutdown(time.Until(next)) {
+				return
+			}
+
+			subject := fmt.Sprintf("[screen-vibe] Daily digest for %s", machineName())
+			if err := sendEmail(subject, buildDigest(time.Now())); err != nil {
+				consoleWarn("Could not send digest email: %v", err)
+			}
+		}
+	}()
+}
+
+// nextDigestTime returns the next occurrence of the configured digest time
+func nextDigestTime(now time.Time) (time.Time, error) {
+	t, err := time.Parse("15:04", digestTime)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid digest time %q, expected HH:MM", digestTime)
+	}
+	next := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next, nil
+}
+
+// buildDigest summarizes recorded time, total size, errors and coverage
+// gaps of the last digest period
+func buildDigest(now time.Time) string {
+	periodStart := now.Add(-digestPeriod)
+
+	digestStats.Lock()
+	pruneDigestStats(now)
+	segments := append([]segmentRecord(nil), digestStats.segments...)
+	errors := append([]errorRecord(nil), digestStats.errors...)
+
+	// Include the segment that is currently being recorded
+	periods := append([]segmentRecord(nil), segments...)
+	if !digestStats.current.IsZero() {
+		periods = append(periods, segmentRecord{start: digestStats.current, end: now})
+	}
+	digestStats.Unlock()
+
+	sort.Slice(periods, func(i, j int) bool { return periods[i].start.Before(periods[j].start) })
+
+	var recorded time.Duration
+	var totalSize int64
+	var gaps []segmentRecord
+	covered := periodStart
+	for _, p := range periods {
+		start, end := p.start, p.end
+		totalSize += p.size
+		if start.Sub(covered) > digestGapThreshold {
+			gaps = append(gaps, segmentRecord{start: covered, end: start})
+		}
+		// Segments of -overlap start before the previous one ended, the
+		// time both recorded counts once
+		if start.Before(covered) {
+			start = covered
+		}
+		if end.After(start) {
+			recorded += end.Sub(start)
+			covered = end
+		}
+	}
+	if now.Sub(covered) > digestGapThreshold {
+		gaps = append(gaps, segmentRecord{start: covered, end: now})
+	}
+
+	const layout = "2006-01-02 15:04:05"
+	var b strings.Builder
+	fmt.Fprintf(&b, "Screen Vibe daily digest for %s\n", machineName())
+	fmt.Fprintf(&b, "Period: %s - %s\n\n", periodStart.Format(layout), now.Format(layout))
+	fmt.Fprintf(&b, "Recorded time: %s\n", recorded.Round(time.Second))
+	fmt.Fprintf(&b, "Segments: %d\n", len(segments))
+	fmt.Fprintf(&b, "Total size: %s\n", formatFileSize(totalSize))
+	fmt.Fprintf(&b, "Errors: %d\n", len(errors))
+
+	fmt.Fprintf(&b, "\nCoverage gaps: %d\n", len(gaps))
+	for _, g := range gaps {
+		fmt.Fprintf(&b, "  - %s - %s (%s)\n", g.start.Format(layout), g.end.Format(layout), g.end.Sub(g.start).Round(time.Second))
+	}
+
+	if len(errors) > 0 {
+		b.WriteString("\nErrors:\n")
+		for _, e := range errors {
+			fmt.Fprintf(&b, "  - %s %s\n", e.time.Format(layout), e.message)
+		}
+	}
+	return b.String()
+}
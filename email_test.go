@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// useDigest turns the daily digest on with empty statistics
+func useDigest(t *testing.T) {
+	setGlobal(t, &smtpServer, "smtp.example.com:587")
+	setGlobal(t, &emailTo, []string{"ops@example.com"})
+	setGlobal(t, &digestTime, "08:00")
+	digestStats.segments, digestStats.errors, digestStats.current = nil, nil, time.Time{}
+	t.Cleanup(func() { digestStats.segments, digestStats.errors, digestStats.current = nil, nil, time.Time{} })
+}
+
+func TestDigestOverlap(t *testing.T) {
+	useDigest(t)
+	now := time.Now()
+	start := now.Add(-time.Hour)
+	// Three segments of -overlap, each starting 5 seconds before the previous
+	// one ended, and a gap of 10 minutes before the last one
+	for _, s := range []struct{ start, end time.Duration }{{0, 10 * time.Minute}, {10*time.Minute - 5*time.Second, 20 * time.Minute}, {30 * time.Minute, 40 * time.Minute}} {
+		recordSegmentEnd("segment.mkv", start.Add(s.start), start.Add(s.end))
+	}
+	digest := buildDigest(now)
+	for _, want := range []string{"Recorded time: 30m0s\n", "Segments: 3\n", "Coverage gaps: 3\n"} {
+		if !strings.Contains(digest, want) {
+			t.Errorf("digest without %q:\n%s", want, digest)
+		}
+	}
+}
+
+func TestDigestStatsWithoutDigest(t *testing.T) {
+	useDigest(t)
+	setGlobal(t, &digestTime, "")
+	setGlobal(t, &smtpServer, "")
+	recordSegmentEnd("segment.mkv", time.Now().Add(-time.Minute), time.Now())
+	alertFailure("disk full")
+	digestStats.Lock()
+	defer digestStats.Unlock()
+	if len(digestStats.segments) != 0 || len(digestStats.errors) != 0 {
+		t.Errorf("collected %d segments and %d errors without -digest", len(digestStats.segments), len(digestStats.errors))
+	}
+}
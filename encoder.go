@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// NVENC errors when no more encoder sessions can be opened, consumer GPUs
+// limit the number of concurrent sessions
+var nvencSessionLimitRe = regexp.MustCompile(`OpenEncodeSessionEx failed: (out of memory \(10\)|incompatible client key \(21\))|(?i)maximum number of (concurrent )?(encoder )?sessions`)
+
+// nvencUnavailable is set once NVENC refused to open a session, later
+// segments then use another encoder
+var nvencUnavailable atomic.Bool
+
+// checkEncoderError looks for encoder errors in a line of ffmpeg output
+func checkEncoderError(line string, log *slog.Logger) {
+	if nvencSessionLimitRe.MatchString(line) && !nvencUnavailable.Swap(true) {
+		consoleWarn("NVENC session limit reached, falling back to another encoder")
+		log.Warn("NVENC session limit reached, later segments use another encoder", "error", line)
+	}
+}
+
+// encoderFallback replaces NVENC encoders once NVENC reached its session
+// limit, with QuickSync on Intel GPUs and the CPU encoder otherwise
+func encoderFallback(encoder string, log *slog.Logger) string {
+	if !nvencUnavailable.Load() || !strings.HasSuffix(encoder, "_nvenc") {
+		return encoder
+	}
+	codec := strings.TrimSuffix(encoder, "_nvenc")
+	fallback := "libx264"
+	if codec == "hevc" {
+		fallback = "libx265"
+	}
+	if hasIntelGPU() {
+		fallback = codec + "_qsv"
+	}
+	log.Warn("NVENC is unavailable, using fallback encoder", "encoder", encoder, "fallback", fallback)
+	return fallback
+}
+
+// Speed/quality presets accepted by -preset, from fastest to best quality
+var presetNames = []string{"ultrafast", "superfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow"}
+
+// Native presets of the hardware encoders for each -preset, in the order of
+// presetNames. NVENC has p1 (fastest) to p7 (best quality), QuickSync lacks
+// the two fastest x264 presets and AMF only knows three quality levels.
+var (
+	nvencPresets = []string{"p1", "p2", "p3", "p3", "p4", "p4", "p5", "p6", "p7"}
+	qsvPresets   = []string{"veryfast", "veryfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow"}
+	amfQualities = []string{"speed", "speed", "speed", "speed", "balanced", "balanced", "quality", "quality", "quality"}
+)
+
+// checkPreset validates a -preset value
+func checkPreset(name string) error {
+	for _, p := range presetNames {
+		if p == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown preset %q, use one of %s", name, strings.Join(presetNames, ", "))
+}
+
+// presetArgs translates the -preset speed/quality knob into the preset
+// options of an encoder. VideoToolbox and VAAPI have no presets.
+func presetArgs(encoder, name string) []string {
+	i := 0
+	for i < len(presetNames) && presetNames[i] != name {
+		i++
+	}
+	if i == len(presetNames) {
+		return nil
+	}
+	switch {
+	case strings.HasSuffix(encoder, "_nvenc"):
+		return []string{"-preset", nvencPresets[i]}
+	case strings.HasSuffix(encoder, "_qsv"):
+		return []string{"-preset", qsvPresets[i]}
+	case strings.HasSuffix(encoder, "_amf"):
+		return []string{"-quality", amfQualities[i]}
+	case strings.HasSuffix(encoder, "_videotoolbox"), strings.HasSuffix(encoder, "_vaapi"):
+		return nil
+	}
+	return []string{"-preset", name}
+}
+
+// encoderOptions returns the output options of an encoder: codec, frame
+// rate, GOP, bitrate, profile, preset and level. They only depend on the
+// encoder, so every tuning flag behaves the same on every OS.
+func encoderOptions(encoder string, fps, bitrate int, log *slog.Logger) []string {
+	fpsStr := fmt.Sprintf("%d", fps)
+
+	// Calculate GOP size based on formula GOP = fps × 2
+	gopSize := fps * 2
+	log.Info("Setting GOP size", "fps", fps, "gopSize", gopSize)
+
+	// Create strings for bitrate settings
+	bitrateStr := fmt.Sprintf("%dk", bitrate)
+	maxrateStr := fmt.Sprintf("%dk", bitrate*2) // Max rate is 2x the target bitrate
+	bufsizeStr := fmt.Sprintf("%dk", bitrate*3) // Buffer size is 3x the target bitrate
+	log.Info("Setting bitrate parameters", "bitrate", bitrateStr, "maxrate", maxrateStr, "bufsize", bufsizeStr)
+
+	args := []string{
+		"-c:v", encoder,
+		"-r", fpsStr, // Explicit output framerate
+		"-g", fmt.Sprintf("%d", gopSize), // GOP size based on fps × 2
+		"-pix_fmt", "yuv420p", // More compatible pixel format
+		"-b:v", bitrateStr,
+		"-maxrate", maxrateStr,
+		"-bufsize", bufsizeStr,
+		"-profile:v", "main",
+	}
+	// Use the command line preset in the vocabulary of the encoder
+	args = append(args, presetArgs(encoder, segmentPreset())...)
+
+	if strings.Contains(encoder, "264") {
+		// H.264 specific options
+		args = append(args, "-level", "4.1") // Good compatibility level
+		if strings.Contains(encoder, "nvenc") {
+			// NVIDIA specific options
+			args = append(args, "-rc:v", "vbr_hq")
+		}
+	} else if !strings.Contains(encoder, "amf") && !strings.Contains(encoder, "qsv") {
+		// Add tag for better compatibility except for AMF and QSV encoders
+		args = append(args, "-tag:v", "hvc1")
+	}
+
+	return append(args, "-an") // No audio
+}
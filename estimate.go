@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// dailyRecordingBytes estimates what a day of recording takes on disk:
+// the bitrate of every -schedule window for its minutes of the day, the
+// -window recording, a camera track and the audio tracks. Encoders rarely
+// exceed the bitrate for long, a static desktop takes much less, and
+// application profiles, idle pauses and -dedupe are not foreseen.
+func dailyRecordingBytes() int64 {
+	videoStreams := 1
+	if cameraSource != "" && cameraLayout == "track" {
+		// -b:v applies to every video stream of the file
+		videoStreams = 2
+	}
+	var kbits int64
+	midnight := time.Date(2000, 1, 1, 0, 0, 0, 0, time.Local)
+	for minute := 0; minute < 24*60; minute++ {
+		kbps := bitrate
+		if w := scheduleWindowAt(midnight.Add(time.Duration(minute) * time.Minute)); w != nil && w.bitrate > 0 {
+			kbps = w.bitrate
+		}
+		kbits += int64(kbps*videoStreams) * 60
+	}
+	if windowTitle != "" {
+		kbits += int64(windowBitrate) * 24 * 60 * 60
+	}
+	if tracks := len(audioTracks()); tracks > 0 {
+		if tracks > 1 {
+			tracks++ // the mix
+		}
+		kbits += int64(tracks*audioKbps) * 24 * 60 * 60
+	}
+	return kbits * 1000 / 8
+}
+
+// existingDir returns dir, or its closest parent that exists, to measure
+// the free space of an output directory that is not created yet
+func existingDir(dir string) string {
+	dir, _ = filepath.Abs(dir)
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// keptRecordingBytes returns the size of the segments in the catalog that
+// are still on the disk, whose space is freed as they expire
+func keptRecordingBytes() int64 {
+	entries, err := readCatalog()
+	if err != nil {
+		return 0
+	}
+	var total int64
+	for _, e := range entries {
+		if info, err := os.Stat(filepath.Join(outputDir, filepath.FromSlash(e.File))); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+// checkStorage prints what the settings take on disk per hour and per day
+// and warns when they cannot fit: the segments kept for -retention or
+// -tier-after need more than the free space and what the expiring ones
+// free, or without either the disk fills up within a day
+func checkStorage() {
+	daily := dailyRecordingBytes()
+	consoleInfo("Estimated storage: up to %s per hour on average, %s per day", formatFileSize(daily/24), formatFileSize(daily))
+	free, err := diskFree(existingDir(outputDir))
+	if err != nil {
+		consoleWarn("Could not read the free space of %s: %v", outputDir, err)
+		return
+	}
+
+	kept := retention
+	if tierAfter > 0 {
+		kept = tierAfter
+	}
+	if kept > 0 {
+		needed := int64(float64(daily) * kept.Hours() / 24)
+		available := free + keptRecordingBytes()
+		if needed > available {
+			consoleWarn("%.0f days of recordings need up to %s, only %s is available in %s; lower -bitrate, add -schedule windows or shorten the period",
+				kept.Hours()/24, formatFileSize(needed), formatFileSize(available), outputDir)
+		}
+		return
+	}
+	days := float64(free) / float64(daily)
+	if days < 1 {
+		consoleWarn("The %s free in %s last about %s at this rate, set -retention or free some space",
+			formatFileSize(free), outputDir, time.Duration(days*24*float64(time.Hour)).Round(time.Minute))
+		return
+	}
+	consoleInfo("The %s free in %s last about %.0f days", formatFileSize(free), outputDir, days)
+}
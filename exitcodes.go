@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+// Exit codes of the recorder, so wrapper scripts and service managers can
+// tell failures that need a person from ones worth a restart
+const (
+	exitCleanStop          = 0 // stopped by a signal, a control command or the end of the run command
+	exitFailure            = 1 // any other error
+	exitConfigError        = 2 // invalid flags, environment or files named by flags
+	exitFFmpegMissing      = 3 // ffmpeg is not installed or not in the PATH
+	exitPermissionDenied   = 4 // the output or the capture device may not be used
+	exitEncoderUnavailable = 5 // ffmpeg lacks the encoder or muxer, or cannot open it
+	exitDiskFull           = 6 // no space left for the recording
+)
+
+// recorderExitCode is set by the first fatal error, the recorder then
+// stops instead of starting another segment and exits with it
+var recorderExitCode atomic.Int32
+
+// ffmpeg errors that make the recorder give up, in order of precedence
+var ffmpegFatalErrors = []struct {
+	re   *regexp.Regexp
+	code int
+}{
+	{regexp.MustCompile(`(?i)no space left on device|disk quota exceeded|there is not enough space on the disk`), exitDiskFull},
+	{regexp.MustCompile(`(?i)permission denied|operation not permitted|access is denied`), exitPermissionDenied},
+	{regexp.MustCompile(`Unknown encoder|Encoder not found|Error while opening encoder|No NVENC capable devices|Cannot load (nvcuda|libcuda)|Requested output format '\S+' is not|Unknown output format`), exitEncoderUnavailable},
+}
+
+// classifyFFmpegLine returns the exit code for a fatal error in a line of
+// ffmpeg output, 0 for other lines
+func classifyFFmpegLine(line string) int {
+	for _, e := range ffmpegFatalErrors {
+		if e.re.MatchString(line) {
+			return e.code
+		}
+	}
+	return 0
+}
+
+// ffmpegFailure remembers the first fatal error ffmpeg reported for a
+// segment
+type ffmpegFailure struct {
+	code atomic.Int32
+	line atomic.Pointer[string]
+}
+
+// check looks for a fatal error in a line of ffmpeg output
+func (f *ffmpegFailure) check(line string) {
+	if code := classifyFFmpegLine(line); code != 0 && f.code.CompareAndSwap(0, int32(code)) {
+		line = strings.TrimSpace(line)
+		f.line.Store(&line)
+	}
+}
+
+// error returns the exit code and the ffmpeg line of the fatal error, 0 if
+// there was none
+func (f *ffmpegFailure) error() (int, string) {
+	code := int(f.code.Load())
+	if code == 0 {
+		return 0, ""
+	}
+	return code, *f.line.Load()
+}
+
+// errorExitCode returns the exit code for an error of the recorder itself,
+// like creating the output directory or starting ffmpeg, 0 if it is not
+// fatal
+func errorExitCode(err error) int {
+	switch {
+	case errors.Is(err, syscall.ENOSPC):
+		return exitDiskFull
+	case errors.Is(err, fs.ErrPermission):
+		return exitPermissionDenied
+	case errors.Is(err, exec.ErrNotFound):
+		return exitFFmpegMissing
+	}
+	return 0
+}
+
+// stopWithExitCode makes the recorder stop after the current segment and
+// exit with code, the first fatal error wins
+func stopWithExitCode(code int, message string) {
+	if recorderExitCode.CompareAndSwap(0, int32(code)) {
+		consoleError("%s, stopping (exit code %d)", message, code)
+	}
+}
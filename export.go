@@ -0,0 +1,645 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Environment variable with the password of export packages
+	exportPasswordEnv = "SCREEN_VIBE_EXPORT_PASSWORD"
+	// Shortest password accepted for a new package
+	minExportPasswordLength = 12
+	// Start of every package file, followed by the salt and the PBKDF2
+	// iterations
+	packageMagic = "SVPKG1"
+	// PBKDF2-SHA256 iterations for new packages
+	packageKDFIterations = 600_000
+	// Iterations accepted when reading a package, the header is not
+	// authenticated until the key is derived, so a damaged or forged one
+	// must neither weaken the key nor keep the reader busy for hours
+	minPackageKDFIterations = packageKDFIterations / 4
+	maxPackageKDFIterations = packageKDFIterations * 16
+	// Plaintext bytes per encrypted chunk
+	packageChunkSize = 1 << 20
+	// Largest chunk a package may contain, plaintext plus the GCM tag
+	packageMaxChunk = packageChunkSize + 16
+	// Files added after the recordings, so their hashes cover what was
+	// actually written
+	packageManifestName = "manifest.json"
+	packageSumsName     = "SHA256SUMS"
+)
+
+// packageManifest describes an export package and its chain of custody
+type packageManifest struct {
+	Format    int            `json:"format"`
+	Case      string         `json:"case,omitempty"`
+	Recipient string         `json:"recipient,omitempty"`
+	Note      string         `json:"note,omitempty"`
+	From      *time.Time     `json:"from,omitempty"`
+	To        *time.Time     `json:"to,omitempty"`
+	Segments  []catalogEntry `json:"segments"`
+	Files     []packageFile  `json:"files"`
+	Custody   []custodyEvent `json:"custody"`
+}
+
+// packageFile is a file in an export package with its checksum
+type packageFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// custodyEvent records who handled the footage, when and where
+type custodyEvent struct {
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`
+	User    string    `json:"user"`
+	Machine string    `json:"machine"`
+	Program string    `json:"program"`
+	Source  string    `json:"source,omitempty"`
+}
+
+// packageKey derives the AES-256 key of a package from the password
+func packageKey(password string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce returns the GCM nonce of chunk n, which also keeps chunks from
+// being reordered
+func chunkNonce(n uint64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], n)
+	return nonce
+}
+
+// chunkData returns the additional data of a chunk: the package header and
+// whether it is the last chunk, so a cut off package does not verify
+func chunkData(header []byte, last bool) []byte {
+	flag := byte(0)
+	if last {
+		flag = 1
+	}
+	return append(append([]byte{}, header...), flag)
+}
+
+// packageWriter encrypts a stream into chunks of AES-256-GCM
+type packageWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	buf    []byte
+	n      uint64
+}
+
+// newPackageWriter writes the package header and returns the writer for
+// its content
+func newPackageWriter(w io.Writer, password string) (*packageWriter, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	header := append([]byte(packageMagic), salt...)
+	header = binary.BigEndian.AppendUint32(header, packageKDFIterations)
+	aead, err := packageKey(password, salt, packageKDFIterations)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &packageWriter{w: w, aead: aead, header: header, buf: make([]byte, 0, packageChunkSize)}, nil
+}
+
+func (p *packageWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		n := copy(p.buf[len(p.buf):cap(p.buf)], b)
+		p.buf = p.buf[:len(p.buf)+n]
+		b = b[n:]
+		written += n
+		if len(p.buf) == cap(p.buf) {
+			if err := p.seal(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close writes the last chunk, which may be empty
+func (p *packageWriter) Close() error {
+	return p.seal(true)
+}
+
+func (p *packageWriter) seal(last bool) error {
+	sealed := p.aead.Seal(nil, chunkNonce(p.n), p.buf, chunkData(p.header, last))
+	p.n++
+	p.buf = p.buf[:0]
+	if err := binary.Write(p.w, binary.BigEndian, uint32(len(sealed))); err != nil {
+		return err
+	}
+	_, err := p.w.Write(sealed)
+	return err
+}
+
+// packageReader decrypts the content of a package and fails on anything
+// changed, reordered or cut off
+type packageReader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	header []byte
+	buf    []byte
+	n      uint64
+	done   bool
+}
+
+// newPackageReader reads the package header and returns the reader for its
+// content
+func newPackageReader(r io.Reader, password string) (*packageReader, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(packageMagic)+16+4)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:len(packageMagic)]) != packageMagic {
+		return nil, errors.New("not a screen-vibe export package")
+	}
+	iterations := binary.BigEndian.Uint32(header[len(header)-4:])
+	if iterations < minPackageKDFIterations || iterations > maxPackageKDFIterations {
+		return nil, errors.New("the package is damaged")
+	}
+	aead, err := packageKey(password, header[len(packageMagic):len(packageMagic)+16], int(iterations))
+	if err != nil {
+		return nil, err
+	}
+	return &packageReader{r: br, aead: aead, header: header}, nil
+}
+
+func (p *packageReader) Read(b []byte) (int, error) {
+	for len(p.buf) == 0 {
+		if p.done {
+			return 0, io.EOF
+		}
+		if err := p.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, p.buf)
+	p.buf = p.buf[n:]
+	return n, nil
+}
+
+func (p *packageReader) open() error {
+	var size uint32
+	if err := binary.Read(p.r, binary.BigEndian, &size); err != nil {
+		return errors.New("the package is cut off")
+	}
+	if size > packageMaxChunk {
+		return errors.New("the package is damaged")
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(p.r, sealed); err != nil {
+		return errors.New("the package is cut off")
+	}
+	// Only the last chunk is shorter than a full one, it may be empty
+	last := size < packageMaxChunk
+	plain, err := p.aead.Open(nil, chunkNonce(p.n), sealed, chunkData(p.header, last))
+	if err != nil {
+		if p.n == 0 {
+			return errors.New("wrong password or damaged package")
+		}
+		return fmt.Errorf("the package is damaged at chunk %d", p.n)
+	}
+	p.n++
+	p.buf = plain
+	if last {
+		p.done = true
+		if _, err := p.r.ReadByte(); err != io.EOF {
+			return errors.New("the package has data after its end")
+		}
+	}
+	return nil
+}
+
+// exportSelection returns the catalog entries to export: the given files,
+// or the segments overlapping from-to
+func exportSelection(entries []catalogEntry, files []string, from, to time.Time) ([]catalogEntry, error) {
+	var selected []catalogEntry
+	if len(files) > 0 {
+		byFile := map[string]catalogEntry{}
+		for _, e := range entries {
+			byFile[filepath.ToSlash(e.File)] = e
+		}
+		for _, f := range files {
+			e, ok := byFile[filepath.ToSlash(relativeToOutput(f))]
+			if !ok {
+				e, ok = byFile[filepath.ToSlash(f)]
+			}
+			if !ok {
+				return nil, fmt.Errorf("%s is not in the catalog", f)
+			}
+			selected = append(selected, e)
+		}
+		return selected, nil
+	}
+	for _, e := range entries {
+		if (from.IsZero() || e.End.After(from)) && (to.IsZero() || e.Start.Before(to)) {
+			selected = append(selected, e)
+		}
+	}
+	return selected, nil
+}
+
+// parseExportTime parses -from and -to, in local time unless a zone is given
+func parseExportTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use 2006-01-02 15:04 or RFC 3339", value)
+}
+
+// addPackageFile copies a file into the package and returns its checksum
+func addPackageFile(tw *tar.Writer, name, src string) (packageFile, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return packageFile{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return packageFile{}, err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime()}); err != nil {
+		return packageFile{}, err
+	}
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tw, hash), f)
+	if err != nil {
+		return packageFile{}, err
+	}
+	if n != info.Size() {
+		return packageFile{}, fmt.Errorf("%s changed while it was exported", src)
+	}
+	return packageFile{Name: name, Size: n, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// addPackageData adds a file written by the export itself
+func addPackageData(tw *tar.Writer, name string, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// writePackage writes the segments with their logs and transcripts, the
+// manifest and a SHA256SUMS file into an encrypted package
+func writePackage(out string, password string, manifest packageManifest) (err error) {
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(out)
+		}
+	}()
+	pw, err := newPackageWriter(f, password)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(pw)
+
+	// Recordings keep their path below the output directory
+	for _, e := range manifest.Segments {
+		for _, name := range []string{e.File, e.Log, e.Transcript} {
+			if name == "" {
+				continue
+			}
+			src := filepath.Join(outputDir, name)
+			_, statErr := os.Stat(src)
+			switch {
+			case name != e.File && os.IsNotExist(statErr):
+				// Logs and transcripts may have been cleaned up
+				continue
+			case e.Remote != "" && os.IsNotExist(statErr):
+				return fmt.Errorf("%s is in cold storage, fetch it with screen-vibe ctl fetch %s", name, name)
+			case e.Storage != "" && os.IsNotExist(statErr):
+				return fmt.Errorf("%s was recorded to %s, copy it to %s first", name, e.Storage, src)
+			}
+			file, err := addPackageFile(tw, path.Join("segments", filepath.ToSlash(name)), src)
+			if err != nil {
+				return err
+			}
+			manifest.Files = append(manifest.Files, file)
+			consoleEvent("Added %s (%s)", name, formatFileSize(file.Size))
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := addPackageData(tw, packageManifestName, data); err != nil {
+		return err
+	}
+	var sums strings.Builder
+	for _, file := range manifest.Files {
+		fmt.Fprintf(&sums, "%s  %s\n", file.SHA256, file.Name)
+	}
+	manifestSum := sha256.Sum256(data)
+	fmt.Fprintf(&sums, "%s  %s\n", hex.EncodeToString(manifestSum[:]), packageManifestName)
+	if err := addPackageData(tw, packageSumsName, []byte(sums.String())); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := pw.Close(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// verifyPackage decrypts a package, checks every file against the manifest
+// and extracts the files to dir if it is not empty
+func verifyPackage(pkg, password, dir string) (*packageManifest, error) {
+	f, err := os.Open(pkg)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	pr, err := newPackageReader(f, password)
+	if err != nil {
+		return nil, err
+	}
+
+	sums := map[string]packageFile{}
+	var manifest *packageManifest
+	var manifestData []byte
+	tr := tar.NewReader(pr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !filepath.IsLocal(hdr.Name) {
+			return nil, fmt.Errorf("the package contains the unsafe path %q", hdr.Name)
+		}
+		var w io.Writer = io.Discard
+		var outFile *os.File
+		if dir != "" {
+			target := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return nil, err
+			}
+			if outFile, err = os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644); err != nil {
+				return nil, err
+			}
+			w = outFile
+		}
+		hash := sha256.New()
+		var content strings.Builder
+		writers := []io.Writer{w, hash}
+		if hdr.Name == packageManifestName {
+			writers = append(writers, &content)
+		}
+		n, err := io.Copy(io.MultiWriter(writers...), tr)
+		if outFile != nil {
+			if closeErr := outFile.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		sums[hdr.Name] = packageFile{Name: hdr.Name, Size: n, SHA256: hex.EncodeToString(hash.Sum(nil))}
+		if hdr.Name == packageManifestName {
+			manifestData = []byte(content.String())
+		}
+	}
+
+	if manifestData == nil {
+		return nil, errors.New("the package has no manifest")
+	}
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	for _, want := range manifest.Files {
+		got, ok := sums[want.Name]
+		switch {
+		case !ok:
+			return manifest, fmt.Errorf("%s is missing", want.Name)
+		case got.Size != want.Size || got.SHA256 != want.SHA256:
+			return manifest, fmt.Errorf("%s does not match its checksum", want.Name)
+		}
+		delete(sums, want.Name)
+	}
+	delete(sums, packageManifestName)
+	delete(sums, packageSumsName)
+	for name := range sums {
+		return manifest, fmt.Errorf("%s is not listed in the manifest", name)
+	}
+	return manifest, nil
+}
+
+// printCustody prints what a package contains and who handled it
+func printCustody(m *packageManifest) {
+	if m.Case != "" {
+		fmt.Printf("Case:       %s\n", m.Case)
+	}
+	if m.Recipient != "" {
+		fmt.Printf("Recipient:  %s\n", m.Recipient)
+	}
+	if m.Note != "" {
+		fmt.Printf("Note:       %s\n", m.Note)
+	}
+	var total int64
+	for _, f := range m.Files {
+		total += f.Size
+	}
+	fmt.Printf("Contents:   %d segments, %d files, %s\n", len(m.Segments), len(m.Files), formatFileSize(total))
+	for _, e := range m.Custody {
+		fmt.Printf("Custody:    %s %s by %s on %s (%s)\n", e.Time.Local().Format("2006-01-02 15:04:05 MST"), e.Action, e.User, e.Machine, e.Program)
+	}
+}
+
+// runExportCommand writes recordings into a password protected package
+// for third parties, or checks and extracts such a package
+func runExportCommand(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	packageFlag := fs.String("package", "", "Write the selected segments into this password protected package")
+	fromFlag := fs.String("from", "", "Export the segments from this time (e.g. \"2024-05-01 09:00\")")
+	toFlag := fs.String("to", "", "Export the segments until this time")
+	caseFlag := fs.String("case", "", "Case or reference number stored in the package")
+	recipientFlag := fs.String("recipient", "", "Who the package is handed to, stored in the package")
+	noteFlag := fs.String("note", "", "Reason for the export, stored in the package")
+	verifyFlag := fs.String("verify", "", "Check this package against its manifest and print its chain of custody")
+	extractFlag := fs.String("extract", "", "With -verify: also extract the files into this new directory")
+	outputDirFlag := fs.String("output", outputDir, "Directory that holds the recordings and the catalog")
+	envUsage(fs)
+	if err := applyFlagEnv(fs); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	fs.Parse(args)
+	outputDir = *outputDirFlag
+
+	password := os.Getenv(exportPasswordEnv)
+	if password == "" {
+		consoleError("Set the package password in %s", exportPasswordEnv)
+		return 2
+	}
+
+	if *verifyFlag != "" {
+		if *extractFlag != "" {
+			if _, err := os.Stat(*extractFlag); err == nil {
+				consoleError("%s already exists, extract into a new directory", *extractFlag)
+				return 2
+			}
+		}
+		manifest, err := verifyPackage(*verifyFlag, password, *extractFlag)
+		if manifest != nil {
+			printCustody(manifest)
+		}
+		if err != nil {
+			consoleError("Verification failed: %v", err)
+			return 1
+		}
+		consoleInfo("All %d files match their checksums", len(manifest.Files))
+		if *extractFlag != "" {
+			consoleInfo("Extracted to %s", *extractFlag)
+		}
+		return 0
+	}
+
+	if *packageFlag == "" {
+		consoleInfo("Usage: screen-vibe export -package out.svpkg [-from time] [-to time] [flags] [segment files...]")
+		consoleInfo("       screen-vibe export -verify in.svpkg [-extract dir]")
+		return 2
+	}
+	if len(password) < minExportPasswordLength {
+		consoleError("The package password must have at least %d characters", minExportPasswordLength)
+		return 2
+	}
+	from, err := parseExportTime(*fromFlag)
+	if err == nil {
+		var to time.Time
+		to, err = parseExportTime(*toFlag)
+		if err == nil && fs.NArg() == 0 && from.IsZero() && to.IsZero() {
+			err = errors.New("select the segments with -from and -to or by file")
+		}
+		if err == nil {
+			err = exportPackage(*packageFlag, password, fs.Args(), from, to, *caseFlag, *recipientFlag, *noteFlag)
+		}
+	}
+	if err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	return 0
+}
+
+// exportPackage selects the segments from the catalog and writes them into
+// a package with the export as first custody event
+func exportPackage(out, password string, files []string, from, to time.Time, caseID, recipient, note string) error {
+	if err := openCatalog(); err != nil {
+		return err
+	}
+	entries, err := readAnnotatedCatalog()
+	if err != nil {
+		return fmt.Errorf("could not read catalog: %v", err)
+	}
+	segments, err := exportSelection(entries, files, from, to)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		return errors.New("no segments match the selection")
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].Start.Before(segments[j].Start) })
+
+	manifest := packageManifest{
+		Format:    1,
+		Case:      caseID,
+		Recipient: recipient,
+		Note:      note,
+		Segments:  segments,
+		Files:     []packageFile{},
+		Custody: []custodyEvent{{
+			Time:    time.Now().UTC(),
+			Action:  "exported",
+			User:    loginUser(),
+			Machine: machineName(),
+			Program: "screen-vibe " + version,
+			Source:  outputDir,
+		}},
+	}
+	if !from.IsZero() {
+		manifest.From = &from
+	}
+	if !to.IsZero() {
+		manifest.To = &to
+	}
+	consoleInfo("Exporting %d segments to %s", len(segments), out)
+	if err := writePackage(out, password, manifest); err != nil {
+		return err
+	}
+	exported := make([]string, 0, len(segments))
+	for _, e := range segments {
+		exported = append(exported, e.File)
+	}
+	logAccess("export", exportDetail(out, caseID, recipient), exported...)
+	consoleInfo("Wrote %s, check it with screen-vibe export -verify %s", out, out)
+	return nil
+}
+
+// exportDetail describes an export in the access log
+func exportDetail(out, caseID, recipient string) string {
+	detail := "package " + filepath.Base(out)
+	if caseID != "" {
+		detail += ", case " + caseID
+	}
+	if recipient != "" {
+		detail += ", for " + recipient
+	}
+	return detail
+}
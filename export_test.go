@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+)
+
+const testPackagePassword = "correct horse battery"
+
+// sealTestPackage encrypts plain into a package
+func sealTestPackage(t *testing.T, plain []byte) []byte {
+	t.Helper()
+	var sealed bytes.Buffer
+	w, err := newPackageWriter(&sealed, testPackagePassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return sealed.Bytes()
+}
+
+// openTestPackage decrypts a package with password
+func openTestPackage(sealed []byte, password string) ([]byte, error) {
+	r, err := newPackageReader(bytes.NewReader(sealed), password)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// packageChunks returns the offsets of the chunks of a package, after the
+// header
+func packageChunks(sealed []byte) []int {
+	var offsets []int
+	for off := len(packageMagic) + 16 + 4; off < len(sealed); off += 4 + int(binary.BigEndian.Uint32(sealed[off:])) {
+		offsets = append(offsets, off)
+	}
+	return offsets
+}
+
+func TestPackageRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 100, packageChunkSize, 2*packageChunkSize + 12345} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+		sealed := sealTestPackage(t, plain)
+		if n := len(packageChunks(sealed)); n != size/packageChunkSize+1 {
+			t.Errorf("%d bytes sealed in %d chunks", size, n)
+		}
+		got, err := openTestPackage(sealed, testPackagePassword)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Fatalf("%d bytes came back as %d different ones", size, len(got))
+		}
+	}
+}
+
+func TestPackageDamaged(t *testing.T) {
+	plain := make([]byte, 2*packageChunkSize+100)
+	rand.Read(plain)
+	sealed := sealTestPackage(t, plain)
+	chunks := packageChunks(sealed)
+	if len(chunks) != 3 {
+		t.Fatalf("%d chunks, want 3", len(chunks))
+	}
+	damage := func(name, want string, change func([]byte) []byte) {
+		t.Run(name, func(t *testing.T) {
+			got, err := openTestPackage(change(bytes.Clone(sealed)), testPackagePassword)
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Fatalf("read %d bytes with error %v, want %q", len(got), err, want)
+			}
+		})
+	}
+	damage("flipped byte", "damaged at chunk 1", func(b []byte) []byte {
+		b[chunks[1]+4+1000] ^= 1
+		return b
+	})
+	damage("swapped chunks", "wrong password or damaged package", func(b []byte) []byte {
+		first := bytes.Clone(b[chunks[0]:chunks[1]])
+		copy(b[chunks[0]:], b[chunks[1]:chunks[2]])
+		copy(b[chunks[1]:], first)
+		return b
+	})
+	damage("truncated last chunk", "cut off", func(b []byte) []byte {
+		return b[:len(b)-10]
+	})
+	// Without its last chunk the package ends in a full chunk, which was not
+	// sealed as the last one
+	damage("removed last chunk", "cut off", func(b []byte) []byte {
+		return b[:chunks[2]]
+	})
+	damage("shortened chunk", "damaged at chunk 1", func(b []byte) []byte {
+		// A full chunk passed off as the last one by its length
+		binary.BigEndian.PutUint32(b[chunks[1]:], packageMaxChunk-1)
+		return append(b[:chunks[1]+4+packageMaxChunk-1:chunks[1]+4+packageMaxChunk-1], b[chunks[2]:]...)
+	})
+	damage("data after the end", "data after its end", func(b []byte) []byte {
+		return append(b, 0)
+	})
+}
+
+func TestPackageWrongPassword(t *testing.T) {
+	sealed := sealTestPackage(t, []byte("segment"))
+	if _, err := openTestPackage(sealed, "battery staple horse"); err == nil || !strings.Contains(err.Error(), "wrong password") {
+		t.Fatalf("opened with a wrong password: %v", err)
+	}
+	if _, err := openTestPackage(sealed[:10], testPackagePassword); err == nil || !strings.Contains(err.Error(), "not a screen-vibe export package") {
+		t.Fatalf("opened a cut off header: %v", err)
+	}
+}
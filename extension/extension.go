@@ -0,0 +1,114 @@
+// Package extension is the interface between screen-vibe and integrations
+// that live outside the core, like uploaders to S3, cold storage on SFTP,
+// MQTT notifiers or OCR indexers.
+//
+// An extension registers itself from an init function and implements any
+// of the optional interfaces below, the recorder calls whatever it finds:
+//
+//	func init() {
+//		extension.Register(&myUploader{})
+//	}
+//
+// Extensions are compiled into the binary by importing them from a file of
+// the main package, e.g. extensions_s3.go:
+//
+//	import _ "example.com/screen-vibe-s3"
+//
+// They read their settings from their own SCREEN_VIBE_* environment
+// variables.
+package extension
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// Extension is the base interface of every extension
+type Extension interface {
+	// Name identifies the extension in the recorder's output
+	Name() string
+}
+
+// Segment describes a recording segment. Paths are as the recorder wrote
+// them, relative to its working directory unless -output is absolute.
+type Segment struct {
+	File    string
+	Log     string
+	Start   time.Time
+	End     time.Time // zero while recording
+	Size    int64
+	User    string
+	Display string
+	Encoder string
+}
+
+// Initializer is implemented by extensions that need to set up before
+// recording starts. An extension that fails to initialize is disabled.
+type Initializer interface {
+	Init() error
+}
+
+// Lifecycle hooks, called synchronously by the recorder. They must return
+// quickly, slow work belongs in an Uploader or a goroutine.
+type (
+	RecorderStartedHook interface{ RecorderStarted() }
+	SegmentStartedHook  interface{ SegmentStarted(Segment) }
+	SegmentFinishedHook interface{ SegmentFinished(Segment) }
+	RecorderStoppedHook interface{ RecorderStopped() }
+)
+
+// Uploader copies finished segments somewhere else. Uploads run in the
+// background and the recorder waits for them before exiting.
+type Uploader interface {
+	Upload(ctx context.Context, segment Segment) error
+}
+
+// ColdStorage keeps the segments that -tier-after moves off the machine.
+// Store copies a finished file and returns where it went, Retrieve copies
+// it from there back to file.
+type ColdStorage interface {
+	Store(ctx context.Context, file string) (location string, err error)
+	Retrieve(ctx context.Context, location, file string) error
+}
+
+// Storage writes the segments of -o <scheme>://... to a remote target
+// while they are recorded, for machines without the disk space to keep
+// them, e.g. as S3 multipart uploads. Create starts the file name, a slash
+// separated path, under the URL of the -o flag and returns where it goes;
+// Close completes the file. A segment whose Close fails is lost.
+type Storage interface {
+	Scheme() string
+	Create(ctx context.Context, url, name string) (w io.WriteCloser, location string, err error)
+}
+
+// Notifier delivers failure alerts, next to the alert emails
+type Notifier interface {
+	Notify(ctx context.Context, subject, message string) error
+}
+
+// Catalog receives every finished segment after it was added to the
+// recorder's own catalog, e.g. to index it in a database
+type Catalog interface {
+	Add(ctx context.Context, segment Segment) error
+}
+
+var (
+	mu         sync.Mutex
+	extensions []Extension
+)
+
+// Register adds an extension, usually from an init function
+func Register(e Extension) {
+	mu.Lock()
+	defer mu.Unlock()
+	extensions = append(extensions, e)
+}
+
+// Registered returns the registered extensions in registration order
+func Registered() []Extension {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]Extension(nil), extensions...)
+}
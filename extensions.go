@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"screen-vibe/extension"
+)
+
+const (
+	// Time an extension gets to upload a segment
+	extensionUploadTimeout = 30 * time.Minute
+	// Time an extension gets to deliver an alert or catalog a segment
+	extensionCallTimeout = 30 * time.Second
+)
+
+// activeExtensions are the registered extensions that initialized
+var activeExtensions []extension.Extension
+
+// startExtensions initializes the extensions compiled into the binary
+func startExtensions() {
+	for _, ext := range extension.Registered() {
+		if init, ok := ext.(extension.Initializer); ok {
+			if err := init.Init(); err != nil {
+				consoleWarn("Extension %s disabled: %v", ext.Name(), err)
+				continue
+			}
+		}
+		activeExtensions = append(activeExtensions, ext)
+		consoleInfo("Extension %s enabled", ext.Name())
+	}
+	for _, ext := range activeExtensions {
+		if hook, ok := ext.(extension.RecorderStartedHook); ok {
+			hook.RecorderStarted()
+		}
+	}
+}
+
+// stopExtensions tells the extensions that the recorder stops
+func stopExtensions() {
+	for _, ext := range activeExtensions {
+		if hook, ok := ext.(extension.RecorderStoppedHook); ok {
+			hook.RecorderStopped()
+		}
+	}
+}
+
+// extensionSegment converts a segment for the extensions
+func extensionSegment(e catalogEntry, file, log string) extension.Segment {
+	return extension.Segment{
+		File:    file,
+		Log:     log,
+		Start:   e.Start,
+		End:     e.End,
+		Size:    e.Size,
+		User:    e.User,
+		Display: e.Display,
+		Encoder: e.Encoder,
+	}
+}
+
+// extensionsSegmentStarted calls the segment started hooks
+func extensionsSegmentStarted(segment extension.Segment) {
+	for _, ext := range activeExtensions {
+		if hook, ok := ext.(extension.SegmentStartedHook); ok {
+			hook.SegmentStarted(segment)
+		}
+	}
+}
+
+// extensionsSegmentFinished hands a finished segment to the hooks, catalogs
+// and uploaders of the extensions
+func extensionsSegmentFinished(segment extension.Segment) {
+	for _, ext := range activeExtensions {
+		if hook, ok := ext.(extension.SegmentFinishedHook); ok {
+			hook.SegmentFinished(segment)
+		}
+		if catalog, ok := ext.(extension.Catalog); ok {
+			ctx, cancel := context.WithTimeout(uploadsCtx, extensionCallTimeout)
+			if err := catalog.Add(ctx, segment); err != nil {
+				consoleWarn("Extension %s could not catalog %s: %v", ext.Name(), segment.File, err)
+			}
+			cancel()
+		}
+	}
+	// Remote segments are not on the machine to upload
+	if remoteOutput == "" {
+		extensionsUpload(segment)
+	}
+}
+
+// extensionsUpload hands a segment to the uploaders of the extensions in the
+// background and returns how many there are
+func extensionsUpload(segment extension.Segment) int {
+	uploaders := 0
+	for _, ext := range activeExtensions {
+		uploader, ok := ext.(extension.Uploader)
+		if !ok {
+			continue
+		}
+		uploaders++
+		segmentJobs.Add(1)
+		go func() {
+			defer segmentJobs.Done()
+			ctx, cancel := context.WithTimeout(uploadsCtx, extensionUploadTimeout)
+			defer cancel()
+			if err := uploader.Upload(ctx, segment); err != nil {
+				consoleWarn("Extension %s could not upload %s: %v", ext.Name(), segment.File, err)
+				return
+			}
+			consoleEvent("Extension %s uploaded %s", ext.Name(), segment.File)
+		}()
+	}
+	return uploaders
+}
+
+// extensionsNotify sends an alert through the notifiers of the extensions
+func extensionsNotify(subject, message string) {
+	for _, ext := range activeExtensions {
+		notifier, ok := ext.(extension.Notifier)
+		if !ok {
+			continue
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), extensionCallTimeout)
+			defer cancel()
+			if err := notifier.Notify(ctx, subject, message); err != nil {
+				consoleWarn("Extension %s could not send the alert: %v", ext.Name(), err)
+			}
+		}()
+	}
+}
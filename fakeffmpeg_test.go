@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The test binary stands in for ffmpeg when this variable holds the
+// directory of the fake, see fakeFFmpeg
+const fakeFFmpegEnv = "SCREEN_VIBE_FAKE_FFMPEG"
+
+const (
+	// The fake writes a chunk of the recording every tick
+	fakeFFmpegTick  = 50 * time.Millisecond
+	fakeFFmpegChunk = 8 << 10
+	// Longest run of the fake, so a test that never stops it cannot hang
+	fakeFFmpegLimit = time.Minute
+)
+
+// fakeFFmpegRunner runs the test binary as ffmpeg
+type fakeFFmpegRunner struct{}
+
+func (fakeFFmpegRunner) command(args ...string) *exec.Cmd {
+	return exec.Command(os.Args[0], args...)
+}
+
+// fakeFFmpeg is the scripted ffmpeg of the tests. It adds its arguments to
+// runs.log in the directory of fakeFFmpegEnv and follows the line of the
+// file script for its run, the first line for the first run:
+//
+//	record         write to the last argument until 'q' arrives (the default)
+//	crash <after>  record, then exit with code 3 after the duration
+//
+// While recording it writes fakeFFmpegChunk bytes and a progress line every
+// fakeFFmpegTick. On 'q' it adds the number of its run to quits.log and
+// exits like ffmpeg after finishing the file. Copies of a file that is cut
+// with -t are not runs, see fakeFFmpegTrim.
+func fakeFFmpeg(dir string, args []string) int {
+	if slices.Contains(args, "-t") && slices.Contains(args, "copy") {
+		return fakeFFmpegTrim(dir, args)
+	}
+	runs, err := os.OpenFile(filepath.Join(dir, "runs.log"), os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintln(runs, strings.Join(args, " "))
+	runs.Close()
+	logged, _ := os.ReadFile(filepath.Join(dir, "runs.log"))
+	run := strings.Count(string(logged), "\n")
+
+	action := "record"
+	if script, err := os.ReadFile(filepath.Join(dir, "script")); err == nil {
+		if lines := strings.Split(strings.TrimSpace(string(script)), "\n"); run <= len(lines) {
+			action = lines[run-1]
+		}
+	}
+	var crash <-chan time.Time
+	if after, ok := strings.CutPrefix(action, "crash "); ok {
+		d, err := time.ParseDuration(after)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		crash = time.After(d)
+	}
+
+	out, err := os.OpenFile(args[len(args)-1], os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer out.Close()
+
+	quit := make(chan struct{})
+	go func() {
+		r := bufio.NewReader(os.Stdin)
+		for {
+			b, err := r.ReadByte()
+			if err != nil {
+				return
+			}
+			if b == 'q' {
+				close(quit)
+				return
+			}
+		}
+	}()
+
+	fmt.Fprintf(os.Stderr, "Input #0, fake, from 'screen':\n  Duration: N/A, start: %.6f, bitrate: N/A\n", float64(time.Now().UnixMicro())/1e6)
+	chunk := make([]byte, fakeFFmpegChunk)
+	ticker := time.NewTicker(fakeFFmpegTick)
+	defer ticker.Stop()
+	limit := time.After(fakeFFmpegLimit)
+	start := time.Now()
+	var frame, size int
+	for {
+		n, _ := out.Write(chunk)
+		frame, size = frame+1, size+n
+		elapsed := time.Since(start)
+		kbps := float64(size) * 8 / 1000 / max(elapsed.Seconds(), fakeFFmpegTick.Seconds())
+		fmt.Fprintf(os.Stderr, "frame=%5d fps=20 q=28.0 size=%8dkB time=%s bitrate=%6.1fkbits/s speed=1.00x\r",
+			frame, size>>10, fakeFFmpegTime(elapsed), kbps)
+		select {
+		case <-ticker.C:
+		case <-quit:
+			f, _ := os.OpenFile(filepath.Join(dir, "quits.log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+			fmt.Fprintln(f, run)
+			f.Close()
+			fmt.Fprintln(os.Stderr)
+			return 0
+		case <-crash:
+			fmt.Fprintln(os.Stderr, "\nfake ffmpeg crashed")
+			return 3
+		case <-limit:
+			return 2
+		}
+	}
+}
+
+// fakeFFmpegTrim cuts the input file to the chunks the fake recorded in
+// the time of -t, and adds its arguments to trims.log
+func fakeFFmpegTrim(dir string, args []string) int {
+	trims, err := os.OpenFile(filepath.Join(dir, "trims.log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintln(trims, strings.Join(args, " "))
+	trims.Close()
+	input := args[slices.Index(args, "-i")+1]
+	length, err := time.ParseDuration(args[slices.Index(args, "-t")+1] + "s")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	data, err := os.ReadFile(input)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	keep := (int(length/fakeFFmpegTick) + 1) * fakeFFmpegChunk
+	if err := os.WriteFile(args[len(args)-1], data[:min(keep, len(data))], 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// fakeFFmpegTime formats d like the time of ffmpeg's progress lines
+func fakeFFmpegTime(d time.Duration) string {
+	h, m := int(d.Hours()), int(d.Minutes())%60
+	s := d.Seconds() - float64(h*3600+m*60)
+	return fmt.Sprintf("%02d:%02d:%05.2f", h, m, s)
+}
+
+// fakeFFmpegRuns returns the runs of the fake so far and the runs that
+// stopped on 'q'
+func fakeFFmpegRuns(dir string) (runs []string, quits []int) {
+	if data, err := os.ReadFile(filepath.Join(dir, "runs.log")); err == nil {
+		runs = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "quits.log")); err == nil {
+		for _, line := range strings.Fields(string(data)) {
+			n, _ := strconv.Atoi(line)
+			quits = append(quits, n)
+		}
+	}
+	return runs, quits
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// captureRegion is the rectangle of -region, relative to the top left of
+// the captured display, nil to capture all of it
+var captureRegion *screenRect
+
+// Offset of an X11 display like :0.0+1920,0
+var x11OffsetRe = regexp.MustCompile(`\+(\d+),(\d+)$`)
+
+// ffmpegArgs is an ffmpeg command line built in stages. Each stage is filled
+// on its own and list joins them in the order ffmpeg expects, so an option
+// added to one stage applies to every OS and encoder.
+type ffmpegArgs struct {
+	input       []string // screen capture input with its options
+	extraInputs []string // overlay inputs, e.g. the watermark image
+	filter      []string // filter graph between the inputs and the encoder
+	codec       []string // encoder options
+	output      []string // muxer and targets of the recording
+}
+
+// list returns the ffmpeg arguments of all stages
+func (a ffmpegArgs) list() []string {
+	var args []string
+	for _, stage := range [][]string{a.input, a.extraInputs, a.filter, a.codec, a.output} {
+		args = append(args, stage...)
+	}
+	return args
+}
+
+// recordingArgs builds the ffmpeg arguments of a recording segment on goos
+func recordingArgs(goos, encoder, device, videoFile string, fps int, blurs []*blurRegion, gpuFrames bool, log *slog.Logger) ffmpegArgs {
+	var a ffmpegArgs
+	a.input = captureInputArgs(goos, device, fps, log)
+	if gpuFrames {
+		a.input = zeroCopyInputArgs(goos, device, fps)
+	}
+
+	// Use the wall clock time of each captured frame as its timestamp
+	if wallclockTimestamps {
+		a.input = append([]string{"-use_wallclock_as_timestamps", "1"}, a.input...)
+	}
+
+	// With -zero-copy the frames go from the capture to the encoder on the
+	// GPU, segments that need CPU filters do not get here
+	if gpuFrames {
+		a.filter = zeroCopyFilter(goos, encoder)
+		a.codec = withoutPixFmt(encoderOptions(encoder, fps, segmentBitrate(), log))
+		a.output = outputTargetArgs(videoFile, false)
+		return a
+	}
+
+	// Blurs and watermark overlays need a filter graph between the capture
+	// input and the encoder settings, image watermarks also their own
+	// inputs. Watermarks go over the blurs so they stay readable.
+	var graph []string
+	input := "[0:v]"
+	var capture []string
+	if goos == "linux" && linuxCapture == "kmsgrab" {
+		// kmsgrab hands over DRM frames, the filters need them in memory
+		capture = append(capture, "hwdownload", "format=bgr0")
+	}
+	if captureRegion != nil && (goos == "darwin" || goos == "linux" && linuxCapture != "") {
+		// avfoundation, the screen cast and kmsgrab capture whole
+		// displays, the region is cut out first so the blurs are relative
+		// to it like on the other OSes
+		capture = append(capture, regionCrop(*captureRegion))
+	}
+	if len(capture) > 0 {
+		graph = append(graph, fmt.Sprintf("%s%s[sv_capture]", input, strings.Join(capture, ",")))
+		input = "[sv_capture]"
+	}
+	blurFilters, label := blurGraph(blurs, input)
+	graph = append(graph, blurFilters...)
+	if crop := profileCrop(); crop != "" {
+		// After the blurs, whose regions are screen coordinates
+		graph = append(graph, fmt.Sprintf("%s%s[sv_region]", label, crop))
+		label = "[sv_region]"
+	}
+	if private := privateBlurFilter(); private != "" {
+		graph = append(graph, fmt.Sprintf("%s%s[sv_private]", label, private))
+		label = "[sv_private]"
+	}
+	if dedupeFrames {
+		// Before the watermark, whose clock would make every frame differ
+		graph = append(graph, fmt.Sprintf("%s%s[sv_dedupe]", label, dedupeFilter(fps)))
+		label = "[sv_dedupe]"
+	}
+	// The camera is the first extra input, beside the screen or as a track
+	firstInput := 1
+	if cameraSource != "" {
+		a.extraInputs = cameraInputArgs(goos, cameraSource)
+		if cameraLayout == "side" {
+			graph, label = cameraGraph(graph, label, firstInput, fps)
+		}
+		firstInput++
+	}
+	watermarkInputs, filter := watermarkArgs(firstInput, graph, label)
+	a.extraInputs, a.filter = append(a.extraInputs, watermarkInputs...), filter
+	if len(a.filter) > 0 {
+		log.Info("Adding filters", "filter", a.filter[1])
+	}
+	if cameraSource != "" && cameraLayout == "track" {
+		if len(a.filter) == 0 {
+			a.filter = []string{"-map", "0:v"}
+		}
+		a.filter = append(a.filter, "-map", "1:v", "-metadata:s:v:1", "title=camera")
+	}
+
+	// The encoder settings are the same on every OS
+	a.codec = encoderOptions(encoder, fps, segmentBitrate(), log)
+	if dedupeFrames {
+		// Keep the timestamps of the frames left, instead of duplicating
+		// them back to the constant frame rate of -r
+		a.codec = append(a.codec, "-fps_mode", "vfr")
+	}
+
+	// Split the video for the review rendition and the stills before the audio joins the graph
+	var review []string
+	if remoteReview {
+		review = reviewArgs(&a, videoFile)
+	}
+	var uiStill []string
+	if watchesUI() {
+		uiStill = uiWatchArgs(&a)
+	}
+
+	// The audio devices are the inputs after the camera and the watermark
+	audioInput := firstInput
+	if watermarkImage != nil {
+		audioInput++
+	}
+	addAudioArgs(&a, goos, audioInput)
+
+	// Send the video to the file, stdout or the network stream
+	a.output = append(outputTargetArgs(videoFile, len(a.filter) > 0), virtualCameraArgs()...)
+	a.output = append(a.output, review...)
+	a.output = append(a.output, uiStill...)
+	return a
+}
+
+// captureInputArgs returns the screen capture input of goos: avfoundation on
+// macOS, gdigrab on Windows and x11grab elsewhere
+func captureInputArgs(goos, device string, fps int, log *slog.Logger) []string {
+	fpsStr := fmt.Sprintf("%d", fps)
+	if r := captureRegion; r != nil {
+		log.Info("Capturing region", "x", r.x, "y", r.y, "width", r.width, "height", r.height)
+	}
+
+	switch goos {
+	case "darwin":
+		// macOS screen capture, use compatible pixel format for input
+		return []string{
+			"-f", "avfoundation",
+			"-framerate", fpsStr,
+			"-pix_fmt", "uyvy422",
+			"-i", device,
+		}
+	case "windows":
+		// Windows screen capture
+		args := []string{
+			"-f", "gdigrab",
+			"-framerate", fpsStr,
+		}
+
+		// A single monitor is captured as a region of the desktop
+		if idx, ok := parseMonitorDisplay(device); ok {
+			monitorArgs, m, err := monitorCaptureArgs(idx)
+			if err != nil {
+				log.Error("Could not select monitor, capturing the full desktop", "monitor", idx, "error", err)
+			} else {
+				log.Info("Capturing monitor", "monitor", idx, "name", m.name, "x", m.x, "y", m.y, "width", m.width, "height", m.height)
+				if captureRegion != nil {
+					monitorArgs = gdigrabRegionArgs(m.x, m.y)
+				}
+				args = append(args, monitorArgs...)
+			}
+			device = "desktop"
+		} else if device == "desktop" {
+			// Pass the physical desktop size so scaled displays are not cropped
+			screen, err := virtualScreen()
+			switch {
+			case captureRegion != nil:
+				// The region starts at the top left of the desktop, which
+				// is left of or above 0,0 with monitors there
+				args = append(args, gdigrabRegionArgs(screen.x, screen.y)...)
+			case err == nil:
+				log.Info("Capturing desktop", "x", screen.x, "y", screen.y, "width", screen.width, "height", screen.height)
+				args = append(args,
+					"-offset_x", fmt.Sprintf("%d", screen.x),
+					"-offset_y", fmt.Sprintf("%d", screen.y),
+					"-video_size", fmt.Sprintf("%dx%d", screen.width, screen.height))
+			}
+		} else if captureRegion != nil {
+			// gdigrab takes the offset of a title= window relative to it
+			args = append(args, gdigrabRegionArgs(0, 0)...)
+		}
+		return append(args, "-i", device)
+	}
+
+	if linuxCapture != "" {
+		return waylandInputArgs(fps)
+	}
+
+	// Linux (X11) screen capture
+	args := []string{
+		"-f", "x11grab",
+		"-framerate", fpsStr,
+	}
+	input := x11DisplayInput()
+	if r := captureRegion; r != nil {
+		// x11grab ignores -grab_x and -grab_y when the display input has an
+		// offset, so it is added to them instead
+		x, y := r.x, r.y
+		if m := x11OffsetRe.FindStringSubmatch(input); m != nil {
+			offsetX, _ := strconv.Atoi(m[1])
+			offsetY, _ := strconv.Atoi(m[2])
+			x, y = x+offsetX, y+offsetY
+			input = strings.TrimSuffix(input, m[0])
+		}
+		args = append(args,
+			"-video_size", fmt.Sprintf("%dx%d", r.width, r.height),
+			"-grab_x", strconv.Itoa(x),
+			"-grab_y", strconv.Itoa(y))
+	} else if virtualMonitorSize != "" {
+		// Only the virtual monitor, from its offset in the display input
+		args = append(args, "-video_size", virtualMonitorSize)
+	}
+	return append(args, "-i", input)
+}
+
+// gdigrabRegionArgs returns the gdigrab options that capture -region of a
+// display whose top left is at x, y on the desktop
+func gdigrabRegionArgs(x, y int) []string {
+	r := captureRegion
+	return []string{
+		"-offset_x", strconv.Itoa(x + r.x),
+		"-offset_y", strconv.Itoa(y + r.y),
+		"-video_size", fmt.Sprintf("%dx%d", r.width, r.height),
+	}
+}
+
+// x11DisplayInput returns the X11 display to capture
+func x11DisplayInput() string {
+	if manualDisplayID != "" {
+		return manualDisplayID
+	}
+	if display := os.Getenv("DISPLAY"); display != "" {
+		// e.g. the host display passed into a container
+		return display
+	}
+	return ":0.0" // Default display
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files of the tests with the current output")
+
+// setGlobal sets a setting of the recorder for the rest of a test
+func setGlobal[T any](t *testing.T, p *T, v T) {
+	old := *p
+	*p = v
+	t.Cleanup(func() { *p = old })
+}
+
+// checkGolden compares got with testdata/name.golden, or writes it there
+// with -update
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v, run go test -update to create it", err)
+	}
+	if got != string(want) {
+		t.Errorf("arguments differ from %s, run go test -update if the change is intended\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// Options of recordingArgs that change the command line, each set on its
+// own over the defaults
+var recordingArgsOptions = map[string]func(t *testing.T){
+	"default": func(t *testing.T) {},
+	"region": func(t *testing.T) {
+		setGlobal(t, &captureRegion, &screenRect{x: 100, y: 50, width: 1280, height: 720})
+	},
+	"dedupe": func(t *testing.T) {
+		setGlobal(t, &dedupeFrames, true)
+	},
+	"wallclock": func(t *testing.T) {
+		setGlobal(t, &wallclockTimestamps, true)
+	},
+	"audio": func(t *testing.T) {
+		setGlobal(t, &audioSystem, "system")
+		setGlobal(t, &audioMic, "mic")
+	},
+	"blur": func(t *testing.T) {},
+	"share": func(t *testing.T) {
+		setGlobal(t, &shareProfile, true)
+	},
+}
+
+// Screen devices and encoders of each OS, software and hardware encoders
+// of both codecs
+var recordingArgsTargets = []struct {
+	goos     string
+	device   string
+	encoders []string
+}{
+	{"linux", ":0.0", []string{"libx264", "libx265", "h264_nvenc", "hevc_vaapi"}},
+	{"windows", "title=Notepad", []string{"libx264", "libx265", "h264_nvenc", "hevc_qsv", "h264_amf"}},
+	{"darwin", "1:none", []string{"libx264", "h264_videotoolbox", "hevc_videotoolbox"}},
+}
+
+func TestRecordingArgs(t *testing.T) {
+	log := slog.New(slog.DiscardHandler)
+	blurs := []*blurRegion{{title: "Password Manager", name: "sv_blur0", width: 400, height: 300, x: 20, y: 40, visible: true}}
+	for _, target := range recordingArgsTargets {
+		for _, encoder := range target.encoders {
+			for option, set := range recordingArgsOptions {
+				name := fmt.Sprintf("recordingargs_%s_%s_%s", target.goos, encoder, option)
+				t.Run(name, func(t *testing.T) {
+					setGlobal(t, &preset, "medium")
+					setGlobal(t, &bitrate, 1000)
+					setGlobal(t, &manualDisplayID, target.device)
+					set(t)
+					var regions []*blurRegion
+					if option == "blur" {
+						regions = blurs
+					}
+					args := recordingArgs(target.goos, encoder, target.device, "out/segment.mkv", 5, regions, false, log)
+					checkGolden(t, name, strings.Join(args.list(), "\n")+"\n")
+				})
+			}
+		}
+	}
+}
+
+// The zero-copy pipeline of each OS, which leaves out the CPU filters
+func TestRecordingArgsZeroCopy(t *testing.T) {
+	log := slog.New(slog.DiscardHandler)
+	for _, c := range []struct{ goos, device, encoder string }{
+		{"linux", ":0.0", "h264_vaapi"},
+		{"windows", "monitor:1", "h264_nvenc"},
+		{"windows", "monitor:0", "hevc_qsv"},
+	} {
+		name := fmt.Sprintf("recordingargs_%s_%s_zerocopy", c.goos, c.encoder)
+		t.Run(name, func(t *testing.T) {
+			setGlobal(t, &preset, "medium")
+			setGlobal(t, &bitrate, 1000)
+			args := recordingArgs(c.goos, c.encoder, c.device, "out/segment.mkv", 5, nil, true, log)
+			checkGolden(t, name, strings.Join(args.list(), "\n")+"\n")
+		})
+	}
+}
+
+// A Wayland desktop is captured from the screen cast or the DRM plane,
+// whole, and the region is cut out in the filter graph
+func TestRecordingArgsWayland(t *testing.T) {
+	log := slog.New(slog.DiscardHandler)
+	for _, capture := range []string{"portal", "kmsgrab"} {
+		name := fmt.Sprintf("recordingargs_linux_libx264_%s", capture)
+		t.Run(name, func(t *testing.T) {
+			setGlobal(t, &preset, "medium")
+			setGlobal(t, &bitrate, 1000)
+			setGlobal(t, &linuxCapture, capture)
+			setGlobal(t, &captureRegion, &screenRect{x: 100, y: 50, width: 1280, height: 720})
+			args := recordingArgs("linux", "libx264", ":0.0", "out/segment.mkv", 5, nil, false, log)
+			checkGolden(t, name, strings.Join(args.list(), "\n")+"\n")
+		})
+	}
+}
+
+// The live view goes to the recorder as RTP beside the segment file
+func TestRecordingArgsLive(t *testing.T) {
+	log := slog.New(slog.DiscardHandler)
+	for _, target := range recordingArgsTargets {
+		name := fmt.Sprintf("recordingargs_%s_libx264_live", target.goos)
+		t.Run(name, func(t *testing.T) {
+			setGlobal(t, &preset, "medium")
+			setGlobal(t, &bitrate, 1000)
+			setGlobal(t, &manualDisplayID, target.device)
+			setGlobal(t, &liveOutput, "rtp://127.0.0.1:5004?pkt_size=1200&rtcpport=5004")
+			args := recordingArgs(target.goos, "libx264", target.device, "out/segment.mkv", 5, nil, false, log)
+			checkGolden(t, name, strings.Join(args.list(), "\n")+"\n")
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Limits of the capture settings, outside of them ffmpeg either fails or
+// records something nobody can use
+const (
+	minFPS     = 1
+	maxFPS     = 120
+	minBitrate = 100    // kbit/s
+	maxBitrate = 100000 // kbit/s
+)
+
+var (
+	// X11 displays like :0, :0.0, :1.0+1920,0 or host:0.0
+	x11DisplayRe = regexp.MustCompile(`^[A-Za-z0-9.\-]*:\d+(\.\d+)?(\+\d+,\d+)?$`)
+	// AVFoundation devices like 1, 1:none or 1:0 (video and audio index)
+	avfDisplayRe = regexp.MustCompile(`^\d+(:(none|\d+))?$`)
+)
+
+// checkFPS validates the -fps value
+func checkFPS(n int) error {
+	if n < minFPS || n > maxFPS {
+		return fmt.Errorf("-fps %d is out of range, use %d to %d frames per second (5 is enough for most screen recordings)", n, minFPS, maxFPS)
+	}
+	return nil
+}
+
+// checkBitrate validates the -bitrate value
+func checkBitrate(kbps int) error {
+	if kbps < minBitrate || kbps > maxBitrate {
+		return fmt.Errorf("-bitrate %d is out of range, use %d to %d kbit/s (the default 700 suits a 1080p screen at 5 fps)", kbps, minBitrate, maxBitrate)
+	}
+	return nil
+}
+
+// checkDisplayID validates a -display value for the capture device of goos
+func checkDisplayID(goos, id string) error {
+	switch goos {
+	case "windows":
+		if id == "desktop" || strings.HasPrefix(id, "title=") && len(id) > len("title=") {
+			return nil
+		}
+		if _, ok := parseMonitorDisplay(id); ok {
+			return nil
+		}
+		return fmt.Errorf("invalid display %q, use desktop, monitor:N or title=<window title> (see -list)", id)
+	case "darwin":
+		if avfDisplayRe.MatchString(id) {
+			return nil
+		}
+		return fmt.Errorf("invalid display %q, use the device index of a screen like 1 or 1:none (see -list)", id)
+	}
+	if x11DisplayRe.MatchString(id) {
+		return nil
+	}
+	return fmt.Errorf("invalid display %q, use an X11 display like :0.0 or :0.0+1920,0 for a second monitor (see -list)", id)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Hosts queried at the same time by fleet status
+const fleetParallel = 16
+
+// fleetHostsConfig is the hosts file of the fleet command
+type fleetHostsConfig struct {
+	Hosts []*fleetHost `yaml:"hosts"`
+}
+
+// fleetHost is a recorder of the fleet, on this machine if SSH is empty
+type fleetHost struct {
+	Name     string `yaml:"name"`
+	SSH      string `yaml:"ssh"`
+	Instance string `yaml:"instance"`
+	Binary   string `yaml:"binary"`
+}
+
+// fleetResult is the status of one recorder, or why it is unknown
+type fleetResult struct {
+	Host   string          `json:"host"`
+	Status *recorderStatus `json:"status,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	// Why the recorder fails the check, the error or a stale capture
+	Problem string `json:"problem,omitempty"`
+}
+
+// loadFleetHosts reads the hosts file
+func loadFleetHosts(path string) ([]*fleetHost, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// Unknown keys are mistakes, like a misspelled instance
+	var config fleetHostsConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(config.Hosts) == 0 {
+		return nil, fmt.Errorf("%s defines no hosts", path)
+	}
+	for i, h := range config.Hosts {
+		if h == nil {
+			return nil, fmt.Errorf("%s: host %d is empty", path, i+1)
+		}
+		if h.Instance == "" {
+			h.Instance = "default"
+		}
+		if h.Binary == "" {
+			h.Binary = "screen-vibe"
+		}
+		if h.Name == "" {
+			h.Name = h.SSH
+			if h.Name == "" {
+				h.Name = "localhost"
+			}
+			if h.Instance != "default" {
+				h.Name += "/" + h.Instance
+			}
+		}
+	}
+	return config.Hosts, nil
+}
+
+// queryFleetHost asks a recorder for its status
+func queryFleetHost(h *fleetHost) (*recorderStatus, error) {
+	var conn io.ReadWriteCloser
+	if h.SSH != "" {
+		c, err := dialSSHControl(h.SSH, h.Binary, h.Instance)
+		if err != nil {
+			return nil, err
+		}
+		conn = c
+	} else {
+		path := controlSocketPath(h.Instance)
+		c, err := dialControl(path, 5*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("instance %q is not running (%s)", h.Instance, path)
+		}
+		conn = c
+	}
+	io.WriteString(conn, "status\n")
+	data, err := io.ReadAll(conn)
+	if closeErr := conn.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if msg, failed := strings.CutPrefix(string(data), "error: "); failed {
+		return nil, fmt.Errorf("%s", strings.TrimSpace(msg))
+	}
+	var status recorderStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("unexpected answer %q", strings.TrimSpace(string(data)))
+	}
+	return &status, nil
+}
+
+// runFleetCommand checks many recorders at once, for daily operations
+func runFleetCommand(args []string) int {
+	if len(args) == 0 || args[0] != "status" {
+		consoleInfo("Usage: screen-vibe fleet status [-hosts hosts.yaml] [-stale 1m] [-json]")
+		return 2
+	}
+	fs := flag.NewFlagSet("fleet status", flag.ExitOnError)
+	hostsFlag := fs.String("hosts", "hosts.yaml", "YAML file listing the recorders, reached over SSH")
+	staleFlag := fs.Duration("stale", time.Minute, "Flag recorders that encoded no frame for this long")
+	jsonFlag := fs.Bool("json", false, "Print the results as JSON lines")
+	envUsage(fs)
+	if err := applyFlagEnv(fs); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	fs.Parse(args[1:])
+
+	hosts, err := loadFleetHosts(*hostsFlag)
+	if err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+
+	results := make([]fleetResult, len(hosts))
+	slots := make(chan struct{}, fleetParallel)
+	var wg sync.WaitGroup
+	for i, h := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results[i].Host = h.Name
+			if status, err := queryFleetHost(h); err != nil {
+				results[i].Error = err.Error()
+			} else {
+				results[i].Status = status
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Unreachable recorders and recorders that stopped encoding fail the
+	// check, paused and stopped ones were held on purpose
+	now, failed := time.Now(), false
+	if !*jsonFlag {
+		fmt.Printf("%-20s %-12s %-12s %-10s %-10s %s\n", "HOST", "STATE", "LAST FRAME", "DISK FREE", "VERSION", "PROBLEM")
+	}
+	for _, r := range results {
+		r.Problem = r.Error
+		if s := r.Status; s != nil && s.State == "recording" {
+			// A segment that just started has no frame yet
+			last := s.LastFrame
+			if last.IsZero() {
+				last = s.Started
+			}
+			if now.Sub(last) > *staleFlag {
+				r.Problem = "no new frame for " + now.Sub(last).Round(time.Second).String()
+			}
+		}
+		if r.Problem != "" {
+			failed = true
+		}
+		if *jsonFlag {
+			data, _ := json.Marshal(r)
+			fmt.Println(string(data))
+			continue
+		}
+		state, lastFrame, free, version := "unreachable", "-", "-", "-"
+		if s := r.Status; s != nil {
+			state, version = s.State, s.Version
+			if !s.LastFrame.IsZero() {
+				lastFrame = now.Sub(s.LastFrame).Round(time.Second).String() + " ago"
+			}
+			if s.DiskFree > 0 {
+				free = formatFileSize(s.DiskFree)
+			}
+		}
+		fmt.Printf("%-20s %-12s %-12s %-10s %-10s %s\n", r.Host, state, lastFrame, free, version, r.Problem)
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Interval between two checks of the focused window
+const focusPollInterval = time.Second
+
+// focusSubtitles is set when a subtitle file with the focused application
+// is written next to every segment and focus changes go to the focus log
+var focusSubtitles bool
+
+// focusChange is the time a window got the focus
+type focusChange struct {
+	time  time.Time
+	app   string
+	title string
+}
+
+// focusHistory holds the focus changes since the current segment started
+var focusHistory struct {
+	sync.Mutex
+	changes []focusChange
+}
+
+// watchFocus polls the focused window, records every change for the focus
+// subtitles, switches the application profiles, finds meetings and keeps
+// private windows out of the recording. Titles are recorded as -log-privacy
+// asks.
+func watchFocus() error {
+	app, title, err := activeWindow()
+	if err != nil {
+		return err
+	}
+	startAppProfile(app, title)
+	app, title = redactFocus(app, title)
+	meetingFocus(title, time.Now())
+	title = privateLogText(title)
+	focusHistory.Lock()
+	focusHistory.changes = append(focusHistory.changes, focusChange{time: time.Now(), app: app, title: title})
+	focusHistory.Unlock()
+
+	goBackground(func() {
+		for sleepOrShutdown(focusPollInterval) {
+			app, title, err := activeWindow()
+			if err != nil {
+				currentLog().Debug("Could not read the focused window", "error", err)
+				continue
+			}
+
+			now := time.Now()
+			appProfileFocus(app, title, now)
+			app, title = redactFocus(app, title)
+			meetingFocus(title, now)
+			title = privateLogText(title)
+			focusHistory.Lock()
+			last := focusHistory.changes[len(focusHistory.changes)-1]
+			changed := app != last.app || title != last.title
+			if changed {
+				focusHistory.changes = append(focusHistory.changes, focusChange{time: now, app: app, title: title})
+				if !focusSubtitles {
+					// Only the application profiles follow the focus, they
+					// need no history
+					focusHistory.changes = focusHistory.changes[len(focusHistory.changes)-1:]
+				}
+			}
+			focusHistory.Unlock()
+
+			if changed && focusSubtitles {
+				logFocusPeriod(last, now)
+			}
+		}
+	})
+	return nil
+}
+
+// logFocusPeriod adds the time a window had the focus to the focus log
+func logFocusPeriod(c focusChange, end time.Time) {
+	if c.app == "" && c.title == "" {
+		return
+	}
+	if err := appendFocusPeriod(focusPeriod{Start: c.time, End: end, App: c.app, Title: c.title}); err != nil {
+		currentLog().Error("Failed to update the focus log", "error", err)
+	}
+}
+
+// flushFocusLog logs the focus period that lasts until the recorder exits
+func flushFocusLog() {
+	focusHistory.Lock()
+	defer focusHistory.Unlock()
+	if n := len(focusHistory.changes); n > 0 {
+		last := focusHistory.changes[n-1]
+		logFocusPeriod(last, time.Now())
+		focusHistory.changes[n-1].time = time.Now()
+	}
+}
+
+// label is the subtitle text of a focus change
+func (c focusChange) label() string {
+	switch {
+	case c.app == "" && c.title == "":
+		return ""
+	case c.title == "":
+		return c.app
+	case c.app == "":
+		return c.title
+	}
+	return c.app + ": " + c.title
+}
+
+// writeFocusSubtitles writes the focus history of a finished segment as an
+// SRT file next to it, named <segment>.focus.srt so players like VLC load it
+// automatically. Changes before the end of the segment are dropped, except
+// the last one which continues into the next segment.
+func writeFocusSubtitles(videoFile string, start, end time.Time) error {
+	focusHistory.Lock()
+	changes := focusHistory.changes
+	keep := 0
+	for i, c := range changes {
+		if !c.time.After(end) {
+			keep = i
+		}
+	}
+	focusHistory.changes = append([]focusChange{}, changes[keep:]...)
+	focusHistory.Unlock()
+
+	var b strings.Builder
+	cue := 0
+	for i, c := range changes {
+		from, to := c.time, end
+		if i+1 < len(changes) {
+			to = changes[i+1].time
+		}
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		if !to.After(from) || c.label() == "" {
+			continue
+		}
+		cue++
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", cue, srtTime(from.Sub(start)), srtTime(to.Sub(start)), c.label())
+	}
+
+	path := strings.TrimSuffix(videoFile, filepath.Ext(videoFile)) + ".focus.srt"
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// srtTime formats an offset as SRT timestamp, e.g. 01:02:03,456
+func srtTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
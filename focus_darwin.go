@@ -0,0 +1,31 @@
+//go:build darwin
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Prints the frontmost application and the title of its front window, the
+// title needs the Accessibility permission and is empty without it
+const activeWindowScript = `tell application "System Events"
+	set frontApp to first application process whose frontmost is true
+	set windowTitle to ""
+	try
+		set windowTitle to name of front window of frontApp
+	end try
+	return (name of frontApp) & tab & windowTitle
+end tell`
+
+// activeWindow returns the name of the frontmost application and the title
+// of its front window
+func activeWindow() (app, title string, err error) {
+	out, err := exec.Command("osascript", "-e", activeWindowScript).Output()
+	if err != nil {
+		return "", "", fmt.Errorf("osascript: %v", err)
+	}
+	app, title, _ = strings.Cut(strings.TrimRight(string(out), "\n"), "\t")
+	return app, title, nil
+}
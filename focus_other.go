@@ -0,0 +1,45 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+var (
+	activeWindowRe = regexp.MustCompile(`window id # (0x[0-9a-fA-F]+)`)
+	windowNameRe   = regexp.MustCompile(`_NET_WM_NAME\([^)]*\) = "(.*)"`)
+	windowPIDRe    = regexp.MustCompile(`_NET_WM_PID\([^)]*\) = ([0-9]+)`)
+)
+
+// activeWindow returns the process name and the title of the focused X11
+// window, read with xprop from the window manager's _NET_ACTIVE_WINDOW
+func activeWindow() (app, title string, err error) {
+	out, err := exec.Command("xprop", "-root", "_NET_ACTIVE_WINDOW").Output()
+	if err != nil {
+		return "", "", fmt.Errorf("xprop: %v", err)
+	}
+	m := activeWindowRe.FindSubmatch(out)
+	if m == nil || string(m[1]) == "0x0" {
+		return "", "", nil
+	}
+
+	out, err = exec.Command("xprop", "-id", string(m[1]), "_NET_WM_NAME", "_NET_WM_PID").Output()
+	if err != nil {
+		// The window may have closed in between
+		return "", "", nil
+	}
+	if m := windowNameRe.FindSubmatch(out); m != nil {
+		title = strings.ReplaceAll(string(m[1]), `\"`, `"`)
+	}
+	if m := windowPIDRe.FindSubmatch(out); m != nil {
+		if comm, err := os.ReadFile("/proc/" + string(m[1]) + "/comm"); err == nil {
+			app = strings.TrimSpace(string(comm))
+		}
+	}
+	return app, title, nil
+}
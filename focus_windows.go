@@ -0,0 +1,49 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procGetForegroundWindow        = moduser32.NewProc("GetForegroundWindow")
+	procGetWindowTextW             = moduser32.NewProc("GetWindowTextW")
+	procGetWindowThreadProcessId   = moduser32.NewProc("GetWindowThreadProcessId")
+	procQueryFullProcessImageNameW = modkernel32.NewProc("QueryFullProcessImageNameW")
+)
+
+// Access right needed for QueryFullProcessImageNameW
+const processQueryLimitedInformation = 0x1000
+
+// activeWindow returns the executable name and the title of the window
+// in the foreground
+func activeWindow() (app, title string, err error) {
+	hwnd, _, _ := procGetForegroundWindow.Call()
+	if hwnd == 0 {
+		// No window has the focus, e.g. on the lock screen
+		return "", "", nil
+	}
+
+	buf := make([]uint16, 512)
+	n, _, _ := procGetWindowTextW.Call(hwnd, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	title = syscall.UTF16ToString(buf[:n])
+
+	var pid uint32
+	procGetWindowThreadProcessId.Call(hwnd, uintptr(unsafe.Pointer(&pid)))
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, pid)
+	if err != nil {
+		return "", title, fmt.Errorf("OpenProcess: %v", err)
+	}
+	defer syscall.CloseHandle(h)
+	size := uint32(len(buf))
+	if r, _, err := procQueryFullProcessImageNameW.Call(uintptr(h), 0, uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size))); r == 0 {
+		return "", title, fmt.Errorf("QueryFullProcessImageNameW: %v", err)
+	}
+	app = strings.TrimSuffix(filepath.Base(syscall.UTF16ToString(buf[:size])), ".exe")
+	return app, title, nil
+}
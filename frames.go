@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Name of the file that lists the time of every exported frame
+const framesIndexName = "frames.csv"
+
+// runFramesCommand writes the frames of recordings as PNG images, for
+// pixel-level comparisons of user interfaces
+func runFramesCommand(args []string) int {
+	fs := flag.NewFlagSet("frames", flag.ExitOnError)
+	fromFlag := fs.String("from", "", "Export the frames from this time (e.g. \"2024-05-01 09:00:30\")")
+	toFlag := fs.String("to", "", "Export the frames until this time")
+	fpsFlag := fs.Float64("fps", 5, "Frames per second to export (default: 5)")
+	outFlag := fs.String("o", "", "Directory the PNG images are written to")
+	outputDirFlag := fs.String("output", outputDir, "Directory that holds the recordings and the catalog")
+	envUsage(fs)
+	if err := applyFlagEnv(fs); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	// Segment files may come before or after the flags
+	var files []string
+	for rest := args; ; rest = fs.Args()[1:] {
+		fs.Parse(rest)
+		if fs.NArg() == 0 {
+			break
+		}
+		files = append(files, fs.Arg(0))
+	}
+	outputDir = *outputDirFlag
+
+	if *outFlag == "" {
+		consoleInfo("Usage: screen-vibe frames [segment files...] [-from time] [-to time] [-fps 5] -o dir")
+		return 2
+	}
+	if *fpsFlag <= 0 || *fpsFlag > maxFPS {
+		consoleError("-fps %g is out of range, use up to %d frames per second", *fpsFlag, maxFPS)
+		return 2
+	}
+	from, err := parseExportTime(*fromFlag)
+	if err == nil {
+		var to time.Time
+		to, err = parseExportTime(*toFlag)
+		if err == nil && len(files) == 0 && from.IsZero() && to.IsZero() {
+			err = errors.New("select the segments with -from and -to or by file")
+		}
+		if err == nil {
+			err = exportFrames(*outFlag, files, from, to, *fpsFlag)
+		}
+	}
+	if err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	return 0
+}
+
+// exportFrames finds the segments of the selection in the catalog and
+// writes their frames between from and to into dir, named after the
+// segment and numbered, with their times in frames.csv
+func exportFrames(dir string, files []string, from, to time.Time, fps float64) error {
+	if err := openCatalog(); err != nil {
+		return err
+	}
+	entries, err := readAnnotatedCatalog()
+	if err != nil {
+		return fmt.Errorf("could not read catalog: %v", err)
+	}
+	segments, err := exportSelection(entries, files, from, to)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		return errors.New("no segments match the selection")
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].Start.Before(segments[j].Start) })
+	// Frames left from an earlier export would end up in the index
+	if existing, err := os.ReadDir(dir); err == nil && len(existing) > 0 {
+		return fmt.Errorf("%s is not empty, export into a new directory", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	var index strings.Builder
+	index.WriteString("file,time\n")
+	total := 0
+	var exported []string
+	for _, e := range segments {
+		src := filepath.Join(outputDir, filepath.FromSlash(e.File))
+		_, statErr := os.Stat(src)
+		switch {
+		case os.IsNotExist(statErr) && e.Remote != "":
+			return fmt.Errorf("%s is in cold storage, fetch it with screen-vibe ctl fetch %s", e.File, e.File)
+		case os.IsNotExist(statErr) && e.Storage != "":
+			return fmt.Errorf("%s was recorded to %s, copy it to %s first", e.File, e.Storage, src)
+		}
+		// The first frame is the most precise start, where it is known
+		start := e.Start
+		if e.FirstFrame != nil {
+			start = *e.FirstFrame
+		}
+		offset, end := time.Duration(0), e.End.Sub(start)
+		if !from.IsZero() && from.After(start) {
+			offset = from.Sub(start)
+		}
+		if !to.IsZero() && to.Before(e.End) {
+			end = to.Sub(start)
+		}
+		if end <= offset {
+			continue
+		}
+
+		base := strings.TrimSuffix(filepath.Base(e.File), filepath.Ext(e.File))
+		cmd := exec.Command("ffmpeg", "-nostdin", "-hide_banner", "-loglevel", "error", "-y",
+			"-ss", fmt.Sprintf("%.3f", offset.Seconds()), "-i", src,
+			"-t", fmt.Sprintf("%.3f", (end-offset).Seconds()),
+			"-map", "0:v:0", "-vf", fmt.Sprintf("fps=%g", fps),
+			filepath.Join(dir, base+"_%06d.png"))
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("could not export the frames of %s: %v %s", e.File, err, strings.TrimSpace(string(out)))
+		}
+
+		// ffmpeg numbers the frames from 1, one every 1/fps from the offset
+		n := 0
+		for ; ; n++ {
+			name := fmt.Sprintf("%s_%06d.png", base, n+1)
+			if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+				break
+			}
+			at := start.Add(offset + time.Duration(float64(n)/fps*float64(time.Second)))
+			fmt.Fprintf(&index, "%s,%s\n", name, at.Format(time.RFC3339Nano))
+		}
+		consoleEvent("Exported %d frames of %s", n, e.File)
+		total += n
+		exported = append(exported, e.File)
+	}
+	if total == 0 {
+		return errors.New("the segments have no frames in the selected time")
+	}
+	if err := os.WriteFile(filepath.Join(dir, framesIndexName), []byte(index.String()), 0644); err != nil {
+		return err
+	}
+	logAccess("frames", fmt.Sprintf("%d frames to %s", total, dir), exported...)
+	consoleInfo("Wrote %d frames to %s, their times are in %s", total, dir, framesIndexName)
+	return nil
+}
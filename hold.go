@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// legalHold keeps a segment on the machine until it is released, e.g.
+// while a case is open
+type legalHold struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Reason string    `json:"reason"`
+}
+
+// runHoldCommand places segments under legal hold or releases them. Holds
+// are annotations, so the annotation log records every change with time and
+// user.
+func runHoldCommand(args []string) int {
+	fs := flag.NewFlagSet("hold", flag.ExitOnError)
+	reasonFlag := fs.String("reason", "", "Why the segments are held, e.g. the case number (required to place a hold)")
+	releaseFlag := fs.Bool("release", false, "Release the hold instead of placing one")
+	fromFlag := fs.String("from", "", "Select the segments from this time (e.g. \"2024-05-01 09:00\")")
+	toFlag := fs.String("to", "", "Select the segments until this time")
+	outputDirFlag := fs.String("output", outputDir, "Directory that holds the catalog")
+	envUsage(fs)
+	if err := applyFlagEnv(fs); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	fs.Parse(args)
+	outputDir = *outputDirFlag
+	reason := strings.TrimSpace(*reasonFlag)
+
+	from, err := parseExportTime(*fromFlag)
+	if err == nil {
+		var to time.Time
+		if to, err = parseExportTime(*toFlag); err == nil {
+			switch {
+			case fs.NArg() == 0 && from.IsZero() && to.IsZero():
+				err = errors.New("select the segments with -from and -to or by file")
+			case !*releaseFlag && reason == "":
+				err = errors.New("a hold needs a -reason, like the case number")
+			}
+		}
+		if err == nil {
+			err = holdSegments(fs.Args(), from, to, reason, *releaseFlag)
+		}
+	}
+	if err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	return 0
+}
+
+// holdSegments places the selected segments under hold, or releases them
+func holdSegments(files []string, from, to time.Time, reason string, release bool) error {
+	if err := openCatalog(); err != nil {
+		return err
+	}
+	entries, err := readAnnotatedCatalog()
+	if err != nil {
+		return fmt.Errorf("could not read catalog: %v", err)
+	}
+	segments, err := exportSelection(entries, files, from, to)
+	if err != nil {
+		return err
+	}
+
+	now, user := time.Now(), loginUser()
+	var annotations []annotation
+	for _, e := range segments {
+		switch {
+		case release && e.Hold != nil:
+			annotations = append(annotations, annotation{Time: now, User: user, File: e.File, Action: "release", Value: reason})
+		case !release && e.Hold == nil:
+			annotations = append(annotations, annotation{Time: now, User: user, File: e.File, Action: "hold", Value: reason})
+		}
+	}
+	if len(annotations) == 0 {
+		if release {
+			return errors.New("none of the selected segments is held")
+		}
+		return errors.New("the selected segments are held already")
+	}
+	if err := appendAnnotations(annotations); err != nil {
+		return fmt.Errorf("could not write annotations: %v", err)
+	}
+	if release {
+		consoleInfo("Released the hold on %d segments", len(annotations))
+	} else {
+		consoleInfo("Placed %d segments under legal hold", len(annotations))
+	}
+	return nil
+}
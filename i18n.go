@@ -0,0 +1,127 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Message catalogs, one JSON file per language that maps the English
+// format strings of the console messages and the web pages to their
+// translation. Messages missing from a catalog are printed in English.
+//
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// messages is the catalog of the console language, nil for English
+var messages map[string]string
+
+// language is the code of the console language
+var language = "en"
+
+// tr returns the translation of a console message format
+func tr(format string) string {
+	if translated, ok := messages[format]; ok {
+		return translated
+	}
+	return format
+}
+
+// languageCode reduces a locale like de_DE.UTF-8 or de-DE to its language
+func languageCode(locale string) string {
+	locale, _, _ = strings.Cut(locale, ".")
+	locale, _, _ = strings.Cut(locale, "@")
+	locale, _, _ = strings.Cut(locale, "_")
+	locale, _, _ = strings.Cut(locale, "-")
+	return strings.ToLower(locale)
+}
+
+// availableLanguages returns the languages with a message catalog
+func availableLanguages() []string {
+	languages := []string{"en"}
+	entries, _ := localeFiles.ReadDir("locales")
+	for _, e := range entries {
+		languages = append(languages, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// setLanguage switches the console messages to a language
+func setLanguage(locale string) error {
+	catalog, err := loadMessages(locale)
+	if err != nil {
+		return err
+	}
+	messages, language = catalog, "en"
+	if catalog != nil {
+		language = languageCode(locale)
+	}
+	return nil
+}
+
+// loadMessages returns the message catalog of a locale, nil for English
+func loadMessages(locale string) (map[string]string, error) {
+	lang := languageCode(locale)
+	if lang == "" || lang == "en" || lang == "c" || lang == "posix" {
+		return nil, nil
+	}
+	data, err := localeFiles.ReadFile(path.Join("locales", lang+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("no translation for %q, available: %s", locale, strings.Join(availableLanguages(), ", "))
+	}
+	var catalog map[string]string
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("broken message catalog for %s: %v", lang, err)
+	}
+	return catalog, nil
+}
+
+// pageText translates the text of a web page into the language of its
+// reader
+type pageText struct {
+	Lang     string
+	messages map[string]string
+}
+
+// T returns the translation of a text or format of the page
+func (p pageText) T(format string) string {
+	if translated, ok := p.messages[format]; ok {
+		return translated
+	}
+	return format
+}
+
+// requestText returns the translations for the first language of the
+// Accept-Language header of a request that has a message catalog, or the
+// console language if none has
+func requestText(r *http.Request) pageText {
+	for _, tag := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, _, _ = strings.Cut(strings.TrimSpace(tag), ";")
+		if tag == "*" {
+			break
+		}
+		if lang := languageCode(tag); lang != "" {
+			if catalog, err := loadMessages(lang); err == nil {
+				return pageText{Lang: lang, messages: catalog}
+			}
+		}
+	}
+	return pageText{Lang: language, messages: messages}
+}
+
+// detectLanguage returns the user's language from the locale environment
+// variables or the system settings
+func detectLanguage() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if locale := os.Getenv(name); locale != "" {
+			return locale
+		}
+	}
+	return systemLanguage()
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// systemLanguage returns the locale of the macOS user, e.g. de_DE, which
+// applications started from the Dock or launchd get without LANG
+func systemLanguage() string {
+	out, err := exec.Command("defaults", "read", "-g", "AppleLocale").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,9 @@
+//go:build !windows && !darwin
+
+package main
+
+// systemLanguage has no system setting to fall back to, the locale comes
+// from the environment
+func systemLanguage() string {
+	return ""
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Every translation takes the arguments of its English format
+func TestMessageCatalogs(t *testing.T) {
+	verb := regexp.MustCompile(`%(\[\d+\])?[-+# 0]*[\d.]*[a-zA-Z%]`)
+	for _, lang := range availableLanguages() {
+		catalog, err := loadMessages(lang)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for format, translated := range catalog {
+			if want, got := len(verb.FindAllString(format, -1)), len(verb.FindAllString(translated, -1)); got != want {
+				t.Errorf("%s: %q has %d verbs, %q has %d", lang, format, want, translated, got)
+			}
+		}
+	}
+}
+
+func TestViewPageLanguage(t *testing.T) {
+	setGlobal(t, &outputDir, t.TempDir())
+	setGlobal(t, &anonymize, false)
+	start := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+	if err := appendCatalogEntry(catalogEntry{File: "a.mkv", Start: start, End: start.Add(time.Minute), Size: 100, Lost: true}); err != nil {
+		t.Fatal(err)
+	}
+	handler := newViewHandler("", "127.0.0.1:8080", false, false)
+	for header, want := range map[string]string{
+		"":                       "1 segments, read-only",
+		"de-DE,de;q=0.9,en;q=.8": "1 Segmente, nur lesbar",
+		"fr-FR, es;q=0.5":        "(perdido)",
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = "127.0.0.1:8080"
+		r.Header.Set("Accept-Language", header)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("Accept-Language %q: the page lacks %q:\n%s", header, want, w.Body)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var procGetUserDefaultLocaleName = modkernel32.NewProc("GetUserDefaultLocaleName")
+
+// systemLanguage returns the locale of the Windows user, e.g. de-DE
+func systemLanguage() string {
+	buf := make([]uint16, 85) // LOCALE_NAME_MAX_LENGTH
+	r, _, _ := procGetUserDefaultLocaleName.Call(uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	if r == 0 {
+		return ""
+	}
+	return syscall.UTF16ToString(buf)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Interval between two checks of the user's input idle time
+const idlePollInterval = 5 * time.Second
+
+// Number of idle periods kept for tagging segments
+const maxIdlePeriods = 1000
+
+// Global variables for idle detection
+var idleThreshold time.Duration // 0 disables idle detection
+var idlePolicy string           // keep, fps, pause or stop
+var idleFPS int                 // frame rate while idle with the fps policy
+
+// idlePeriod is a time without user input longer than the idle threshold,
+// end is zero while it lasts
+type idlePeriod struct {
+	start, end time.Time
+}
+
+// idleState tracks whether the user is idle and the recent idle periods
+var idleState struct {
+	sync.Mutex
+	idle    bool
+	paused  bool // recording was paused by the pause policy
+	periods []idlePeriod
+}
+
+// parseIdlePolicy checks an idle policy name
+func parseIdlePolicy(policy string) error {
+	switch policy {
+	case "keep", "fps", "pause", "stop":
+		return nil
+	}
+	return fmt.Errorf("unknown idle policy %q, use keep, fps, pause or stop", policy)
+}
+
+// captureFPS returns the frame rate for new segments, which is lowered
+// while the user is idle with the fps policy, set by the -policy script or
+// limited by -adaptive
+func captureFPS() int {
+	return adaptiveFPS(requestedFPS())
+}
+
+// requestedFPS returns the frame rate the flags, application profile, idle
+// policy and -policy script ask for
+func requestedFPS() int {
+	if n := policyFPS.Load(); n > 0 {
+		return int(n)
+	}
+	base := profileFPS()
+	if idlePolicy != "fps" {
+		return base
+	}
+	idleState.Lock()
+	defer idleState.Unlock()
+	if idleState.idle && idleFPS < base {
+		return idleFPS
+	}
+	return base
+}
+
+// idleSecondsBetween returns how long the user was idle between start and end
+func idleSecondsBetween(start, end time.Time) float64 {
+	idleState.Lock()
+	defer idleState.Unlock()
+	var total time.Duration
+	for _, p := range idleState.periods {
+		pEnd := p.end
+		if pEnd.IsZero() {
+			pEnd = end
+		}
+		from, to := max(p.start.UnixNano(), start.UnixNano()), min(pEnd.UnixNano(), end.UnixNano())
+		if to > from {
+			total += time.Duration(to - from)
+		}
+	}
+	return total.Seconds()
+}
+
+// watchIdle polls the user's input idle time and applies the idle policy
+// when it crosses the threshold and when the user is back
+func watchIdle(sigs chan os.Signal) error {
+	if _, err := userIdleTime(); err != nil {
+		return err
+	}
+	go func() {
+		for {
+			time.Sleep(idlePollInterval)
+			idle, err := userIdleTime()
+			if err != nil {
+				currentLog().Warn("Could not read the user idle time", "error", err)
+				continue
+			}
+			now := time.Now()
+
+			idleState.Lock()
+			wasIdle := idleState.idle
+			switch {
+			case !wasIdle && idle >= idleThreshold:
+				idleState.idle = true
+				idleState.periods = append(idleState.periods, idlePeriod{start: now.Add(-idle)})
+				if len(idleState.periods) > maxIdlePeriods {
+					idleState.periods = idleState.periods[1:]
+				}
+			case wasIdle && idle < idleThreshold:
+				idleState.idle = false
+				idleState.periods[len(idleState.periods)-1].end = now.Add(-idle)
+			}
+			isIdle := idleState.idle
+			idleState.Unlock()
+
+			if isIdle != wasIdle {
+				applyIdlePolicy(isIdle, idle, sigs)
+			}
+		}
+	}()
+	return nil
+}
+
+// applyIdlePolicy reacts to the user becoming idle or active again
+func applyIdlePolicy(idle bool, idleTime time.Duration, sigs chan os.Signal) {
+	if idle {
+		consoleEvent("User idle for %s", idleTime.Round(time.Second))
+		currentLog().Info("User idle", "idle", idleTime.Round(time.Second), "policy", idlePolicy)
+		emitStatus(statusEvent{Event: "idle", Reason: idlePolicy})
+	} else {
+		consoleEvent("User active again")
+		currentLog().Info("User active", "policy", idlePolicy)
+		emitStatus(statusEvent{Event: "active", Reason: idlePolicy})
+	}
+
+	switch idlePolicy {
+	case "fps":
+		if fps > idleFPS {
+			if idle {
+				requestRotation(fmt.Sprintf("user idle, recording at %d fps", idleFPS))
+			} else {
+				requestRotation(fmt.Sprintf("user active, recording at %d fps", fps))
+			}
+		}
+	case "pause":
+		idleState.Lock()
+		defer idleState.Unlock()
+		if idle && recorderHold() == "" {
+			idleState.paused = controlRecording("pause") == nil
+		} else if !idle && idleState.paused {
+			// Recording stopped by a control command stays stopped
+			if recorderHold() == "paused" {
+				controlRecording("start")
+			}
+			idleState.paused = false
+		}
+	case "stop":
+		if idle {
+			consoleEvent("Stopping the recorder, the idle policy is stop")
+			select {
+			case sigs <- os.Interrupt:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,32 @@
+//go:build darwin
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var hidIdleTimeRe = regexp.MustCompile(`"HIDIdleTime" = ([0-9]+)`)
+
+// userIdleTime returns the time since the last keyboard or mouse input. It
+// reads the HID idle counter that CGEventSourceSecondsSinceLastEventType is
+// based on from the IOHIDSystem registry entry, which needs no cgo.
+func userIdleTime() (time.Duration, error) {
+	out, err := exec.Command("ioreg", "-c", "IOHIDSystem", "-d", "4").Output()
+	if err != nil {
+		return 0, fmt.Errorf("ioreg: %v", err)
+	}
+	m := hidIdleTimeRe.FindSubmatch(out)
+	if m == nil {
+		return 0, fmt.Errorf("no HIDIdleTime in the IOHIDSystem registry entry")
+	}
+	ns, err := strconv.ParseInt(string(m[1]), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ns), nil
+}
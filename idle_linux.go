@@ -0,0 +1,37 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// userIdleTime returns the time since the last keyboard or mouse input,
+// read from the X screen saver extension with xprintidle, or from the
+// Mutter idle monitor on GNOME Wayland sessions
+func userIdleTime() (time.Duration, error) {
+	if out, err := exec.Command("xprintidle").Output(); err == nil {
+		ms, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return 0, errors.New("idle detection needs xprintidle or a GNOME session")
+	}
+	var ms uint64
+	obj := conn.Object("org.gnome.Mutter.IdleMonitor", "/org/gnome/Mutter/IdleMonitor/Core")
+	if err := obj.Call("org.gnome.Mutter.IdleMonitor.GetIdletime", 0).Store(&ms); err != nil {
+		return 0, errors.New("idle detection needs xprintidle or a GNOME session")
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
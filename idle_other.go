@@ -0,0 +1,13 @@
+//go:build !windows && !darwin && !linux
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// userIdleTime is only implemented on Windows, macOS and Linux
+func userIdleTime() (time.Duration, error) {
+	return 0, errors.New("idle detection is only supported on Windows, macOS and Linux")
+}
@@ -0,0 +1,32 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+var (
+	procGetLastInputInfo = moduser32.NewProc("GetLastInputInfo")
+	procGetTickCount     = modkernel32.NewProc("GetTickCount")
+)
+
+// lastInputInfo mirrors LASTINPUTINFO
+type lastInputInfo struct {
+	cbSize uint32
+	dwTime uint32
+}
+
+// userIdleTime returns the time since the last keyboard or mouse input in
+// the session of the recorder
+func userIdleTime() (time.Duration, error) {
+	info := lastInputInfo{cbSize: uint32(unsafe.Sizeof(lastInputInfo{}))}
+	if r, _, err := procGetLastInputInfo.Call(uintptr(unsafe.Pointer(&info))); r == 0 {
+		return 0, fmt.Errorf("GetLastInputInfo: %v", err)
+	}
+	now, _, _ := procGetTickCount.Call()
+	// Both are 32-bit tick counts, the subtraction handles the wrap around
+	return time.Duration(uint32(now)-info.dwTime) * time.Millisecond, nil
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Directory of the imported files that were outside the output directory
+const importedDirName = "imported"
+
+// importExtensions are the video files a directory is searched for
+var importExtensions = map[string]bool{
+	".mkv": true, ".mp4": true, ".mov": true, ".m4v": true, ".webm": true,
+	".avi": true, ".wmv": true, ".flv": true, ".ts": true,
+}
+
+// importNameRe finds a date and time in a file name, like the segment names
+// 2025-01-10_09-00-00, OBS's 2025-01-10 09-00-00, 20250110_090000 of phones
+// or macOS's Screen Recording 2025-01-10 at 09.00.00
+var importNameRe = regexp.MustCompile(`(\d{4})[-_.]?(\d{2})[-_.]?(\d{2})(?:[ _T-]|[ _]at[ _])?(\d{2})[-_.:h]?(\d{2})[-_.:m]?(\d{2})`)
+
+// importProbe is what ffprobe tells about a file to import
+type importProbe struct {
+	Streams []struct {
+		CodecType string `json:"codec_type"`
+		CodecName string `json:"codec_name"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+		Tags     struct {
+			CreationTime string `json:"creation_time"`
+		} `json:"tags"`
+	} `json:"format"`
+}
+
+// importTime reads the start of a recording from a date and time in its
+// file name
+func importTime(name string) (time.Time, bool) {
+	for _, m := range importNameRe.FindAllStringSubmatch(name, -1) {
+		var v [6]int
+		for i := range v {
+			v[i], _ = strconv.Atoi(m[i+1])
+		}
+		t := time.Date(v[0], time.Month(v[1]), v[2], v[3], v[4], v[5], 0, time.Local)
+		// time.Date normalizes a 13th month or 61st second away
+		if t.Year() == v[0] && int(t.Month()) == v[1] && t.Day() == v[2] && t.Hour() == v[3] && t.Minute() == v[4] && t.Second() == v[5] {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// probeImport returns a catalog entry for a video file with its times,
+// size and codec. The start is taken from the file name, else from the
+// creation time of the metadata, else the end is the last change of the
+// file; the source is returned with it.
+func probeImport(file string) (catalogEntry, string, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return catalogEntry{}, "", err
+	}
+	out, err := exec.Command("ffprobe", "-v", "error", "-show_entries",
+		"format=duration:format_tags=creation_time:stream=codec_type,codec_name", "-of", "json", file).Output()
+	if err != nil {
+		return catalogEntry{}, "", fmt.Errorf("ffprobe: %v", probeError(err))
+	}
+	var probed importProbe
+	if err := json.Unmarshal(out, &probed); err != nil {
+		return catalogEntry{}, "", fmt.Errorf("ffprobe: %v", err)
+	}
+	entry := catalogEntry{Size: info.Size()}
+	for _, s := range probed.Streams {
+		if s.CodecType == "video" {
+			entry.Encoder = s.CodecName
+			break
+		}
+	}
+	if entry.Encoder == "" {
+		return catalogEntry{}, "", errors.New("the file has no video")
+	}
+	var duration time.Duration
+	if seconds, err := strconv.ParseFloat(probed.Format.Duration, 64); err == nil && seconds > 0 {
+		duration = time.Duration(seconds * float64(time.Second))
+	} else if duration, err = probeDuration(file); err != nil {
+		return catalogEntry{}, "", err
+	}
+
+	source := "name"
+	start, ok := importTime(filepath.Base(file))
+	if !ok {
+		if created, err := time.Parse(time.RFC3339Nano, probed.Format.Tags.CreationTime); err == nil {
+			start, source = created, "metadata"
+		} else {
+			start, source = info.ModTime().Add(-duration), "last change"
+		}
+	}
+	entry.Start, entry.End = start, start.Add(duration)
+	return entry, source, nil
+}
+
+// importFiles returns the video files of the arguments, searching
+// directories
+func importFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && importExtensions[strings.ToLower(filepath.Ext(path))] {
+				files = append(files, path)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// importDestination returns where a file outside the output directory goes,
+// a name in output/imported that is not taken yet
+func importDestination(file string) string {
+	dir := filepath.Join(outputDir, importedDirName)
+	ext := filepath.Ext(file)
+	base := strings.TrimSuffix(filepath.Base(file), ext)
+	if anonymize {
+		// Legacy names tell as much as the segment names do
+		base = newUUID()
+	}
+	dest := filepath.Join(dir, base+ext)
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(dest); os.IsNotExist(err) {
+			return dest
+		}
+		dest = filepath.Join(dir, fmt.Sprintf("%s_%d%s", base, i, ext))
+	}
+}
+
+// copyImport copies a file to dest through a temporary file, so an
+// interrupted copy is never taken for the recording
+func copyImport(file, dest string) error {
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp := dest + ".part"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if err == nil {
+		err = dst.Sync()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, dest)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// runImportCommand adds existing video files to the catalog, so legacy
+// footage is listed, searched, annotated and exported like recordings
+func runImportCommand(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	var tags []string
+	fs.Func("tag", "Tag the imported segments, like legacy, can be repeated", func(value string) error {
+		if strings.TrimSpace(value) == "" {
+			return fmt.Errorf("empty tag")
+		}
+		tags = append(tags, strings.TrimSpace(value))
+		return nil
+	})
+	userFlag := fs.String("user", "", "User the recordings show, stored in the catalog")
+	moveFlag := fs.Bool("move", false, "Move files outside the output directory to output/imported instead of copying them")
+	dryRunFlag := fs.Bool("dry-run", false, "Only print what would be imported")
+	outputDirFlag := fs.String("output", outputDir, "Directory that holds the recordings and the catalog")
+	envUsage(fs)
+	if err := applyFlagEnv(fs); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	fs.Parse(args)
+	outputDir = *outputDirFlag
+	if fs.NArg() == 0 {
+		consoleInfo("Usage: screen-vibe import [-tag tag]... [-user name] [-move] [-dry-run] <file or directory>...")
+		return 2
+	}
+
+	if err := openCatalog(); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		consoleError("ffprobe is not installed or not in PATH, it comes with ffmpeg")
+		return 1
+	}
+	files, err := importFiles(fs.Args())
+	if err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	entries, err := readCatalog()
+	if err != nil {
+		consoleError("Could not read catalog: %v", err)
+		return 1
+	}
+	known := map[string]bool{}
+	for _, e := range entries {
+		known[e.File] = true
+		if e.Imported != "" {
+			known[e.Imported] = true
+		}
+	}
+
+	absOutput, _ := filepath.Abs(outputDir)
+	imported, failed := 0, 0
+	now, user := time.Now(), loginUser()
+	for _, file := range files {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			consoleWarn("%s: %v", file, err)
+			failed++
+			continue
+		}
+		rel, err := filepath.Rel(absOutput, abs)
+		inside := err == nil && filepath.IsLocal(rel)
+		if known[abs] || inside && known[filepath.ToSlash(rel)] {
+			consoleInfo("%s is in the catalog already", file)
+			continue
+		}
+		entry, source, err := probeImport(file)
+		if err != nil {
+			consoleWarn("Skipped %s: %v", file, err)
+			failed++
+			continue
+		}
+		entry.User, entry.Imported = *userFlag, abs
+		dest := abs
+		entry.File = filepath.ToSlash(rel)
+		if !inside {
+			dest = importDestination(file)
+			entry.File = relativeToOutput(dest)
+		}
+		fmt.Printf("%s  %s  %10s  %s (start from the %s)\n", entry.Start.Local().Format("2006-01-02 15:04:05"),
+			entry.End.Sub(entry.Start).Round(time.Second), formatFileSize(entry.Size), entry.File, source)
+		if *dryRunFlag {
+			imported++
+			continue
+		}
+
+		if !inside {
+			if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+				consoleError("%v", err)
+				return 1
+			}
+			// A move to another file system is a copy
+			moved := *moveFlag && os.Rename(abs, dest) == nil
+			if !moved {
+				if err := copyImport(abs, dest); err != nil {
+					consoleWarn("Could not copy %s: %v", file, err)
+					failed++
+					continue
+				}
+				if *moveFlag {
+					os.Remove(abs)
+				}
+			}
+		}
+		if err := appendCatalogEntry(entry); err != nil {
+			consoleError("Could not update catalog: %v", err)
+			return 1
+		}
+		var annotations []annotation
+		for _, t := range tags {
+			annotations = append(annotations, annotation{Time: now, User: user, File: entry.File, Action: "tag", Value: t})
+		}
+		if len(annotations) > 0 {
+			if err := appendAnnotations(annotations); err != nil {
+				consoleWarn("Could not tag %s: %v", entry.File, err)
+			}
+		}
+		known[abs] = true
+		imported++
+	}
+
+	if *dryRunFlag {
+		consoleInfo("Found %d recordings to import, run without -dry-run to import them", imported)
+	} else {
+		consoleInfo("Imported %d recordings into the catalog of %s", imported, outputDir)
+	}
+	if failed > 0 {
+		consoleWarn("%d files could not be imported", failed)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Segment files changed this recently at startup may belong to another
+// recorder writing to the same output directory
+const reconcileQuietTime = time.Minute
+
+// appendSynced appends data to the log at path and syncs it to disk before
+// it returns, so a record that was reported written survives a power loss
+func appendSynced(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// replaceFile writes data to a temporary file, syncs it and renames it over
+// path. After a crash path holds either the old or the new data, never a
+// renamed file whose data did not reach the disk.
+func replaceFile(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// syncDir syncs a directory so a rename in it is on disk. Windows cannot
+// sync directories and commits renames itself, so errors are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// repairLogTail cuts a record that a power loss left half written off the
+// end of a JSON lines log, with the zeros some file systems leave after
+// it, and reports whether it did
+func repairLogTail(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	complete := bytes.TrimRight(data, "\x00")
+	complete = complete[:bytes.LastIndexByte(complete, '\n')+1]
+	if len(complete) == len(data) {
+		return false, nil
+	}
+	return true, os.Truncate(path, int64(len(complete)))
+}
+
+// recoverCatalog brings the catalog and logs back in line with the output
+// directory after the recorder ended without shutting down, e.g. in a
+// power loss: half written records are cut off, segments that were
+// recorded but not cataloged are added and segments whose files are gone
+// are marked lost, or unmarked when their files are back
+func recoverCatalog() {
+	os.Remove(catalogPath() + ".tmp")
+	for _, path := range []string{catalogPath(), annotationsPath(), accessLogPath(), filepath.Join(outputDir, focusLogFileName)} {
+		if repaired, err := repairLogTail(path); err != nil {
+			consoleWarn("Could not check %s: %v", path, err)
+		} else if repaired {
+			consoleWarn("Removed a record of %s that was not completely written", path)
+		}
+	}
+
+	found, err := reconcileCatalog(false, true)
+	if err != nil {
+		consoleWarn("Could not reconcile the catalog with the output directory: %v", err)
+		return
+	}
+	counts := map[string]int{}
+	for _, d := range found {
+		counts[d.kind]++
+	}
+	if n := counts["uncataloged"]; n > 0 {
+		consoleWarn("Added %d segments to the catalog that were recorded but not cataloged, e.g. in a power loss; the reconcile command reads their duration", n)
+	}
+	if n := counts["missing"]; n > 0 {
+		consoleWarn("Marked %d segments as lost in the catalog, their files are missing from %s", n, outputDir)
+	}
+	if n := counts["found"]; n > 0 {
+		consoleInfo("Found the files of %d segments that were marked as lost", n)
+	}
+	if n := counts["size"]; n > 0 {
+		consoleWarn("Corrected the size of %d segments in the catalog", n)
+	}
+}
+
+// orphanedSegments returns catalog entries for the segment files in the
+// output directory that the catalog does not list. Their start is read
+// from the file name, anonymized names have none; the end is the last time
+// the file was written.
+func orphanedSegments(cataloged map[string]bool, now time.Time) []catalogEntry {
+	var orphans []catalogEntry
+	skip := map[string]bool{clipsDirName: true, reviewDirName: true, signageDirName: true, uiAlertsDirName: true}
+	filepath.WalkDir(outputDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != outputDir && skip[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel := relativeToOutput(path)
+		ext := filepath.Ext(path)
+		if ext != ".mkv" && ext != ".mp4" || cataloged[rel] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || now.Sub(info.ModTime()) < reconcileQuietTime {
+			return nil
+		}
+		base := strings.TrimSuffix(path, ext)
+		entry := catalogEntry{File: rel, End: info.ModTime(), Size: info.Size(), Recovered: true}
+		entry.Start = entry.End
+		if start, err := time.ParseInLocation(segmentNameLayout, segmentNamePrefix(path), time.Local); err == nil {
+			entry.Start = start
+		}
+		if strings.HasSuffix(base, "_window") {
+			base = strings.TrimSuffix(base, "_window")
+		}
+		if _, err := os.Stat(base + ".log"); err == nil {
+			entry.Log = relativeToOutput(base + ".log")
+		}
+		orphans = append(orphans, entry)
+		return nil
+	})
+	return orphans
+}
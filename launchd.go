@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Default label of the LaunchAgent
+const defaultLaunchdLabel = "com.screenvibe.recorder"
+
+// launchAgent describes the LaunchAgent that runs the recorder at login
+type launchAgent struct {
+	label      string
+	program    string
+	args       []string
+	workingDir string
+	logFile    string
+	env        map[string]string
+}
+
+// plist renders the LaunchAgent property list. The recorder is restarted
+// whenever it exits and only runs in graphical login sessions, where screen
+// capture is possible.
+func (a launchAgent) plist() []byte {
+	var b bytes.Buffer
+	str := func(s string) string {
+		var e bytes.Buffer
+		xml.EscapeText(&e, []byte(s))
+		return "<string>" + e.String() + "</string>"
+	}
+
+	b.WriteString(xml.Header)
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString("<plist version=\"1.0\">\n<dict>\n")
+	fmt.Fprintf(&b, "\t<key>Label</key>\n\t%s\n", str(a.label))
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, arg := range append([]string{a.program}, a.args...) {
+		fmt.Fprintf(&b, "\t\t%s\n", str(arg))
+	}
+	b.WriteString("\t</array>\n")
+	fmt.Fprintf(&b, "\t<key>WorkingDirectory</key>\n\t%s\n", str(a.workingDir))
+	fmt.Fprintf(&b, "\t<key>StandardOutPath</key>\n\t%s\n", str(a.logFile))
+	fmt.Fprintf(&b, "\t<key>StandardErrorPath</key>\n\t%s\n", str(a.logFile))
+	if len(a.env) > 0 {
+		keys := make([]string, 0, len(a.env))
+		for k := range a.env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b.WriteString("\t<key>EnvironmentVariables</key>\n\t<dict>\n")
+		for _, k := range keys {
+			fmt.Fprintf(&b, "\t\t<key>%s</key>\n\t\t%s\n", k, str(a.env[k]))
+		}
+		b.WriteString("\t</dict>\n")
+	}
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n")
+	b.WriteString("\t<key>KeepAlive</key>\n\t<true/>\n")
+	b.WriteString("\t<key>ThrottleInterval</key>\n\t<integer>10</integer>\n")
+	b.WriteString("\t<key>ProcessType</key>\n\t<string>Interactive</string>\n")
+	b.WriteString("\t<key>LimitLoadToSessionType</key>\n\t<string>Aqua</string>\n")
+	b.WriteString("</dict>\n</plist>\n")
+	return b.Bytes()
+}
+
+// launchAgentPath returns the plist file of a LaunchAgent label
+func launchAgentPath(label string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", label+".plist"), nil
+}
+
+// launchdEnvironment returns the environment passed to the recorder: the
+// PATH, so ffmpeg from Homebrew is found, and the SCREEN_VIBE_* secrets
+func launchdEnvironment() map[string]string {
+	env := map[string]string{"PATH": os.Getenv("PATH")}
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(k, "SCREEN_VIBE_") {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// runLaunchdCommand installs or removes the LaunchAgent that starts the
+// recorder at login on macOS
+func runLaunchdCommand(args []string) int {
+	if len(args) == 0 || (args[0] != "install" && args[0] != "uninstall") {
+		fmt.Println("Usage: screen-vibe launchd install [-label name] [-dir path] [-- recorder flags]")
+		fmt.Println("       screen-vibe launchd uninstall [-label name]")
+		return 2
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("launchd "+action, flag.ExitOnError)
+	labelFlag := fs.String("label", defaultLaunchdLabel, "Label of the LaunchAgent")
+	dirFlag := fs.String("dir", "", "Working directory of the recorder, the output directory is created in it (default: current directory)")
+	printFlag := fs.Bool("print", false, "Print the LaunchAgent instead of installing it")
+	fs.Parse(args[1:])
+
+	if runtime.GOOS != "darwin" && !*printFlag {
+		consoleError("LaunchAgents are only supported on macOS")
+		return 1
+	}
+	path, err := launchAgentPath(*labelFlag)
+	if err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	domain := fmt.Sprintf("gui/%d", os.Getuid())
+
+	if action == "uninstall" {
+		// Stops the recorder, an agent that is not loaded is fine
+		exec.Command("launchctl", "bootout", domain+"/"+*labelFlag).Run()
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			consoleError("Could not remove %s: %v", path, err)
+			return 1
+		}
+		consoleInfo("Removed LaunchAgent %s", *labelFlag)
+		return 0
+	}
+
+	program, err := os.Executable()
+	if err == nil {
+		program, err = filepath.EvalSymlinks(program)
+	}
+	if err != nil {
+		consoleError("Could not find the screen-vibe executable: %v", err)
+		return 1
+	}
+	workingDir := *dirFlag
+	if workingDir == "" {
+		workingDir, _ = os.Getwd()
+	}
+	if workingDir, err = filepath.Abs(workingDir); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	home, _ := os.UserHomeDir()
+	agent := launchAgent{
+		label:      *labelFlag,
+		program:    program,
+		args:       fs.Args(),
+		workingDir: workingDir,
+		logFile:    filepath.Join(home, "Library", "Logs", "screen-vibe", *labelFlag+".log"),
+		env:        launchdEnvironment(),
+	}
+
+	if *printFlag {
+		os.Stdout.Write(agent.plist())
+		return 0
+	}
+
+	for _, dir := range []string{filepath.Dir(path), filepath.Dir(agent.logFile), workingDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			consoleError("Could not create %s: %v", dir, err)
+			return 1
+		}
+	}
+	// The plist may contain SMTP and catalog secrets
+	if err := os.WriteFile(path, agent.plist(), 0600); err != nil {
+		consoleError("Could not write %s: %v", path, err)
+		return 1
+	}
+
+	// Replace a loaded agent with the new definition
+	exec.Command("launchctl", "bootout", domain+"/"+*labelFlag).Run()
+	if out, err := exec.Command("launchctl", "bootstrap", domain, path).CombinedOutput(); err != nil {
+		consoleError("Could not load %s: %v %s", path, err, strings.TrimSpace(string(out)))
+		return 1
+	}
+	consoleInfo("Installed LaunchAgent %s (%s)", *labelFlag, path)
+	consoleInfo("The recorder starts at login, its output is logged to %s", agent.logFile)
+	return 0
+}
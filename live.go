@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	// Largest RTP packet ffmpeg sends, small enough for SRTP over links
+	// with a smaller MTU than ethernet, like VPNs
+	liveRTPPacketSize = 1200
+	// Viewers of the live view at once, each gets its own copy of the stream
+	maxLiveViewers = 8
+	// Time the answer to a viewer waits for the local ICE candidates
+	liveGatherTimeout = 10 * time.Second
+	// Clock rate of H.264 over RTP
+	liveClockRate = 90000
+)
+
+// Global variables of the live view
+var liveView bool
+var live *liveServer
+
+// liveOutput is the RTP URL ffmpeg sends the live view to, empty without
+// one
+var liveOutput string
+
+// livePage plays the live view in the browser. It sends its offer with all
+// ICE candidates and plays the answer, like a WHEP player without trickle.
+var livePage = template.Must(template.New("live").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<title>screen-vibe live</title>
+<style>
+body { margin: 0; background: #000; color: #ccc; font-family: sans-serif; }
+video { width: 100vw; height: 100vh; object-fit: contain; }
+p { position: fixed; top: 0; left: 0; margin: 0.5em 1em; }
+</style>
+</head>
+<body>
+<video autoplay muted playsinline></video>
+<p>{{.T "Connecting..."}}</p>
+<script>
+const video = document.querySelector("video"), state = document.querySelector("p");
+const pc = new RTCPeerConnection();
+pc.addTransceiver("video", {direction: "recvonly"});
+pc.ontrack = e => { video.srcObject = e.streams[0]; };
+pc.onconnectionstatechange = () => {
+  state.textContent = pc.connectionState === "connected" ? "" : {{.T "Live view"}} + " " + pc.connectionState;
+};
+(async () => {
+  await pc.setLocalDescription(await pc.createOffer());
+  await new Promise(done => {
+    if (pc.iceGatheringState === "complete") return done();
+    pc.onicegatheringstatechange = () => pc.iceGatheringState === "complete" && done();
+  });
+  const res = await fetch("live", {method: "POST", headers: {"Content-Type": "application/sdp"}, body: pc.localDescription.sdp});
+  if (!res.ok) throw new Error(await res.text());
+  await pc.setRemoteDescription({type: "answer", sdp: await res.text()});
+})().catch(err => { state.textContent = {{.T "Live view failed:"}} + " " + err.message; });
+</script>
+</body>
+</html>
+`))
+
+// liveServer hands the H.264 stream of the recording ffmpeg to the WebRTC
+// viewers of -live. ffmpeg sends RTP to a loopback port that outlives the
+// segments, so viewers stay connected across rotations and restarts.
+type liveServer struct {
+	conn *net.UDPConn
+	// Port ffmpeg sends the RTP packets from, packets from other ports are
+	// of other local users
+	source int
+	track  *webrtc.TrackLocalStaticRTP
+	sync.Mutex
+	// Connected viewers and the ones negotiating, which hold their slot
+	// already
+	peers map[*webrtc.PeerConnection]struct{}
+}
+
+// startLiveView listens for the RTP stream of ffmpeg on a loopback port and
+// sets liveOutput to it
+func startLiveView() error {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return fmt.Errorf("could not listen for the live view stream: %v", err)
+	}
+	track, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: liveClockRate}, "screen", "screen-vibe")
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	// Any local user can send to the port, so ffmpeg sends from ports picked
+	// here and forward drops the packets from other ports. Who takes one of
+	// them first only fails the optional live output of ffmpeg.
+	ports, err := freeLoopbackPorts(2)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("could not pick the ports of the live view stream: %v", err)
+	}
+	live = &liveServer{conn: conn, source: ports[0], track: track, peers: make(map[*webrtc.PeerConnection]struct{})}
+	// ffmpeg sends its sender reports to the same port, from the second
+	// port, forward drops them
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	liveOutput = fmt.Sprintf("rtp://127.0.0.1:%d?pkt_size=%d&rtcpport=%d&localrtpport=%d&localrtcpport=%d", port, liveRTPPacketSize, port, ports[0], ports[1])
+	go live.forward()
+	return nil
+}
+
+// freeLoopbackPorts returns n UDP ports that are free on the loopback
+// interface
+func freeLoopbackPorts(n int) ([]int, error) {
+	ports := make([]int, 0, n)
+	for range n {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		ports = append(ports, conn.LocalAddr().(*net.UDPAddr).Port)
+	}
+	return ports, nil
+}
+
+// stopLiveView disconnects the viewers
+func stopLiveView() {
+	if live == nil {
+		return
+	}
+	live.conn.Close()
+	live.Lock()
+	peers := live.peers
+	live.peers = nil
+	live.Unlock()
+	for pc := range peers {
+		pc.Close()
+	}
+}
+
+// forward copies the RTP packets of ffmpeg to the viewers. Every ffmpeg
+// starts its own sequence numbers and timestamps, which are continued
+// across segments so the players of the viewers neither wait for the
+// packets in between nor drop the frames of the next segment as late.
+func (l *liveServer) forward() {
+	buf := make([]byte, 1500)
+	var pkt rtp.Packet
+	var ssrc, offset, last uint32
+	var seq uint16
+	var lastAt time.Time
+	for {
+		n, from, err := l.conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			return
+		}
+		if int(from.Port()) != l.source || !from.Addr().Unmap().IsLoopback() {
+			continue
+		}
+		// RTCP packet types 192 to 223 overlap RTP payload types 64 to 95,
+		// which ffmpeg does not use for H.264
+		if n < 2 || buf[1] >= 192 && buf[1] <= 223 {
+			continue
+		}
+		if err := pkt.Unmarshal(buf[:n]); err != nil {
+			continue
+		}
+		if pkt.SSRC != ssrc {
+			ssrc, offset = pkt.SSRC, -pkt.Timestamp
+			if !lastAt.IsZero() {
+				offset += last + uint32(time.Since(lastAt).Seconds()*liveClockRate)
+			}
+		}
+		pkt.Timestamp += offset
+		pkt.SequenceNumber = seq
+		seq++
+		last, lastAt = pkt.Timestamp, time.Now()
+		l.track.WriteRTP(&pkt)
+	}
+}
+
+// viewers returns the number of connected viewers
+func (l *liveServer) viewers() int {
+	l.Lock()
+	defer l.Unlock()
+	return len(l.peers)
+}
+
+// page serves the player of the live view
+func (l *liveServer) page(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := livePage.Execute(w, requestText(r)); err != nil {
+		consoleWarn("Could not show the live view: %v", err)
+	}
+}
+
+// offer connects a viewer: it answers the SDP offer of the player with the
+// video track, once the local ICE candidates are gathered
+func (l *liveServer) offer(w http.ResponseWriter, r *http.Request) {
+	if crossOrigin(r) {
+		http.Error(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+		return
+	}
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != "application/sdp" {
+		http.Error(w, "Send the SDP offer as application/sdp", http.StatusUnsupportedMediaType)
+		return
+	}
+	offer, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The viewer holds its slot while it negotiates, so viewers that offer
+	// at once cannot pass the limit together
+	l.Lock()
+	switch {
+	case l.peers == nil:
+		l.Unlock()
+		pc.Close()
+		http.Error(w, "The live view stopped", http.StatusServiceUnavailable)
+		return
+	case len(l.peers) >= maxLiveViewers:
+		l.Unlock()
+		pc.Close()
+		http.Error(w, fmt.Sprintf("The live view has %d viewers already", maxLiveViewers), http.StatusServiceUnavailable)
+		return
+	}
+	l.peers[pc] = struct{}{}
+	l.Unlock()
+	drop := func() {
+		l.Lock()
+		delete(l.peers, pc)
+		l.Unlock()
+		pc.Close()
+	}
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			drop()
+		}
+	})
+	answer, err := l.answer(pc, string(offer), r)
+	if err != nil {
+		drop()
+		http.Error(w, "Could not connect the live view: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/sdp")
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, answer)
+}
+
+// answer adds the video track to pc and returns the answer to offer
+func (l *liveServer) answer(pc *webrtc.PeerConnection, offer string, r *http.Request) (string, error) {
+	sender, err := pc.AddTrack(l.track)
+	if err != nil {
+		return "", err
+	}
+	// Reading the receiver reports lets pion answer the NACKs of the viewer
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := sender.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer}); err != nil {
+		return "", err
+	}
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		return "", err
+	}
+	gathered := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(answer); err != nil {
+		return "", err
+	}
+	select {
+	case <-gathered:
+	case <-r.Context().Done():
+		return "", r.Context().Err()
+	case <-time.After(liveGatherTimeout):
+		return "", fmt.Errorf("no ICE candidates after %s", liveGatherTimeout)
+	}
+	return pc.LocalDescription().SDP, nil
+}
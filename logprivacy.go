@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Environment variable holding the key of the -log-privacy hash
+const logKeyEnv = "SCREEN_VIBE_LOG_KEY"
+
+// Replacement of the values -log-privacy omit removes
+const omittedLogValue = "(omitted)"
+
+// logPrivacy is how window titles, user names and paths appear in the logs
+// and the focus sidecars: off, hash or omit
+var logPrivacy = "off"
+
+// logKey keys the hashes, so names cannot be found by hashing guesses
+var logKey []byte
+
+// privateLogKeys are the log attributes whose whole value is private
+var privateLogKeys = map[string]bool{
+	"user":   true,
+	"window": true,
+	"title":  true,
+	"label":  true,
+	"output": true,
+	"file":   true,
+}
+
+// privateLogValues are the names known to the recorder, like the user and
+// the output directory, that are replaced wherever they show up in a line
+var privateLogValues struct {
+	sync.Mutex
+	values []string
+}
+
+// initLogPrivacy reads the hash key and collects the names the recorder
+// knows of, call it once the flags are set
+func initLogPrivacy() {
+	if key := os.Getenv(logKeyEnv); key != "" {
+		logKey = []byte(key)
+	}
+	addPrivateLogValue(loginUser())
+	if home, err := os.UserHomeDir(); err == nil {
+		addPrivateLogValue(home)
+	}
+	for _, dir := range []string{outputDir, spillDir} {
+		if dir == "" || dir == "." {
+			continue
+		}
+		addPrivateLogValue(dir)
+		if abs, err := filepath.Abs(dir); err == nil {
+			addPrivateLogValue(abs)
+		}
+	}
+	addPrivateLogValue(windowTitle)
+	for _, title := range blurWindowTitles {
+		addPrivateLogValue(title)
+	}
+}
+
+// addPrivateLogValue adds a name to replace in every log line
+func addPrivateLogValue(s string) {
+	if logPrivacy == "off" || strings.TrimSpace(s) == "" {
+		return
+	}
+	privateLogValues.Lock()
+	defer privateLogValues.Unlock()
+	for _, v := range privateLogValues.values {
+		if v == s {
+			return
+		}
+	}
+	// Longer values first, a home directory goes before the user in it
+	privateLogValues.values = append(privateLogValues.values, s)
+	sort.SliceStable(privateLogValues.values, func(i, j int) bool {
+		return len(privateLogValues.values[i]) > len(privateLogValues.values[j])
+	})
+}
+
+// privateLogText returns how a private value is logged: a short keyed hash
+// that stays the same for the same value, or nothing at all
+func privateLogText(s string) string {
+	switch {
+	case logPrivacy == "off" || s == "":
+		return s
+	case logPrivacy == "omit":
+		return omittedLogValue
+	}
+	h := hmac.New(sha256.New, logKey)
+	h.Write([]byte(s))
+	return "#" + hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// scrubLogLine replaces the known private names in a line, like the output
+// path in an ffmpeg line. Names are only replaced as whole words, a user
+// named pi keeps pix_fmt intact.
+func scrubLogLine(line string) string {
+	if logPrivacy == "off" {
+		return line
+	}
+	privateLogValues.Lock()
+	values := privateLogValues.values
+	privateLogValues.Unlock()
+	for _, v := range values {
+		line = replaceWord(line, v, privateLogText(v))
+	}
+	return line
+}
+
+// replaceWord replaces old in s where it is not part of a longer word
+func replaceWord(s, old, repl string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, old)
+		if i < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		end := i + len(old)
+		before, _ := utf8.DecodeLastRuneInString(s[:i])
+		after, _ := utf8.DecodeRuneInString(s[end:])
+		b.WriteString(s[:i])
+		if isWordRune(before) && isWordRune([]rune(old)[0]) || isWordRune(after) && isWordRune(lastRune(old)) {
+			b.WriteString(old)
+		} else {
+			b.WriteString(repl)
+		}
+		s = s[end:]
+	}
+}
+
+// isWordRune reports whether r continues a name
+func isWordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+}
+
+// lastRune returns the last rune of s
+func lastRune(s string) rune {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r
+}
+
+// redactLogAttr is the slog ReplaceAttr of the segment logs: private
+// attributes are hashed or omitted, the message and the other values lose
+// the known names and the paths of file errors
+func redactLogAttr(groups []string, a slog.Attr) slog.Attr {
+	if privateLogKeys[a.Key] {
+		return slog.String(a.Key, privateLogText(a.Value.String()))
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, scrubLogLine(a.Value.String()))
+	case slog.KindAny:
+		err, ok := a.Value.Any().(error)
+		if !ok {
+			return a
+		}
+		// Pipes are named |0 and the like, they reveal nothing
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) && !strings.HasPrefix(pathErr.Path, "|") {
+			msg := strings.ReplaceAll(err.Error(), pathErr.Path, privateLogText(pathErr.Path))
+			return slog.String(a.Key, scrubLogLine(msg))
+		}
+		return slog.String(a.Key, scrubLogLine(err.Error()))
+	}
+	return a
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -12,7 +13,10 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -20,141 +24,1433 @@ import (
 const (
 	// Check interval in seconds
 	checkInterval = 5
+	// Bytes per second of bitrate ffmpeg may still write between the size
+	// check and the end of the segment, finishing frames and the trailer
+	sizeStopHeadroom = time.Second
 	// Default maximum file size in megabytes (1GB)
 	defaultMaxFileSizeMB = 1024
 )
 
+// Directory that holds recordings, logs and the catalog
+var outputDir = "output"
+
 // Global variables for command line settings
 var maxFileSizeBytes int64
+var sizeCheckInterval = checkInterval * time.Second
 var manualDisplayID string
 var fps int
 var useH264 bool
 var preset string
 var bitrate int
+var outputLayout string
+var wallclockTimestamps bool
+var anonymize bool
+var streamOutput bool
+var streamFormat string
+
+// rotateRequests asks the recording session to start a new segment
+var rotateRequests = make(chan string, 1)
+
+// controlRequests asks the recording session to start, stop or pause recording
+var controlRequests = make(chan string, 4)
+
+// holdState is "paused" or "stopped" while recording is held, see recorderHold
+var holdState atomic.Value
+
+// stateHooks are called whenever recording starts, stops or is paused
+var stateHooks []func(recorderStatus)
+
+// activeLog is the logger of the segment being recorded
+var activeLog atomic.Pointer[slog.Logger]
+
+// segmentInfo describes the segment being recorded
+type segmentInfo struct {
+	file    string
+	log     string
+	start   time.Time
+	encoder string
+	display string
+
+	stop     chan bool                 // finishes the segment
+	progress *segmentProgress          // progress of its ffmpeg
+	handover atomic.Pointer[time.Time] // first frame of the overlapping next segment
+}
+
+// activeSegment is the segment being recorded, nil between segments
+var activeSegment atomic.Pointer[segmentInfo]
+
+// lastSegmentFile is the absolute path of the last finished segment
+var lastSegmentFile atomic.Pointer[string]
 
 func main() {
+	setupConsole()
+	setLanguage(detectLanguage()) // English for unknown languages
+	recorderArgs := os.Args[1:]
+	var runArgs []string
+
+	// Run a subcommand if one is given instead of flags
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "catalog":
+			os.Exit(runCatalogCommand(os.Args[2:]))
+		case "logs":
+			os.Exit(runLogsCommand(os.Args[2:]))
+		case "ctl":
+			os.Exit(runCtlCommand(os.Args[2:]))
+		case "launchd":
+			os.Exit(runLaunchdCommand(os.Args[2:]))
+		case "usage":
+			os.Exit(runUsageCommand(os.Args[2:]))
+		case "supervisor":
+			os.Exit(runSupervisorCommand(os.Args[2:]))
+		case "transcode-watch":
+			os.Exit(runTranscodeWatchCommand(os.Args[2:]))
+		case "annotate":
+			os.Exit(runAnnotateCommand(os.Args[2:]))
+		case "hold":
+			os.Exit(runHoldCommand(os.Args[2:]))
+		case "access-log":
+			os.Exit(runAccessLogCommand(os.Args[2:]))
+		case "fleet":
+			os.Exit(runFleetCommand(os.Args[2:]))
+		case "export":
+			os.Exit(runExportCommand(os.Args[2:]))
+		case "frames":
+			os.Exit(runFramesCommand(os.Args[2:]))
+		case "reconcile":
+			os.Exit(runReconcileCommand(os.Args[2:]))
+		case "import":
+			os.Exit(runImportCommand(os.Args[2:]))
+		case "view":
+			os.Exit(runViewCommand(os.Args[2:]))
+		case "backup":
+			os.Exit(runBackupCommand(os.Args[2:]))
+		case "open-last", "open-output":
+			os.Exit(runOpenCommand(os.Args[1], os.Args[2:]))
+		case "validate":
+			os.Exit(runValidateCommand(os.Args[2:]))
+		case "self-update":
+			os.Exit(runSelfUpdateCommand(os.Args[2:]))
+		case "version":
+			os.Exit(runVersionCommand(os.Args[2:]))
+		case "run":
+			// Record a command: recorder flags come before "--"
+			var command []string
+			recorderArgs, command = splitRunArgs(os.Args[2:])
+			if len(command) == 0 {
+				consoleInfo("Usage: screen-vibe run [flags] -- <command> [args...]")
+				os.Exit(exitConfigError)
+			}
+			runArgs = command
+		}
+	}
+
+	// Exit with the status of a recorded command, after all cleanup ran
+	defer func() {
+		if code := childExitCode(); code != 0 {
+			os.Exit(code)
+		}
+	}()
+
 	// Parse command line flags
 	maxFileSizeMB := flag.Int("size", defaultMaxFileSizeMB, "Maximum file size in megabytes (default: 1024 MB / 1 GB)")
+	checkIntervalFlag := flag.Duration("check-interval", checkInterval*time.Second, "How often the size of the segment is checked against -size, besides every size ffmpeg reports (default: 5s)")
 	displayID := flag.String("display", "", "Display ID to record (default: auto-detect)")
+	regionFlag := flag.String("region", "", "Record only this rectangle of the display, <width>x<height>+<x>+<y> like 1920x1080+100+50 (default: the whole display)")
 	listFlag := flag.Bool("list", false, "List available displays and exit")
 	fpsFlag := flag.Int("fps", 5, "Frames per second for recording (default: 5)")
 	h264Flag := flag.Bool("h264", false, "Use H.264 codec instead of H.265/HEVC (better compatibility)")
-	presetFlag := flag.String("preset", "medium", "Encoding preset (ultrafast, superfast, veryfast, faster, fast, medium, slow, slower)")
+	presetFlag := flag.String("preset", "medium", "Encoding speed/quality preset (ultrafast, superfast, veryfast, faster, fast, medium, slow, slower, veryslow), translated for hardware encoders")
 	bitrateFlag := flag.Int("bitrate", 700, "Video bitrate in kbit/s (default: 700)")
-	flag.Parse()
+	smtpFlag := flag.String("smtp", "", "SMTP server (host:port) used for email alerts (default: disabled)")
+	smtpUserFlag := flag.String("smtp-user", "", "SMTP username (password is read from SCREEN_VIBE_SMTP_PASSWORD)")
+	emailFromFlag := flag.String("email-from", "", "Sender address for email alerts (default: screen-vibe@<hostname>)")
+	emailToFlag := flag.String("email-to", "", "Comma separated recipients for failure alerts and the daily digest")
+	digestFlag := flag.String("digest", "", "Time of day (HH:MM) to send the daily digest email (default: disabled)")
+	instanceFlag := flag.String("instance", "default", "Instance name, used by the logs command to find this recorder")
+	layoutFlag := flag.String("layout", "flat", "Output layout: flat, or session for output/<user>/<date>/<session-id>/")
+	ntpFlag := flag.String("ntp-server", "", "NTP server to check the system clock against at startup and hourly (e.g. pool.ntp.org)")
+	wallclockFlag := flag.Bool("wallclock", false, "Timestamp frames with the wall clock and store the first frame time and drift in the catalog")
+	syncClockFlag := flag.String("sync-clock", "", "NTP server all recorders of a group measure against, stores sync markers in the catalog to align their recordings (implies -wallclock)")
+	watermarkFlag := flag.String("watermark", "", "Overlay an image, as path[@x,y][:opacity] (e.g. logo.png@10,10:0.5)")
+	watermarkTextFlag := flag.String("watermark-text", "", "Overlay a text, {user}, {time} and {date} are replaced (e.g. \"CONFIDENTIAL {user} {time}\")")
+	anonymizeFlag := flag.Bool("anonymize", false, "Name files with random UUIDs and keep time/user/display only in the encrypted catalog (key from SCREEN_VIBE_CATALOG_KEY)")
+	outputFlag := flag.String("o", "", "Use - to write the encoded stream to stdout, or ssh://[user@]host/dir or the URL of a storage extension to write the segments there, instead of files in the output directory")
+	streamFormatFlag := flag.String("stream-format", "matroska", "Container of the stream written with -o -: matroska or mpegts")
+	udpFlag := flag.String("udp", "", "Also send an MPEG-TS stream to a udp:// or rtp:// URL, e.g. udp://239.0.0.1:1234 for multicast")
+	udpOnlyFlag := flag.Bool("udp-only", false, "Only send the -udp stream, do not record files")
+	liveFlag := flag.Bool("live", false, "Experimental: serve a sub-second latency WebRTC live view of the screen at /live of -listen (needs -h264)")
+	cameraFlag := flag.String("camera", "", "Also record a camera: an RTSP URL, or a camera device (/dev/video0 on Linux, the DirectShow name on Windows, the AVFoundation index on macOS)")
+	cameraLayoutFlag := flag.String("camera-layout", "side", "Where -camera goes: side (beside the screen) or track (a second video track of the file)")
+	remoteReviewFlag := flag.Bool("remote-review", false, "Also write a 240p/5fps HLS rendition of every segment to output/review, for review over slow links like 3G")
+	uiCheckFlag := flag.Duration("ui-check", time.Minute, "How often the screen is compared against the -ui-reference images (default: 1m)")
+	uiDiffFlag := flag.Int("ui-diff", 5, "Percent of the picture hash a screen may differ from the closest -ui-reference before it counts as deviating (default: 5)")
+	signageFlag := flag.String("signage", "", "YAML file that turns the recorder into a signage watchdog: stills every minute kept for 7 days, verified against reference images, template images and texts")
+	virtualCameraFlag := flag.String("virtual-camera", "", "Also feed the screen to a v4l2loopback device, e.g. /dev/video10, to share it in video calls (Linux only)")
+	outputDirFlag := flag.String("output", outputDir, "Directory for recordings, logs and the catalog (default: output)")
+	virtualDisplayFlag := flag.String("virtual-display", "", "Record a virtual X display: a size like 1920x1080 starts one, a display like :99 attaches to it (Linux, and Windows with -virtual-display-server monitor)")
+	virtualDisplayServerFlag := flag.String("virtual-display-server", "xvfb", "Server for -virtual-display: xvfb, xephyr, or monitor to add a monitor to the desktop (Linux and Windows)")
+	virtualDisplayDeviceFlag := flag.String("virtual-display-device", "", "Device instance ID of the virtual display driver that -virtual-display-server monitor enables (Windows)")
+	virtualDisplayCommandFlag := flag.String("virtual-display-command", "", "Command to run inside the virtual display, recording stops when it exits")
+	stdinCommandsFlag := flag.Bool("stdin-commands", false, "Read marker <label>, rotate, pause and resume commands from stdin, one per line")
+	appProfilesFlag := flag.String("app-profiles", "", "YAML file with fps, bitrate and region per application, applied to new segments when the application has the focus")
+	focusSubtitlesFlag := flag.Bool("focus-subtitles", false, "Write the focused application and window title over time as subtitle file next to every segment")
+	activityFlag := flag.Bool("activity", false, "Analyze finished segments for screen changes and store the active share and inactive periods in the catalog")
+	transcribeFlag := flag.String("transcribe", "", "Speech-to-text command run on the audio of finished segments, {audio} is replaced by a WAV file and {output} by the segment path without extension")
+	markerClipsFlag := flag.Int("marker-clips", 0, "Export a clip from N seconds before to N seconds after every marker to output/clips once its segment is finished (default: disabled)")
+	manifestFlag := flag.String("manifest", "", "With run: write a JSON manifest (JUnit XML if it ends in .xml) linking the recordings to the command, markers are read from stdin")
+	listenFlag := flag.String("listen", "", "Serve an HTTP API on this address, like 127.0.0.1:8090: POST /start, /stop and /pause, GET /status and /recordings (password in "+listenPasswordEnv+")")
+	dbusFlag := flag.Bool("dbus", false, "Expose org.screenvibe.Recorder with Start/Stop/Pause/Status on the session bus (Linux only)")
+	statusJSONFlag := flag.Bool("status-json", false, "Write newline-delimited JSON status events to stdout, console output goes to stderr")
+	statusFileFlag := flag.String("status-file", "", "Keep a JSON file with state, config hash, last error and last segment at this path, for configuration management health checks")
+	statusIntervalFlag := flag.Int("status-interval", 5, "Seconds between progress events of -status-json (default: 5)")
+	progressLogFlag := flag.Int("progress-log", 120, "Write every Nth ffmpeg progress line to the log, 0 for only significant changes (default: 120, about once a minute)")
+	retentionFlag := flag.Duration("retention", 0, "Delete segments with their logs, subtitles and clips this long (e.g. 2160h) after they ended, except under legal hold (default: keep all)")
+	audioMicFlag := flag.String("audio-mic", "", "Record a microphone on its own audio track: a PulseAudio source on Linux, the DirectShow name on Windows, the AVFoundation index on macOS")
+	audioFlag := flag.String("audio", "", "Record mic, system or both audio sources with the default devices, named by -audio-mic and -audio-system where the OS has no defaults")
+	audioCodecFlag := flag.String("audio-codec", "aac", "Codec of the audio tracks: aac or opus")
+	audioBitrateFlag := flag.Int("audio-bitrate", 128, "Bitrate of every audio track in kbit/s")
+	audioSystemFlag := flag.String("audio-system", "", "Record the system audio on its own audio track: a PulseAudio monitor like @DEFAULT_MONITOR@ on Linux, a loopback device on Windows and macOS")
+	shareFlag := flag.Bool("share", false, "Share profile for pasting clips into chats and tickets: H.264 MP4 segments of at most 10 MB that play while they download, each path copied to the clipboard")
+	clipboardFlag := flag.String("clipboard", "", "Copy each finished segment to the clipboard: path for its file path, or the URL of a view command serving the output directory, like http://nas:8080, for a link to it")
+	meetingsFlag := flag.Bool("meetings", false, "Meetings profile for call-recording compliance: records system audio and microphone, adds a chapter per meeting and needs -retention")
+	meetingsTitleFlag := flag.String("meetings-title", defaultMeetingTitles, "With -meetings: regular expression of the window titles of calls, a meeting starts when one gets the focus")
+	meetingsCalendarFlag := flag.String("meetings-calendar", "", "With -meetings: ICS file whose events are the meetings, instead of the window titles")
+	consentNoticeFlag := flag.String("consent-notice", "", "With -meetings: reminder shown when a meeting starts and stored in the catalog (default: This call is recorded, tell all participants)")
+	tierAfterFlag := flag.Duration("tier-after", 0, "Move segments older than this (e.g. 168h) to the cold storage of an extension, leaving stubs in the catalog (default: keep all local)")
+	dedupeFlag := flag.Bool("dedupe", false, "Skip frames that look the same as the previous one and list the static periods in the catalog, for screens that rarely change")
+	bitrateAdviceFlag := flag.String("bitrate-advice", "suggest", "What to do with the bitrate the quantizer of the first minutes suggests for the screen: off, suggest (log it) or adopt (record at it)")
+	adaptiveFlag := flag.Bool("adaptive", false, "Lower preset, frame rate and then bitrate of the next segment when encoding falls behind real time, with an alert")
+	waylandCaptureFlag := flag.String("wayland-capture", "auto", "Linux capture: portal (PipeWire screen cast through GStreamer), kmsgrab (DRM plane, needs CAP_SYS_ADMIN), x11 (x11grab), or auto to pick portal, then kmsgrab in Wayland sessions and x11grab elsewhere")
+	zeroCopyFlag := flag.Bool("zero-copy", false, "Keep the frames on the GPU from capture to encoder (ddagrab on Windows, kmsgrab and VAAPI on Linux), falling back to the regular capture where that is not possible")
+	spillDirFlag := flag.String("spill-dir", "", "Record into this fast local or tmpfs directory and copy the segments to -output meanwhile, so a slow output disk does not make ffmpeg drop frames")
+	overlapFlag := flag.Bool("overlap", false, "Start the next segment before the current one stops on rotation and trim the overlap, so no frame is lost in between")
+	segmentMuxerFlag := flag.Bool("segment-muxer", false, "Rotate segments inside one ffmpeg with its segment muxer, without a gap, after the time -size takes at the target bitrate")
+	stallTimeoutFlag := flag.Duration("stall-timeout", time.Minute, "Restart ffmpeg when it encodes no new frame for this long, 0 to disable (default: 1m)")
+	maxSessionFlag := flag.Duration("max-session", 0, "Stop recording after this time (e.g. 24h) until it is started again with ctl start (default: no limit)")
+	idleFlag := flag.Duration("idle", 0, "Detect when the user made no input for this long (e.g. 5m) and apply -idle-policy (default: disabled)")
+	logPrivacyFlag := flag.String("log-privacy", "off", "Keep window titles, user names and paths out of the logs and focus sidecars: off, hash (keyed with SCREEN_VIBE_LOG_KEY) or omit")
+	doNotRecordActionFlag := flag.String("do-not-record-action", "pause", "What to do while a -do-not-record window has the focus: pause or blur")
+	idlePolicyFlag := flag.String("idle-policy", "keep", "What to do while the user is idle: keep recording, fps (record at -idle-fps), pause or stop the recorder")
+	idleFPSFlag := flag.Int("idle-fps", 1, "Frames per second while the user is idle with -idle-policy fps (default: 1)")
+	policyFlag := flag.String("policy", "", "Starlark script whose on_event(event) can pause, resume, stop, rotate, set_fps, upload and notify")
+	checkFlag := flag.Bool("check", false, "Check the flags and exit without recording, used by the validate command")
+	langFlag := flag.String("lang", "", "Language of the console messages, e.g. de or es (default: from the system locale)")
+	flag.Func("blur-window", "Blur the window whose title contains this text and follow it when it moves, can be repeated (Windows and X11)", func(title string) error {
+		if strings.TrimSpace(title) == "" {
+			return fmt.Errorf("empty window title")
+		}
+		blurWindowTitles = append(blurWindowTitles, title)
+		return nil
+	})
+	flag.Func("do-not-record", "Pause or blur the recording while the focused window's title or application matches this regular expression (case-insensitive), can be repeated", func(pattern string) error {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return err
+		}
+		doNotRecord = append(doNotRecord, re)
+		return nil
+	})
+	flag.Func("ui-reference", "Alert when the screen matches none of these PNG or JPEG screenshots for two -ui-check stills in a row, like a kiosk showing a crash dialog or nothing, can be repeated", func(path string) error {
+		ref, err := loadUIReference(path)
+		if err != nil {
+			return err
+		}
+		uiReferences = append(uiReferences, ref)
+		return nil
+	})
+	flag.Func("schedule", "Record new segments with other settings in a time of day, as \"HH:MM-HH:MM fps=N bitrate=N\" (e.g. \"22:00-06:00 fps=1 bitrate=200\"), can be repeated", func(spec string) error {
+		w, err := parseScheduleWindow(spec)
+		if err != nil {
+			return err
+		}
+		qualitySchedule = append(qualitySchedule, w)
+		return nil
+	})
+	windowFlag := flag.String("window", "", "Also record the window with this title into its own files, at -window-fps and -window-bitrate (Windows and X11)")
+	windowFPSFlag := flag.Int("window-fps", 15, "Frames per second of the -window recording (default: 15)")
+	windowBitrateFlag := flag.Int("window-bitrate", 2000, "Video bitrate of the -window recording in kbit/s (default: 2000)")
+	sessionSegmentsFlag := flag.Bool("session-segments", false, "Start a new segment on lock/unlock/user switch and tag it with the active user (Windows only)")
+	envUsage(flag.CommandLine)
+	if err := applyFlagEnv(flag.CommandLine); err != nil {
+		consoleError("%v", err)
+		os.Exit(exitConfigError)
+	}
+	flag.CommandLine.Parse(recorderArgs)
+	if *langFlag != "" {
+		if err := setLanguage(*langFlag); err != nil {
+			consoleError("%v", err)
+			os.Exit(exitConfigError)
+		}
+	}
 
 	// Store command settings in global variables
+	outputDir = *outputDirFlag
 	fps = *fpsFlag
+	if err := checkFPS(fps); err != nil {
+		consoleError("%v", err)
+		os.Exit(exitConfigError)
+	}
 	useH264 = *h264Flag
 	preset = *presetFlag
+	if err := checkPreset(preset); err != nil {
+		consoleError("%v", err)
+		os.Exit(exitConfigError)
+	}
+	if runtime.GOOS == "darwin" && preset != "medium" {
+		consoleWarn("-preset has no effect on macOS, VideoToolbox has no presets")
+	}
 	bitrate = *bitrateFlag
+	if err := checkBitrate(bitrate); err != nil {
+		consoleError("%v", err)
+		os.Exit(exitConfigError)
+	}
+	if *maxFileSizeMB < 1 {
+		consoleError("-size must be at least 1 MB")
+		os.Exit(exitConfigError)
+	}
+	smtpServer = *smtpFlag
+	smtpUser = *smtpUserFlag
+	smtpPassword = os.Getenv("SCREEN_VIBE_SMTP_PASSWORD")
+	emailFrom = *emailFromFlag
+	emailTo = parseEmailList(*emailToFlag)
+	digestTime = *digestFlag
+	sessionSegments = *sessionSegmentsFlag
+	maxSession = *maxSessionFlag
+	idleThreshold = *idleFlag
+	idlePolicy = *idlePolicyFlag
+	idleFPS = *idleFPSFlag
+	if err := parseIdlePolicy(idlePolicy); err != nil {
+		consoleError("%v", err)
+		os.Exit(exitConfigError)
+	}
+	if idleFPS < 1 {
+		consoleError("-idle-fps must be at least 1")
+		os.Exit(exitConfigError)
+	}
+	if idlePolicy == "fps" && idleFPS >= fps {
+		consoleWarn("-idle-fps %d is not lower than -fps %d, the fps idle policy has no effect", idleFPS, fps)
+	}
+	if *statusIntervalFlag < 1 {
+		consoleError("-status-interval must be at least 1 second")
+		os.Exit(exitConfigError)
+	}
+	if maxSession < 0 || idleThreshold < 0 {
+		consoleError("-max-session and -idle must not be negative")
+		os.Exit(exitConfigError)
+	}
+	stallTimeout = *stallTimeoutFlag
+	adaptiveQuality = *adaptiveFlag
+	bitrateAdvice = *bitrateAdviceFlag
+	if bitrateAdvice != "off" && bitrateAdvice != "suggest" && bitrateAdvice != "adopt" {
+		consoleError("Unknown -bitrate-advice %q, use off, suggest or adopt", bitrateAdvice)
+		os.Exit(exitConfigError)
+	}
+	dedupeFrames = *dedupeFlag
+	zeroCopy = *zeroCopyFlag
+	overlapRotation = *overlapFlag
+	segmentMuxer = *segmentMuxerFlag
+	spillDir = *spillDirFlag
+	if dedupeFrames && adaptiveQuality {
+		consoleError("-adaptive cannot measure the encode speed of -dedupe recordings, which skip frames")
+		os.Exit(exitConfigError)
+	}
+	if stallTimeout != 0 && stallTimeout < 10*time.Second {
+		consoleError("-stall-timeout must be at least 10s, or 0 to disable it")
+		os.Exit(exitConfigError)
+	}
+	progressLogEvery = *progressLogFlag
+	statusJSON = *statusJSONFlag
+	statusInterval = time.Duration(*statusIntervalFlag) * time.Second
+	statusFilePath = *statusFileFlag
+	streamFormat = *streamFormatFlag
+	if streamFormat != "matroska" && streamFormat != "mpegts" {
+		consoleError("Unknown stream format %q, use matroska or mpegts", streamFormat)
+		os.Exit(exitConfigError)
+	}
+	switch *outputFlag {
+	case "":
+	case "-":
+		streamOutput = true
+		if statusJSON {
+			consoleError("-o - cannot be combined with -status-json, both write to stdout")
+			os.Exit(exitConfigError)
+		}
+		if sessionSegments && streamFormat == "matroska" {
+			consoleError("-session-segments restarts the stream, use -stream-format mpegts with -o -")
+			os.Exit(exitConfigError)
+		}
+	default:
+		target, err := parseRemoteOutput(*outputFlag)
+		if err != nil {
+			consoleError("%v", err)
+			os.Exit(exitConfigError)
+		}
+		remoteOutput = target
+	}
+	if *udpFlag != "" {
+		target, err := parseNetworkOutput(*udpFlag)
+		if err != nil {
+			consoleError("%v", err)
+			os.Exit(exitConfigError)
+		}
+		udpOutput = target
+	}
+	udpOnly = *udpOnlyFlag
+	if *liveFlag {
+		if *listenFlag == "" {
+			consoleError("-live needs -listen, whose HTTP server serves the live view")
+			os.Exit(exitConfigError)
+		}
+		if !useH264 {
+			consoleError("-live needs -h264, WebRTC players do not support H.265")
+			os.Exit(exitConfigError)
+		}
+		liveView = true
+	}
+	if *virtualCameraFlag != "" {
+		if err := checkVirtualCamera(*virtualCameraFlag); err != nil {
+			consoleError("%v", err)
+			os.Exit(exitConfigError)
+		}
+		virtualCamera = *virtualCameraFlag
+	}
+	if udpOnly && (udpOutput == "" || streamOutput || remoteOutput != "") {
+		consoleError("-udp-only needs -udp and cannot be combined with -o")
+		os.Exit(exitConfigError)
+	}
+	if spillDir != "" {
+		if !recordsFiles() {
+			consoleError("-spill-dir only works for recordings to files")
+			os.Exit(exitConfigError)
+		}
+		if err := checkSpillDir(); err != nil {
+			consoleError("Could not create the spill directory: %v", err)
+			os.Exit(exitConfigError)
+		}
+	}
+	if overlapRotation && (!recordsFiles() || udpOutput != "" || liveView || virtualCamera != "") {
+		// Their receivers would get two streams at once
+		consoleError("-overlap only works for recordings to files, without -o, -udp, -live or -virtual-camera")
+		os.Exit(exitConfigError)
+	}
+	cameraSource, cameraLayout = *cameraFlag, *cameraLayoutFlag
+	if cameraLayout != "side" && cameraLayout != "track" {
+		consoleError("Unknown camera layout %q, use side or track", cameraLayout)
+		os.Exit(exitConfigError)
+	}
+	if cameraSource != "" && cameraLayout == "side" && dedupeFrames {
+		// Every camera frame would change the picture
+		consoleError("-camera-layout side cannot be combined with -dedupe, use -camera-layout track")
+		os.Exit(exitConfigError)
+	}
+	if cameraSource != "" && cameraLayout == "track" && liveView {
+		consoleError("-camera-layout track cannot be combined with -live, which carries one video track")
+		os.Exit(exitConfigError)
+	}
+	if statusJSON || streamOutput {
+		// Keep stdout free for the status stream or the recording
+		consoleOut = os.Stderr
+		setupConsole()
+	}
+	instanceName = *instanceFlag
+	outputLayout = *layoutFlag
+	if outputLayout != "flat" && outputLayout != "session" {
+		consoleError("Unknown output layout %q, use flat or session", outputLayout)
+		os.Exit(exitConfigError)
+	}
+	wallclockTimestamps = *wallclockFlag || *syncClockFlag != ""
+	ntpServer = *ntpFlag
+	syncClockServer = *syncClockFlag
+	watermarkText = *watermarkTextFlag
+	if *watermarkFlag != "" {
+		wm, err := parseWatermark(*watermarkFlag)
+		if err != nil {
+			consoleError("%v", err)
+			os.Exit(exitConfigError)
+		}
+		watermarkImage = wm
+	}
+	anonymize = *anonymizeFlag
+	if anonymize {
+		if outputLayout == "session" {
+			consoleError("-anonymize cannot be combined with -layout session, the directories would reveal the user")
+			os.Exit(exitConfigError)
+		}
+		if err := loadCatalogKey(); err != nil {
+			consoleError("%v", err)
+			os.Exit(exitConfigError)
+		}
+		if catalogHeader == nil || legacyCatalogKey != nil {
+			if err := upgradeCatalogKey(); err != nil {
+				consoleError("Could not upgrade the encrypted catalog to a salted key: %v", err)
+				os.Exit(exitConfigError)
+			}
+			consoleInfo("Upgraded the encrypted catalog to a salted key")
+		}
+	}
+
+	// Work with physical pixels on scaled Windows displays
+	if err := enableDPIAwareness(); err != nil {
+		consoleWarn("Could not enable DPI awareness, captures on scaled displays may be cropped: %v", err)
+	}
 
 	// Check if we only need to show available displays
 	if *listFlag {
-		fmt.Println("Available displays that can be used with the -display flag:")
+		consoleInfo("Available displays that can be used with the -display flag:")
 		showAvailableDisplays()
 		return
 	}
 
 	// Convert MB to bytes
 	maxFileSizeBytes = int64(*maxFileSizeMB) * 1024 * 1024
+	if *checkIntervalFlag < 100*time.Millisecond {
+		consoleError("-check-interval must be at least 100ms")
+		os.Exit(exitConfigError)
+	}
+	sizeCheckInterval = *checkIntervalFlag
 
 	// Store display ID in global variable if provided
 	if *displayID != "" {
+		if err := checkDisplayID(runtime.GOOS, *displayID); err != nil {
+			consoleError("%v", err)
+			os.Exit(exitConfigError)
+		}
 		manualDisplayID = *displayID
 	}
 
+	if *virtualDisplayFlag != "" && manualDisplayID != "" {
+		consoleError("-virtual-display cannot be combined with -display")
+		os.Exit(exitConfigError)
+	}
+	if *virtualDisplayDeviceFlag != "" && *virtualDisplayServerFlag != "monitor" {
+		consoleError("-virtual-display-device needs -virtual-display-server monitor")
+		os.Exit(exitConfigError)
+	}
+	virtualDisplayDevice = *virtualDisplayDeviceFlag
+	if *regionFlag != "" {
+		r, err := regionRect(*regionFlag)
+		if err != nil {
+			consoleError("-region: %v", err)
+			os.Exit(exitConfigError)
+		}
+		if *virtualDisplayFlag != "" && *virtualDisplayServerFlag == "monitor" {
+			consoleError("-region cannot be combined with -virtual-display-server monitor, which captures the added monitor")
+			os.Exit(exitConfigError)
+		}
+		captureRegion = &r
+	}
+	if *virtualDisplayFlag == "" && *virtualDisplayCommandFlag != "" {
+		consoleError("-virtual-display-command needs -virtual-display")
+		os.Exit(exitConfigError)
+	}
+	if *manifestFlag != "" {
+		if len(runArgs) == 0 && *virtualDisplayCommandFlag == "" {
+			consoleError("-manifest needs the run command or -virtual-display-command")
+			os.Exit(exitConfigError)
+		}
+		if !recordsFiles() {
+			consoleError("-manifest needs recorded files, it cannot be combined with -o or -udp-only")
+			os.Exit(exitConfigError)
+		}
+		manifestPath = *manifestFlag
+	}
+	if *markerClipsFlag > 0 && !recordsFiles() {
+		consoleError("-marker-clips needs recorded files, it cannot be combined with -o or -udp-only")
+		os.Exit(exitConfigError)
+	}
+	markerClipSeconds = *markerClipsFlag
+	activityAnalysis = *activityFlag && recordsFiles()
+	if *focusSubtitlesFlag {
+		if !recordsFiles() || anonymize {
+			consoleError("-focus-subtitles needs recorded files and cannot be combined with -anonymize, -o or -udp-only")
+			os.Exit(exitConfigError)
+		}
+		focusSubtitles = true
+	}
+	doNotRecordAction = *doNotRecordActionFlag
+	if doNotRecordAction != "pause" && doNotRecordAction != "blur" {
+		consoleError("Unknown -do-not-record-action %q, use pause or blur", doNotRecordAction)
+		os.Exit(exitConfigError)
+	}
+	if *appProfilesFlag != "" {
+		profiles, err := loadAppProfiles(*appProfilesFlag)
+		if err != nil {
+			consoleError("Could not load the application profiles: %v", err)
+			os.Exit(exitConfigError)
+		}
+		appProfiles = profiles
+	}
+	if recordsFiles() {
+		transcribeCommand = strings.TrimSpace(*transcribeFlag)
+	}
+	if len(blurWindowTitles) > 0 {
+		switch {
+		case runtime.GOOS == "darwin":
+			consoleError("-blur-window is not supported on macOS")
+			os.Exit(exitConfigError)
+		case runtime.GOOS == "windows" && strings.HasPrefix(manualDisplayID, "title="):
+			consoleError("-blur-window needs the capture of the desktop or a monitor, not of a window")
+			os.Exit(exitConfigError)
+		case runtime.GOOS != "windows":
+			if _, err := exec.LookPath("xwininfo"); err != nil {
+				consoleError("-blur-window needs xwininfo (x11-utils) to find the windows")
+				os.Exit(exitConfigError)
+			}
+		}
+	}
+	if *tierAfterFlag != 0 {
+		switch {
+		case *tierAfterFlag < 0:
+			consoleError("-tier-after must not be negative")
+			os.Exit(exitConfigError)
+		case !recordsFiles():
+			consoleError("-tier-after needs recorded files, it cannot be combined with -o or -udp-only")
+			os.Exit(exitConfigError)
+		case !hasColdStorage():
+			consoleError("-tier-after needs a cold storage extension compiled in, like one for S3 or SFTP")
+			os.Exit(exitConfigError)
+		}
+		tierAfter = *tierAfterFlag
+	}
+	if *retentionFlag != 0 {
+		switch {
+		case *retentionFlag < 0:
+			consoleError("-retention must not be negative")
+			os.Exit(exitConfigError)
+		case !recordsFiles():
+			consoleError("-retention needs recorded files, it cannot be combined with -o or -udp-only")
+			os.Exit(exitConfigError)
+		case tierAfter > 0:
+			// The recorder cannot delete what it moved to cold storage
+			consoleError("-retention cannot be combined with -tier-after")
+			os.Exit(exitConfigError)
+		}
+		retention = *retentionFlag
+	}
+	if *remoteReviewFlag {
+		switch {
+		case !recordsFiles():
+			consoleError("-remote-review needs recorded files, it cannot be combined with -o or -udp-only")
+			os.Exit(exitConfigError)
+		case spillDir != "":
+			consoleError("-remote-review cannot be combined with -spill-dir, the rendition would stay in the spill directory")
+			os.Exit(exitConfigError)
+		}
+		remoteReview = true
+	}
+	if segmentMuxer && (!recordsFiles() || udpOutput != "" || liveView || overlapRotation || spillDir != "" ||
+		anonymize || remoteReview || *windowFlag != "" || *meetingsFlag) {
+		// ffmpeg names the segments and writes them itself
+		consoleError("-segment-muxer only works for recordings to files, without -o, -udp, -live, -overlap, -spill-dir, -anonymize, -remote-review, -window or -meetings")
+		os.Exit(exitConfigError)
+	}
+	if *signageFlag != "" {
+		if len(uiReferences) > 0 {
+			consoleError("-ui-reference cannot be combined with -signage, list the references in the -signage file")
+			os.Exit(exitConfigError)
+		}
+		config, err := loadSignage(*signageFlag)
+		if err != nil {
+			consoleError("Could not load the signage settings: %v", err)
+			os.Exit(exitConfigError)
+		}
+		signage = config
+	}
+	if watchesUI() {
+		uiCheckInterval, uiDiffPercent = *uiCheckFlag, *uiDiffFlag
+		if signage != nil {
+			uiCheckInterval, uiDiffPercent = signage.Interval, signage.Diff
+		}
+		switch {
+		case uiCheckInterval < 10*time.Second:
+			consoleError("-ui-check must be at least 10s")
+			os.Exit(exitConfigError)
+		case uiDiffPercent < 1 || uiDiffPercent > 100:
+			consoleError("-ui-diff must be between 1 and 100 percent")
+			os.Exit(exitConfigError)
+		}
+		dir := outputDir
+		if signage != nil {
+			dir = signageDir()
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			consoleError("Could not create output directory: %v", err)
+			os.Exit(exitConfigError)
+		}
+	}
+	audioMic, audioSystem = *audioMicFlag, *audioSystemFlag
+	if *audioFlag != "" {
+		if err := selectAudio(runtime.GOOS, *audioFlag); err != nil {
+			consoleError("%v", err)
+			os.Exit(exitConfigError)
+		}
+	}
+	audioCodec, audioKbps = *audioCodecFlag, *audioBitrateFlag
+	switch {
+	case audioCodec != "aac" && audioCodec != "opus":
+		consoleError("Unknown audio codec %q, use aac or opus", audioCodec)
+		os.Exit(exitConfigError)
+	case audioKbps < 16 || audioKbps > 512:
+		consoleError("-audio-bitrate must be between 16 and 512 kbit/s")
+		os.Exit(exitConfigError)
+	}
+	if *meetingsFlag {
+		switch {
+		case !recordsFiles() || anonymize:
+			consoleError("-meetings needs recorded files and cannot be combined with -anonymize, -o or -udp-only")
+			os.Exit(exitConfigError)
+		case retention == 0:
+			consoleError("-meetings needs -retention, call recordings must not be kept longer than allowed")
+			os.Exit(exitConfigError)
+		}
+		if audioMic == "" && audioSystem == "" {
+			audioMic, audioSystem = defaultAudioDevices(runtime.GOOS)
+		}
+		if audioMic == "" || audioSystem == "" {
+			consoleError("-meetings needs -audio-mic and -audio-system on this OS, the system audio through a loopback device like VB-CABLE or BlackHole")
+			os.Exit(exitConfigError)
+		}
+		if *meetingsCalendarFlag != "" {
+			if _, err := readCalendar(*meetingsCalendarFlag); err != nil {
+				consoleError("Could not read the calendar: %v", err)
+				os.Exit(exitConfigError)
+			}
+			meetingCalendar = *meetingsCalendarFlag
+		} else {
+			re, err := regexp.Compile(*meetingsTitleFlag)
+			if err != nil {
+				consoleError("Invalid -meetings-title: %v", err)
+				os.Exit(exitConfigError)
+			}
+			meetingTitleRe = re
+		}
+		consentNotice = *consentNoticeFlag
+		if consentNotice == "" {
+			consentNotice = "This call is recorded, tell all participants"
+		}
+		meetingsProfile = true
+	}
+	if *shareFlag {
+		switch {
+		case !recordsFiles() || udpOutput != "" || liveView:
+			consoleError("-share records MP4 files, it cannot be combined with -o, -udp or -live")
+			os.Exit(exitConfigError)
+		case overlapRotation || segmentMuxer || spillDir != "":
+			// ffmpeg rewrites the MP4 file at its end to move the index
+			consoleError("-share cannot be combined with -overlap, -segment-muxer or -spill-dir")
+			os.Exit(exitConfigError)
+		case *maxFileSizeMB > shareMaxSizeMB && *maxFileSizeMB != defaultMaxFileSizeMB:
+			consoleError("-share records segments of at most %d MB, use a smaller -size", shareMaxSizeMB)
+			os.Exit(exitConfigError)
+		}
+		if *maxFileSizeMB > shareMaxSizeMB {
+			maxFileSizeBytes = shareMaxSizeMB * 1024 * 1024
+		}
+		// Plays in every browser and chat preview
+		useH264 = true
+		shareProfile = true
+	}
+	target, err := parseClipboardTarget(*clipboardFlag)
+	if err != nil {
+		consoleError("Invalid -clipboard: %v", err)
+		os.Exit(exitConfigError)
+	}
+	clipboardTarget = target
+	if clipboardTarget != "" && !recordsFiles() {
+		consoleError("-clipboard needs recorded files, it cannot be combined with -o or -udp-only")
+		os.Exit(exitConfigError)
+	}
+	if shareProfile && clipboardTarget == "" {
+		clipboardTarget = "path"
+	}
+	if *windowFlag != "" {
+		switch {
+		case !recordsFiles():
+			consoleError("-window needs recorded files, it cannot be combined with -o or -udp-only")
+			os.Exit(exitConfigError)
+		case runtime.GOOS == "darwin":
+			consoleError("-window is not supported on macOS, avfoundation cannot capture single windows")
+			os.Exit(exitConfigError)
+		case *windowFPSFlag < minFPS || *windowFPSFlag > maxFPS:
+			consoleError("-window-fps %d is out of range, use %d to %d frames per second", *windowFPSFlag, minFPS, maxFPS)
+			os.Exit(exitConfigError)
+		case *windowBitrateFlag < minBitrate || *windowBitrateFlag > maxBitrate:
+			consoleError("-window-bitrate %d is out of range, use %d to %d kbit/s", *windowBitrateFlag, minBitrate, maxBitrate)
+			os.Exit(exitConfigError)
+		}
+		windowTitle = *windowFlag
+		windowFPS = *windowFPSFlag
+		windowBitrate = *windowBitrateFlag
+	}
+	logPrivacy = *logPrivacyFlag
+	if logPrivacy != "off" && logPrivacy != "hash" && logPrivacy != "omit" {
+		consoleError("Unknown -log-privacy %q, use off, hash or omit", logPrivacy)
+		os.Exit(exitConfigError)
+	}
+	initLogPrivacy()
+	var policy *policyScript
+	if *policyFlag != "" {
+		var err error
+		if policy, err = loadPolicy(*policyFlag); err != nil {
+			consoleError("Could not load the policy: %v", err)
+			os.Exit(exitConfigError)
+		}
+	}
+
+	if recordsFiles() {
+		checkStorage()
+	}
+
+	// Stop before anything is started when only checking the flags
+	if *checkFlag {
+		consoleInfo("The settings are valid")
+		return
+	}
+	if recordsFiles() {
+		recoverCatalog()
+	}
+
 	// Setup signal handling for graceful termination
 	sigs := make(chan os.Signal, 1)
 	done := make(chan bool, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	quitSignals = sigs
 
 	// Check ffmpeg availability
 	if !isFFmpegAvailable() {
-		fmt.Println("Error: ffmpeg is not installed or not in PATH.")
-		os.Exit(1)
+		consoleError("ffmpeg is not installed or not in PATH.")
+		os.Exit(exitFFmpegMissing)
+	}
+	if remoteReview && !ffmpegHasMuxer("hls") {
+		consoleError("This ffmpeg cannot write HLS, which -remote-review needs")
+		os.Exit(exitEncoderUnavailable)
+	}
+
+	// Start or attach to the virtual display before anything looks at the display
+	if *virtualDisplayFlag != "" {
+		vd, err := startVirtualDisplay(*virtualDisplayFlag, *virtualDisplayServerFlag)
+		if err != nil {
+			consoleError("%v", err)
+			os.Exit(exitFailure)
+		}
+		defer vd.stop()
+		upgradeBlocker = "a virtual display"
+		manualDisplayID = vd.display
+		if vd.monitor == nil {
+			os.Setenv("DISPLAY", vd.display)
+			consoleInfo("Recording virtual display %s", vd.display)
+		} else {
+			consoleInfo("Recording virtual monitor %s", vd.display)
+		}
+		if *virtualDisplayCommandFlag != "" && runtime.GOOS == "windows" {
+			runArgs = []string{"cmd", "/c", *virtualDisplayCommandFlag}
+		} else if *virtualDisplayCommandFlag != "" {
+			runArgs = []string{"sh", "-c", *virtualDisplayCommandFlag}
+		}
+	}
+	// x11grab records a Wayland desktop black, except XWayland windows
+	if runtime.GOOS != "linux" && *waylandCaptureFlag != "auto" {
+		consoleError("-wayland-capture is only available on Linux")
+		os.Exit(exitConfigError)
+	} else if runtime.GOOS == "linux" {
+		mode := *waylandCaptureFlag
+		if mode == "auto" && manualDisplayID != "" {
+			// An X display given with -display or -virtual-display
+			mode = "x11"
+		}
+		capture, err := selectLinuxCapture(mode)
+		if err != nil {
+			consoleError("Cannot capture with -wayland-capture %s: %v", mode, err)
+			os.Exit(exitConfigError)
+		}
+		linuxCapture = capture
+	}
+	if linuxCapture != "" && windowTitle != "" {
+		consoleError("-window needs an X11 capture, use -wayland-capture x11 to record XWayland windows")
+		os.Exit(exitConfigError)
+	}
+	switch linuxCapture {
+	case "portal":
+		if err := openScreenCast(); err != nil {
+			consoleError("Could not start the screen cast: %v", err)
+			os.Exit(exitFailure)
+		}
+		defer screenCastSession.close()
+		consoleInfo("Recording the screen cast (PipeWire node %d, %dx%d) through GStreamer", screenCastSession.node, screenCastSession.width, screenCastSession.height)
+	case "kmsgrab":
+		consoleInfo("Recording the DRM plane of %s with kmsgrab", kmsDevice)
+	}
+	if *stdinCommandsFlag || manifestPath != "" {
+		stdinCommands = true
+		go readStdinCommands()
+	}
+	if len(runArgs) > 0 {
+		upgradeBlocker = "a command"
+		startChildCommand(runArgs, sigs)
 	}
 
-	fmt.Printf("Recording with maximum file size of %s\n", formatFileSize(maxFileSizeBytes))
-	fmt.Printf("Recording at %d frames per second\n", fps)
-	fmt.Printf("Video bitrate: %d kbit/s\n", bitrate)
+	if streamOutput {
+		consoleInfo("Writing a %s stream to stdout, no files are created", streamFormat)
+	} else if remoteOutput != "" {
+		consoleInfo("Recording to %s with maximum file size of %s, only the catalog is kept locally", remoteOutput, formatFileSize(maxFileSizeBytes))
+	} else if segmentMuxer {
+		consoleInfo("Recording segments of %s each with the segment muxer of ffmpeg, about %s at the target bitrate",
+			segmentMuxerTime(segmentBitrate()), formatFileSize(int64(float64(maxFileSizeBytes)*segmentMuxerFill)))
+	} else if !udpOnly {
+		consoleInfo("Recording with maximum file size of %s", formatFileSize(maxFileSizeBytes))
+	}
+	if udpOutput != "" {
+		consoleInfo("Sending an MPEG-TS stream to %s", udpOutput)
+	}
+	if virtualCamera != "" {
+		consoleInfo("Sharing the screen as virtual camera %s", virtualCamera)
+	}
+	if remoteReview {
+		consoleInfo("Writing a %dp, %d fps HLS rendition of every segment to the %s directory beside it", reviewHeight, reviewFPS, reviewDirName)
+	}
+	if signage != nil {
+		consoleInfo("Verifying the signage against %d reference images and %d markers every %s, keeping the stills in %s for %s",
+			len(uiReferences), len(signage.Markers), uiCheckInterval, signageDir(), signage.Keep)
+	} else if len(uiReferences) > 0 {
+		consoleInfo("Comparing the screen against %d reference images every %s", len(uiReferences), uiCheckInterval)
+	}
+	consoleInfo("Recording at %d frames per second", fps)
+	consoleInfo("Video bitrate: %d kbit/s", bitrate)
 
 	// Show codec and preset info
 	if useH264 {
-		fmt.Println("Using H.264 codec for better compatibility")
+		consoleInfo("Using H.264 codec for better compatibility")
 	} else {
-		fmt.Println("Using H.265/HEVC codec for better compression")
+		consoleInfo("Using H.265/HEVC codec for better compression")
+	}
+	consoleInfo("Encoding preset: %s", preset)
+	if zeroCopy {
+		if reason := zeroCopySupport(runtime.GOOS); reason != "" {
+			consoleWarn("No zero-copy capture, %s; recording with the regular capture", reason)
+			zeroCopy = false
+		} else {
+			consoleInfo("Zero-copy capture: frames stay on the GPU where the segment settings allow it")
+		}
+	}
+	if anonymize {
+		consoleInfo("Anonymized file names, the catalog is encrypted")
+	}
+	switch logPrivacy {
+	case "hash":
+		consoleInfo("Window titles, user names and paths are hashed in the logs and focus sidecars")
+		if logKey == nil {
+			consoleWarn("%s is not set, hashes of common names can be guessed", logKeyEnv)
+		}
+	case "omit":
+		consoleInfo("Window titles, user names and paths are left out of the logs and focus sidecars")
+	}
+	if outputLayout == "session" {
+		consoleInfo("Organizing output by session: %s", filepath.Join(outputDir, fileTag(loginUser()), "<date>", fileTag(osSessionID())))
+	}
+
+	// Show email settings and start the daily digest
+	if emailEnabled() {
+		consoleInfo("Email alerts will be sent to %s via %s", strings.Join(emailTo, ", "), smtpServer)
+		if digestTime != "" {
+			consoleInfo("Daily digest will be sent at %s", digestTime)
+			startDigestScheduler()
+		}
+	} else if smtpServer != "" || len(emailTo) > 0 || digestTime != "" {
+		consoleWarn("Email alerts need both -smtp and -email-to, emails are disabled")
 	}
-	fmt.Printf("Encoding preset: %s\n", preset)
 
 	// Show available displays if we're not using a manual display ID
 	if manualDisplayID == "" {
 		showAvailableDisplays()
 	} else {
-		fmt.Printf("Using manually specified display: %s\n", manualDisplayID)
+		consoleInfo("Using manually specified display: %s", manualDisplayID)
+	}
+
+	// Make sure timestamps can be trusted and watch for clock jumps
+	checkClockSanity()
+	if ntpServer != "" {
+		checkNTPOffset()
+	}
+	watchClock()
+	if syncClockServer != "" {
+		if err := startSyncClock(); err != nil {
+			consoleWarn("Could not measure the shared clock %s, segments get sync markers once it answers: %v", syncClockServer, err)
+			go func() {
+				for startSyncClock() != nil {
+					time.Sleep(syncCheckInterval)
+				}
+			}()
+		} else {
+			consoleInfo("Synchronizing timestamps with the shared clock %s", syncClockServer)
+		}
+	}
+
+	// Finalize the segment before the system sleeps
+	if err := watchSleep(); err != nil {
+		consoleInfo("Segments are not finalized before suspend: %v", err)
+	}
+
+	// Start a new segment whenever the Windows session changes
+	if sessionSegments {
+		if err := watchSessionChanges(); err != nil {
+			consoleWarn("Session segmentation disabled: %v", err)
+		} else {
+			consoleInfo("Starting new segments on session changes (current: %s)", currentSessionTag())
+		}
+	}
+
+	// Track the focused window for the subtitles, application profiles and
+	// meetings
+	if focusSubtitles || len(appProfiles) > 0 || meetingTitleRe != nil || len(doNotRecord) > 0 {
+		if err := watchFocus(); err != nil {
+			if len(doNotRecord) > 0 {
+				// Recording private windows is worse than not recording
+				consoleError("Cannot read the focused window for -do-not-record: %v", err)
+				os.Exit(exitFailure)
+			}
+			consoleWarn("Focus subtitles, application profiles and meeting chapters disabled: %v", err)
+			focusSubtitles, appProfiles, meetingTitleRe = false, nil, nil
+		} else {
+			if focusSubtitles {
+				consoleInfo("Writing the focused application as subtitles next to every segment")
+			}
+			if len(appProfiles) > 0 {
+				consoleInfo("Switching between %d application profiles with the focus", len(appProfiles))
+			}
+			if meetingTitleRe != nil {
+				consoleInfo("Adding a chapter for every meeting whose window gets the focus")
+			}
+			if len(doNotRecord) > 0 {
+				consoleInfo("Keeping %d kinds of private windows out of the recording (%s)", len(doNotRecord), doNotRecordAction)
+			}
+		}
+	}
+
+	// Lower the settings at night and raise them again in the morning
+	if len(qualitySchedule) > 0 {
+		startSchedule()
+		consoleInfo("Recording with the settings of %d schedule windows at their times of day", len(qualitySchedule))
+	}
+
+	// Limit how long recording runs unattended
+	if maxSession > 0 {
+		consoleInfo("Recording stops after %s until it is started again", maxSession)
+		watchMaxSession()
+	}
+
+	// Apply the idle policy when nobody uses the machine
+	if idleThreshold > 0 {
+		if err := watchIdle(sigs); err != nil {
+			consoleWarn("Idle detection disabled: %v", err)
+		} else {
+			consoleInfo("Idle after %s without input, policy: %s", idleThreshold, idlePolicy)
+		}
+	}
+
+	// Accept control commands like "screen-vibe logs -f"
+	if err := startControlServer(); err != nil {
+		consoleWarn("Control socket disabled: %v", err)
+	}
+	defer stopControlServer()
+	if liveView {
+		if err := startLiveView(); err != nil {
+			consoleError("%v", err)
+			os.Exit(exitConfigError)
+		}
+		defer stopLiveView()
+	}
+	if *listenFlag != "" {
+		if err := startAPIServer(*listenFlag); err != nil {
+			consoleError("%v", err)
+			os.Exit(exitConfigError)
+		}
+		defer stopAPIServer()
+	}
+	if statusFilePath != "" {
+		if err := startStatusFile(); err != nil {
+			consoleError("Could not write the status file: %v", err)
+			os.Exit(exitConfigError)
+		}
+	}
+	watchUpgradeSignal()
+	restoreUpgradeState()
+
+	// Integrations compiled in through the extension package
+	startExtensions()
+	if remoteOutput != "" {
+		if err := startRemoteOutput(); err != nil {
+			consoleError("Cannot record to %s: %v", remoteOutput, err)
+			os.Exit(exitConfigError)
+		}
+	}
+	if tierAfter > 0 {
+		if err := startTiering(); err != nil {
+			consoleWarn("Tiering disabled: %v", err)
+		} else {
+			consoleInfo("Moving segments older than %s to the cold storage of %s", tierAfter, coldStorageName)
+		}
+	}
+	if retention > 0 && os.Getenv(supervisorJanitorEnv) != "" {
+		consoleInfo("The supervisor deletes segments %s after they ended", retention)
+	} else if retention > 0 {
+		startRetention()
+		consoleInfo("Deleting segments %s after they ended", retention)
+	}
+	if meetingsProfile {
+		consoleInfo("Recording meetings with system audio (%s) and microphone (%s)", audioSystem, audioMic)
+	}
+
+	// Let the policy script react to events from here on
+	if policy != nil {
+		consoleInfo("Policy %s receives the recorder's events", *policyFlag)
+		startPolicy(policy)
+	}
+
+	// Let desktop scripts and extensions control the recorder
+	if *dbusFlag {
+		if name, err := startDBusService(); err != nil {
+			consoleWarn("D-Bus interface disabled: %v", err)
+		} else {
+			consoleInfo("D-Bus interface available as %s", name)
+		}
 	}
 
-	fmt.Println("Press Ctrl+C to stop recording gracefully")
+	consoleInfo("Press Ctrl+C to stop recording gracefully")
 
 	// Start recording session, which handles restarts if files get too large
 	go startRecordingSession(done, sigs)
 
 	// Wait for done signal
 	<-done
-	fmt.Println("Recording complete")
+	shutdown()
+	stopExtensions()
+	if focusSubtitles {
+		flushFocusLog()
+	}
+	consoleInfo("Recording complete")
+	if statusFilePath != "" {
+		status := currentStatus()
+		status.State = "exited"
+		if err := writeStatusFile(status); err != nil {
+			consoleWarn("Could not write the status file: %v", err)
+		}
+	}
+	if manifestPath != "" {
+		if err := writeManifest(manifestPath); err != nil {
+			consoleError("Could not write the manifest: %v", err)
+		} else {
+			consoleInfo("Wrote manifest %s", manifestPath)
+		}
+	}
+	flushCatalog()
+	if code := recorderExitCode.Load(); code != 0 {
+		os.Exit(int(code))
+	}
+	if upgradeRequested.Load() {
+		if err := execUpgrade(); err != nil {
+			consoleError("Could not start the new binary: %v", err)
+			os.Exit(exitFailure)
+		}
+	}
 }
 
 func startRecordingSession(done chan bool, sigs chan os.Signal) {
-	var stopRecording = make(chan bool, 1)
-	var recordingDone = make(chan bool, 1)
+	var stopRecording chan bool                 // the stop channel of the current segment
+	var recordingDone = make(chan chan bool, 1) // the stop channel of a finished segment
+	var retiring []chan bool                    // segments that stop once the next one records
+
+	// Every segment gets its own stop channel, so a stop request the
+	// previous segment did not read before it ended cannot stop the next one
+	startSegment := func() {
+		stopRecording = make(chan bool, 1)
+		go startNewRecording(stopRecording, recordingDone)
+	}
 
-	// Start initial recording
-	go startNewRecording(stopRecording, recordingDone)
+	// Start initial recording, unless it was held before an upgrade
+	running := recorderHold() == "" // a segment is being recorded or about to start
+	if running {
+		startSegment()
+	}
 
 	for {
 		select {
-		case <-recordingDone:
-			// Normal recording completion - start a new one
-			go startNewRecording(stopRecording, recordingDone)
+		case stop := <-recordingDone:
+			if stop != stopRecording {
+				// A segment replaced by an overlapping one finished
+				retiring = slices.DeleteFunc(retiring, func(s chan bool) bool { return s == stop })
+				continue
+			}
+			// Normal recording completion - start a new one unless paused or
+			// stopped, or a fatal error makes the recorder give up
+			if recorderExitCode.Load() != 0 {
+				done <- true
+				return
+			}
+			if recorderHold() != "" {
+				running = false
+				stateChanged()
+				continue
+			}
+			startSegment()
+		case reason := <-rotateRequests:
+			if !running || recorderHold() != "" {
+				continue
+			}
+			// Finish the current segment, the next one starts on completion
+			consoleEvent("Starting new segment: %s", reason)
+			emitStatus(statusEvent{Event: "rotated", Reason: reason})
+			if seg := activeSegment.Load(); overlapRotation && seg != nil && seg.stop == stopRecording {
+				// Start the next segment right away, the current one stops
+				// once the next one records
+				retiring = append(retiring, stopRecording)
+				startSegment()
+				go handOver(seg, stopRecording)
+				continue
+			}
+			stopSegment(stopRecording)
+		case action := <-controlRequests:
+			switch action {
+			case "pause", "stop":
+				hold := "paused"
+				if action == "stop" {
+					hold = "stopped"
+				}
+				if recorderHold() == "" && running {
+					consoleEvent("Recording %s, finishing the current segment", hold)
+					stopSegment(stopRecording)
+				}
+				holdState.Store(hold)
+			case "start":
+				holdState.Store("")
+				if !running {
+					consoleEvent("Recording resumed")
+					running = true
+					startSegment()
+				}
+			}
+			stateChanged()
+		case <-upgradeRequests:
+			consoleEvent("Upgrading, finishing the current segment...")
+			upgradeRequested.Store(true)
+			if running {
+				stopSegments(stopRecording, retiring, recordingDone)
+			}
+			done <- true
+			return
 		case sig := <-sigs:
 			// User requested termination
-			fmt.Printf("Received signal %v, stopping recording...\n", sig)
-			stopRecording <- true
-			<-recordingDone // Wait for recording to finish
+			consoleEvent("Received signal %v, stopping recording...", sig)
+			if running {
+				stopSegments(stopRecording, retiring, recordingDone) // Wait for recording to finish
+			}
 			done <- true
 			return
 		}
 	}
 }
 
-func startNewRecording(stopRecording chan bool, recordingDone chan bool) {
+// stopSegments stops the current segment and the segments it overlaps with
+// and waits until all of them are finished
+func stopSegments(current chan bool, retiring []chan bool, recordingDone chan chan bool) {
+	stopSegment(current)
+	for _, stop := range retiring {
+		stopSegment(stop)
+	}
+	for range 1 + len(retiring) {
+		<-recordingDone
+	}
+}
+
+// stopSegment asks the segment of stop to finish. It never blocks: a
+// request that is still pending stops the segment just as well, and one
+// that finished no longer reads its channel.
+func stopSegment(stop chan bool) {
+	select {
+	case stop <- true:
+	default:
+	}
+}
+
+// recorderHold returns "paused" or "stopped" while recording is held by a
+// control command, and "" otherwise
+func recorderHold() string {
+	hold, _ := holdState.Load().(string)
+	return hold
+}
+
+// controlRecording asks the recording session to "start", "stop" or "pause"
+// recording. Stop and pause both finish the current segment and keep the
+// recorder running until it is started again.
+func controlRecording(action string) error {
+	switch action {
+	case "start", "stop", "pause":
+	default:
+		return fmt.Errorf("unknown action %q", action)
+	}
+	select {
+	case controlRequests <- action:
+		return nil
+	default:
+		return fmt.Errorf("too many pending control requests")
+	}
+}
+
+// stateChanged notifies the state hooks about the current recorder status
+func stateChanged() {
+	status := currentStatus()
+	for _, hook := range stateHooks {
+		hook(status)
+	}
+}
+
+// currentLog returns the logger of the segment being recorded, or a
+// logger that discards everything when no segment is running
+func currentLog() *slog.Logger {
+	if log := activeLog.Load(); log != nil {
+		return log
+	}
+	return slog.New(slog.DiscardHandler)
+}
+
+// requestRotation asks the recording session to finish the current segment
+// and start a new one. Requests made while another one is pending are merged.
+func requestRotation(reason string) {
+	select {
+	case rotateRequests <- reason:
+	default:
+	}
+}
+
+func startNewRecording(stopRecording chan bool, recordingDone chan chan bool) {
+	now := time.Now()
+	user, session := loginUser(), osSessionID()
+
 	// Create output directory if it doesn't exist
-	outputDir := "output"
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		fmt.Printf("Error creating output directory: %v\n", err)
-		recordingDone <- true
-		return
+	segmentDir := outputDir
+	if outputLayout == "session" {
+		segmentDir = filepath.Join(outputDir, fileTag(user), now.Format("2006-01-02"), fileTag(session))
+	}
+	if recordsFiles() {
+		dir := segmentDir
+		if remoteReview {
+			dir = filepath.Join(segmentDir, reviewDirName)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			consoleError("Could not create output directory: %v", err)
+			alertFailure(fmt.Sprintf("Could not create output directory: %v", err))
+			if code := errorExitCode(err); code != 0 {
+				stopWithExitCode(code, "Cannot write to the output directory")
+			}
+			recordingDone <- stopRecording
+			return
+		}
 	}
 
 	// Prepare output file and log file names
-	baseName := time.Now().Format("2006-01-02_15-04-05")
-	videoFile := filepath.Join(outputDir, baseName+".mkv")
-	logFile := filepath.Join(outputDir, baseName+".log")
+	baseName := segmentBaseName(now)
+	tag := currentSessionTag()
+	if anonymize {
+		// Opaque names, time and user are only kept in the encrypted catalog
+		baseName = newUUID()
+	} else if tag != "" {
+		baseName += "_" + fileTag(tag)
+	}
+	videoFile := filepath.Join(segmentDir, baseName+segmentExtension())
+	logFile := filepath.Join(segmentDir, baseName+".log")
+	if segmentMuxer {
+		// ffmpeg names the segments, the log covers all of them
+		videoFile = filepath.Join(segmentDir, segmentMuxerPattern(tag))
+		os.Remove(filepath.Join(segmentDir, segmentListFileName))
+	}
+	// Streams write nothing to disk, the log can be followed with the logs command
+	switch {
+	case streamOutput:
+		videoFile, logFile = "-", ""
+	case udpOnly:
+		videoFile, logFile = udpOutput, ""
+	}
+	// Remote segments keep the name and directories they would have locally
+	var remote *remoteSegment
+	remoteName := relativeToOutput(videoFile)
+	if remoteOutput != "" {
+		var err error
+		if remote, err = createRemoteSegment(remoteName); err != nil {
+			consoleError("Could not start the segment at %s: %v", remoteOutput, err)
+			alertFailure(fmt.Sprintf("Could not start the segment %s at %s: %v", remoteName, remoteOutput, err))
+			waitBeforeRetry(stopRecording)
+			recordingDone <- stopRecording
+			return
+		}
+		videoFile, logFile = remote.location, ""
+	}
 
 	// Set up slog logger and log file with DEBUG level
-	logWriter := mustCreateFile(logFile)
+	var logOut io.Writer = segmentLogs
+	var logWriter *os.File
+	if logFile != "" {
+		logWriter = mustCreateFile(logFile)
+		logOut = io.MultiWriter(logWriter, segmentLogs)
+	}
 	handlerOpts := &slog.HandlerOptions{Level: slog.LevelDebug}
-	log := slog.New(slog.NewTextHandler(logWriter, handlerOpts))
-	log.Info("Starting screen recording", "output", videoFile)
-	log.Info("Recording settings", "fps", fps, "bitrate", fmt.Sprintf("%d kbit/s", bitrate), "maxSize", formatFileSize(maxFileSizeBytes))
+	if logPrivacy != "off" {
+		addPrivateLogValue(tag)
+		handlerOpts.ReplaceAttr = redactLogAttr
+	}
+	log := slog.New(slog.NewTextHandler(logOut, handlerOpts))
+	activeLog.Store(log)
+	if anonymize {
+		log.Info("Starting screen recording", "output", videoFile)
+	} else {
+		log.Info("Starting screen recording", "output", videoFile, "user", user, "session", session)
+	}
+	segmentFPS, segmentKbps := captureFPS(), segmentBitrate()
+	log.Info("Recording settings", "fps", segmentFPS, "bitrate", fmt.Sprintf("%d kbit/s", segmentKbps), "preset", segmentPreset(), "maxSize", formatFileSize(maxFileSizeBytes))
+	profile, schedule := activeAppProfile(), activeSchedule()
+	if profile != "" {
+		log.Info("Recording with application profile", "profile", profile)
+	}
+	if schedule != "" {
+		log.Info("Recording with schedule window", "window", schedule)
+	}
+	if tag != "" && !anonymize {
+		log.Info("Segment tagged with active session", "user", tag)
+	}
 
 	// Detect hardware encoder
 	encoder, device := detectHardwareEncoder(log)
+	encoder = encoderFallback(encoder, log)
 	log.Info("Selected encoder", "encoder", encoder, "device", device)
 
 	// Build ffmpeg command
-	cmd := buildFFmpegCommand(encoder, device, videoFile, log)
+	blurs, captureArea := newBlurRegions(device, log)
+	encoder, gpuFrames := zeroCopyEncoder(recorderOS, encoder, device, blurs, log)
+	if gpuFrames {
+		log.Info("Zero-copy capture, frames stay on the GPU", "encoder", encoder)
+	}
+	// With -spill-dir ffmpeg records to the spill directory, from where
+	// the segment is copied to the output directory while it is recorded
+	recordFile := videoFile
+	if spillDir != "" {
+		recordFile = spillFile(videoFile)
+	}
+	if len(uiReferences) > 0 && signage == nil {
+		// ffmpeg would ask before replacing the still of the last segment
+		os.Remove(uiStillPath())
+	}
+	cmd := buildFFmpegCommand(encoder, device, recordFile, blurs, gpuFrames, log)
 	log.Info("Running ffmpeg", "cmd", cmd.String())
+	var pipewire *pipewireCapture
+	if linuxCapture == "portal" && !gpuFrames {
+		var err error
+		if pipewire, err = startPipeWireCapture(cmd, segmentFPS, log); err != nil {
+			log.Error("Could not read the screen cast", "error", err)
+			alertFailure(fmt.Sprintf("Could not read the screen cast: %v", err))
+			waitBeforeRetry(stopRecording)
+			recordingDone <- stopRecording
+			return
+		}
+	}
 
 	// Set up pipes for ffmpeg IO
 	stderrPipe, _ := cmd.StderrPipe()
@@ -166,28 +1462,148 @@ func startNewRecording(stopRecording chan bool, recordingDone chan bool) {
 		stdinPipe = nil // Ensure it's nil if there was an error
 	}
 
-	// Stdout can go directly to console
-	cmd.Stdout = os.Stdout
+	// Stdout can go directly to console, unless it carries the stream
+	cmd.Stdout = consoleOut
+	if streamOutput {
+		cmd.Stdout = os.Stdout
+	}
+	if remote != nil {
+		cmd.Stdout = remote.input
+	}
 
 	// Start the command
 	if err := cmd.Start(); err != nil {
 		log.Error("Failed to start ffmpeg", "error", err)
-		recordingDone <- true
+		alertFailure(fmt.Sprintf("Failed to start ffmpeg: %v", err))
+		if code := errorExitCode(err); code != 0 {
+			stopWithExitCode(code, "Cannot start ffmpeg")
+		}
+		if remote != nil {
+			remote.receive()
+			remote.finish()
+		}
+		if pipewire != nil {
+			pipewire.stop()
+		}
+		recordingDone <- stopRecording
 		return
 	}
+	if remote != nil {
+		remote.receive()
+	}
+	segmentStart := time.Now()
+	var spill *spillCopy
+	if spillDir != "" {
+		spill = startSpillCopy(videoFile, log)
+	}
+	resumeRecovery.Store(false)
+	recordSegmentStart(segmentStart)
+	progress := &segmentProgress{sizeChanged: make(chan struct{}, 1)}
+	seg := &segmentInfo{file: videoFile, log: logFile, start: segmentStart, encoder: encoder, display: device, stop: stopRecording, progress: progress}
+	activeSegment.Store(seg)
+	stateChanged()
+	extensionsSegmentStarted(extensionSegment(catalogEntry{Start: segmentStart, User: user, Display: device, Encoder: encoder}, videoFile, logFile))
+	var muxed *segmentList
+	if segmentMuxer {
+		var origin time.Time
+		muxed = watchSegmentList(segmentDir, func(name string, from, to time.Duration) {
+			// The times of the list count from the first frame, the
+			// segments follow each other without a gap
+			first := origin.IsZero()
+			if first {
+				origin = segmentStart
+				if t, ok := progress.firstEncoded(); ok {
+					origin = t
+				}
+			}
+			file := filepath.Join(segmentDir, name)
+			entry := catalogEntry{File: relativeToOutput(file), Start: origin.Add(from), End: origin.Add(to),
+				User: user, Session: session, Tag: tag, Display: device, Encoder: encoder, Profile: profile, Schedule: schedule}
+			entry.Command, _ = childCommandTag()
+			if info, err := os.Stat(file); err == nil {
+				entry.Size = info.Size()
+			}
+			if idleThreshold > 0 {
+				entry.IdleSeconds = idleSecondsBetween(entry.Start, entry.End)
+			}
+			segmentLog := ""
+			if first {
+				// The log goes with the first segment, so retention removes it once
+				entry.Log, segmentLog = relativeToOutput(logFile), logFile
+			}
+			log.Info("Segment muxer finished a segment", "file", file, "size", formatFileSize(entry.Size))
+			consoleEvent("Finished segment %s (%s)", file, formatFileSize(entry.Size))
+			emitStatus(statusEvent{Event: "rotated", Reason: "segment time reached", File: file, Size: entry.Size})
+			recordSegmentEnd(file, entry.Start, entry.End)
+			recordSegmentStart(entry.End)
+			finishSegment(entry, file, segmentLog, log)
+		}, log)
+	}
+	var window *windowRecording
+	if windowTitle != "" {
+		window = startWindowRecording(encoder, filepath.Join(segmentDir, baseName+"_window.mkv"), log)
+	}
+	switch {
+	case streamOutput:
+		consoleEvent("Streaming %s to stdout", streamFormat)
+	case udpOnly:
+		consoleEvent("Streaming to %s", udpOutput)
+	case segmentMuxer:
+		consoleEvent("Recording segments %s", videoFile)
+	default:
+		consoleEvent("Recording segment %s", videoFile)
+	}
+	emitStatus(statusEvent{Event: "started", File: videoFile, Log: logFile, Display: device, Encoder: encoder})
 
 	// Process stderr for progress updates
 	ffmpegOutputDone := make(chan bool, 1)
-	go processFFmpegOutput(stderrPipe, log, ffmpegOutputDone)
+	failure := &ffmpegFailure{}
+	go processFFmpegOutput(stderrPipe, log, progress, failure, ffmpegOutputDone)
 
-	// Start file size monitoring
-	go monitorFileSize(videoFile, stopRecording, log)
+	// Start file size monitoring until ffmpeg exits. The watchers end
+	// before the segment, they log to its log and read the settings.
+	stopChan := make(chan struct{})
+	var watchers sync.WaitGroup
+	watch := func(f func()) {
+		watchers.Add(1)
+		go func() {
+			defer watchers.Done()
+			f()
+		}()
+	}
+	switch {
+	case segmentMuxer:
+		// ffmpeg starts the next segment itself
+	case remote != nil:
+		watch(func() { monitorFileSize(videoFile, remote.size, progress, stopRecording, stopChan, log) })
+	case recordsFiles():
+		watch(func() { monitorFileSize(recordFile, statSize(recordFile), progress, stopRecording, stopChan, log) })
+	}
+	watch(func() { reportProgress(videoFile, segmentStart, progress, stopChan) })
+	var stalled atomic.Bool
+	watch(func() { watchStall(cmd, stdinPipe, progress, &stalled, stopChan, log) })
+	watch(func() { watchEncodeSpeed(encoder, progress, stopChan, log) })
+	watch(func() { watchBitrateAdvice(segmentKbps, progress, stopChan, log) })
+	if watchesUI() {
+		watch(func() { watchUI(segmentStart, stopChan, log) })
+	}
+	if len(blurs) > 0 {
+		watch(func() { trackBlurRegions(blurs, captureArea, stdinPipe, stopChan, log) })
+	}
+	if privateBlurFilter() != "" && !gpuFrames && stdinPipe != nil {
+		watch(func() { followPrivateBlur(stdinPipe, stopChan, log) })
+	}
 
 	// Wait for stop signal or command to finish
-	stopChan := make(chan struct{})
+	var stopRequested atomic.Bool
 	go func() {
-		// Wait for stop signal directly (no select needed for single case)
-		<-stopRecording
+		// Wait for the stop signal, unless ffmpeg exits on its own first
+		select {
+		case <-stopRecording:
+			stopRequested.Store(true)
+		case <-stopChan:
+			return
+		}
 		log.Info("Stop signal received, gracefully terminating ffmpeg...")
 
 		if stdinPipe != nil {
@@ -208,6 +1624,13 @@ func startNewRecording(stopRecording chan bool, recordingDone chan bool) {
 			select {
 			case <-gracefulTimeout.C:
 				log.Warn("Graceful shutdown timed out after 10 seconds")
+				// ffmpeg that hangs on a capture handle gone stale during a
+				// suspend never finishes, the file is lost anyway
+				if resumeRecovery.Load() {
+					log.Warn("Killing ffmpeg stuck after a suspend")
+					cmd.Process.Kill()
+					return
+				}
 				// Still don't send additional signals - let ffmpeg finish
 				// This is critical for proper file finalization
 			case <-stopChan:
@@ -220,9 +1643,22 @@ func startNewRecording(stopRecording chan bool, recordingDone chan bool) {
 
 	// Wait for ffmpeg to exit
 	err = cmd.Wait()
+	var remoteErr error
+	if remote != nil {
+		remoteErr = remote.finish()
+	}
 	close(stopChan) // Signal that ffmpeg has terminated
+	watchers.Wait()
+	if window != nil {
+		window.stop(log)
+	}
+	if pipewire != nil {
+		pipewire.stop()
+	}
 
-	if err != nil {
+	if stalled.Load() {
+		log.Warn("Segment ended after ffmpeg stalled", "error", err)
+	} else if err != nil {
 		// Check for expected exit codes during graceful shutdown
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			exitCode := exitErr.ExitCode()
@@ -231,46 +1667,263 @@ func startNewRecording(stopRecording chan bool, recordingDone chan bool) {
 				log.Info("ffmpeg exited with expected code", "code", exitCode)
 			} else {
 				log.Error("ffmpeg exited with unexpected error code", "code", exitCode, "error", err)
+				alertFailure(fmt.Sprintf("ffmpeg exited with unexpected error code %d while recording %s", exitCode, videoFile))
 			}
 		} else {
 			log.Error("ffmpeg exited with error", "error", err)
+			alertFailure(fmt.Sprintf("ffmpeg exited with error while recording %s: %v", videoFile, err))
 		}
 	} else {
 		log.Info("Recording finished successfully")
 	}
-
+	segmentEnd := time.Now()
+	activeSegment.CompareAndSwap(seg, nil)
+	stateChanged()
 	<-ffmpegOutputDone // Wait for output processing to finish
-	logWriter.Close()
-	recordingDone <- true
+	var spilled *spillStats
+	if spill != nil {
+		var copyErr error
+		if spilled, copyErr = spill.finish(); copyErr != nil {
+			log.Error("Segment not copied to the output directory", "error", copyErr)
+			alertFailure(fmt.Sprintf("Segment not copied to the output directory: %v", copyErr))
+		} else {
+			log.Info("Copied the segment from the spill directory", "maxBacklog", formatFileSize(spilled.MaxBacklog),
+				"drain", time.Duration(spilled.DrainSeconds*float64(time.Second)).Round(time.Millisecond))
+		}
+	}
+	segmentEnd = trimOverlap(seg, videoFile, segmentStart, segmentEnd, log)
+	if muxed == nil {
+		recordSegmentEnd(videoFile, segmentStart, segmentEnd)
+	}
+
+	// A zero-copy pipeline that did not get to its first frame is not
+	// supported by the driver or ffmpeg, the next segment captures regularly
+	zeroCopyFallback := false
+	if _, updated := progress.snapshot(); gpuFrames && err != nil && updated.IsZero() {
+		zeroCopyFallback = true
+		zeroCopyFailed.Store(true)
+		_, line := failure.error()
+		log.Warn("Zero-copy capture failed, the next segment uses the regular capture", "error", err, "ffmpeg", line)
+		consoleWarn("Zero-copy capture failed, falling back to the regular capture")
+	}
+
+	// Give up on errors the next segment would run into again. NVENC out of
+	// sessions is not one of them, the next segment uses another encoder.
+	if code, line := failure.error(); code != 0 && err != nil && !zeroCopyFallback {
+		if code == exitEncoderUnavailable && strings.HasSuffix(encoder, "_nvenc") && nvencUnavailable.Load() {
+			log.Warn("Encoder failed, the next segment uses a fallback encoder", "encoder", encoder)
+		} else {
+			log.Error("ffmpeg failed", "error", line, "exit_code", code)
+			stopWithExitCode(code, fmt.Sprintf("ffmpeg failed: %s", line))
+		}
+	}
+
+	// Register the finished segment in the catalog
+	entry := catalogEntry{
+		File:    relativeToOutput(videoFile),
+		Log:     relativeToOutput(logFile),
+		Start:   segmentStart,
+		End:     segmentEnd,
+		User:    user,
+		Session: session,
+		Tag:     tag,
+		Display: device,
+		Encoder: encoder,
+	}
+	entry.Command, entry.ExitCode = childCommandTag()
+	entry.Stalled = stalled.Load()
+	entry.Profile, entry.Schedule = profile, schedule
+	entry.Dedupe = progress.dedupeStats(segmentStart, segmentEnd, segmentFPS)
+	entry.Spill = spilled
+	if idleThreshold > 0 {
+		entry.IdleSeconds = idleSecondsBetween(segmentStart, segmentEnd)
+	}
+	if meetingsProfile {
+		entry.ConsentNotice = consentNotice
+		if entry.Meetings = segmentMeetings(segmentStart, segmentEnd); len(entry.Meetings) > 0 {
+			if err := writeMeetingChapters(videoFile, segmentStart, entry.Meetings); err != nil {
+				log.Warn("Could not add the meeting chapters", "error", err)
+			}
+		}
+	}
+	if fileInfo, err := os.Stat(videoFile); err == nil {
+		entry.Size = fileInfo.Size()
+	}
+	if remote != nil {
+		entry.File, entry.Log, entry.Storage = remoteName, "", remote.location
+		entry.Size, _ = remote.size()
+	}
+	var cpu time.Duration
+	if cmd.ProcessState != nil {
+		cpu = cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()
+	}
+	if entry.Stats = progress.stats(entry.Size, cpu, segmentFPS, segmentKbps); entry.Stats != nil {
+		log.Info("Segment statistics", "frames", entry.Stats.Frames, "fps", entry.Stats.FPS, "targetFps", entry.Stats.TargetFPS,
+			"bitrate", fmt.Sprintf("%.1f kbit/s", entry.Stats.Bitrate), "dropped", entry.Stats.Dropped,
+			"duplicated", entry.Stats.Duplicated, "speed", entry.Stats.Speed, "cpuSeconds", entry.Stats.CPUSeconds)
+	}
+	if first, ok := progress.firstFrameTime(); ok {
+		entry.FirstFrame = &first
+		if syncClockServer != "" {
+			entry.Sync = segmentSync(first, segmentEnd)
+		}
+		if drift, ok := progress.drift(); ok {
+			driftSeconds := drift.Seconds()
+			entry.DriftSeconds = &driftSeconds
+			log.Info("Wall clock drift", "firstFrame", first.Format(time.RFC3339Nano), "drift", drift)
+		}
+	}
+	switch {
+	case muxed != nil:
+		// The segments were cataloged as ffmpeg finished them
+		muxed.finish()
+		recordSegmentStart(time.Time{})
+	case recordsFiles():
+		finishSegment(entry, videoFile, logFile, log)
+		if window != nil {
+			window.finish(entry, logFile, log)
+		}
+	case remote != nil:
+		if remoteErr != nil {
+			log.Error("Segment not completed at the remote target", "error", remoteErr)
+			consoleError("Segment %s not completed at %s: %v", remoteName, remoteOutput, remoteErr)
+			alertFailure(fmt.Sprintf("Segment %s not completed at %s: %v", remoteName, remoteOutput, remoteErr))
+			// A stopped segment is not followed by another one right away
+			if !stopRequested.Load() {
+				waitBeforeRetry(stopRecording)
+			}
+		} else {
+			if err := appendCatalogEntry(entry); err != nil {
+				log.Error("Failed to update catalog", "error", err)
+			}
+			extensionsSegmentFinished(extensionSegment(entry, videoFile, logFile))
+		}
+	}
+	emitStatus(statusEvent{Event: "stopped", File: videoFile, Size: entry.Size, Duration: segmentEnd.Sub(segmentStart).Seconds()})
+
+	activeLog.CompareAndSwap(log, nil)
+	if logWriter != nil {
+		logWriter.Close()
+	}
+	recordingDone <- stopRecording
+}
+
+// finishSegment catalogs a segment recorded to the output directory, after
+// analyzing and transcribing it, hands it to the extensions and writes its
+// subtitles, marker clips and manifest record
+func finishSegment(entry catalogEntry, videoFile, logFile string, log *slog.Logger) {
+	segmentStart, segmentEnd := entry.Start, entry.End
+	if activityAnalysis || transcribeCommand != "" {
+		// Decoding the segment takes a while, the next one starts meanwhile
+		segmentJobs.Add(1)
+		go func() {
+			defer segmentJobs.Done()
+			if activityAnalysis {
+				activity, err := analyzeActivity(videoFile, segmentEnd.Sub(segmentStart))
+				if err != nil {
+					consoleWarn("Could not analyze the activity of %s: %v", videoFile, err)
+				}
+				entry.Activity = activity
+			}
+			if transcribeCommand != "" {
+				transcript, err := transcribeSegment(videoFile)
+				switch {
+				case err == nil:
+					entry.Transcript = relativeToOutput(transcript)
+					consoleEvent("Transcribed %s", videoFile)
+				case !errors.Is(err, errNoAudio):
+					consoleWarn("Could not transcribe %s: %v", videoFile, err)
+				}
+			}
+			if err := appendCatalogEntry(entry); err != nil {
+				consoleError("Failed to update catalog: %v", err)
+			}
+			extensionsSegmentFinished(extensionSegment(entry, videoFile, logFile))
+		}()
+	} else {
+		if err := appendCatalogEntry(entry); err != nil {
+			log.Error("Failed to update catalog", "error", err)
+		}
+		extensionsSegmentFinished(extensionSegment(entry, videoFile, logFile))
+	}
+	if abs, err := filepath.Abs(videoFile); err == nil {
+		lastSegmentFile.Store(&abs)
+		if clipboardTarget != "" {
+			if err := copySegment(abs); err != nil {
+				consoleWarn("Could not copy %s to the clipboard: %v", abs, err)
+			}
+		}
+	}
+	if manifestPath != "" {
+		recordManifestSegment(videoFile, segmentStart, segmentEnd, entry.Size)
+	}
+	if focusSubtitles {
+		if err := writeFocusSubtitles(videoFile, segmentStart, segmentEnd); err != nil {
+			log.Error("Failed to write focus subtitles", "error", err)
+		}
+	}
+	exportMarkerClips(videoFile, segmentStart, segmentEnd)
 }
 
 // monitorFileSize checks output file size periodically and signals to stop
-// if it exceeds the maximum size limit
-func monitorFileSize(filePath string, stopRecording chan bool, log *slog.Logger) {
-	ticker := time.NewTicker(checkInterval * time.Second)
+// if it exceeds the maximum size limit. It returns once finished is closed.
+// size returns the current size, of the file on disk or of what was sent to
+// a remote target. The size ffmpeg reports is checked as soon as it is read,
+// about twice a second, and the segment stops early by what ffmpeg writes
+// while it stops, so small limits are kept.
+func monitorFileSize(filePath string, size func() (int64, error), progress *segmentProgress, stopRecording chan bool, finished chan struct{}, log *slog.Logger) {
+	ticker := time.NewTicker(sizeCheckInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		fileInfo, err := os.Stat(filePath)
+	for {
+		select {
+		case <-finished:
+			return
+		case <-ticker.C:
+		case <-progress.sizeChanged:
+		}
+
+		fileSize, err := size()
 		if err != nil {
 			log.Warn("Could not check file size", "error", err)
 			continue
 		}
+		last, _ := progress.snapshot()
+		fileSize = max(fileSize, last.size)
+		headroom := int64(last.bitrate * 1000 / 8 * sizeStopHeadroom.Seconds())
 
-		if fileInfo.Size() >= maxFileSizeBytes {
+		if fileSize+headroom >= maxFileSizeBytes {
 			// Format sizes in MB or GB for more readable logs
-			sizeStr := formatFileSize(fileInfo.Size())
+			sizeStr := formatFileSize(fileSize)
 			limitStr := formatFileSize(maxFileSizeBytes)
-			log.Info(fmt.Sprintf("File %s exceeded size limit of %s (current size: %s), gracefully stopping and starting new recording",
+			log.Info(fmt.Sprintf("File %s reached size limit of %s (current size: %s), gracefully stopping and starting new recording",
 				filePath, limitStr, sizeStr))
+			// With -overlap the session starts the next segment first
+			if overlapRotation {
+				requestRotation(fmt.Sprintf("size limit of %s reached", limitStr))
+				return
+			}
+			consoleEvent("Size limit of %s reached, starting new segment", limitStr)
+			emitStatus(statusEvent{Event: "rotated", Reason: "size limit reached", File: filePath, Size: fileSize})
 
 			// Signal to stop recording - this will use our improved graceful shutdown
-			stopRecording <- true
+			stopSegment(stopRecording)
 			return
 		}
 	}
 }
 
+// statSize returns the size function of monitorFileSize for a file
+func statSize(filePath string) func() (int64, error) {
+	return func() (int64, error) {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+}
+
 // formatFileSize converts bytes to a human-readable format (KB, MB, GB)
 func formatFileSize(bytes int64) string {
 	const (
@@ -292,11 +1945,12 @@ func formatFileSize(bytes int64) string {
 }
 
 // processFFmpegOutput reads ffmpeg stderr output, handles carriage returns,
-// logs each line, and prints it to console
-func processFFmpegOutput(r io.Reader, log *slog.Logger, done chan bool) {
+// logs each line, prints it to console and keeps track of the progress
+func processFFmpegOutput(r io.Reader, log *slog.Logger, progress *segmentProgress, failure *ffmpegFailure, done chan bool) {
 	// Use a buffered reader instead of a scanner to handle carriage returns
 	reader := bufio.NewReader(r)
 	var line strings.Builder
+	progressLog := newProgressLogger(log)
 
 	for {
 		b, err := reader.ReadByte()
@@ -312,8 +1966,11 @@ func processFFmpegOutput(r io.Reader, log *slog.Logger, done chan bool) {
 			// If we have content, log it and print to console
 			if line.Len() > 0 {
 				s := line.String()
-				fmt.Println(s)
-				log.Debug(s)
+				consoleFFmpegLine(s)
+				progressLog.line(s)
+				progress.update(s)
+				checkEncoderError(s, log)
+				failure.check(s)
 				line.Reset()
 			}
 			continue
@@ -324,8 +1981,11 @@ func processFFmpegOutput(r io.Reader, log *slog.Logger, done chan bool) {
 			// If we have content, log it and print to console
 			if line.Len() > 0 {
 				s := line.String()
-				fmt.Println(s)
-				log.Debug(s)
+				consoleFFmpegLine(s)
+				progressLog.line(s)
+				progress.update(s)
+				checkEncoderError(s, log)
+				failure.check(s)
 				line.Reset()
 			}
 			continue
@@ -338,9 +1998,13 @@ func processFFmpegOutput(r io.Reader, log *slog.Logger, done chan bool) {
 	// Log any remaining content
 	if line.Len() > 0 {
 		s := line.String()
-		fmt.Println(s)
-		log.Debug(s)
+		consoleFFmpegLine(s)
+		progressLog.line(s)
+		progress.update(s)
+		checkEncoderError(s, log)
+		failure.check(s)
 	}
+	progressLog.flush()
 
 	done <- true
 }
@@ -350,6 +2014,21 @@ func isFFmpegAvailable() bool {
 	return err == nil
 }
 
+// ffmpegHasMuxer reports whether ffmpeg was built with the given output format
+func ffmpegHasMuxer(name string) bool {
+	out, err := exec.Command("ffmpeg", "-hide_banner", "-muxers").Output()
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && strings.Contains(fields[0], "E") && fields[1] == name {
+			return true
+		}
+	}
+	return false
+}
+
 func mustCreateFile(name string) *os.File {
 	f, err := os.Create(name)
 	if err != nil {
@@ -359,7 +2038,7 @@ func mustCreateFile(name string) *os.File {
 }
 
 func detectHardwareEncoder(log *slog.Logger) (encoder, device string) {
-	osType := runtime.GOOS
+	osType := recorderOS
 
 	// Log codec choice
 	if useH264 {
@@ -517,111 +2196,15 @@ func detectHardwareEncoder(log *slog.Logger) (encoder, device string) {
 	return "libx265", "0"
 }
 
-func buildFFmpegCommand(encoder, device, videoFile string, log *slog.Logger) *exec.Cmd {
-	osType := runtime.GOOS
-	var args []string
-
-	// Convert fps to string for ffmpeg arguments
-	fpsStr := fmt.Sprintf("%d", fps)
-
-	// Calculate GOP size based on formula GOP = fps × 2
-	gopSize := fps * 2
-
-	log.Info("Setting GOP size", "fps", fps, "gopSize", gopSize)
-
-	// Create strings for bitrate settings
-	bitrateStr := fmt.Sprintf("%dk", bitrate)
-	maxrateStr := fmt.Sprintf("%dk", bitrate*2) // Max rate is 2x the target bitrate
-	bufsizeStr := fmt.Sprintf("%dk", bitrate*3) // Buffer size is 3x the target bitrate
-
-	log.Info("Setting bitrate parameters", "bitrate", bitrateStr, "maxrate", maxrateStr, "bufsize", bufsizeStr)
-
-	if osType == "darwin" {
-		// macOS screen capture, use compatible pixel format for input
-		args = []string{
-			"-f", "avfoundation",
-			"-framerate", fpsStr,
-			"-pix_fmt", "uyvy422",
-			"-i", device,
-			"-c:v", encoder,
-			"-r", fpsStr, // Explicit output framerate
-			"-g", fmt.Sprintf("%d", gopSize), // GOP size based on fps × 2
-			"-b:v", bitrateStr,
-			"-maxrate", maxrateStr,
-			"-bufsize", bufsizeStr,
-			"-pix_fmt", "yuv420p", // More compatible pixel format
-			"-profile:v", "main",
-			"-an", // No audio
-			videoFile,
-		}
-	} else if osType == "windows" {
-		// Windows screen capture
-		baseArgs := []string{
-			"-f", "gdigrab",
-			"-framerate", fpsStr,
-			"-i", device,
-			"-c:v", encoder,
-			"-r", fpsStr, // Explicit output framerate
-			"-g", fmt.Sprintf("%d", gopSize), // GOP size based on fps × 2
-			"-pix_fmt", "yuv420p", // More compatible pixel format
-			"-preset", preset, // Use command line preset
-			"-b:v", bitrateStr,
-			"-maxrate", maxrateStr,
-			"-bufsize", bufsizeStr,
-			"-profile:v", "main",
-		}
-
-		// Special options for Windows depending on codec
-		if strings.Contains(encoder, "264") {
-			// H.264 specific options
-			baseArgs = append(baseArgs, "-level", "4.1") // Good compatibility level
-			if strings.Contains(encoder, "nvenc") {
-				// NVIDIA specific options
-				baseArgs = append(baseArgs, "-rc:v", "vbr_hq")
-			}
-		} else {
-			// H.265/HEVC specific options
-			if !strings.Contains(encoder, "amf") && !strings.Contains(encoder, "qsv") {
-				// Add tag for better compatibility except for AMF and QSV encoders
-				baseArgs = append(baseArgs, "-tag:v", "hvc1")
-			}
-		}
-
-		// Complete the argument list
-		baseArgs = append(baseArgs,
-			"-an", // No audio
-			videoFile,
-		)
-
-		args = baseArgs
-	} else {
-		// Linux (X11) screen capture
-		displayInput := ":0.0" // Default display
-		if manualDisplayID != "" {
-			displayInput = manualDisplayID
-		}
-
-		args = []string{
-			"-f", "x11grab",
-			"-framerate", fpsStr,
-			"-i", displayInput,
-			"-c:v", encoder,
-			"-r", fpsStr, // Explicit output framerate
-			"-g", fmt.Sprintf("%d", gopSize), // GOP size based on fps × 2
-			"-pix_fmt", "yuv420p", // More compatible pixel format
-			"-b:v", bitrateStr,
-			"-maxrate", maxrateStr,
-			"-bufsize", bufsizeStr,
-			"-profile:v", "main",
-			"-an", // No audio
-			videoFile,
-		}
-	}
-	return exec.Command("ffmpeg", args...)
+func buildFFmpegCommand(encoder, device, videoFile string, blurs []*blurRegion, gpuFrames bool, log *slog.Logger) *exec.Cmd {
+	// The capture rate is lowered while the user is idle
+	args := recordingArgs(recorderOS, encoder, device, videoFile, captureFPS(), blurs, gpuFrames, log)
+	cmd := recorderFFmpeg.command(args.list()...)
+	cmd.Env = dpiAwareEnv(os.Environ())
+	return cmd
 }
 
 func getMacOSMainDisplayID(log *slog.Logger) string {
-	outputDir := "output"
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
 		log.Warn("Could not create output directory", "error", err)
 	}
@@ -683,7 +2266,6 @@ func getWindowsMainDisplayID(log *slog.Logger) string {
 	// - "hwnd=123456" for window handle
 
 	// List available windows for the log file
-	outputDir := "output"
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
 		log.Warn("Could not create output directory", "error", err)
 	}
@@ -782,9 +2364,8 @@ func showAvailableDisplays() {
 	osType := runtime.GOOS
 	if osType == "darwin" {
 		// Create temp dir for device list if needed
-		outputDir := "output"
 		if err := os.MkdirAll(outputDir, 0755); err != nil {
-			fmt.Printf("Warning: Could not create output directory: %v\n", err)
+			consoleWarn("Could not create output directory: %v", err)
 		}
 
 		// Get the list of AVFoundation devices
@@ -800,8 +2381,8 @@ func showAvailableDisplays() {
 			f.Close()
 		}
 
-		fmt.Println("\nAvailable displays for recording:")
-		fmt.Println("--------------------------------")
+		consoleInfo("\nAvailable displays for recording:")
+		consoleInfo("--------------------------------")
 
 		// Parse the device list from stderr output that was printed
 		file, err := os.Open(deviceFile)
@@ -827,32 +2408,41 @@ func showAvailableDisplays() {
 						if strings.Contains(strings.ToLower(name), "screen") ||
 							strings.Contains(strings.ToLower(name), "display") ||
 							strings.Contains(strings.ToLower(name), "capture") {
-							fmt.Printf("  * %s: %s (recommended for screen recording)\n", idx, name)
+							consoleInfo("  * %s: %s (recommended for screen recording)", idx, name)
 						} else {
-							fmt.Printf("  - %s: %s\n", idx, name)
+							consoleInfo("  - %s: %s", idx, name)
 						}
 					}
 				}
 			}
-			fmt.Println("--------------------------------")
-			fmt.Println("To select a specific display, use the -display flag (e.g., -display '2:none')")
-			fmt.Println()
+			consoleInfo("--------------------------------")
+			consoleInfo("To select a specific display, use the -display flag (e.g., -display '2:none')")
+			consoleInfo("")
 		} else {
-			fmt.Printf("Warning: Could not read device list file: %v\n", err)
+			consoleWarn("Could not read device list file: %v", err)
 		}
 	} else if osType == "windows" {
-		fmt.Println("\nAvailable displays for Windows:")
-		fmt.Println("--------------------------------")
-		fmt.Println("  - desktop: Full desktop (all screens)")
-		fmt.Println("  - title=Window Title: Specific window by title")
-		fmt.Println("--------------------------------")
-		fmt.Println("To select a specific display, use the -display flag (e.g., -display 'desktop')")
+		consoleInfo("\nAvailable displays for Windows:")
+		consoleInfo("--------------------------------")
+		consoleInfo("  - desktop: Full desktop (all screens)")
+		if monitors, err := listMonitors(); err == nil {
+			for i, m := range monitors {
+				primary := ""
+				if m.primary {
+					primary = ", primary"
+				}
+				consoleInfo("  - monitor:%d: %s %dx%d at %d,%d%s", i, m.name, m.width, m.height, m.x, m.y, primary)
+			}
+		}
+		consoleInfo("  - title=Window Title: Specific window by title")
+		consoleInfo("--------------------------------")
+		consoleInfo("To select a specific display, use the -display flag (e.g., -display 'desktop' or -display 'monitor:1')")
 	} else { // Linux
-		fmt.Println("\nAvailable displays for Linux:")
-		fmt.Println("--------------------------------")
-		fmt.Println("  - :0.0: Primary display")
-		fmt.Println("  - :0.0+1920,0: Second monitor (adjust offset as needed)")
-		fmt.Println("--------------------------------")
-		fmt.Println("To select a specific display, use the -display flag (e.g., -display ':0.0')")
+		consoleInfo("\nAvailable displays for Linux:")
+		consoleInfo("--------------------------------")
+		consoleInfo("  - :0.0: Primary display")
+		consoleInfo("  - :0.0+1920,0: Second monitor (adjust offset as needed)")
+		consoleInfo("--------------------------------")
+		consoleInfo("To select a specific display, use the -display flag (e.g., -display ':0.0')")
 	}
 }
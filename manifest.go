@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Global variables for the manifest of "screen-vibe run"
+var manifestPath string
+
+// manifestRecording is a segment recorded during the run
+type manifestRecording struct {
+	File  string    `json:"file"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Size  int64     `json:"size"`
+}
+
+// manifestMarker is a point on the timeline, e.g. the start of a test
+type manifestMarker struct {
+	Label  string    `json:"label"`
+	Time   time.Time `json:"time"`
+	File   string    `json:"file,omitempty"`   // segment recorded at the time
+	Offset float64   `json:"offset,omitempty"` // seconds into the segment
+}
+
+// runManifest links the recordings of "screen-vibe run" to the command, so
+// CI systems can show the video next to the test results
+type runManifest struct {
+	Command    string              `json:"command"`
+	ExitCode   *int                `json:"exit_code"`
+	Start      time.Time           `json:"start"`
+	End        time.Time           `json:"end"`
+	Recordings []manifestRecording `json:"recordings"`
+	Markers    []manifestMarker    `json:"markers"`
+}
+
+// manifest collects recordings and markers while the recorder runs
+var manifest struct {
+	sync.Mutex
+	recordings []manifestRecording
+	markers    []manifestMarker
+}
+
+// addMarker drops a marker at the current time of the recording
+func addMarker(label string) {
+	m := manifestMarker{Label: label, Time: time.Now()}
+	ev := statusEvent{Event: "marker", Time: m.Time, Label: label}
+	if seg := activeSegment.Load(); seg != nil {
+		m.File = seg.file
+		ev.File = seg.file
+		if abs, err := filepath.Abs(seg.file); err == nil {
+			m.File = abs
+		}
+		m.Offset = m.Time.Sub(seg.start).Seconds()
+		ev.Offset = m.Offset
+	}
+	manifest.Lock()
+	manifest.markers = append(manifest.markers, m)
+	manifest.Unlock()
+
+	currentLog().Info("Marker", "label", label, "offset", fmt.Sprintf("%.1fs", m.Offset))
+	consoleEvent("Marker: %s", label)
+	emitStatus(ev)
+}
+
+// recordManifestSegment adds a finished segment to the manifest
+func recordManifestSegment(file string, start, end time.Time, size int64) {
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	manifest.Lock()
+	manifest.recordings = append(manifest.recordings, manifestRecording{File: file, Start: start, End: end, Size: size})
+	manifest.Unlock()
+}
+
+// buildRunManifest returns the manifest of the finished run
+func buildRunManifest() runManifest {
+	childCommand.Lock()
+	m := runManifest{Command: childCommand.name, Start: childCommand.started, End: childCommand.ended}
+	if childCommand.exited {
+		code := childCommand.exitCode
+		m.ExitCode = &code
+	}
+	childCommand.Unlock()
+
+	manifest.Lock()
+	m.Recordings = append([]manifestRecording{}, manifest.recordings...)
+	m.Markers = append([]manifestMarker{}, manifest.markers...)
+	manifest.Unlock()
+
+	// The command may not have started, or was interrupted with the recorder
+	if m.Start.IsZero() && len(m.Recordings) > 0 {
+		m.Start = m.Recordings[0].Start
+	}
+	if m.End.IsZero() {
+		m.End = time.Now()
+	}
+	return m
+}
+
+// writeManifest writes the manifest of the run as JSON, or as JUnit XML if
+// the path ends in .xml
+func writeManifest(path string) error {
+	m := buildRunManifest()
+	var data []byte
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".xml") {
+		data, err = m.junit()
+	} else {
+		data, err = json.MarshalIndent(m, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// JUnit XML elements, recordings are attached with the [[ATTACHMENT|path]]
+// convention understood by Jenkins and GitLab
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Time      string      `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+// junit renders the manifest as a JUnit report. Every marker starts a test
+// case that lasts until the next marker, with the recordings of that time
+// attached. A final case for the command fails if it exited with an error.
+func (m runManifest) junit() ([]byte, error) {
+	seconds := func(d time.Duration) string {
+		return fmt.Sprintf("%.3f", d.Seconds())
+	}
+	attachments := func(start, end time.Time) *junitOutput {
+		var b strings.Builder
+		for _, r := range m.Recordings {
+			if r.End.Before(start) || r.Start.After(end) {
+				continue
+			}
+			offset := start.Sub(r.Start)
+			if offset < 0 {
+				offset = 0
+			}
+			fmt.Fprintf(&b, "Recording %s from %s\n[[ATTACHMENT|%s]]\n", r.File, offset.Round(time.Second), r.File)
+		}
+		if b.Len() == 0 {
+			return nil
+		}
+		return &junitOutput{Text: b.String()}
+	}
+
+	suite := junitSuite{
+		Name:      "screen-vibe",
+		Time:      seconds(m.End.Sub(m.Start)),
+		Timestamp: m.Start.Format("2006-01-02T15:04:05"),
+	}
+	for i, marker := range m.Markers {
+		end := m.End
+		if i+1 < len(m.Markers) {
+			end = m.Markers[i+1].Time
+		}
+		suite.Cases = append(suite.Cases, junitCase{
+			Name:      marker.Label,
+			ClassName: "screen-vibe.markers",
+			Time:      seconds(end.Sub(marker.Time)),
+			SystemOut: attachments(marker.Time, end),
+		})
+	}
+	command := junitCase{
+		Name:      m.Command,
+		ClassName: "screen-vibe.run",
+		Time:      suite.Time,
+		SystemOut: attachments(m.Start, m.End),
+	}
+	switch {
+	case m.ExitCode == nil:
+		command.Failure = &junitFailure{Message: "the command did not finish"}
+	case *m.ExitCode != 0:
+		command.Failure = &junitFailure{Message: fmt.Sprintf("exited with code %d", *m.ExitCode)}
+	}
+	if command.Failure != nil {
+		suite.Failures = 1
+	}
+	suite.Cases = append(suite.Cases, command)
+	suite.Tests = len(suite.Cases)
+
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	enc := xml.NewEncoder(&b)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitSuites{Suites: []junitSuite{suite}}); err != nil {
+		return nil, err
+	}
+	b.WriteString("\n")
+	return b.Bytes(), nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxSession is how long the recorder records before it stops and waits to
+// be started again explicitly, 0 for no limit
+var maxSession time.Duration
+
+// watchMaxSession stops recording once it ran for the maximum session time,
+// so no unattended capture runs indefinitely. Recording stays stopped until
+// it is started with "ctl start" or D-Bus, which starts a new session.
+func watchMaxSession() {
+	go func() {
+		for {
+			time.Sleep(maxSession)
+			consoleEvent("Recording ran for %s, stopping until it is started again (ctl start)", maxSession)
+			currentLog().Warn("Maximum session time reached, stopping recording", "maxSession", maxSession)
+			emitStatus(statusEvent{Event: "limit", Reason: fmt.Sprintf("maximum session time of %s reached", maxSession)})
+			if err := controlRecording("stop"); err != nil {
+				consoleError("Could not stop recording: %v", err)
+			}
+
+			// Wait for an explicit start
+			time.Sleep(time.Second)
+			for recorderHold() != "" {
+				time.Sleep(time.Second)
+			}
+			consoleEvent("New recording session started, it stops after %s", maxSession)
+		}
+	}()
+}
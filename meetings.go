@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Time without a meeting window in focus after which the meeting is over,
+// so looking at notes during a call does not end its chapter
+const meetingEndGap = 10 * time.Minute
+
+// Window titles of calls in Zoom, Microsoft Teams, Webex and Google Meet
+const defaultMeetingTitles = `(?i)zoom meeting|meeting with .*\| microsoft teams|webex meeting|^meet - `
+
+// Settings of the meetings profile
+var (
+	meetingsProfile bool
+	// Window titles that start a meeting, nil with a calendar
+	meetingTitleRe *regexp.Regexp
+	// ICS file whose events are the meetings
+	meetingCalendar string
+	// Reminder shown when a meeting starts and kept in the catalog
+	consentNotice string
+)
+
+// meetingChapter is a meeting, a chapter of the segments it spans
+type meetingChapter struct {
+	Title string    `json:"title"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// meetingHistory holds the meetings found through the focused window, the
+// last one ends at the last time its window had the focus
+var meetingHistory struct {
+	sync.Mutex
+	meetings []meetingChapter
+}
+
+// meetingFocus starts a meeting when a meeting window got the focus, or
+// extends the current one
+func meetingFocus(title string, now time.Time) {
+	if meetingTitleRe == nil || !meetingTitleRe.MatchString(title) {
+		return
+	}
+	meetingHistory.Lock()
+	if n := len(meetingHistory.meetings); n > 0 && now.Sub(meetingHistory.meetings[n-1].End) < meetingEndGap {
+		meetingHistory.meetings[n-1].End = now
+		meetingHistory.Unlock()
+		return
+	}
+	meetingHistory.meetings = append(meetingHistory.meetings, meetingChapter{Title: title, Start: now, End: now})
+	meetingHistory.Unlock()
+
+	currentLog().Info("Meeting started", "title", title)
+	consoleEvent("Meeting started: %s", privateLogText(title))
+	if consentNotice != "" {
+		consoleEvent("%s", consentNotice)
+	}
+	emitStatus(statusEvent{Event: "meeting", Label: title, Message: consentNotice})
+}
+
+// segmentMeetings returns the meetings between start and end, cut to the
+// segment. They come from the calendar if there is one.
+func segmentMeetings(start, end time.Time) []meetingChapter {
+	var meetings []meetingChapter
+	if meetingCalendar != "" {
+		events, err := readCalendar(meetingCalendar)
+		if err != nil {
+			consoleWarn("Could not read the calendar %s: %v", meetingCalendar, err)
+			return nil
+		}
+		meetings = events
+	} else {
+		meetingHistory.Lock()
+		for i, m := range meetingHistory.meetings {
+			// A meeting whose window may come back lasts to the segment end
+			if i == len(meetingHistory.meetings)-1 && end.Sub(m.End) < meetingEndGap {
+				m.End = end
+			}
+			meetings = append(meetings, m)
+		}
+		// Later segments only need the meetings that may reach into them
+		for len(meetingHistory.meetings) > 1 && meetingHistory.meetings[0].End.Before(start) {
+			meetingHistory.meetings = meetingHistory.meetings[1:]
+		}
+		meetingHistory.Unlock()
+	}
+
+	var chapters []meetingChapter
+	for _, m := range meetings {
+		if !m.End.After(start) || !m.Start.Before(end) {
+			continue
+		}
+		m.Start = maxTime(m.Start, start)
+		m.End = minTime(m.End, end)
+		chapters = append(chapters, m)
+	}
+	return chapters
+}
+
+// maxTime returns the later of two times
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// minTime returns the earlier of two times
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// readCalendar returns the timed events of an ICS file, as exported by
+// Outlook, Google Calendar or Thunderbird. Recurring events count once,
+// all-day events are no meetings.
+func readCalendar(path string) ([]meetingChapter, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// Long lines continue on lines that start with a space or a tab
+	text := strings.NewReplacer("\r\n ", "", "\r\n\t", "", "\n ", "", "\n\t", "").Replace(string(data))
+	unescape := strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`)
+
+	var events []meetingChapter
+	var event *meetingChapter
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		name, value, _ := strings.Cut(line, ":")
+		key, params, _ := strings.Cut(name, ";")
+		switch {
+		case line == "BEGIN:VEVENT":
+			event = &meetingChapter{}
+		case line == "END:VEVENT":
+			if event != nil && !event.Start.IsZero() && event.End.After(event.Start) {
+				events = append(events, *event)
+			}
+			event = nil
+		case event == nil:
+		case key == "SUMMARY":
+			event.Title = unescape.Replace(value)
+		case key == "DTSTART":
+			event.Start, _ = parseCalendarTime(params, value)
+		case key == "DTEND":
+			event.End, _ = parseCalendarTime(params, value)
+		}
+	}
+	return events, nil
+}
+
+// parseCalendarTime parses an ICS date-time in UTC, in the time zone of its
+// TZID parameter or in local time
+func parseCalendarTime(params, value string) (time.Time, error) {
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse("20060102T150405Z", value)
+	}
+	loc := time.Local
+	for _, p := range strings.Split(params, ";") {
+		if tz, ok := strings.CutPrefix(p, "TZID="); ok {
+			if l, err := time.LoadLocation(strings.Trim(tz, `"`)); err == nil {
+				loc = l
+			}
+		}
+	}
+	return time.ParseInLocation("20060102T150405", value, loc)
+}
+
+// writeMeetingChapters adds a chapter per meeting to a finished segment
+// recorded from start. The streams are copied into a new file with the
+// chapters, which then replaces the segment.
+func writeMeetingChapters(videoFile string, start time.Time, meetings []meetingChapter) error {
+	escape := strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", `\`+"\n")
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	for _, m := range meetings {
+		fmt.Fprintf(&b, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			m.Start.Sub(start).Milliseconds(), m.End.Sub(start).Milliseconds(), escape.Replace(m.Title))
+	}
+	ext := filepath.Ext(videoFile)
+	base := strings.TrimSuffix(videoFile, ext)
+	metadata, chaptered := base+".chapters.txt", base+".chapters"+ext
+	if err := os.WriteFile(metadata, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	defer os.Remove(metadata)
+	cmd := exec.Command("ffmpeg", "-nostdin", "-hide_banner", "-loglevel", "error", "-y",
+		"-i", videoFile, "-i", metadata, "-map", "0", "-map_metadata", "0", "-map_chapters", "1", "-c", "copy", chaptered)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(chaptered)
+		return fmt.Errorf("%v %s", err, strings.TrimSpace(string(out)))
+	}
+	return os.Rename(chaptered, videoFile)
+}
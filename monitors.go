@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// monitorInfo describes a monitor in desktop coordinates
+type monitorInfo struct {
+	name          string
+	x, y          int
+	width, height int
+	primary       bool
+}
+
+// parseMonitorDisplay returns N for a "monitor:N" display ID
+func parseMonitorDisplay(display string) (int, bool) {
+	n, found := strings.CutPrefix(display, "monitor:")
+	if !found {
+		return 0, false
+	}
+	idx, err := strconv.Atoi(n)
+	if err != nil || idx < 0 {
+		return 0, false
+	}
+	return idx, true
+}
+
+// monitorCaptureArgs returns the gdigrab options that limit the capture of
+// the desktop to monitor N
+func monitorCaptureArgs(idx int) ([]string, monitorInfo, error) {
+	monitors, err := listMonitors()
+	if err != nil {
+		return nil, monitorInfo{}, err
+	}
+	if idx >= len(monitors) {
+		return nil, monitorInfo{}, fmt.Errorf("monitor %d not found, %d monitors available", idx, len(monitors))
+	}
+
+	m := monitors[idx]
+	return []string{
+		"-offset_x", strconv.Itoa(m.x),
+		"-offset_y", strconv.Itoa(m.y),
+		"-video_size", fmt.Sprintf("%dx%d", m.width, m.height),
+	}, m, nil
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+// listMonitors is only implemented on Windows, other platforms select
+// monitors through their own display IDs
+func listMonitors() ([]monitorInfo, error) {
+	return nil, errors.New("monitor selection is only supported on Windows")
+}
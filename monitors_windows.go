@@ -0,0 +1,72 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	moduser32               = syscall.NewLazyDLL("user32.dll")
+	procEnumDisplayMonitors = moduser32.NewProc("EnumDisplayMonitors")
+	procGetMonitorInfoW     = moduser32.NewProc("GetMonitorInfoW")
+)
+
+// MONITORINFOF_PRIMARY flag of MONITORINFO.dwFlags
+const monitorInfoPrimary = 1
+
+type rect struct {
+	left, top, right, bottom int32
+}
+
+// monitorInfoEx mirrors MONITORINFOEXW
+type monitorInfoEx struct {
+	cbSize    uint32
+	rcMonitor rect
+	rcWork    rect
+	dwFlags   uint32
+	szDevice  [32]uint16
+}
+
+// listMonitors returns all monitors in desktop coordinates, primary first.
+// Monitors left of or above the primary one have negative coordinates.
+func listMonitors() ([]monitorInfo, error) {
+	var monitors []monitorInfo
+	callback := syscall.NewCallback(func(hMonitor, hdc, lprc, lparam uintptr) uintptr {
+		info := monitorInfoEx{}
+		info.cbSize = uint32(unsafe.Sizeof(info))
+		if r, _, _ := procGetMonitorInfoW.Call(hMonitor, uintptr(unsafe.Pointer(&info))); r != 0 {
+			monitors = append(monitors, monitorInfo{
+				name:    syscall.UTF16ToString(info.szDevice[:]),
+				x:       int(info.rcMonitor.left),
+				y:       int(info.rcMonitor.top),
+				width:   int(info.rcMonitor.right - info.rcMonitor.left),
+				height:  int(info.rcMonitor.bottom - info.rcMonitor.top),
+				primary: info.dwFlags&monitorInfoPrimary != 0,
+			})
+		}
+		return 1 // continue enumeration
+	})
+
+	if r, _, e := procEnumDisplayMonitors.Call(0, 0, callback, 0); r == 0 {
+		return nil, fmt.Errorf("EnumDisplayMonitors failed: %v", e)
+	}
+	if len(monitors) == 0 {
+		return nil, fmt.Errorf("no monitors found")
+	}
+
+	// Stable numbering: primary first, then left to right, top to bottom
+	sort.SliceStable(monitors, func(i, j int) bool {
+		if monitors[i].primary != monitors[j].primary {
+			return monitors[i].primary
+		}
+		if monitors[i].x != monitors[j].x {
+			return monitors[i].x < monitors[j].x
+		}
+		return monitors[i].y < monitors[j].y
+	})
+	return monitors, nil
+}
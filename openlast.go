@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// lastRecording returns the newest segment of the catalog whose file is in
+// the output directory, skipping segments in cold storage or lost
+func lastRecording() (string, error) {
+	entries, err := readCatalog()
+	if err != nil {
+		return "", fmt.Errorf("could not read catalog: %v", err)
+	}
+	var last *catalogEntry
+	var lastFile string
+	for i := range entries {
+		e := &entries[i]
+		if e.File == "" || e.Storage != "" || e.Lost || last != nil && !e.Start.After(last.Start) {
+			continue
+		}
+		file := filepath.Join(outputDir, filepath.FromSlash(e.File))
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		last, lastFile = e, file
+	}
+	if last == nil {
+		return "", fmt.Errorf("no recording of the catalog of %s is in the directory", outputDir)
+	}
+	return lastFile, nil
+}
+
+// revealCommands returns the commands that show file selected in the file
+// manager of goos, to be tried in order: Finder, Explorer, or the
+// FileManager1 D-Bus interface of Nautilus, Dolphin, Nemo and others on
+// Linux, else the directory with xdg-open
+func revealCommands(goos, file string) []*exec.Cmd {
+	switch goos {
+	case "darwin":
+		return []*exec.Cmd{exec.Command("open", "-R", file)}
+	case "windows":
+		// explorer exits with 1 even when it opened the window
+		return []*exec.Cmd{exec.Command("explorer", "/select,"+file)}
+	}
+	uri := (&url.URL{Scheme: "file", Path: file}).String()
+	return []*exec.Cmd{
+		exec.Command("dbus-send", "--session", "--print-reply", "--dest=org.freedesktop.FileManager1", "/org/freedesktop/FileManager1",
+			"org.freedesktop.FileManager1.ShowItems", "array:string:"+uri, "string:"),
+		exec.Command("xdg-open", filepath.Dir(file)),
+	}
+}
+
+// openFolderCommand returns the command that opens dir in the file manager
+// of goos
+func openFolderCommand(goos, dir string) *exec.Cmd {
+	switch goos {
+	case "darwin":
+		return exec.Command("open", dir)
+	case "windows":
+		return exec.Command("explorer", dir)
+	}
+	return exec.Command("xdg-open", dir)
+}
+
+// runOpenCommand shows the newest recording in the file manager, found
+// through the catalog so imports, tags and subdirectories do not matter,
+// or with folder the output directory. A desktop shortcut or menu entry
+// can run it.
+func runOpenCommand(name string, args []string) int {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	outputDirFlag := fs.String("output", outputDir, "Directory that holds the recordings and the catalog")
+	printFlag := fs.Bool("print", false, "Only print the path instead of opening the file manager")
+	envUsage(fs)
+	if err := applyFlagEnv(fs); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	fs.Parse(args)
+	outputDir = *outputDirFlag
+	if fs.NArg() != 0 {
+		consoleInfo("Usage: screen-vibe %s [-output dir] [-print]", name)
+		return 2
+	}
+
+	abs, err := filepath.Abs(outputDir)
+	if err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	if name == "open-output" {
+		if _, err := os.Stat(abs); err != nil {
+			consoleError("%v", err)
+			return 1
+		}
+		fmt.Println(abs)
+		if *printFlag {
+			return 0
+		}
+		if err := openFolderCommand(runtime.GOOS, abs).Start(); err != nil {
+			consoleError("Could not open %s: %v", abs, err)
+			return 1
+		}
+		return 0
+	}
+
+	if err := openCatalog(); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	file, err := lastRecording()
+	if err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	if file, err = filepath.Abs(file); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	fmt.Println(file)
+	if *printFlag {
+		return 0
+	}
+	for _, cmd := range revealCommands(runtime.GOOS, file) {
+		if runtime.GOOS == "windows" {
+			err = cmd.Start()
+		} else {
+			err = cmd.Run()
+		}
+		if err == nil {
+			return 0
+		}
+	}
+	consoleError("Could not show %s in the file manager: %v", file, err)
+	return 1
+}
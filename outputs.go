@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// Global variables for the network streams
+var udpOutput string
+var udpOnly bool
+var virtualCamera string
+
+// MPEG-TS packets per UDP datagram (7 × 188 bytes) that fit into one
+// ethernet frame
+const udpPacketSize = "1316"
+
+// parseNetworkOutput checks a udp:// or rtp:// URL and adds a packet size
+// suitable for MPEG-TS if none is given
+func parseNetworkOutput(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid stream URL %q: %w", raw, err)
+	}
+	if u.Scheme != "udp" && u.Scheme != "rtp" {
+		return "", fmt.Errorf("unsupported stream URL %q, use udp://host:port or rtp://host:port", raw)
+	}
+	if u.Port() == "" {
+		return "", fmt.Errorf("stream URL %q needs a port", raw)
+	}
+	q := u.Query()
+	if q.Get("pkt_size") == "" {
+		q.Set("pkt_size", udpPacketSize)
+		u.RawQuery = q.Encode()
+	}
+	return u.String(), nil
+}
+
+// recordsFiles reports whether segments are written to the output directory
+func recordsFiles() bool {
+	return !streamOutput && !udpOnly && remoteOutput == ""
+}
+
+// outputTarget is a destination of the encoded video
+type outputTarget struct {
+	format   string
+	url      string
+	optional bool   // a failure does not stop the other targets
+	options  string // more options of the tee muxer for this target
+}
+
+// outputTargetArgs returns the ffmpeg arguments that send the encoded video
+// to the segment file, stdout and the network streams. Several targets are
+// written with the tee muxer, which needs the video stream to be mapped
+// explicitly unless a filter graph already does so.
+func outputTargetArgs(videoFile string, mapped bool) []string {
+	if segmentMuxer {
+		return segmentMuxerArgs(videoFile)
+	}
+	var targets []outputTarget
+	switch {
+	case streamOutput:
+		targets = append(targets, outputTarget{format: streamFormat, url: "pipe:1"})
+	case remoteOutput != "":
+		// The recorder copies stdout to the remote target
+		targets = append(targets, outputTarget{format: "matroska", url: "pipe:1"})
+	case shareProfile:
+		// Neither streams nor -o, the MP4 index is written at the end
+		return segmentFileArgs(videoFile)
+	case !udpOnly:
+		targets = append(targets, outputTarget{format: "matroska", url: videoFile})
+	}
+	if udpOutput != "" {
+		format := "mpegts"
+		if strings.HasPrefix(udpOutput, "rtp://") {
+			format = "rtp_mpegts"
+		}
+		// Monitoring viewers must not be able to break the recording
+		targets = append(targets, outputTarget{format: format, url: udpOutput, optional: len(targets) > 0})
+	}
+
+	if liveOutput != "" {
+		// The RTP muxer takes the video only. Viewers that join between
+		// keyframes need the parameter sets in the stream.
+		targets = append(targets, outputTarget{format: "rtp", url: liveOutput, optional: true, options: "select=v:bsfs/v=dump_extra"})
+	}
+
+	var args []string
+	if liveOutput != "" {
+		// WebRTC players cannot reorder frames
+		args = append(args, "-bf", "0")
+	}
+	if len(targets) == 1 {
+		return append(args, "-f", targets[0].format, targets[0].url)
+	}
+
+	var slaves []string
+	for _, t := range targets {
+		options := "f=" + t.format
+		if t.optional {
+			options += ":onfail=ignore"
+		}
+		if t.options != "" {
+			options += ":" + t.options
+		}
+		slaves = append(slaves, "["+options+"]"+escapeTeeTarget(t.url))
+	}
+	if !mapped {
+		args = append(args, "-map", "0:v")
+	}
+	return append(args, "-f", "tee", strings.Join(slaves, "|"))
+}
+
+// escapeTeeTarget escapes the characters the tee muxer treats specially, so
+// that Windows paths and URLs with queries arrive unchanged
+func escapeTeeTarget(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`\'|[]`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// virtualCameraArgs returns a second ffmpeg output that feeds the raw capture
+// to a v4l2loopback device, so video calls can use the screen as a camera
+func virtualCameraArgs() []string {
+	if virtualCamera == "" {
+		return nil
+	}
+	return []string{
+		"-map", "0:v",
+		"-c:v", "rawvideo",
+		"-pix_fmt", "yuv420p", // Accepted by browsers and conferencing apps
+		"-f", "v4l2",
+		virtualCamera,
+	}
+}
+
+// checkVirtualCamera verifies that the virtual camera device can be used
+func checkVirtualCamera(device string) error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("virtual cameras are only supported on Linux (v4l2loopback)")
+	}
+	fileInfo, err := os.Stat(device)
+	if err != nil {
+		return fmt.Errorf("virtual camera %s not found, load v4l2loopback first (sudo modprobe v4l2loopback exclusive_caps=1)", device)
+	}
+	if fileInfo.Mode()&os.ModeCharDevice == 0 {
+		return fmt.Errorf("%s is not a video device", device)
+	}
+	return nil
+}
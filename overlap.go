@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// Time both segments record once the next one encodes frames
+	overlapMargin = time.Second
+	// Longest time the previous segment waits for the next one to start
+	overlapTimeout = 15 * time.Second
+)
+
+// overlapRotation starts the next segment before the current one stops when
+// segments rotate, so no frame is lost between the two
+var overlapRotation bool
+
+// handOver finishes the previous segment once the segment started with the
+// stop channel next encodes frames, and tells the previous one where the
+// next one starts, so it can cut its end there. If the next segment does
+// not get to its first frame in time, the previous one stops untrimmed.
+func handOver(previous *segmentInfo, next chan bool) {
+	for deadline := time.Now().Add(overlapTimeout); time.Now().Before(deadline); {
+		if seg := activeSegment.Load(); seg != nil && seg.stop == next {
+			if first, ok := seg.progress.firstEncoded(); ok {
+				previous.handover.Store(&first)
+				time.Sleep(overlapMargin)
+				break
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	stopSegment(previous.stop)
+}
+
+// firstEncoded returns when the first frame of the segment was captured:
+// its wall clock timestamp, or else the time of the last progress line less
+// the media time encoded until then, which is never earlier
+func (sp *segmentProgress) firstEncoded() (time.Time, bool) {
+	if first, ok := sp.firstFrameTime(); ok {
+		return first, true
+	}
+	p, updated := sp.snapshot()
+	if updated.IsZero() {
+		return time.Time{}, false
+	}
+	return updated.Add(-p.time), true
+}
+
+// trimSegmentEnd cuts a finished segment after length from its first frame.
+// Cutting the end needs no keyframe, so the streams are copied.
+func trimSegmentEnd(videoFile string, length time.Duration) error {
+	ext := filepath.Ext(videoFile)
+	trimmed := strings.TrimSuffix(videoFile, ext) + ".trim" + ext
+	cmd := recorderFFmpeg.command("-nostdin", "-hide_banner", "-loglevel", "error", "-y",
+		"-i", videoFile, "-t", fmt.Sprintf("%.3f", length.Seconds()), "-map", "0", "-c", "copy", trimmed)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(trimmed)
+		return fmt.Errorf("%v %s", err, strings.TrimSpace(string(out)))
+	}
+	return os.Rename(trimmed, videoFile)
+}
+
+// trimOverlap cuts the end of a segment where the next, overlapping segment
+// starts, and returns the new end of the segment recorded from start. Only
+// files in the output directory can be cut, a segment at a remote target
+// or one that did not get there keeps the overlap.
+func trimOverlap(seg *segmentInfo, videoFile string, start, end time.Time, log *slog.Logger) time.Time {
+	next := seg.handover.Load()
+	if next == nil || !recordsFiles() {
+		return end
+	}
+	if _, err := os.Stat(videoFile); err != nil {
+		log.Warn("Could not trim the overlap with the next segment", "error", err)
+		return end
+	}
+	// Counting from the start of ffmpeg cuts later than the first frame,
+	// the next segment then repeats a few frames instead of missing them
+	origin := start
+	if first, ok := seg.progress.firstFrameTime(); ok {
+		origin = first
+	}
+	if !next.After(origin) || !next.Before(end) {
+		return end
+	}
+	if err := trimSegmentEnd(videoFile, next.Sub(origin)); err != nil {
+		log.Warn("Could not trim the overlap with the next segment", "error", err)
+		return end
+	}
+	log.Info("Trimmed the overlap with the next segment", "overlap", end.Sub(*next).Round(time.Millisecond))
+	return *next
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"go.starlark.net/starlark"
+
+	"screen-vibe/extension"
+)
+
+const (
+	// Interval of the tick event, so policies can follow a schedule
+	policyTickInterval = time.Minute
+	// Execution steps a policy may take per event before it is aborted
+	policyMaxSteps = 1_000_000
+	// Events waiting for the policy before new ones are dropped
+	policyQueueSize = 100
+)
+
+// policyEvents queues events for the policy script, nil without -policy
+var policyEvents chan statusEvent
+
+// policyFPS overrides the frame rate of new segments when set by the
+// policy, 0 when it is not
+var policyFPS atomic.Int32
+
+// policyScript is a loaded -policy script
+type policyScript struct {
+	thread  *starlark.Thread
+	onEvent starlark.Callable
+}
+
+// loadPolicy runs a Starlark policy script, which must define
+// on_event(event). The actions it can call are predeclared.
+func loadPolicy(path string) (*policyScript, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	thread := &starlark.Thread{
+		Name:  "policy",
+		Print: func(_ *starlark.Thread, msg string) { consoleInfo("Policy: %s", msg) },
+	}
+	globals, err := starlark.ExecFile(thread, path, src, policyActions())
+	if err != nil {
+		return nil, policyError(err)
+	}
+	onEvent, ok := globals["on_event"].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("%s does not define on_event(event)", path)
+	}
+	return &policyScript{thread: thread, onEvent: onEvent}, nil
+}
+
+// startPolicy feeds the recorder's events to the policy script one at a
+// time, so a slow script never holds up recording
+func startPolicy(p *policyScript) {
+	policyEvents = make(chan statusEvent, policyQueueSize)
+	handle := func(ev statusEvent) {
+		p.thread.SetMaxExecutionSteps(p.thread.ExecutionSteps() + policyMaxSteps)
+		if _, err := starlark.Call(p.thread, p.onEvent, starlark.Tuple{policyEventDict(ev)}, nil); err != nil {
+			consoleWarn("Policy failed on the %s event: %v", ev.Event, policyError(err))
+		}
+	}
+	// On shutdown the events already queued, like the last stopped, are
+	// still handled
+	goBackground(func() {
+		for {
+			select {
+			case ev := <-policyEvents:
+				handle(ev)
+			case <-shutdownCtx.Done():
+				for {
+					select {
+					case ev := <-policyEvents:
+						handle(ev)
+					default:
+						return
+					}
+				}
+			}
+		}
+	})
+	go func() {
+		for sleepOrShutdown(time.Until(time.Now().Truncate(policyTickInterval).Add(policyTickInterval))) {
+			sendPolicyEvent(statusEvent{Event: "tick", Time: time.Now()})
+		}
+	}()
+}
+
+// sendPolicyEvent queues an event for the policy script if there is one
+func sendPolicyEvent(ev statusEvent) {
+	if policyEvents == nil || ev.Event == "progress" {
+		return
+	}
+	select {
+	case policyEvents <- ev:
+	default:
+		currentLog().Warn("Policy is too slow, dropped an event", "event", ev.Event)
+	}
+}
+
+// policyEventDict converts an event to the dict passed to on_event, with
+// the same keys as the -status-json event plus the local hour, minute and
+// weekday
+func policyEventDict(ev statusEvent) *starlark.Dict {
+	dict := starlark.NewDict(16)
+	data, _ := json.Marshal(ev)
+	var fields map[string]any
+	json.Unmarshal(data, &fields)
+	for k, v := range fields {
+		switch v := v.(type) {
+		case string:
+			dict.SetKey(starlark.String(k), starlark.String(v))
+		case float64:
+			if v == float64(int64(v)) {
+				dict.SetKey(starlark.String(k), starlark.MakeInt64(int64(v)))
+			} else {
+				dict.SetKey(starlark.String(k), starlark.Float(v))
+			}
+		}
+	}
+	local := ev.Time.Local()
+	dict.SetKey(starlark.String("hour"), starlark.MakeInt(local.Hour()))
+	dict.SetKey(starlark.String("minute"), starlark.MakeInt(local.Minute()))
+	dict.SetKey(starlark.String("weekday"), starlark.String(local.Weekday().String()))
+	return dict
+}
+
+// policyError adds the Starlark backtrace to script errors
+func policyError(err error) error {
+	if evalErr, ok := err.(*starlark.EvalError); ok {
+		return fmt.Errorf("%s", evalErr.Backtrace())
+	}
+	return err
+}
+
+// policyActions returns the builtins a policy script can call
+func policyActions() starlark.StringDict {
+	control := func(name, action string) *starlark.Builtin {
+		return starlark.NewBuiltin(name, func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
+				return nil, err
+			}
+			currentLog().Info("Policy action", "action", b.Name())
+			return starlark.None, controlRecording(action)
+		})
+	}
+
+	return starlark.StringDict{
+		"pause":  control("pause", "pause"),
+		"resume": control("resume", "start"),
+		"stop":   control("stop", "stop"),
+		"rotate": starlark.NewBuiltin("rotate", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			reason := "policy"
+			if err := starlark.UnpackArgs(b.Name(), args, kwargs, "reason?", &reason); err != nil {
+				return nil, err
+			}
+			requestRotation(reason)
+			return starlark.None, nil
+		}),
+		"set_fps": starlark.NewBuiltin("set_fps", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var n int
+			if err := starlark.UnpackArgs(b.Name(), args, kwargs, "fps", &n); err != nil {
+				return nil, err
+			}
+			if n < 0 || n > maxFPS {
+				return nil, fmt.Errorf("%s: fps must be %d to %d, or 0 for -fps", b.Name(), minFPS, maxFPS)
+			}
+			if policyFPS.Swap(int32(n)) != int32(n) {
+				currentLog().Info("Policy action", "action", b.Name(), "fps", n)
+				requestRotation(fmt.Sprintf("policy set the frame rate to %d fps", captureFPS()))
+			}
+			return starlark.None, nil
+		}),
+		"upload": starlark.NewBuiltin("upload", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var file string
+			if err := starlark.UnpackArgs(b.Name(), args, kwargs, "file", &file); err != nil {
+				return nil, err
+			}
+			info, err := os.Stat(file)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", b.Name(), err)
+			}
+			segment := extension.Segment{File: file, Start: info.ModTime(), End: info.ModTime(), Size: info.Size()}
+			if extensionsUpload(segment) == 0 {
+				return nil, fmt.Errorf("%s: no extension can upload files", b.Name())
+			}
+			return starlark.None, nil
+		}),
+		"notify": starlark.NewBuiltin("notify", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var message string
+			if err := starlark.UnpackArgs(b.Name(), args, kwargs, "message", &message); err != nil {
+				return nil, err
+			}
+			consoleEvent("Policy: %s", message)
+			sendNotification(fmt.Sprintf("[screen-vibe] Notification from %s", machineName()), message)
+			return starlark.None, nil
+		}),
+	}
+}
+
+// sendNotification sends a message through the notifier extensions and
+// email, if configured
+func sendNotification(subject, message string) {
+	extensionsNotify(subject, message)
+	if !emailEnabled() {
+		return
+	}
+	go func() {
+		if err := sendEmail(subject, message+"\n"); err != nil {
+			consoleWarn("Could not send notification email: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,179 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	portalBus           = "org.freedesktop.portal.Desktop"
+	portalPath          = dbus.ObjectPath("/org/freedesktop/portal/desktop")
+	screenCastInterface = "org.freedesktop.portal.ScreenCast"
+	// Time the user gets to pick a screen in the dialog of the portal
+	portalResponseTimeout = 5 * time.Minute
+)
+
+// Source types and cursor modes of the screen cast portal
+const (
+	screenCastMonitor       = 1
+	screenCastCursorEmbed   = 2
+	screenCastPersistRevoke = 2 // until the user revokes it
+)
+
+// screenCast is a session of the screen cast portal, which streams the
+// screen the user picked over PipeWire
+type screenCast struct {
+	conn    *dbus.Conn
+	session dbus.ObjectPath
+	node    uint32 // PipeWire node of the stream
+	width   int32
+	height  int32
+}
+
+// portalRequest calls a method of the screen cast portal and waits for the
+// Response signal of its request, which carries the results. The request
+// path is known before the call from the handle token, so the signal
+// cannot be missed.
+func portalRequest(conn *dbus.Conn, method string, options map[string]dbus.Variant, args ...any) (map[string]dbus.Variant, error) {
+	token := "screen_vibe_" + newUUID()[:8]
+	sender := strings.NewReplacer(":", "", ".", "_").Replace(conn.Names()[0])
+	path := dbus.ObjectPath("/org/freedesktop/portal/desktop/request/" + sender + "/" + token)
+	if err := conn.AddMatchSignal(dbus.WithMatchObjectPath(path), dbus.WithMatchInterface("org.freedesktop.portal.Request"), dbus.WithMatchMember("Response")); err != nil {
+		return nil, err
+	}
+	defer conn.RemoveMatchSignal(dbus.WithMatchObjectPath(path), dbus.WithMatchInterface("org.freedesktop.portal.Request"), dbus.WithMatchMember("Response"))
+	signals := make(chan *dbus.Signal, 4)
+	conn.Signal(signals)
+	defer conn.RemoveSignal(signals)
+
+	options["handle_token"] = dbus.MakeVariant(token)
+	var handle dbus.ObjectPath
+	if err := conn.Object(portalBus, portalPath).Call(screenCastInterface+"."+method, 0, append(args, options)...).Store(&handle); err != nil {
+		return nil, fmt.Errorf("%s: %w", method, err)
+	}
+	timeout := time.After(portalResponseTimeout)
+	for {
+		select {
+		case s := <-signals:
+			if s.Path != path && s.Path != handle || len(s.Body) < 2 {
+				continue
+			}
+			response, _ := s.Body[0].(uint32)
+			results, _ := s.Body[1].(map[string]dbus.Variant)
+			switch response {
+			case 0:
+				return results, nil
+			case 1:
+				return nil, fmt.Errorf("%s: the screen sharing dialog was canceled", method)
+			default:
+				return nil, fmt.Errorf("%s: the portal refused the request", method)
+			}
+		case <-timeout:
+			return nil, fmt.Errorf("%s: no answer from the portal within %s", method, portalResponseTimeout)
+		}
+	}
+}
+
+// startScreenCast opens a screen cast session of one monitor with the
+// pointer drawn in, restoring the screen of restoreToken if the portal
+// still knows it. It returns the token that restores the screen next time.
+func startScreenCast(restoreToken string) (*screenCast, string, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, "", fmt.Errorf("could not connect to the session bus: %w", err)
+	}
+	s, token, err := negotiateScreenCast(conn, restoreToken)
+	if err != nil {
+		conn.Close()
+		return nil, "", err
+	}
+	return s, token, nil
+}
+
+// negotiateScreenCast runs CreateSession, SelectSources and Start
+func negotiateScreenCast(conn *dbus.Conn, restoreToken string) (*screenCast, string, error) {
+	portal := conn.Object(portalBus, portalPath)
+	v, err := portal.GetProperty(screenCastInterface + ".version")
+	if err != nil {
+		return nil, "", fmt.Errorf("no screen cast portal, install xdg-desktop-portal with the backend of the desktop: %w", err)
+	}
+	version, _ := v.Value().(uint32)
+
+	results, err := portalRequest(conn, "CreateSession", map[string]dbus.Variant{
+		"session_handle_token": dbus.MakeVariant("screen_vibe"),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	var session dbus.ObjectPath
+	switch h := results["session_handle"].Value().(type) {
+	case string:
+		session = dbus.ObjectPath(h)
+	case dbus.ObjectPath:
+		session = h
+	default:
+		return nil, "", errors.New("CreateSession: no session handle")
+	}
+
+	options := map[string]dbus.Variant{
+		"types":    dbus.MakeVariant(uint32(screenCastMonitor)),
+		"multiple": dbus.MakeVariant(false),
+	}
+	if v, err := portal.GetProperty(screenCastInterface + ".AvailableCursorModes"); err == nil {
+		if modes, _ := v.Value().(uint32); modes&screenCastCursorEmbed != 0 {
+			options["cursor_mode"] = dbus.MakeVariant(uint32(screenCastCursorEmbed))
+		}
+	}
+	if version >= 4 {
+		options["persist_mode"] = dbus.MakeVariant(uint32(screenCastPersistRevoke))
+		if restoreToken != "" {
+			options["restore_token"] = dbus.MakeVariant(restoreToken)
+		}
+	}
+	if _, err := portalRequest(conn, "SelectSources", options, session); err != nil {
+		return nil, "", err
+	}
+
+	results, err = portalRequest(conn, "Start", map[string]dbus.Variant{}, session, "")
+	if err != nil {
+		return nil, "", err
+	}
+	streams, _ := results["streams"].Value().([][]any)
+	if len(streams) == 0 || len(streams[0]) < 2 {
+		return nil, "", errors.New("Start: the portal returned no stream")
+	}
+	s := &screenCast{conn: conn, session: session}
+	s.node, _ = streams[0][0].(uint32)
+	if props, ok := streams[0][1].(map[string]dbus.Variant); ok {
+		if size, ok := props["size"].Value().([]any); ok && len(size) == 2 {
+			s.width, _ = size[0].(int32)
+			s.height, _ = size[1].(int32)
+		}
+	}
+	token, _ := results["restore_token"].Value().(string)
+	return s, token, nil
+}
+
+// openRemote returns a new connection to PipeWire that can only see the
+// stream of the session, one per GStreamer process
+func (s *screenCast) openRemote() (*os.File, error) {
+	var fd dbus.UnixFD
+	err := s.conn.Object(portalBus, portalPath).Call(screenCastInterface+".OpenPipeWireRemote", 0, s.session, map[string]dbus.Variant{}).Store(&fd)
+	if err != nil {
+		return nil, fmt.Errorf("OpenPipeWireRemote: %w", err)
+	}
+	return os.NewFile(uintptr(fd), "pipewire"), nil
+}
+
+// close ends the session, which also removes the screen sharing indicator
+func (s *screenCast) close() {
+	s.conn.Object(portalBus, s.session).Call("org.freedesktop.portal.Session.Close", 0)
+	s.conn.Close()
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// screenCast is a session of the screen cast portal, only on Linux
+type screenCast struct {
+	node          uint32
+	width, height int32
+}
+
+// startScreenCast is only available on Linux
+func startScreenCast(restoreToken string) (*screenCast, string, error) {
+	return nil, "", errors.New("the screen cast portal is only available on Linux")
+}
+
+func (s *screenCast) openRemote() (*os.File, error) {
+	return nil, errors.New("the screen cast portal is only available on Linux")
+}
+
+func (s *screenCast) close() {}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Name of the focus in the focus log and subtitles while a private window
+// has it, the real title must not be written anywhere
+const privateFocusLabel = "(private)"
+
+// doNotRecord are the -do-not-record patterns, matched against the
+// application and the title of the focused window
+var doNotRecord []*regexp.Regexp
+
+// doNotRecordAction is what happens while a private window has the focus:
+// pause or blur
+var doNotRecordAction = "pause"
+
+// privateBlur is set while the whole picture is blurred for a private window
+var privateBlur atomic.Bool
+
+// privacyState tracks whether a private window has the focus
+var privacyState struct {
+	sync.Mutex
+	private bool
+	paused  bool // the recorder paused for it
+}
+
+// privateFocus reports whether the focused window matches -do-not-record,
+// and which pattern it matched as its number from 1
+func privateFocus(app, title string) (bool, int) {
+	for i, re := range doNotRecord {
+		if re.MatchString(title) || re.MatchString(app) {
+			return true, i + 1
+		}
+	}
+	return false, 0
+}
+
+// redactFocus pauses or blurs the recording while a private window has the
+// focus, and returns the application and title to remember of the focus.
+// Only the number of the pattern is logged, never the title it matched.
+func redactFocus(app, title string) (string, string) {
+	private, rule := privateFocus(app, title)
+	privacyState.Lock()
+	defer privacyState.Unlock()
+	if private == privacyState.private {
+		if private {
+			return privateFocusLabel, ""
+		}
+		return app, title
+	}
+	privacyState.private = private
+
+	if private {
+		consoleEvent("Private window in focus, recording %s", map[string]string{"pause": "paused", "blur": "blurred"}[doNotRecordAction])
+		currentLog().Info("Redaction started", "rule", rule, "action", doNotRecordAction)
+		emitStatus(statusEvent{Event: "redacted", Reason: doNotRecordAction})
+	} else {
+		consoleEvent("Private window lost the focus, recording again")
+		currentLog().Info("Redaction ended", "action", doNotRecordAction)
+		emitStatus(statusEvent{Event: "unredacted", Reason: doNotRecordAction})
+	}
+
+	switch doNotRecordAction {
+	case "blur":
+		privateBlur.Store(private)
+	case "pause":
+		if private && recorderHold() == "" {
+			privacyState.paused = controlRecording("pause") == nil
+		} else if !private && privacyState.paused {
+			// Recording stopped by a control command stays stopped
+			if recorderHold() == "paused" {
+				controlRecording("start")
+			}
+			privacyState.paused = false
+		}
+	}
+	if private {
+		return privateFocusLabel, ""
+	}
+	return app, title
+}
+
+// privateBlurFilter returns the filter that blurs the whole picture while
+// a private window has the focus, "" without -do-not-record-action blur.
+// Its enable option is switched by followPrivateBlur.
+func privateBlurFilter() string {
+	if len(doNotRecord) == 0 || doNotRecordAction != "blur" {
+		return ""
+	}
+	enable := 0
+	if privateBlur.Load() {
+		enable = 1
+	}
+	return fmt.Sprintf("boxblur@sv_private=luma_radius='min(w,h)/10':luma_power=3:chroma_radius='min(cw,ch)/10':chroma_power=3:enable=%d", enable)
+}
+
+// followPrivateBlur switches the blur of privateBlurFilter on and off with
+// filter commands on ffmpeg's stdin until done is closed
+func followPrivateBlur(stdin io.Writer, done chan struct{}, log *slog.Logger) {
+	ticker := time.NewTicker(blurPollInterval)
+	defer ticker.Stop()
+	sent := privateBlur.Load()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		if blurred := privateBlur.Load(); blurred != sent {
+			enable := 0
+			if blurred {
+				enable = 1
+			}
+			io.WriteString(stdin, fmt.Sprintf("cboxblur@sv_private -1 enable %d\n", enable))
+			log.Info("Private blur", "enabled", blurred)
+			sent = blurred
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// A progress line is logged whenever the output grew by this much
+	progressLogSizeStep = 50 * 1024 * 1024
+	// Interval of the progress summary records
+	progressSummaryInterval = time.Minute
+	// Capture rates below this share of the target fps are logged as drops
+	progressFPSDropRatio = 0.8
+	// ffmpeg's fps is unstable right after starting, ignore drops before this
+	progressFPSWarmup = 10 * time.Second
+)
+
+// Global variable for how often progress lines are written to the log
+var progressLogEvery int
+
+// ffmpegProgress holds the values of one ffmpeg progress line, e.g.
+// "frame=  120 fps=5.0 q=28.0 size=    1024kB time=00:00:24.00 bitrate= 349.5kbits/s speed=1.00x"
+type ffmpegProgress struct {
+	frame   int64
+	fps     float64
+	q       float64
+	size    int64 // bytes
+	time    time.Duration
+	bitrate float64 // kbit/s
+	dup     int64
+	drop    int64
+	speed   float64
+}
+
+// segmentProgress keeps the latest progress of a running recording
+type segmentProgress struct {
+	sync.Mutex
+	last       ffmpegProgress
+	updated    time.Time // when the last progress line was read
+	frameAt    time.Time // when the frame count last advanced
+	inputStart float64   // "start:" reported for the capture input, in seconds
+	haveStart  bool
+	static     staticTracker // static screen periods, only with -dedupe
+	// Signaled when ffmpeg reports a larger output size, for the size limit
+	sizeChanged chan struct{}
+}
+
+var (
+	progressFieldRe = regexp.MustCompile(`(\w+)=\s*(\S+)`)
+	inputStartRe    = regexp.MustCompile(`Duration: .*, start: (-?[0-9]+\.[0-9]+)`)
+)
+
+// parseProgress parses an ffmpeg progress line
+func parseProgress(line string) (ffmpegProgress, bool) {
+	if !strings.HasPrefix(strings.TrimSpace(line), "frame=") {
+		return ffmpegProgress{}, false
+	}
+
+	var p ffmpegProgress
+	for _, m := range progressFieldRe.FindAllStringSubmatch(line, -1) {
+		value := m[2]
+		switch m[1] {
+		case "frame":
+			p.frame, _ = strconv.ParseInt(value, 10, 64)
+		case "fps":
+			p.fps, _ = strconv.ParseFloat(value, 64)
+		case "q":
+			p.q, _ = strconv.ParseFloat(value, 64)
+		case "size", "Lsize":
+			p.size = parseProgressSize(value)
+		case "time":
+			p.time = parseProgressTime(value)
+		case "bitrate":
+			p.bitrate, _ = strconv.ParseFloat(strings.TrimSuffix(value, "kbits/s"), 64)
+		case "dup":
+			p.dup, _ = strconv.ParseInt(value, 10, 64)
+		case "drop":
+			p.drop, _ = strconv.ParseInt(value, 10, 64)
+		case "speed":
+			p.speed, _ = strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+		}
+	}
+	return p, true
+}
+
+// parseProgressSize converts sizes like "1024kB" or "1024KiB" to bytes
+func parseProgressSize(value string) int64 {
+	for _, suffix := range []string{"KiB", "kB"} {
+		if strings.HasSuffix(value, suffix) {
+			n, _ := strconv.ParseInt(strings.TrimSuffix(value, suffix), 10, 64)
+			return n * 1024
+		}
+	}
+	n, _ := strconv.ParseInt(value, 10, 64)
+	return n
+}
+
+// parseProgressTime converts "HH:MM:SS.ss" to a duration
+func parseProgressTime(value string) time.Duration {
+	negative := strings.HasPrefix(value, "-")
+	parts := strings.Split(strings.TrimPrefix(value, "-"), ":")
+	if len(parts) != 3 {
+		return 0
+	}
+	h, errH := strconv.Atoi(parts[0])
+	m, errM := strconv.Atoi(parts[1])
+	sec, errS := strconv.ParseFloat(parts[2], 64)
+	if errH != nil || errM != nil || errS != nil {
+		return 0
+	}
+	d := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec*float64(time.Second))
+	if negative {
+		return -d
+	}
+	return d
+}
+
+// update records a line of ffmpeg output
+func (sp *segmentProgress) update(line string) {
+	if p, ok := parseProgress(line); ok {
+		sp.Lock()
+		if p.frame > sp.last.frame {
+			sp.frameAt = time.Now()
+		}
+		if p.size > sp.last.size {
+			select {
+			case sp.sizeChanged <- struct{}{}:
+			default:
+			}
+		}
+		sp.last = p
+		sp.updated = time.Now()
+		if dedupeFrames {
+			sp.static.update(p.frame, sp.updated)
+		}
+		sp.Unlock()
+		return
+	}
+
+	// The first "start:" belongs to the capture input
+	if m := inputStartRe.FindStringSubmatch(line); m != nil {
+		sp.Lock()
+		if !sp.haveStart {
+			sp.inputStart, _ = strconv.ParseFloat(m[1], 64)
+			sp.haveStart = true
+		}
+		sp.Unlock()
+	}
+}
+
+// snapshot returns the latest progress and when it was read
+func (sp *segmentProgress) snapshot() (ffmpegProgress, time.Time) {
+	sp.Lock()
+	defer sp.Unlock()
+	return sp.last, sp.updated
+}
+
+// lastFrameTime returns when ffmpeg last encoded a new frame, zero before
+// the first one
+func (sp *segmentProgress) lastFrameTime() time.Time {
+	sp.Lock()
+	defer sp.Unlock()
+	return sp.frameAt
+}
+
+// firstFrameTime returns the wall clock time of the first captured frame.
+// It is only known when the input uses wall clock timestamps.
+func (sp *segmentProgress) firstFrameTime() (time.Time, bool) {
+	sp.Lock()
+	defer sp.Unlock()
+	// Wall clock timestamps are seconds since the Unix epoch
+	if !sp.haveStart || sp.inputStart < 1e9 {
+		return time.Time{}, false
+	}
+	sec, frac := math.Modf(sp.inputStart)
+	return time.Unix(int64(sec), int64(frac*1e9)), true
+}
+
+// drift returns how far the recorded media time lags behind the wall
+// clock time elapsed since the first frame, at the last progress update
+func (sp *segmentProgress) drift() (time.Duration, bool) {
+	first, ok := sp.firstFrameTime()
+	if !ok {
+		return 0, false
+	}
+	last, updated := sp.snapshot()
+	if updated.IsZero() {
+		return 0, false
+	}
+	return updated.Sub(first) - last.time, true
+}
+
+// progressLogger writes ffmpeg output to the segment log, keeping only every
+// Nth progress line, significant changes and a summary record per minute
+type progressLogger struct {
+	log        *slog.Logger
+	targetFPS  int   // frame rate the segment is captured at
+	count      int   // progress lines seen
+	loggedSize int64 // size of the last logged progress line
+	fpsLow     bool
+
+	// Current summary window
+	windowStart    time.Time
+	first, last    ffmpegProgress
+	minFPS, maxFPS float64
+	updates        int
+}
+
+func newProgressLogger(log *slog.Logger) *progressLogger {
+	return &progressLogger{log: log, targetFPS: captureFPS(), windowStart: time.Now()}
+}
+
+// line logs a line of ffmpeg output
+func (pl *progressLogger) line(s string) {
+	p, ok := parseProgress(s)
+	if !ok {
+		pl.log.Debug(s)
+		return
+	}
+	pl.count++
+
+	low := pl.targetFPS > 0 && p.time >= progressFPSWarmup && p.fps < float64(pl.targetFPS)*progressFPSDropRatio
+	logged := true
+	switch {
+	case low && !pl.fpsLow:
+		pl.log.Warn("Capture frame rate dropped", "fps", p.fps, "target", pl.targetFPS, "progress", s)
+	case !low && pl.fpsLow:
+		pl.log.Info("Capture frame rate recovered", "fps", p.fps, "target", pl.targetFPS, "progress", s)
+	case p.size-pl.loggedSize >= progressLogSizeStep:
+		pl.log.Debug(s)
+	case progressLogEvery > 0 && pl.count%progressLogEvery == 0:
+		pl.log.Debug(s)
+	default:
+		logged = false
+	}
+	pl.fpsLow = low
+	if logged {
+		pl.loggedSize = p.size
+	}
+
+	if pl.updates == 0 || p.fps < pl.minFPS {
+		pl.minFPS = p.fps
+	}
+	if pl.updates == 0 || p.fps > pl.maxFPS {
+		pl.maxFPS = p.fps
+	}
+	pl.last = p
+	pl.updates++
+
+	if now := time.Now(); now.Sub(pl.windowStart) >= progressSummaryInterval {
+		pl.summarize(now)
+	}
+}
+
+// flush writes the summary of a partial window when ffmpeg exits
+func (pl *progressLogger) flush() {
+	if pl.updates > 0 {
+		pl.summarize(time.Now())
+	}
+}
+
+// summarize logs the summary record of the current window and starts a new one
+func (pl *progressLogger) summarize(now time.Time) {
+	elapsed := now.Sub(pl.windowStart)
+	frames := pl.last.frame - pl.first.frame
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(frames) / elapsed.Seconds()
+	}
+	pl.log.Info("Progress summary",
+		"period", elapsed.Round(time.Second),
+		"frames", frames,
+		"fps", math.Round(rate*100)/100,
+		"minFps", pl.minFPS,
+		"maxFps", pl.maxFPS,
+		"size", formatFileSize(pl.last.size),
+		"growth", formatFileSize(pl.last.size-pl.first.size),
+		"bitrate", fmt.Sprintf("%.1f kbit/s", pl.last.bitrate),
+		"speed", pl.last.speed,
+		"dropped", pl.last.drop-pl.first.drop,
+		"duplicated", pl.last.dup-pl.first.dup,
+		"updates", pl.updates)
+
+	pl.windowStart = now
+	pl.first = pl.last
+	pl.updates = 0
+}
+
+// segmentStats summarizes how well a finished segment kept up with its
+// settings
+type segmentStats struct {
+	Frames        int64   `json:"frames"`
+	FPS           float64 `json:"fps"`
+	TargetFPS     int     `json:"target_fps"`
+	Bitrate       float64 `json:"bitrate_kbps"`
+	TargetBitrate int     `json:"target_bitrate_kbps"`
+	Dropped       int64   `json:"dropped"`
+	Duplicated    int64   `json:"duplicated"`
+	Speed         float64 `json:"speed"`
+	CPUSeconds    float64 `json:"cpu_seconds"`
+}
+
+// stats returns the statistics of the segment from the last progress line,
+// the size of the finished file (0 if unknown) and the CPU time of ffmpeg.
+// It returns nil if ffmpeg reported no progress.
+func (sp *segmentProgress) stats(size int64, cpu time.Duration, targetFPS, targetBitrate int) *segmentStats {
+	last, updated := sp.snapshot()
+	if updated.IsZero() {
+		return nil
+	}
+	s := &segmentStats{
+		Frames:        last.frame,
+		TargetFPS:     targetFPS,
+		Bitrate:       last.bitrate,
+		TargetBitrate: targetBitrate,
+		Dropped:       last.drop,
+		Duplicated:    last.dup,
+		Speed:         last.speed,
+		CPUSeconds:    math.Round(cpu.Seconds()*100) / 100,
+	}
+	// ffmpeg's values are averages since the start, the file size also
+	// counts the index written at the end
+	if seconds := last.time.Seconds(); seconds > 0 {
+		s.FPS = math.Round(float64(last.frame)/seconds*100) / 100
+		if size > 0 {
+			s.Bitrate = float64(size) * 8 / 1000 / seconds
+		}
+	}
+	s.Bitrate = math.Round(s.Bitrate*10) / 10
+	return s
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// catalogDiscrepancy is a difference between the catalog and the output
+// directory
+type catalogDiscrepancy struct {
+	kind   string // uncataloged, missing, found, size, duration or unreadable
+	file   string
+	detail string
+}
+
+// reconcileCatalog compares the catalog with the segment files of the
+// output directory and returns the differences. With fix it adds the
+// uncataloged segments, marks and unmarks lost ones and corrects sizes;
+// with probe it also reads the duration of the recovered segments with
+// ffprobe, for times their name and last change do not give.
+func reconcileCatalog(probe, fix bool) ([]catalogDiscrepancy, error) {
+	entries, err := readCatalog()
+	if err != nil {
+		return nil, err
+	}
+	cataloged := map[string]bool{}
+	for _, e := range entries {
+		cataloged[e.File] = true
+	}
+
+	var found []catalogDiscrepancy
+	fixed := map[string]catalogEntry{}
+	for _, e := range entries {
+		if e.File == "" || e.Remote != "" || e.Storage != "" {
+			continue
+		}
+		changed, before := e, len(found)
+		info, err := os.Stat(filepath.Join(outputDir, filepath.FromSlash(e.File)))
+		switch {
+		case os.IsNotExist(err):
+			if !e.Lost {
+				found = append(found, catalogDiscrepancy{"missing", e.File, "the file is gone, marked as lost"})
+				changed.Lost = true
+			}
+		case err != nil:
+			found = append(found, catalogDiscrepancy{"unreadable", e.File, err.Error()})
+		default:
+			if e.Lost {
+				found = append(found, catalogDiscrepancy{"found", e.File, "the file is back, no longer marked as lost"})
+				changed.Lost = false
+			}
+			if info.Size() != e.Size {
+				found = append(found, catalogDiscrepancy{"size", e.File,
+					fmt.Sprintf("%s in the catalog, %s on disk", formatFileSize(e.Size), formatFileSize(info.Size()))})
+				changed.Size = info.Size()
+			}
+			if probe && e.Recovered {
+				found = append(found, probeSegmentTimes(&changed)...)
+			}
+		}
+		if len(found) > before {
+			fixed[e.File] = changed
+		}
+	}
+
+	orphans := orphanedSegments(cataloged, time.Now())
+	for i := range orphans {
+		found = append(found, catalogDiscrepancy{"uncataloged", orphans[i].File, "added to the catalog"})
+		if probe {
+			found = append(found, probeSegmentTimes(&orphans[i])...)
+		}
+	}
+	if !fix || len(fixed) == 0 && len(orphans) == 0 {
+		return found, nil
+	}
+	return found, updateCatalog(func(entries []catalogEntry) []catalogEntry {
+		for i, e := range entries {
+			if changed, ok := fixed[e.File]; ok && e.Remote == "" {
+				entries[i] = changed
+			}
+		}
+		return append(entries, orphans...)
+	})
+}
+
+// probeSegmentTimes reads the duration of a recovered segment and corrects
+// its end, or its start if the file name has no time
+func probeSegmentTimes(e *catalogEntry) []catalogDiscrepancy {
+	duration, err := probeDuration(filepath.Join(outputDir, filepath.FromSlash(e.File)))
+	if err != nil {
+		return []catalogDiscrepancy{{"unreadable", e.File, err.Error()}}
+	}
+	start, end := e.Start, e.End
+	if _, err := time.ParseInLocation(segmentNameLayout, segmentNamePrefix(e.File), time.Local); err == nil {
+		end = start.Add(duration)
+	} else {
+		start = end.Add(-duration)
+	}
+	if start.Equal(e.Start) && end.Equal(e.End) {
+		return nil
+	}
+	was := e.End.Sub(e.Start).Round(time.Second)
+	e.Start, e.End = start, end
+	return []catalogDiscrepancy{{"duration", e.File, fmt.Sprintf("%s in the catalog, %s in the file", was, duration.Round(time.Second))}}
+}
+
+// segmentNamePrefix returns the part of a segment file name that holds its
+// start time
+func segmentNamePrefix(file string) string {
+	name := filepath.Base(file)
+	return name[:min(len(name), len(segmentNameLayout))]
+}
+
+// probeDuration returns the duration of a media file. Files that were cut
+// off have no duration in their header, then it is the time of their last
+// video packet.
+func probeDuration(file string) (time.Duration, error) {
+	out, err := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "json", file).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe: %v", probeError(err))
+	}
+	var probed struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(out, &probed); err != nil {
+		return 0, fmt.Errorf("ffprobe: %v", err)
+	}
+	if seconds, err := strconv.ParseFloat(probed.Format.Duration, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+
+	out, err = exec.Command("ffprobe", "-v", "error", "-select_streams", "v:0", "-show_entries", "packet=pts_time", "-of", "csv=p=0", file).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe: %v", probeError(err))
+	}
+	last := 0.0
+	for _, line := range strings.Fields(string(out)) {
+		if t, err := strconv.ParseFloat(strings.TrimSuffix(line, ","), 64); err == nil && t > last {
+			last = t
+		}
+	}
+	if last == 0 {
+		return 0, errors.New("the file has no video")
+	}
+	return time.Duration(last * float64(time.Second)), nil
+}
+
+// probeError returns the message ffprobe printed for a failure
+func probeError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
+
+// runReconcileCommand compares the catalog with the output directory,
+// prints the differences and fixes them
+func runReconcileCommand(args []string) int {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	dryRunFlag := fs.Bool("dry-run", false, "Only print the differences, do not change the catalog")
+	instanceFlag := fs.String("instance", "default", "Recorder instance that writes to the output directory, it must not be running")
+	outputDirFlag := fs.String("output", outputDir, "Directory that holds the recordings and the catalog")
+	envUsage(fs)
+	if err := applyFlagEnv(fs); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	fs.Parse(args)
+	outputDir = *outputDirFlag
+
+	if err := openCatalog(); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	// The recorder would append to the catalog while it is rewritten
+	if !*dryRunFlag {
+		if conn, err := dialControl(controlSocketPath(*instanceFlag), time.Second); err == nil {
+			conn.Close()
+			consoleError("Instance %q is running, stop it first or use -dry-run; it reconciles the catalog itself when it starts", *instanceFlag)
+			return 1
+		}
+	}
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		consoleError("ffprobe is not installed or not in PATH, it comes with ffmpeg")
+		return 1
+	}
+
+	found, err := reconcileCatalog(true, !*dryRunFlag)
+	unreadable := 0
+	for _, d := range found {
+		fmt.Printf("%-12s %s  %s\n", d.kind, d.file, d.detail)
+		if d.kind == "unreadable" {
+			unreadable++
+		}
+	}
+	if err != nil {
+		consoleError("Could not reconcile the catalog: %v", err)
+		return 1
+	}
+	fixable := len(found) - unreadable
+	switch {
+	case len(found) == 0:
+		consoleInfo("The catalog matches %s", outputDir)
+	case fixable == 0:
+	case *dryRunFlag:
+		consoleInfo("%d differences between the catalog and %s, run without -dry-run to fix them", fixable, outputDir)
+	default:
+		consoleInfo("Reconciled %d differences between the catalog and %s", fixable, outputDir)
+	}
+	if unreadable > 0 {
+		consoleWarn("%d segment files cannot be read, they may be damaged", unreadable)
+	}
+	return 0
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	if dir := os.Getenv(fakeFFmpegEnv); dir != "" {
+		os.Exit(fakeFFmpeg(dir, os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// testRecorder is a recording session of the tests, recording with the
+// fake ffmpeg into a temporary output directory
+type testRecorder struct {
+	t    *testing.T
+	fake string // directory of the fake ffmpeg
+	done chan bool
+	sigs chan os.Signal
+	// Set once the session ended
+	stopped bool
+}
+
+// recorderOSes are the platforms whose recording pipeline the tests run,
+// each on any platform
+var recorderOSes = []string{"linux", "windows", "darwin"}
+
+// forEachOS runs test with the recording pipeline of each platform
+func forEachOS(t *testing.T, test func(t *testing.T, goos string)) {
+	for _, goos := range recorderOSes {
+		t.Run(goos, func(t *testing.T) { test(t, goos) })
+	}
+}
+
+// startTestRecorder starts a recording session with the pipeline of goos
+// that runs the fake ffmpeg with script, see fakeFFmpeg
+func startTestRecorder(t *testing.T, goos, script string) *testRecorder {
+	dir := t.TempDir()
+	fake := filepath.Join(dir, "ffmpeg")
+	if err := os.Mkdir(fake, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(fake, "script"), []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(fakeFFmpegEnv, fake)
+	setGlobal[ffmpegRunner](t, &recorderFFmpeg, fakeFFmpegRunner{})
+	setGlobal(t, &recorderOS, goos)
+	// Segments follow each other within a second
+	setGlobal(t, &segmentBaseName, func(t time.Time) string { return t.Format(segmentNameLayout + ".000") })
+	setGlobal[io.Writer](t, &consoleOut, io.Discard)
+	setGlobal(t, &outputDir, filepath.Join(dir, "output"))
+	setGlobal(t, &fps, 20)
+	setGlobal(t, &bitrate, 1000)
+	setGlobal(t, &preset, "medium")
+	if maxFileSizeBytes == 0 {
+		setGlobal(t, &maxFileSizeBytes, 1<<30)
+	}
+	setGlobal(t, &sizeCheckInterval, 100*time.Millisecond)
+	display := ":0.0"
+	switch goos {
+	case "windows":
+		display = "desktop"
+	case "darwin":
+		display = "1:none"
+	}
+	setGlobal(t, &manualDisplayID, display)
+	// Requests left over from another test
+	for len(rotateRequests) > 0 {
+		<-rotateRequests
+	}
+
+	r := &testRecorder{t: t, fake: fake, done: make(chan bool, 1), sigs: make(chan os.Signal, 1)}
+	go startRecordingSession(r.done, r.sigs)
+	t.Cleanup(func() {
+		if !r.stopped {
+			r.stop()
+		}
+	})
+	return r
+}
+
+// waitFor waits until cond holds and fails the test if it does not within
+// ten seconds
+func (r *testRecorder) waitFor(what string, cond func() bool) {
+	r.t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); !cond(); time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			r.t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+// waitForRuns waits until the fake ffmpeg was started n times and the
+// current segment records, it reported its first frame
+func (r *testRecorder) waitForRuns(n int) {
+	r.t.Helper()
+	r.waitFor("ffmpeg to run", func() bool {
+		runs, _ := fakeFFmpegRuns(r.fake)
+		if seg := activeSegment.Load(); len(runs) == n && seg != nil {
+			_, updated := seg.progress.snapshot()
+			return !updated.IsZero()
+		}
+		return false
+	})
+}
+
+// stop stops the session like Ctrl+C and waits for the segments to be
+// cataloged
+func (r *testRecorder) stop() {
+	r.t.Helper()
+	r.stopped = true
+	r.sigs <- os.Interrupt
+	select {
+	case <-r.done:
+	case <-time.After(20 * time.Second):
+		r.t.Fatal("recording session did not stop")
+	}
+	segmentJobs.Wait()
+}
+
+// catalog returns the cataloged segments and checks that their files exist
+// and were written to
+func (r *testRecorder) catalog() []catalogEntry {
+	r.t.Helper()
+	entries, err := readCatalog()
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	for _, e := range entries {
+		info, err := os.Stat(filepath.Join(outputDir, e.File))
+		if err != nil {
+			r.t.Fatal(err)
+		}
+		if info.Size() == 0 || info.Size() != e.Size {
+			r.t.Errorf("%s has %d bytes, the catalog %d", e.File, info.Size(), e.Size)
+		}
+	}
+	return entries
+}
+
+func TestGracefulStop(t *testing.T) {
+	forEachOS(t, func(t *testing.T, goos string) {
+		r := startTestRecorder(t, goos, "")
+		r.waitForRuns(1)
+		r.stop()
+
+		runs, quits := fakeFFmpegRuns(r.fake)
+		if len(runs) != 1 || !slices.Equal(quits, []int{1}) {
+			t.Fatalf("ffmpeg ran %d times and stopped on 'q' in runs %v, want 1 run stopped on 'q'", len(runs), quits)
+		}
+		entries := r.catalog()
+		if len(entries) != 1 {
+			t.Fatalf("%d segments cataloged, want 1", len(entries))
+		}
+		capture := map[string]string{"linux": "-f x11grab", "windows": "-f gdigrab", "darwin": "-f avfoundation"}[goos]
+		if !strings.Contains(runs[0], capture) {
+			t.Errorf("ffmpeg ran without %s: %s", capture, runs[0])
+		}
+		if !strings.HasSuffix(runs[0], filepath.Join(outputDir, entries[0].File)) {
+			t.Errorf("ffmpeg recorded to %q, the catalog lists %s", runs[0], entries[0].File)
+		}
+		if entries[0].Stats == nil || entries[0].Stats.Frames == 0 {
+			t.Errorf("no progress of ffmpeg in the catalog: %+v", entries[0].Stats)
+		}
+	})
+}
+
+func TestRotation(t *testing.T) {
+	forEachOS(t, func(t *testing.T, goos string) {
+		r := startTestRecorder(t, goos, "")
+		r.waitForRuns(1)
+		requestRotation("test")
+		r.waitForRuns(2)
+		r.stop()
+
+		runs, quits := fakeFFmpegRuns(r.fake)
+		if len(runs) != 2 || !slices.Equal(quits, []int{1, 2}) {
+			t.Fatalf("ffmpeg ran %d times and stopped on 'q' in runs %v, want 2 runs stopped on 'q'", len(runs), quits)
+		}
+		entries := r.catalog()
+		if len(entries) != 2 || entries[0].File == entries[1].File {
+			t.Fatalf("cataloged %+v, want 2 segments", entries)
+		}
+		if entries[1].Start.Before(entries[0].End) {
+			t.Errorf("the second segment starts at %s, before the first ends at %s", entries[1].Start, entries[0].End)
+		}
+	})
+}
+
+// A stop request that arrives after its segment ended, like a rotation
+// that crossed a size stop, must not stop the next segment
+func TestLateStopRequest(t *testing.T) {
+	forEachOS(t, func(t *testing.T, goos string) {
+		r := startTestRecorder(t, goos, "")
+		r.waitForRuns(1)
+		seg := activeSegment.Load()
+		stopSegment(seg.stop)
+		r.waitFor("the next segment", func() bool {
+			next := activeSegment.Load()
+			return next != nil && next != seg
+		})
+		stopSegment(seg.stop)
+		r.waitForRuns(2)
+		r.stop()
+
+		if runs, quits := fakeFFmpegRuns(r.fake); len(runs) != 2 || !slices.Equal(quits, []int{1, 2}) {
+			t.Fatalf("ffmpeg ran %d times and stopped on 'q' in runs %v, want 2 runs, stopped on 'q' by the request and the test", len(runs), quits)
+		}
+	})
+}
+
+// With -overlap the next segment starts before the current one stops, which
+// is then cut where the next one starts
+func TestOverlapRotation(t *testing.T) {
+	forEachOS(t, func(t *testing.T, goos string) {
+		setGlobal(t, &overlapRotation, true)
+		r := startTestRecorder(t, goos, "")
+		r.waitForRuns(1)
+		requestRotation("test")
+		r.waitFor("the first segment", func() bool {
+			entries, _ := readCatalog()
+			return len(entries) == 1
+		})
+		r.stop()
+
+		runs, quits := fakeFFmpegRuns(r.fake)
+		if len(runs) != 2 || !slices.Equal(quits, []int{1, 2}) {
+			t.Fatalf("ffmpeg ran %d times and stopped on 'q' in runs %v, want 2 runs stopped on 'q'", len(runs), quits)
+		}
+		entries := r.catalog()
+		if len(entries) != 2 {
+			t.Fatalf("%d segments cataloged, want 2", len(entries))
+		}
+		trims, err := os.ReadFile(filepath.Join(r.fake, "trims.log"))
+		if err != nil || !strings.Contains(string(trims), filepath.Join(outputDir, entries[0].File)) {
+			t.Fatalf("the first segment was not cut: %q, %v", trims, err)
+		}
+		// The cut is at the first frame of the second segment, shortly after
+		// its ffmpeg started
+		if overlap := entries[0].End.Sub(entries[1].Start); overlap < 0 || overlap > overlapMargin {
+			t.Errorf("the first segment ends at %s, the second starts at %s", entries[0].End, entries[1].Start)
+		}
+	})
+}
+
+func TestCrashRestart(t *testing.T) {
+	forEachOS(t, func(t *testing.T, goos string) {
+		r := startTestRecorder(t, goos, "crash 300ms\n")
+		r.waitFor("ffmpeg to crash", func() bool {
+			entries, _ := readCatalog()
+			return len(entries) == 1
+		})
+		r.waitForRuns(2)
+		r.stop()
+
+		runs, quits := fakeFFmpegRuns(r.fake)
+		if len(runs) != 2 || !slices.Equal(quits, []int{2}) {
+			t.Fatalf("ffmpeg ran %d times and stopped on 'q' in runs %v, want a crash and a run stopped on 'q'", len(runs), quits)
+		}
+		if code := recorderExitCode.Load(); code != 0 {
+			t.Fatalf("the recorder gives up with exit code %d after a crash", code)
+		}
+		if entries := r.catalog(); len(entries) != 2 {
+			t.Fatalf("%d segments cataloged, want the crashed one and its successor", len(entries))
+		}
+	})
+}
+
+func TestSizeLimit(t *testing.T) {
+	forEachOS(t, func(t *testing.T, goos string) {
+		const limit = 400 << 10
+		setGlobal(t, &maxFileSizeBytes, limit)
+		r := startTestRecorder(t, goos, "")
+		r.waitForRuns(2)
+		r.stop()
+
+		entries := r.catalog()
+		if len(entries) < 2 {
+			t.Fatalf("%d segments cataloged, want the size limit to start a second one", len(entries))
+		}
+		if size := entries[0].Size; size > limit || size < limit/2 {
+			t.Errorf("the first segment has %d bytes, want it stopped just below the limit of %d", size, limit)
+		}
+		if _, quits := fakeFFmpegRuns(r.fake); len(quits) == 0 || quits[0] != 1 {
+			t.Errorf("the size limit did not stop ffmpeg with 'q': %v", quits)
+		}
+	})
+}
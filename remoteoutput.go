@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"screen-vibe/extension"
+)
+
+const (
+	// Time to wait before the next segment after a remote target failed, so
+	// a server that is down is not asked for a new file every second
+	remoteRetryDelay = 30 * time.Second
+	// Time the remote target gets to read the rest of the output after
+	// ffmpeg exited, in case a child of ffmpeg keeps its stdout open
+	remoteDrainTimeout = 5 * time.Second
+	// Time the ssh command that removes the temporary file of a failed
+	// segment gets, the upload may have failed because the server is gone
+	sshCleanupTimeout = 20 * time.Second
+)
+
+// remoteOutput is the URL of -o that segments are written to instead of
+// the output directory, empty to record files
+var remoteOutput string
+
+// remoteStorage writes the segments to remoteOutput, the built-in SSH
+// target or a storage extension
+var (
+	remoteStorage     extension.Storage
+	remoteStorageName string
+)
+
+// parseRemoteOutput checks the URL of -o. ssh:// is built in, other
+// schemes need a storage extension compiled in.
+func parseRemoteOutput(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("unsupported output %q, use - (stdout), ssh://[user@]host/dir or the URL of a storage extension", raw)
+	}
+	if u.Scheme == "ssh" {
+		if u.Path == "" || u.Path == "/" {
+			return "", fmt.Errorf("output %q needs a directory, e.g. ssh://%s/srv/recordings or ssh://%s/~/recordings", raw, u.Host, u.Host)
+		}
+		if _, err := exec.LookPath("ssh"); err != nil {
+			return "", fmt.Errorf("output %q needs the ssh client: %v", raw, err)
+		}
+		return raw, nil
+	}
+	for _, ext := range extension.Registered() {
+		if s, ok := ext.(extension.Storage); ok && s.Scheme() == u.Scheme {
+			return raw, nil
+		}
+	}
+	return "", fmt.Errorf("output %q needs a storage extension for %s:// compiled in", raw, u.Scheme)
+}
+
+// startRemoteOutput picks the storage of the -o URL, a storage extension
+// only once it initialized, and creates the output directory that keeps
+// the catalog
+func startRemoteOutput() error {
+	scheme, _, _ := strings.Cut(remoteOutput, "://")
+	if scheme == "ssh" {
+		remoteStorage, remoteStorageName = sshStorage{}, "ssh"
+	}
+	for _, ext := range activeExtensions {
+		if s, ok := ext.(extension.Storage); ok && remoteStorage == nil && s.Scheme() == scheme {
+			remoteStorage, remoteStorageName = s, ext.Name()
+		}
+	}
+	if remoteStorage == nil {
+		return fmt.Errorf("the storage extension for %s:// did not initialize", scheme)
+	}
+	return os.MkdirAll(outputDir, 0755)
+}
+
+// remoteSegment is a segment ffmpeg writes to stdout, copied to the remote
+// target while it is recorded
+type remoteSegment struct {
+	w        io.WriteCloser
+	location string
+	written  atomic.Int64
+	// Pipe that is the stdout of ffmpeg, it writes to a pipe of its own
+	// so it does not wait for the remote target
+	stdout, input *os.File
+	done          chan error
+}
+
+// createRemoteSegment starts the file name at the remote target
+func createRemoteSegment(name string) (*remoteSegment, error) {
+	r, input, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	w, location, err := remoteStorage.Create(uploadsCtx, remoteOutput, name)
+	if err != nil {
+		r.Close()
+		input.Close()
+		return nil, err
+	}
+	return &remoteSegment{w: w, location: location, stdout: r, input: input, done: make(chan error, 1)}, nil
+}
+
+// Write counts what reached the remote target, for the size limit
+func (s *remoteSegment) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.written.Add(int64(n))
+	return n, err
+}
+
+// size returns the number of bytes written so far
+func (s *remoteSegment) size() (int64, error) {
+	return s.written.Load(), nil
+}
+
+// receive copies the stdout of ffmpeg to the target once it started and
+// completes the file at its end. When the target fails the pipe is closed,
+// so ffmpeg fails on its next write instead of blocking, and the file is
+// completed with what it got.
+func (s *remoteSegment) receive() {
+	s.input.Close()
+	go func() {
+		_, err := io.Copy(s, s.stdout)
+		s.stdout.Close()
+		// The target tells better why a write failed when it is closed
+		if closeErr := s.w.Close(); closeErr != nil {
+			err = closeErr
+		}
+		s.done <- err
+	}()
+}
+
+// finish waits until the file is complete after ffmpeg exited
+func (s *remoteSegment) finish() error {
+	timer := time.NewTimer(remoteDrainTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-s.done:
+		return err
+	case <-timer.C:
+		s.stdout.Close()
+		return <-s.done
+	}
+}
+
+// waitBeforeRetry waits remoteRetryDelay after the remote target failed,
+// or until the segment is asked to stop
+func waitBeforeRetry(stopRecording chan bool) {
+	timer := time.NewTimer(remoteRetryDelay)
+	defer timer.Stop()
+	select {
+	case <-stopRecording:
+	case <-timer.C:
+	}
+}
+
+// sshStorage writes segments to a directory of an SSH server with cat,
+// without anything on the server besides a shell. The URL is
+// ssh://[user@]host[:port]/dir, /~/dir is relative to the home directory.
+type sshStorage struct{}
+
+func (sshStorage) Scheme() string { return "ssh" }
+
+// Create starts ssh with a shell command that writes its input to a
+// temporary file. The input also ends when the recorder crashes, so only
+// Close renames the file to the segment, with a second ssh command.
+func (sshStorage) Create(ctx context.Context, target, name string) (io.WriteCloser, string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, "", err
+	}
+	dir := u.Path
+	if dir == "/~" || strings.HasPrefix(dir, "/~/") {
+		dir = "." + strings.TrimPrefix(dir, "/~")
+	}
+	file := path.Join(dir, name)
+	host, user := u.Hostname(), (*url.Userinfo)(nil)
+	if u.User != nil {
+		host = u.User.Username() + "@" + host
+		user = url.User(u.User.Username())
+	}
+	args := []string{"-T", "-o", "BatchMode=yes", "-o", "ConnectTimeout=10"}
+	if u.Port() != "" {
+		args = append(args, "-p", u.Port())
+	}
+	args = append(args, "--", host)
+	script := fmt.Sprintf("mkdir -p %s && cat > %s", shellQuote(path.Dir(file)), shellQuote(file+".part"))
+	cmd := exec.CommandContext(ctx, "ssh", append(args, script)...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, "", err
+	}
+	w := &sshWriter{ctx: ctx, args: args, file: file, cmd: cmd, stdin: stdin}
+	cmd.Stderr = &w.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, "", fmt.Errorf("ssh: %v", err)
+	}
+	location := (&url.URL{Scheme: "ssh", User: user, Host: u.Host, Path: path.Join(u.Path, name)}).String()
+	return w, location, nil
+}
+
+// sshWriter is the input of the ssh command of a segment
+type sshWriter struct {
+	ctx context.Context
+	// Arguments of ssh up to the command, and the file on the server
+	args   []string
+	file   string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr bytes.Buffer
+}
+
+func (w *sshWriter) Write(p []byte) (int, error) {
+	return w.stdin.Write(p)
+}
+
+// Close ends the input and renames the file to the segment once all of it
+// was written, or removes the file if the upload failed
+func (w *sshWriter) Close() error {
+	w.stdin.Close()
+	part := shellQuote(w.file + ".part")
+	if err := sshResult(w.cmd.Wait(), &w.stderr); err != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), sshCleanupTimeout)
+		defer cancel()
+		w.run(ctx, "rm -f "+part)
+		return err
+	}
+	return w.run(w.ctx, fmt.Sprintf("mv %s %s", part, shellQuote(w.file)))
+}
+
+// run runs a shell command on the server of the segment
+func (w *sshWriter) run(ctx context.Context, script string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ssh", append(w.args, script)...)
+	cmd.Stderr = &stderr
+	return sshResult(cmd.Run(), &stderr)
+}
+
+// sshResult turns the error of an ssh command into the message of ssh or of
+// the shell on the server
+func sshResult(err error, stderr *bytes.Buffer) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = exitErr.Error()
+		}
+		// ssh exits with 255 for its own errors, anything else is the shell
+		if exitErr.ExitCode() == 255 {
+			if !strings.HasPrefix(message, "ssh:") {
+				message = "ssh: " + message
+			}
+			return errors.New(message)
+		}
+		return fmt.Errorf("writing on the server failed: %s", message)
+	}
+	return err
+}
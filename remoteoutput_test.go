@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// useFakeSSH puts an ssh in the PATH that runs the command locally in dir,
+// which stands in for the server
+func useFakeSSH(t *testing.T) (dir string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ssh is a shell script")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip(err)
+	}
+	bin, dir := t.TempDir(), t.TempDir()
+	script := "#!/bin/sh\nwhile [ \"$1\" != -- ]; do shift; done\nshift 2\ncd " + shellQuote(dir) + " && exec sh -c \"$1\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "ssh"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func TestSSHStorage(t *testing.T) {
+	server := useFakeSSH(t)
+	segment := filepath.Join(server, "rec", "a.mkv")
+	create := func(ctx context.Context, name string) io.WriteCloser {
+		w, location, err := sshStorage{}.Create(ctx, "ssh://alice@nas/~/rec", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "ssh://alice@nas/~/rec/" + name; location != want {
+			t.Errorf("location %s, want %s", location, want)
+		}
+		if _, err := io.WriteString(w, "segment"); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	// A crash ends the input without Close, which must not complete the
+	// segment
+	w := create(context.Background(), "a.mkv")
+	w.(*sshWriter).stdin.Close()
+	w.(*sshWriter).cmd.Wait()
+	if _, err := os.Stat(segment); !os.IsNotExist(err) {
+		t.Fatalf("the segment of a crashed recorder was completed: %v", err)
+	}
+
+	w = create(context.Background(), "a.mkv")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(segment); err != nil || string(data) != "segment" {
+		t.Fatalf("segment after Close: %q, %v", data, err)
+	}
+	if _, err := os.Stat(segment + ".part"); !os.IsNotExist(err) {
+		t.Errorf("the temporary file is left: %v", err)
+	}
+
+	// A cancelled upload removes its temporary file
+	ctx, cancel := context.WithCancel(context.Background())
+	w = create(ctx, "b.mkv")
+	cancel()
+	if err := w.Close(); err == nil {
+		t.Fatal("a cancelled upload was completed")
+	}
+	for _, name := range []string{"b.mkv", "b.mkv.part"} {
+		if _, err := os.Stat(filepath.Join(server, "rec", name)); !os.IsNotExist(err) {
+			t.Errorf("%s is left after a cancelled upload: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// Interval between two passes that delete expired segments
+	retentionInterval = time.Hour
+	// Set in the environment of the recorders of a supervisor, which
+	// deletes their expired segments
+	supervisorJanitorEnv = "SCREEN_VIBE_SUPERVISOR_JANITOR"
+)
+
+// retention is how long finished segments are kept, 0 to keep them
+var retention time.Duration
+
+// startRetention deletes expired segments now and every retentionInterval
+// until the recorder shuts down
+func startRetention() {
+	goBackground(func() {
+		for {
+			deleteExpiredSegments()
+			if !sleepOrShutdown(retentionInterval) {
+				return
+			}
+		}
+	})
+}
+
+// runJanitor deletes the expired segments of the pipelines of a
+// supervisor whose recorders leave it to the supervisor, now and every
+// retentionInterval until the supervisor stops
+func runJanitor(pipelines []*pipeline) {
+	for {
+		for _, p := range pipelines {
+			if shutdownCtx.Err() != nil {
+				return
+			}
+			if p.janitor {
+				p.deleteExpired()
+			}
+		}
+		if !sleepOrShutdown(retentionInterval) {
+			return
+		}
+	}
+}
+
+// deleteExpired deletes the expired segments of a pipeline. The pipelines
+// take turns with the settings and the key of the catalog, which only the
+// janitor uses in the supervisor; the lock file of the catalog keeps it
+// from writing at once with the recorder.
+func (p *pipeline) deleteExpired() {
+	d, err := time.ParseDuration(p.config.flag("retention"))
+	if err != nil || d <= 0 {
+		// The recorder rejects the flag
+		return
+	}
+	outputDir, retention, anonymize = "output", d, false
+	if dir := p.config.flag("output"); dir != "" {
+		outputDir = dir
+	}
+	catalogKey, catalogHeader, legacyCatalogKey = nil, nil, nil
+	catalogPassphrase = func() string { return p.config.env(catalogKeyEnv) }
+	if err := openCatalog(); err != nil {
+		consoleWarn("[%s] Could not open the catalog for the retention period: %v", p.config.Name, err)
+		return
+	}
+	if deleted := deleteExpiredSegments(); deleted > 0 {
+		consoleEvent("[%s] Deleted %d segments after the retention period of %s", p.config.Name, deleted, d)
+		p.mu.Lock()
+		p.expired += deleted
+		p.mu.Unlock()
+	}
+}
+
+// deleteExpiredSegments deletes the segments that ended longer than
+// -retention ago with their logs, subtitles, transcripts, marker clips,
+// review renditions and catalog entries, and returns how many. Segments
+// under legal hold stay until released.
+func deleteExpiredSegments() int {
+	entries, err := readAnnotatedCatalog()
+	if err != nil {
+		consoleWarn("Could not read the catalog for the retention period: %v", err)
+		return 0
+	}
+	cutoff := time.Now().Add(-retention)
+	deleted := map[string]bool{}
+	for _, e := range entries {
+		// The catalog still learns what was deleted so far
+		if shutdownCtx.Err() != nil {
+			break
+		}
+		if e.File == "" || e.End.After(cutoff) || e.Hold != nil {
+			continue
+		}
+		file := filepath.Join(outputDir, filepath.FromSlash(e.File))
+		base := strings.TrimSuffix(file, filepath.Ext(file))
+		files := []string{file, base + ".focus.srt"}
+		if e.Log != "" {
+			files = append(files, filepath.Join(outputDir, filepath.FromSlash(e.Log)))
+		}
+		if e.Transcript != "" {
+			files = append(files, filepath.Join(outputDir, filepath.FromSlash(e.Transcript)))
+		}
+		clips, _ := filepath.Glob(filepath.Join(outputDir, clipsDirName, filepath.Base(base)+"_*"))
+		files = append(files, clips...)
+		files = append(files, reviewFiles(file)...)
+
+		failed := false
+		for _, f := range files {
+			if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+				consoleWarn("Could not delete %s after the retention period: %v", f, err)
+				failed = true
+			}
+		}
+		if !failed {
+			deleted[e.File] = true
+			logAccess("delete", "retention period of "+retention.String()+" ended", e.File)
+			consoleEvent("Deleted %s after the retention period", e.File)
+		}
+	}
+	if len(deleted) == 0 {
+		return 0
+	}
+	err = updateCatalog(func(entries []catalogEntry) []catalogEntry {
+		var kept []catalogEntry
+		for _, e := range entries {
+			if !deleted[e.File] {
+				kept = append(kept, e)
+			}
+		}
+		return kept
+	})
+	if err != nil {
+		consoleError("Could not update catalog: %v", err)
+	}
+	return len(deleted)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// Directory of the -remote-review renditions, beside the segments
+	reviewDirName = "review"
+	// Picture height and frame rate of the rendition, small enough to
+	// watch over a 3G link
+	reviewHeight = 240
+	reviewFPS    = 5
+	// Bitrate of the rendition and the length of its HLS chunks, long
+	// chunks keep the requests over slow links few
+	reviewBitrate    = "150k"
+	reviewChunkSecs  = 10
+	reviewMaxBitrate = "200k"
+)
+
+// remoteReview is set when every segment also gets a 240p/5fps HLS
+// rendition for review over slow links
+var remoteReview bool
+
+// reviewPlaylist returns the HLS playlist of the review rendition of a
+// segment, output/review/<segment>.m3u8
+func reviewPlaylist(videoFile string) string {
+	base := strings.TrimSuffix(filepath.Base(videoFile), filepath.Ext(videoFile))
+	return filepath.Join(filepath.Dir(videoFile), reviewDirName, base+".m3u8")
+}
+
+// reviewFiles returns the files of the review rendition of a segment, the
+// playlist and its chunks
+func reviewFiles(videoFile string) []string {
+	playlist := reviewPlaylist(videoFile)
+	chunks, _ := filepath.Glob(strings.TrimSuffix(playlist, ".m3u8") + "_[0-9][0-9][0-9][0-9][0-9].ts")
+	return append([]string{playlist}, chunks...)
+}
+
+// reviewArgs returns the ffmpeg output of the review rendition and splits
+// the video of the filter graph for it, call it before the audio tracks
+// are added. The rendition shows what the segment shows, blurs and
+// watermark included; without a filter graph the capture is scaled.
+func reviewArgs(a *ffmpegArgs, videoFile string) []string {
+	scale := fmt.Sprintf("fps=%d,scale=-2:%d", reviewFPS, reviewHeight)
+	args := []string{"-map", "0:v", "-vf", scale}
+	// The graph maps its video output right after it
+	if len(a.filter) >= 4 && a.filter[0] == "-filter_complex" && a.filter[2] == "-map" {
+		a.filter[1] += fmt.Sprintf(";%ssplit[sv_record][sv_review_in];[sv_review_in]%s[sv_review]", a.filter[3], scale)
+		a.filter[3] = "[sv_record]"
+		args = []string{"-map", "[sv_review]"}
+	}
+	playlist := reviewPlaylist(videoFile)
+	return append(args,
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-profile:v", "baseline",
+		"-pix_fmt", "yuv420p",
+		"-b:v", reviewBitrate,
+		"-maxrate", reviewMaxBitrate,
+		"-bufsize", reviewMaxBitrate,
+		"-g", fmt.Sprint(reviewFPS*reviewChunkSecs),
+		"-an",
+		"-f", "hls",
+		"-hls_time", fmt.Sprint(reviewChunkSecs),
+		"-hls_playlist_type", "event",
+		"-hls_segment_filename", strings.TrimSuffix(playlist, ".m3u8")+"_%05d.ts",
+		playlist,
+	)
+}
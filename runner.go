@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// ffmpegRunner creates the ffmpeg processes that record the segments and
+// windows. The recorder runs the ffmpeg in PATH; the tests run a scripted
+// fake that writes a growing file and progress lines and stops on 'q' like
+// ffmpeg, so rotation, stops and restarts are exercised without a screen.
+type ffmpegRunner interface {
+	command(args ...string) *exec.Cmd
+}
+
+// pathFFmpeg runs the ffmpeg binary found in PATH
+type pathFFmpeg struct{}
+
+func (pathFFmpeg) command(args ...string) *exec.Cmd {
+	return exec.Command("ffmpeg", args...)
+}
+
+// recorderFFmpeg is the runner of the recording processes
+var recorderFFmpeg ffmpegRunner = pathFFmpeg{}
+
+// recorderOS is the platform whose capture and encoders the segments are
+// recorded with, the tests run the pipeline of each on any of them
+var recorderOS = runtime.GOOS
+
+// segmentBaseName names the files of a segment that starts at t, before
+// the session tag and extension. Segments are named after the second they
+// start in; the tests, which start several a second, add the milliseconds.
+var segmentBaseName = func(t time.Time) string {
+	return t.Format(segmentNameLayout)
+}
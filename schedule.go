@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Interval between two checks whether another -schedule window started
+const scheduleCheckInterval = time.Minute
+
+// Time windows like 22:00-06:00
+var scheduleTimeRe = regexp.MustCompile(`^([01]\d|2[0-3]):([0-5]\d)-([01]\d|2[0-3]):([0-5]\d)$`)
+
+// scheduleWindow is a time of day with other settings for new segments.
+// start and end are minutes after midnight, a window with end before start
+// runs over midnight.
+type scheduleWindow struct {
+	spec       string
+	start, end int
+	fps        int
+	bitrate    int
+}
+
+// qualitySchedule are the -schedule windows in flag order, the first one
+// containing the time applies
+var qualitySchedule []*scheduleWindow
+
+// scheduleState holds the window new segments are recorded with, nil
+// outside of all windows
+var scheduleState struct {
+	sync.Mutex
+	active *scheduleWindow
+}
+
+// parseScheduleWindow parses a -schedule value like
+// "22:00-06:00 fps=1 bitrate=200"
+func parseScheduleWindow(spec string) (*scheduleWindow, error) {
+	fields := strings.Fields(spec)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("invalid schedule %q, use HH:MM-HH:MM fps=N bitrate=N", spec)
+	}
+	m := scheduleTimeRe.FindStringSubmatch(fields[0])
+	if m == nil {
+		return nil, fmt.Errorf("invalid time window %q, use HH:MM-HH:MM like 22:00-06:00", fields[0])
+	}
+	minutes := func(h, min string) int {
+		hours, _ := strconv.Atoi(h)
+		minutes, _ := strconv.Atoi(min)
+		return hours*60 + minutes
+	}
+	w := &scheduleWindow{spec: fields[0], start: minutes(m[1], m[2]), end: minutes(m[3], m[4])}
+	if w.start == w.end {
+		return nil, fmt.Errorf("time window %q is empty", fields[0])
+	}
+
+	for _, setting := range fields[1:] {
+		key, value, _ := strings.Cut(setting, "=")
+		n, err := strconv.Atoi(strings.TrimSuffix(value, "k"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid setting %q, use fps=N or bitrate=N", setting)
+		}
+		switch key {
+		case "fps":
+			if err := checkFPS(n); err != nil {
+				return nil, err
+			}
+			w.fps = n
+		case "bitrate":
+			if err := checkBitrate(n); err != nil {
+				return nil, err
+			}
+			w.bitrate = n
+		default:
+			return nil, fmt.Errorf("unknown setting %q, use fps=N or bitrate=N", key)
+		}
+	}
+	return w, nil
+}
+
+// contains reports whether the local time t falls into the window
+func (w *scheduleWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return w.start <= minute && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+// scheduleWindowAt returns the first -schedule window containing t, nil if
+// none does
+func scheduleWindowAt(t time.Time) *scheduleWindow {
+	for _, w := range qualitySchedule {
+		if w.contains(t) {
+			return w
+		}
+	}
+	return nil
+}
+
+// startSchedule applies the current -schedule window to the first segment
+// and starts a new segment whenever another window starts or ends, at the
+// start of every minute so a window starts on time
+func startSchedule() {
+	scheduleState.Lock()
+	scheduleState.active = scheduleWindowAt(time.Now())
+	scheduleState.Unlock()
+
+	go func() {
+		for {
+			time.Sleep(time.Until(time.Now().Truncate(scheduleCheckInterval).Add(scheduleCheckInterval)))
+			w := scheduleWindowAt(time.Now())
+			scheduleState.Lock()
+			changed := w != scheduleState.active
+			scheduleState.active = w
+			scheduleState.Unlock()
+			if !changed {
+				continue
+			}
+			if w == nil {
+				consoleEvent("Schedule window ended, recording with the flags")
+				requestRotation("schedule window ended")
+			} else {
+				consoleEvent("Schedule window %s started", w.spec)
+				requestRotation(fmt.Sprintf("schedule window %s started", w.spec))
+			}
+		}
+	}()
+}
+
+// activeSchedule returns the time window new segments are recorded with,
+// "" outside of all -schedule windows
+func activeSchedule() string {
+	scheduleState.Lock()
+	defer scheduleState.Unlock()
+	if scheduleState.active == nil {
+		return ""
+	}
+	return scheduleState.active.spec
+}
+
+// scheduleFPS returns the frame rate of the current -schedule window, -fps
+// if it sets none
+func scheduleFPS() int {
+	scheduleState.Lock()
+	defer scheduleState.Unlock()
+	if w := scheduleState.active; w != nil && w.fps > 0 {
+		return w.fps
+	}
+	return fps
+}
+
+// scheduleBitrate returns the bitrate of the current -schedule window,
+// -bitrate or the adopted advice if it sets none
+func scheduleBitrate() int {
+	scheduleState.Lock()
+	defer scheduleState.Unlock()
+	if w := scheduleState.active; w != nil && w.bitrate > 0 {
+		return w.bitrate
+	}
+	return flagBitrate()
+}
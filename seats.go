@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Interval between two checks for graphical sessions that started or ended
+const seatPollInterval = 5 * time.Second
+
+// seatsConfig is the configuration of the supervisor's -seats mode, which
+// records every graphical session of a shared machine separately
+type seatsConfig struct {
+	// Directory that gets a subdirectory per user
+	Output string `yaml:"output"`
+	// Whether users that are not listed are recorded, true if unset
+	Record *bool `yaml:"record"`
+	// Recorder flags of every session, without the dash
+	Flags map[string]string   `yaml:"flags"`
+	Users map[string]seatUser `yaml:"users"`
+}
+
+// seatUser holds the consent and settings of a user
+type seatUser struct {
+	Record *bool             `yaml:"record"`
+	Flags  map[string]string `yaml:"flags"`
+}
+
+// graphicalSession is a session with a desktop to record, on a seat of a
+// Linux multi-seat machine or on a Windows terminal server
+type graphicalSession struct {
+	ID      string
+	User    string
+	Display string   // X display, Linux only
+	Env     []string // environment the recorder needs to reach the desktop
+	// Why the session cannot be recorded, like a Wayland desktop
+	Unsupported string
+}
+
+// seatRecorder is the recorder of a session
+type seatRecorder struct {
+	pipeline *pipeline
+	stopping chan struct{}
+}
+
+// loadSeatsConfig reads and checks a -seats configuration file
+func loadSeatsConfig(path string) (*seatsConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// Unknown keys are mistakes, like a misspelled record
+	var config seatsConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if config.Output == "" {
+		return nil, fmt.Errorf("%s sets no output directory", path)
+	}
+	for _, flags := range append([]map[string]string{config.Flags}, usersFlags(config.Users)...) {
+		for _, name := range []string{"instance", "output", "display"} {
+			if _, ok := flags[name]; ok {
+				return nil, fmt.Errorf("%s: the %s flag is set per session", path, name)
+			}
+		}
+	}
+	return &config, nil
+}
+
+// usersFlags returns the flags of every user
+func usersFlags(users map[string]seatUser) []map[string]string {
+	var flags []map[string]string
+	for _, u := range users {
+		flags = append(flags, u.Flags)
+	}
+	return flags
+}
+
+// records reports whether a user's sessions are recorded
+func (c *seatsConfig) records(user string) bool {
+	if u, ok := c.Users[user]; ok && u.Record != nil {
+		return *u.Record
+	}
+	return c.Record == nil || *c.Record
+}
+
+// pipeline returns the recorder configuration of a session: the common
+// flags, then the user's, with the output in the user's directory
+func (c *seatsConfig) pipeline(s graphicalSession) pipelineConfig {
+	p := pipelineConfig{
+		Name:         "seat-" + fileTag(s.User) + "-" + fileTag(s.ID),
+		Flags:        map[string]string{},
+		Env:          map[string]string{},
+		RestartDelay: defaultRestartDelay,
+	}
+	for name, value := range c.Flags {
+		p.Flags[name] = value
+	}
+	for name, value := range c.Users[s.User].Flags {
+		p.Flags[name] = value
+	}
+	p.Flags["output"] = filepath.Join(c.Output, fileTag(s.User))
+	if s.Display != "" {
+		p.Flags["display"] = s.Display
+	}
+	for _, kv := range s.Env {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			p.Env[k] = v
+		}
+	}
+	return p
+}
+
+// runSeats records every graphical session as it starts, each with its own
+// recorder, until the supervisor gets a signal
+func runSeats(program string, config *seatsConfig, sigs chan os.Signal) int {
+	if _, err := listGraphicalSessions(); err != nil {
+		consoleError("Cannot find the graphical sessions: %v", err)
+		return 1
+	}
+	consoleInfo("Recording every graphical session into %s, one directory per user", config.Output)
+
+	recorders := map[string]*seatRecorder{}
+	skipped := map[string]bool{}
+	var wg sync.WaitGroup
+	ticker := time.NewTicker(seatPollInterval)
+	defer ticker.Stop()
+	for {
+		sessions, err := listGraphicalSessions()
+		if err != nil {
+			consoleWarn("Could not list the graphical sessions: %v", err)
+		}
+		active := map[string]bool{}
+		for _, s := range sessions {
+			active[s.ID] = true
+			if recorders[s.ID] != nil || skipped[s.ID] {
+				continue
+			}
+			if s.Unsupported != "" {
+				consoleWarn("Cannot record session %s of %s: %s", s.ID, s.User, s.Unsupported)
+				skipped[s.ID] = true
+				continue
+			}
+			if !config.records(s.User) {
+				consoleEvent("Not recording session %s of %s, who is not to be recorded", s.ID, s.User)
+				skipped[s.ID] = true
+				continue
+			}
+			r := &seatRecorder{pipeline: &pipeline{config: config.pipeline(s)}, stopping: make(chan struct{})}
+			r.pipeline.prepare = func(cmd *exec.Cmd) (func(), error) { return prepareSessionCommand(s, cmd) }
+			recorders[s.ID] = r
+			consoleEvent("Recording session %s of %s as %s", s.ID, s.User, r.pipeline.config.Name)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.pipeline.run(program, r.stopping)
+			}()
+		}
+		if err == nil {
+			for id, r := range recorders {
+				if !active[id] {
+					consoleEvent("Session %s ended, stopping %s", id, r.pipeline.config.Name)
+					close(r.stopping)
+					r.pipeline.stop()
+					delete(recorders, id)
+				}
+			}
+			for id := range skipped {
+				if !active[id] {
+					delete(skipped, id)
+				}
+			}
+		}
+
+		select {
+		case sig := <-sigs:
+			consoleInfo("Received signal %v, stopping all sessions...", sig)
+			for _, r := range recorders {
+				close(r.stopping)
+				r.pipeline.stop()
+			}
+			stopped := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-time.After(pipelineStopTimeout):
+				for _, r := range recorders {
+					r.pipeline.kill()
+				}
+				<-stopped
+			}
+			consoleInfo("All sessions stopped")
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
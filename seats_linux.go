@@ -0,0 +1,93 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// listGraphicalSessions returns the active desktop sessions systemd-logind
+// knows, on every seat and from remote desktops like xrdp
+func listGraphicalSessions() ([]graphicalSession, error) {
+	out, err := exec.Command("loginctl", "list-sessions", "--no-legend").Output()
+	if err != nil {
+		return nil, fmt.Errorf("loginctl: %v", err)
+	}
+	var sessions []graphicalSession
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		props, err := sessionProperties(fields[0])
+		if err != nil || props["State"] != "active" {
+			continue
+		}
+		s := graphicalSession{ID: fields[0], User: props["Name"]}
+		switch props["Type"] {
+		case "x11":
+			s.Display = props["Display"]
+			s.Env = []string{"DISPLAY=" + s.Display}
+			if xauth := sessionXAuthority(props); xauth != "" {
+				s.Env = append(s.Env, "XAUTHORITY="+xauth)
+			}
+		case "wayland":
+			s.Unsupported = "Wayland desktops need a recorder started in the session, for the screen sharing dialog"
+		default:
+			continue // text consoles and ssh logins
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
+
+// sessionProperties returns the logind properties of a session
+func sessionProperties(id string) (map[string]string, error) {
+	out, err := exec.Command("loginctl", "show-session", id,
+		"-p", "Name", "-p", "Type", "-p", "State", "-p", "Display", "-p", "Leader", "-p", "User").Output()
+	if err != nil {
+		return nil, err
+	}
+	props := map[string]string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			props[k] = v
+		}
+	}
+	return props, nil
+}
+
+// sessionXAuthority finds the X authority file of a session: in the
+// environment of its leader, where display managers put it, or in the
+// user's home directory
+func sessionXAuthority(props map[string]string) string {
+	if env, err := os.ReadFile(filepath.Join("/proc", props["Leader"], "environ")); err == nil {
+		for _, kv := range bytes.Split(env, []byte{0}) {
+			if v, ok := bytes.CutPrefix(kv, []byte("XAUTHORITY=")); ok {
+				return string(v)
+			}
+		}
+	}
+	candidates := []string{filepath.Join("/run/user", props["User"], "gdm/Xauthority")}
+	if u, err := user.Lookup(props["Name"]); err == nil {
+		candidates = append(candidates, filepath.Join(u.HomeDir, ".Xauthority"))
+	}
+	for _, c := range candidates {
+		if _, err := os.Stat(c); err == nil {
+			return c
+		}
+	}
+	return ""
+}
+
+// prepareSessionCommand has nothing to do on Linux, the environment of
+// the session is enough to reach its X display
+func prepareSessionCommand(s graphicalSession, cmd *exec.Cmd) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// listGraphicalSessions is only implemented on Linux and Windows, macOS
+// only lets the console session capture the screen
+func listGraphicalSessions() ([]graphicalSession, error) {
+	return nil, errors.New("recording several sessions is only supported on Linux and Windows")
+}
+
+// prepareSessionCommand is only needed on Windows
+func prepareSessionCommand(s graphicalSession, cmd *exec.Cmd) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,96 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var procWTSEnumerateSessionsW = modwtsapi32.NewProc("WTSEnumerateSessionsW")
+
+const (
+	// WTS_CONNECTSTATE_CLASS value of a session with a user at the desktop
+	wtsActive = 0
+	// Access the recorder's parent process needs
+	processCreateProcess = 0x0080
+	processDupHandle     = 0x0040
+)
+
+// wtsSessionInfo is a WTS_SESSION_INFOW
+type wtsSessionInfo struct {
+	SessionID      uint32
+	WinStationName *uint16
+	State          uint32
+}
+
+// listGraphicalSessions returns the sessions with a user at the desktop,
+// on the console or over Remote Desktop
+func listGraphicalSessions() ([]graphicalSession, error) {
+	var info *wtsSessionInfo
+	var count uint32
+	r, _, e := procWTSEnumerateSessionsW.Call(0, 0, 1, uintptr(unsafe.Pointer(&info)), uintptr(unsafe.Pointer(&count)))
+	if r == 0 {
+		return nil, fmt.Errorf("WTSEnumerateSessions failed: %v", e)
+	}
+	defer procWTSFreeMemory.Call(uintptr(unsafe.Pointer(info)))
+
+	var sessions []graphicalSession
+	for _, si := range unsafe.Slice(info, count) {
+		// Session 0 runs the services, it has no desktop
+		if si.State != wtsActive || si.SessionID == 0 {
+			continue
+		}
+		name, err := querySessionString(uintptr(si.SessionID), wtsUserName)
+		if err != nil || name == "" {
+			continue
+		}
+		sessions = append(sessions, graphicalSession{ID: strconv.FormatUint(uint64(si.SessionID), 10), User: name})
+	}
+	return sessions, nil
+}
+
+// prepareSessionCommand starts the recorder as a child of the session's
+// explorer.exe. It then runs as the user on the session's desktop, which
+// is the only desktop ffmpeg can capture; a service's children would get
+// the invisible desktop of session 0.
+func prepareSessionCommand(s graphicalSession, cmd *exec.Cmd) (func(), error) {
+	session, _ := strconv.ParseUint(s.ID, 10, 32)
+	pid, err := findSessionProcess("explorer.exe", uint32(session))
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.OpenProcess(processCreateProcess|processDupHandle|syscall.PROCESS_QUERY_INFORMATION, false, pid)
+	if err != nil {
+		return nil, fmt.Errorf("could not open explorer.exe of session %s (the supervisor needs to run as SYSTEM): %v", s.ID, err)
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{ParentProcess: h}
+	return func() { syscall.CloseHandle(h) }, nil
+}
+
+// findSessionProcess returns the ID of a process with the given name that
+// runs in a session
+func findSessionProcess(name string, session uint32) (uint32, error) {
+	snapshot, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer syscall.CloseHandle(snapshot)
+
+	var entry syscall.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	for err = syscall.Process32First(snapshot, &entry); err == nil; err = syscall.Process32Next(snapshot, &entry) {
+		if !strings.EqualFold(syscall.UTF16ToString(entry.ExeFile[:]), name) {
+			continue
+		}
+		var id uint32
+		if r, _, _ := procProcessIdToSessionId.Call(uintptr(entry.ProcessID), uintptr(unsafe.Pointer(&id))); r != 0 && id == session {
+			return entry.ProcessID, nil
+		}
+	}
+	return 0, fmt.Errorf("no %s runs in session %d", name, session)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Part of -size a segment of the segment muxer is timed to fill at the
+	// target bitrate, the bitrate varies around the target
+	segmentMuxerFill = 0.9
+	// Shortest segment of the segment muxer, the file names have seconds
+	minSegmentMuxerTime = 10 * time.Second
+	// Name of the list the segment muxer adds the finished segments to
+	segmentListFileName = ".segments.csv"
+	// Interval at which the segment list is read
+	segmentListPollInterval = 500 * time.Millisecond
+)
+
+// segmentMuxer rotates the segments inside one ffmpeg with its segment
+// muxer, without a gap between them, instead of restarting ffmpeg at the
+// size limit
+var segmentMuxer bool
+
+// segmentMuxerTime returns how long a segment of the segment muxer records:
+// the time the target bitrate takes to fill most of -size. The muxer only
+// splits by time, at the next keyframe.
+func segmentMuxerTime(kbps int) time.Duration {
+	seconds := float64(maxFileSizeBytes) * 8 * segmentMuxerFill / float64(kbps*1000)
+	return max(time.Duration(seconds*float64(time.Second)), minSegmentMuxerTime).Round(time.Second)
+}
+
+// segmentMuxerPattern returns the file name of the segments the segment
+// muxer writes, the segment name layout in strftime form
+func segmentMuxerPattern(tag string) string {
+	pattern := "%Y-%m-%d_%H-%M-%S"
+	if tag != "" {
+		pattern += "_" + strings.ReplaceAll(fileTag(tag), "%", "%%")
+	}
+	return pattern + ".mkv"
+}
+
+// segmentMuxerArgs returns the output of ffmpeg that writes the segments
+// named by pattern, listing every finished one in the segment list next to
+// them. Each segment starts at timestamp 0 like a segment of its own.
+func segmentMuxerArgs(pattern string) []string {
+	return []string{
+		"-f", "segment",
+		"-segment_format", "matroska",
+		"-segment_time", strconv.Itoa(int(segmentMuxerTime(segmentBitrate()).Seconds())),
+		"-reset_timestamps", "1",
+		"-strftime", "1",
+		"-segment_list", filepath.Join(filepath.Dir(pattern), segmentListFileName),
+		"-segment_list_type", "csv",
+		pattern,
+	}
+}
+
+// segmentList follows the list the segment muxer adds a line to for every
+// segment it finished: the file name and its start and end time in the
+// recording
+type segmentList struct {
+	path    string
+	handle  func(name string, start, end time.Duration)
+	stopped chan struct{}
+	done    chan struct{}
+	log     *slog.Logger
+}
+
+// watchSegmentList calls handle for every segment in the list of dir until
+// finish is called. A list left by a recorder that did not stop has to be
+// removed before ffmpeg starts, it would be read again.
+func watchSegmentList(dir string, handle func(name string, start, end time.Duration), log *slog.Logger) *segmentList {
+	l := &segmentList{
+		path:    filepath.Join(dir, segmentListFileName),
+		handle:  handle,
+		stopped: make(chan struct{}),
+		done:    make(chan struct{}),
+		log:     log,
+	}
+	go l.follow()
+	return l
+}
+
+// follow reads the lines ffmpeg appends to the list, once more after it
+// exited for the last segment
+func (l *segmentList) follow() {
+	defer close(l.done)
+	var f *os.File
+	var pending []byte
+	for {
+		stopped := false
+		select {
+		case <-l.stopped:
+			stopped = true
+		default:
+		}
+		if f == nil {
+			// ffmpeg creates the list once it starts writing
+			f, _ = os.Open(l.path)
+		}
+		if f != nil {
+			data, err := io.ReadAll(f)
+			if err != nil {
+				l.log.Warn("Could not read the segment list", "error", err)
+			}
+			pending = append(pending, data...)
+			for {
+				i := bytes.IndexByte(pending, '\n')
+				if i < 0 {
+					break
+				}
+				l.line(string(pending[:i]))
+				pending = pending[i+1:]
+			}
+		}
+		if stopped {
+			break
+		}
+		select {
+		case <-l.stopped:
+		case <-time.After(segmentListPollInterval):
+		}
+	}
+	if f != nil {
+		f.Close()
+	}
+	os.Remove(l.path)
+}
+
+// line hands a segment of the list, like 2025-01-10_09-00-00.mkv,0.0,600.2
+func (l *segmentList) line(s string) {
+	record, err := csv.NewReader(strings.NewReader(s)).Read()
+	if err == nil && len(record) != 3 {
+		err = fmt.Errorf("%d fields", len(record))
+	}
+	if err != nil {
+		l.log.Warn("Invalid line in the segment list", "line", s, "error", err)
+		return
+	}
+	start, errStart := strconv.ParseFloat(record[1], 64)
+	end, errEnd := strconv.ParseFloat(record[2], 64)
+	if errStart != nil || errEnd != nil {
+		l.log.Warn("Invalid times in the segment list", "line", s)
+		return
+	}
+	l.handle(record[0], time.Duration(start*float64(time.Second)), time.Duration(end*float64(time.Second)))
+}
+
+// finish waits until the segments ffmpeg finished last are handled, after
+// it exited
+func (l *segmentList) finish() {
+	close(l.stopped)
+	<-l.done
+}
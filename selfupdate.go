@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Release build settings, set with -ldflags "-X main.version=v1.2.3 ..."
+var (
+	version = "dev"
+	// URL of the signed release manifest checked by self-update
+	updateURL = ""
+	// Ed25519 public key that signs the release manifest, base64 encoded
+	updatePublicKey = ""
+)
+
+// Timeout of a self-update download
+const updateTimeout = 10 * time.Minute
+
+// releaseManifest describes the newest release, its signature is served
+// next to it with a .sig suffix
+type releaseManifest struct {
+	Version string                  `json:"version"`
+	Files   map[string]releaseAsset `json:"files"` // by <goos>-<goarch>
+}
+
+// releaseAsset is the binary of a release for one platform
+type releaseAsset struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
+// parseUpdateKey reads an Ed25519 public key given as base64 of the 32 key
+// bytes or as PEM file, like written by openssl pkey -pubout
+func parseUpdateKey(key string) (ed25519.PublicKey, error) {
+	if raw, err := base64.StdEncoding.DecodeString(key); err == nil && len(raw) == ed25519.PublicKeySize {
+		return ed25519.PublicKey(raw), nil
+	}
+	data, err := os.ReadFile(key)
+	if err != nil {
+		return nil, fmt.Errorf("the key is neither a base64 Ed25519 key nor a readable file: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", key)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", key, err)
+	}
+	edKey, ok := pub.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 public key", key)
+	}
+	return edKey, nil
+}
+
+// fetchURL downloads a small file
+func fetchURL(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+}
+
+// fetchRelease downloads the release manifest and checks its signature
+func fetchRelease(client *http.Client, url string, key ed25519.PublicKey) (*releaseManifest, error) {
+	data, err := fetchURL(client, url)
+	if err != nil {
+		return nil, err
+	}
+	sigData, err := fetchURL(client, url+".sig")
+	if err != nil {
+		return nil, fmt.Errorf("could not download the signature: %v", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sigData)))
+	if err != nil || !ed25519.Verify(key, data, sig) {
+		return nil, errors.New("the release manifest is not signed with the update key")
+	}
+	var release releaseManifest
+	if err := json.Unmarshal(data, &release); err != nil {
+		return nil, fmt.Errorf("invalid release manifest: %v", err)
+	}
+	return &release, nil
+}
+
+// compareVersions compares versions like v1.2.3, a development build is
+// older than any release
+func compareVersions(a, b string) int {
+	parse := func(v string) []int {
+		if v == "dev" {
+			return nil
+		}
+		var parts []int
+		for _, p := range strings.Split(strings.TrimPrefix(v, "v"), ".") {
+			n, _ := strconv.Atoi(strings.SplitN(p, "-", 2)[0])
+			parts = append(parts, n)
+		}
+		return parts
+	}
+	pa, pb := parse(a), parse(b)
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(pa) - len(pb)
+}
+
+// downloadBinary downloads a release binary next to the running one and
+// checks its checksum, it returns the temporary file
+func downloadBinary(client *http.Client, asset releaseAsset, program string) (string, error) {
+	want, err := hex.DecodeString(asset.SHA256)
+	if err != nil || len(want) != sha256.Size {
+		return "", fmt.Errorf("invalid checksum %q in the release manifest", asset.SHA256)
+	}
+	resp, err := client.Get(asset.URL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", asset.URL, resp.Status)
+	}
+
+	// Same directory, so the binary can be renamed into place
+	tmp, err := os.CreateTemp(filepath.Dir(program), ".screen-vibe-update-*")
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && !bytes.Equal(hash.Sum(nil), want) {
+		err = fmt.Errorf("checksum mismatch for %s", asset.URL)
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0755)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// replaceBinary moves the new binary over the running one. Windows cannot
+// replace a running executable but can rename it, the old one is left as
+// .old and removed by the next update.
+func replaceBinary(newFile, program string) error {
+	if runtime.GOOS == "windows" {
+		old := program + ".old"
+		os.Remove(old)
+		if err := os.Rename(program, old); err != nil {
+			return err
+		}
+		if err := os.Rename(newFile, program); err != nil {
+			os.Rename(old, program)
+			return err
+		}
+		return nil
+	}
+	return os.Rename(newFile, program)
+}
+
+// runSelfUpdateCommand installs the newest release over the running
+// binary after checking the signature of the release manifest and the
+// checksum of the binary
+func runSelfUpdateCommand(args []string) int {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	urlFlag := fs.String("url", updateURL, "URL of the signed release manifest")
+	keyFlag := fs.String("key", updatePublicKey, "Ed25519 public key of the releases, base64 or PEM file")
+	checkFlag := fs.Bool("check", false, "Only report whether an update is available")
+	forceFlag := fs.Bool("force", false, "Install the release even if it is not newer")
+	restartFlag := fs.String("restart", "", "Upgrade this running instance to the new binary (ctl upgrade)")
+	fs.Parse(args)
+
+	if *urlFlag == "" || *keyFlag == "" {
+		consoleError("This build has no release endpoint, set -url and -key")
+		return 2
+	}
+	key, err := parseUpdateKey(*keyFlag)
+	if err != nil {
+		consoleError("%v", err)
+		return 2
+	}
+	client := &http.Client{Timeout: updateTimeout}
+
+	release, err := fetchRelease(client, *urlFlag, key)
+	if err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	newer := compareVersions(release.Version, version) > 0
+	if *checkFlag {
+		if newer {
+			fmt.Printf("Update available: %s (running %s)\n", release.Version, version)
+		} else {
+			fmt.Printf("Up to date: %s\n", version)
+		}
+		return 0
+	}
+	if !newer && !*forceFlag {
+		consoleInfo("Already up to date (%s, newest release %s)", version, release.Version)
+		return 0
+	}
+	platform := runtime.GOOS + "-" + runtime.GOARCH
+	asset, ok := release.Files[platform]
+	if !ok {
+		consoleError("Release %s has no binary for %s", release.Version, platform)
+		return 1
+	}
+
+	program, err := os.Executable()
+	if err == nil {
+		program, err = filepath.EvalSymlinks(program)
+	}
+	if err != nil {
+		consoleError("Could not find the screen-vibe executable: %v", err)
+		return 1
+	}
+	consoleInfo("Downloading %s for %s", release.Version, platform)
+	newFile, err := downloadBinary(client, asset, program)
+	if err != nil {
+		consoleError("Download failed: %v", err)
+		return 1
+	}
+	if err := replaceBinary(newFile, program); err != nil {
+		os.Remove(newFile)
+		consoleError("Could not replace %s: %v", program, err)
+		return 1
+	}
+	consoleInfo("Updated %s from %s to %s", program, version, release.Version)
+
+	if *restartFlag != "" {
+		var out strings.Builder
+		if err := sendControlCommand(*restartFlag, "upgrade", &out); err != nil {
+			consoleError("%v", err)
+			return 1
+		}
+		if msg, failed := strings.CutPrefix(out.String(), "error: "); failed {
+			consoleError("%s", strings.TrimSpace(msg))
+			return 1
+		}
+		consoleInfo("Instance %s is upgrading", *restartFlag)
+	}
+	return 0
+}
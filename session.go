@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os/user"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Interval between two checks of the session state
+const sessionPollInterval = 2 * time.Second
+
+// Global variable for session segmentation setting
+var sessionSegments bool
+
+// sessionTag holds the tag added to new segments, e.g. the active username
+var sessionTag struct {
+	sync.Mutex
+	value string
+}
+
+var unsafeTagChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// currentSessionTag returns the tag for the next recording segment
+func currentSessionTag() string {
+	sessionTag.Lock()
+	defer sessionTag.Unlock()
+	return sessionTag.value
+}
+
+// loginUser returns the name of the user running the recorder
+func loginUser() string {
+	u, err := user.Current()
+	if err != nil || u.Username == "" {
+		return "unknown"
+	}
+	return u.Username
+}
+
+// sessionTagFor builds a segment tag from the session state
+func sessionTagFor(user string, locked bool) string {
+	if locked || user == "" {
+		return "locked"
+	}
+	return user
+}
+
+// fileTag makes a segment tag safe to use in a file name
+func fileTag(tag string) string {
+	return unsafeTagChars.ReplaceAllString(tag, "-")
+}
+
+// watchSessionChanges polls the session state and starts a new segment
+// whenever the session is locked, unlocked or switched to another user.
+// Polling avoids running a hidden window just to receive WM_WTSSESSION_CHANGE.
+func watchSessionChanges() error {
+	user, locked, err := querySessionState()
+	if err != nil {
+		return err
+	}
+	sessionTag.Lock()
+	sessionTag.value = sessionTagFor(user, locked)
+	sessionTag.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(sessionPollInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			user, locked, err := querySessionState()
+			if err != nil {
+				continue
+			}
+			tag := sessionTagFor(user, locked)
+
+			sessionTag.Lock()
+			previous := sessionTag.value
+			sessionTag.value = tag
+			sessionTag.Unlock()
+
+			if tag == previous {
+				continue
+			}
+
+			var reason string
+			switch {
+			case tag == "locked":
+				reason = "session locked"
+			case previous == "locked":
+				reason = fmt.Sprintf("session unlocked by %s", user)
+			default:
+				reason = fmt.Sprintf("user switched from %s to %s", previous, user)
+			}
+			requestRotation(reason)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// querySessionState is only implemented on Windows
+func querySessionState() (user string, locked bool, err error) {
+	return "", false, errors.New("session tracking is only supported on Windows")
+}
+
+// osSessionID identifies the login session this process runs in, using the
+// systemd-logind session on Linux and the security session on macOS
+func osSessionID() string {
+	if id := os.Getenv("XDG_SESSION_ID"); id != "" {
+		return "session-" + id
+	}
+	if id := os.Getenv("SECURITYSESSIONID"); id != "" {
+		return "session-" + id
+	}
+	return "unknown"
+}
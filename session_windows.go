@@ -0,0 +1,109 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	modwtsapi32                      = syscall.NewLazyDLL("wtsapi32.dll")
+	procWTSQuerySessionInformationW  = modwtsapi32.NewProc("WTSQuerySessionInformationW")
+	procWTSFreeMemory                = modwtsapi32.NewProc("WTSFreeMemory")
+	modkernel32                      = syscall.NewLazyDLL("kernel32.dll")
+	procWTSGetActiveConsoleSessionId = modkernel32.NewProc("WTSGetActiveConsoleSessionId")
+	procProcessIdToSessionId         = modkernel32.NewProc("ProcessIdToSessionId")
+)
+
+const (
+	// WTS_INFO_CLASS values
+	wtsUserName      = 5
+	wtsDomainName    = 7
+	wtsSessionInfoEx = 25
+	// WTSINFOEX_LEVEL1.SessionFlags value for a locked session
+	wtsSessionStateLock = 0
+	// Returned by WTSGetActiveConsoleSessionId when no session is attached
+	noConsoleSession = 0xFFFFFFFF
+)
+
+// querySessionState returns the user of the active console session and
+// whether that session is locked
+func querySessionState() (user string, locked bool, err error) {
+	session, _, _ := procWTSGetActiveConsoleSessionId.Call()
+	if session == noConsoleSession {
+		// Nobody is attached to the console (e.g. during a user switch)
+		return "", true, nil
+	}
+
+	name, err := querySessionString(session, wtsUserName)
+	if err != nil {
+		return "", false, err
+	}
+	if domain, err := querySessionString(session, wtsDomainName); err == nil && domain != "" && name != "" {
+		name = domain + `\` + name
+	}
+
+	// WTSINFOEXW starts with a DWORD level followed by the 8 byte aligned
+	// WTSINFOEX_LEVEL1_W: SessionId (ULONG), SessionState (int) and SessionFlags (LONG)
+	var buf *byte
+	var size uint32
+	r, _, e := procWTSQuerySessionInformationW.Call(0, session, wtsSessionInfoEx,
+		uintptr(unsafe.Pointer(&buf)), uintptr(unsafe.Pointer(&size)))
+	if r == 0 {
+		return name, false, fmt.Errorf("WTSQuerySessionInformation failed: %v", e)
+	}
+	defer procWTSFreeMemory.Call(uintptr(unsafe.Pointer(buf)))
+	if size < 20 {
+		return name, false, fmt.Errorf("unexpected session info size %d", size)
+	}
+	flags := *(*int32)(unsafe.Pointer(uintptr(unsafe.Pointer(buf)) + 16))
+
+	return name, flags == wtsSessionStateLock, nil
+}
+
+// querySessionString queries a string property of a terminal services session
+func querySessionString(session uintptr, infoClass uintptr) (string, error) {
+	var buf *uint16
+	var size uint32
+	r, _, e := procWTSQuerySessionInformationW.Call(0, session, infoClass,
+		uintptr(unsafe.Pointer(&buf)), uintptr(unsafe.Pointer(&size)))
+	if r == 0 {
+		return "", fmt.Errorf("WTSQuerySessionInformation failed: %v", e)
+	}
+	defer procWTSFreeMemory.Call(uintptr(unsafe.Pointer(buf)))
+	return syscall.UTF16ToString(unsafe.Slice(buf, size/2)), nil
+}
+
+// osSessionID identifies the Windows logon session this process runs in.
+// Session numbers are reused, so the logon time is added to keep them unique.
+func osSessionID() string {
+	var session uint32
+	r, _, _ := procProcessIdToSessionId.Call(uintptr(syscall.Getpid()), uintptr(unsafe.Pointer(&session)))
+	if r == 0 {
+		return "unknown"
+	}
+	id := fmt.Sprintf("session-%d", session)
+
+	var buf *byte
+	var size uint32
+	r, _, _ = procWTSQuerySessionInformationW.Call(0, uintptr(session), wtsSessionInfoEx,
+		uintptr(unsafe.Pointer(&buf)), uintptr(unsafe.Pointer(&size)))
+	if r == 0 {
+		return id
+	}
+	defer procWTSFreeMemory.Call(uintptr(unsafe.Pointer(buf)))
+
+	// LogonTime follows SessionFlags and the WinStationName, UserName and
+	// DomainName arrays (33, 21 and 18 WCHARs) at offset 160 of WTSINFOEX_LEVEL1_W
+	if size < 176 {
+		return id
+	}
+	logon := *(*syscall.Filetime)(unsafe.Pointer(uintptr(unsafe.Pointer(buf)) + 168))
+	if logon.Nanoseconds() <= 0 {
+		return id
+	}
+	return id + "-" + time.Unix(0, logon.Nanoseconds()).Format("150405")
+}
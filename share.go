@@ -0,0 +1,28 @@
+package main
+
+// Largest segment of the share profile in megabytes, what chat tools and
+// issue trackers take as an attachment
+const shareMaxSizeMB = 10
+
+// shareProfile records small H.264 MP4 segments that start playing before
+// they are downloaded completely, for pasting short clips into chats and
+// tickets
+var shareProfile bool
+
+// segmentExtension returns the file extension of the segments
+func segmentExtension() string {
+	if shareProfile {
+		return ".mp4"
+	}
+	return ".mkv"
+}
+
+// segmentFileArgs returns the muxer of a segment file. MP4 files of the
+// share profile get their index at the start, which ffmpeg moves there
+// when the segment ends.
+func segmentFileArgs(videoFile string) []string {
+	if shareProfile {
+		return []string{"-movflags", "+faststart", "-f", "mp4", videoFile}
+	}
+	return []string{"-f", "matroska", videoFile}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// Time finished segments get on exit to be analyzed, cataloged and
+	// uploaded, and the background loops to finish their step
+	shutdownTimeout = 2 * time.Minute
+	// Time uploads get to return once they are cancelled
+	shutdownCancelGrace = 5 * time.Second
+)
+
+// shutdownCtx is cancelled when the recorder exits. Background loops stop
+// at their next step and tiering stops moving files.
+var shutdownCtx, cancelShutdown = context.WithCancel(context.Background())
+
+// uploadsCtx is cancelled when uploads of finished segments ran out of
+// shutdownTimeout, until then they continue on exit
+var uploadsCtx, cancelUploads = context.WithCancel(context.Background())
+
+// backgroundJobs are the loops that write files, like the retention and
+// tiering passes, the focus log and the status file
+var backgroundJobs sync.WaitGroup
+
+// goBackground runs a background loop that the shutdown waits for
+func goBackground(loop func()) {
+	backgroundJobs.Add(1)
+	go func() {
+		defer backgroundJobs.Done()
+		loop()
+	}()
+}
+
+// sleepOrShutdown waits for d and reports false if the recorder is
+// shutting down instead
+func sleepOrShutdown(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-shutdownCtx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// shutdown stops the background loops and waits for them and the work on
+// finished segments. Uploads that are still running after shutdownTimeout
+// are cancelled, anything else left then is abandoned.
+func shutdown() {
+	cancelShutdown()
+	finished := make(chan struct{})
+	go func() {
+		backgroundJobs.Wait()
+		segmentJobs.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return
+	case <-time.After(shutdownTimeout):
+	}
+	consoleWarn("Work on finished segments did not end within %s, cancelling the uploads", shutdownTimeout)
+	cancelUploads()
+	select {
+	case <-finished:
+	case <-time.After(shutdownCancelGrace):
+		consoleWarn("Exiting with work on finished segments left unfinished")
+	}
+}
+
+// flushCatalog syncs the catalog to disk and keeps the catalog and logs
+// locked until the recorder exits, so a late writer waits instead of being
+// cut off in the middle of a line
+func flushCatalog() {
+	catalogMu.Lock()
+	annotationsMu.Lock()
+	accessLogMu.Lock()
+	focusLogMu.Lock()
+	if f, err := os.OpenFile(catalogPath(), os.O_WRONLY, 0); err == nil {
+		if err := f.Sync(); err != nil {
+			consoleWarn("Could not write the catalog to disk: %v", err)
+		}
+		f.Close()
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// Directory of the -signage stills, beside the segments
+	signageDirName = "signage"
+	// Stills are named after the time ffmpeg took them
+	signageStillLayout = "2006-01-02_15-04-05"
+	// Templates are scaled down to about this size before they are searched
+	// for, which keeps a minute's search of a 4K still short
+	signageTemplateSize = 32
+	// Time the -signage OCR command gets for a still
+	signageOCRTimeout = 30 * time.Second
+)
+
+// signageConfig is the -signage file
+type signageConfig struct {
+	Interval   time.Duration    `yaml:"interval"`
+	Keep       time.Duration    `yaml:"keep"`
+	Diff       int              `yaml:"diff"`
+	References []string         `yaml:"references"`
+	Markers    []*signageMarker `yaml:"markers"`
+	OCR        string           `yaml:"ocr"`
+}
+
+// signageMarker is content the screen has to show: a template image found
+// anywhere in the region, or a text the OCR command reads in it
+type signageMarker struct {
+	Name     string  `yaml:"name"`
+	Template string  `yaml:"template"`
+	Text     string  `yaml:"text"`
+	Region   string  `yaml:"region"`
+	Match    float64 `yaml:"match"`
+
+	area     image.Rectangle // empty for the whole screen
+	factor   int             // the template and still are scaled down by this
+	tw, th   int
+	template []float64 // scaled template, zero mean and unit length
+}
+
+// signage is the -signage configuration, nil without
+var signage *signageConfig
+
+// loadSignage reads and checks a -signage file
+func loadSignage(path string) (*signageConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &signageConfig{Interval: time.Minute, Keep: 7 * 24 * time.Hour, Diff: 5, OCR: "tesseract {image} stdout"}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	switch {
+	case config.Interval < 10*time.Second:
+		return nil, fmt.Errorf("%s: the interval must be at least 10s", path)
+	case config.Keep < config.Interval:
+		return nil, fmt.Errorf("%s: keep must be longer than the interval", path)
+	case config.Diff < 1 || config.Diff > 100:
+		return nil, fmt.Errorf("%s: diff must be between 1 and 100 percent", path)
+	case len(config.References) == 0 && len(config.Markers) == 0:
+		return nil, fmt.Errorf("%s defines no references or markers to verify", path)
+	}
+
+	// Paths in the file are relative to it
+	dir := filepath.Dir(path)
+	relative := func(p string) string {
+		if filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+	for _, ref := range config.References {
+		r, err := loadUIReference(relative(ref))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		uiReferences = append(uiReferences, r)
+	}
+	names := map[string]bool{}
+	for i, m := range config.Markers {
+		switch {
+		case m == nil || m.Name == "":
+			return nil, fmt.Errorf("%s: marker %d has no name", path, i+1)
+		case names[m.Name]:
+			return nil, fmt.Errorf("%s: marker %q is defined twice", path, m.Name)
+		case (m.Template == "") == (m.Text == ""):
+			return nil, fmt.Errorf("%s: marker %q needs either a template or a text", path, m.Name)
+		}
+		names[m.Name] = true
+		if m.Template != "" {
+			m.Template = relative(m.Template)
+		}
+		if err := m.compile(); err != nil {
+			return nil, fmt.Errorf("%s: marker %q: %v", path, m.Name, err)
+		}
+		if m.Text != "" {
+			fields := strings.Fields(config.OCR)
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("%s: marker %q needs an ocr command", path, m.Name)
+			}
+			if _, err := exec.LookPath(fields[0]); err != nil {
+				return nil, fmt.Errorf("%s: marker %q needs %s to read texts: %v", path, m.Name, fields[0], err)
+			}
+		}
+	}
+	return config, nil
+}
+
+// compile checks the settings of a marker and scales its template down
+func (m *signageMarker) compile() error {
+	if m.Match == 0 {
+		m.Match = 0.8
+	}
+	if m.Match < 0 || m.Match > 1 {
+		return fmt.Errorf("match must be between 0 and 1")
+	}
+	if m.Region != "" {
+		match := regionRe.FindStringSubmatch(m.Region)
+		if match == nil {
+			return fmt.Errorf("invalid region %q, use <width>x<height>+<x>+<y> like 1280x720+0+0", m.Region)
+		}
+		var w, h, x, y int
+		fmt.Sscan(strings.Join(match[1:], " "), &w, &h, &x, &y)
+		m.area = image.Rect(x, y, x+w, y+h)
+	}
+	if m.Template == "" {
+		return nil
+	}
+
+	f, err := os.Open(m.Template)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %v", m.Template, err)
+	}
+	b := img.Bounds()
+	if !m.area.Empty() && (b.Dx() > m.area.Dx() || b.Dy() > m.area.Dy()) {
+		return fmt.Errorf("the template is larger than the region")
+	}
+	m.factor = max(1, max(b.Dx(), b.Dy())/signageTemplateSize)
+	var pixels []float64
+	m.tw, m.th, pixels = grayGrid(img, b, m.factor)
+	if m.tw == 0 || m.th == 0 {
+		return fmt.Errorf("the template is too small")
+	}
+	mean := 0.0
+	for _, v := range pixels {
+		mean += v
+	}
+	mean /= float64(len(pixels))
+	norm := 0.0
+	for i := range pixels {
+		pixels[i] -= mean
+		norm += pixels[i] * pixels[i]
+	}
+	if norm == 0 {
+		return fmt.Errorf("the template is a plain color, it would match any empty area")
+	}
+	norm = math.Sqrt(norm)
+	for i := range pixels {
+		pixels[i] /= norm
+	}
+	m.template = pixels
+	return nil
+}
+
+// grayGrid scales the area r of img down by factor, averaging the
+// brightness of every factor x factor block
+func grayGrid(img image.Image, r image.Rectangle, factor int) (int, int, []float64) {
+	w, h := r.Dx()/factor, r.Dy()/factor
+	pixels := make([]float64, w*h)
+	for y := range h * factor {
+		for x := range w * factor {
+			pixels[y/factor*w+x/factor] += float64(luma(img, r.Min.X+x, r.Min.Y+y))
+		}
+	}
+	for i := range pixels {
+		pixels[i] /= float64(factor * factor)
+	}
+	return w, h, pixels
+}
+
+// findTemplate reports whether the template of the marker is in its region
+// of the still, by the normalized cross-correlation of the scaled pictures
+func (m *signageMarker) findTemplate(img image.Image) (bool, float64) {
+	area := img.Bounds()
+	if !m.area.Empty() {
+		area = m.area.Add(area.Min).Intersect(area)
+	}
+	w, h, pixels := grayGrid(img, area, m.factor)
+	n := float64(m.tw * m.th)
+	best := 0.0
+	for y := 0; y+m.th <= h; y++ {
+		for x := 0; x+m.tw <= w; x++ {
+			var sum, squares, product float64
+			for ty := range m.th {
+				row := pixels[(y+ty)*w+x : (y+ty)*w+x+m.tw]
+				tpl := m.template[ty*m.tw : (ty+1)*m.tw]
+				for i, v := range row {
+					sum += v
+					squares += v * v
+					product += v * tpl[i]
+				}
+			}
+			// The template has zero mean, so the mean of the window drops
+			// out of the product
+			variance := squares - sum*sum/n
+			if variance <= 0 {
+				continue
+			}
+			if score := product / math.Sqrt(variance); score > best {
+				best = score
+			}
+		}
+	}
+	return best >= m.Match, best
+}
+
+// readText runs the OCR command on the region of the marker in the still
+// and reports whether the text of the marker is in what it read
+func (m *signageMarker) readText(still string, img image.Image) (bool, error) {
+	input := still
+	if !m.area.Empty() {
+		sub, ok := img.(interface {
+			SubImage(image.Rectangle) image.Image
+		})
+		if !ok {
+			return false, errors.New("cannot crop the still")
+		}
+		f, err := os.CreateTemp("", "screen-vibe-ocr-*.png")
+		if err != nil {
+			return false, err
+		}
+		defer os.Remove(f.Name())
+		err = png.Encode(f, sub.SubImage(m.area.Add(img.Bounds().Min)))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return false, err
+		}
+		input = f.Name()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), signageOCRTimeout)
+	defer cancel()
+	fields := strings.Fields(signage.OCR)
+	for i, f := range fields {
+		fields[i] = strings.ReplaceAll(f, "{image}", input)
+	}
+	out, err := exec.CommandContext(ctx, fields[0], fields[1:]...).Output()
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", fields[0], err)
+	}
+	// Line breaks and spacing depend on the layout, not on the text
+	normalize := func(s string) string { return strings.ToLower(strings.Join(strings.Fields(s), " ")) }
+	return strings.Contains(normalize(string(out)), normalize(m.Text)), nil
+}
+
+// missingMarkers returns what the still does not show of the markers
+func missingMarkers(still string, img image.Image) []string {
+	var missing []string
+	for _, m := range signage.Markers {
+		if m.Template != "" {
+			if found, _ := m.findTemplate(img); !found {
+				missing = append(missing, m.Name)
+			}
+			continue
+		}
+		found, err := m.readText(still, img)
+		if err != nil {
+			consoleWarn("Could not read the text of marker %s: %v", m.Name, err)
+			continue
+		}
+		if !found {
+			missing = append(missing, m.Name)
+		}
+	}
+	return missing
+}
+
+// signageDir returns the directory of the -signage stills
+func signageDir() string {
+	return filepath.Join(outputDir, signageDirName)
+}
+
+// latestSignageStill returns the newest still ffmpeg finished and when it
+// was taken. ffmpeg writes to a temporary file and renames it.
+func latestSignageStill() (string, time.Time, error) {
+	stills, _ := filepath.Glob(filepath.Join(signageDir(), "*.jpg"))
+	sort.Strings(stills)
+	for i := len(stills) - 1; i >= 0; i-- {
+		name := strings.TrimSuffix(filepath.Base(stills[i]), ".jpg")
+		if t, err := time.ParseInLocation(signageStillLayout, name, time.Local); err == nil {
+			return stills[i], t, nil
+		}
+	}
+	return "", time.Time{}, os.ErrNotExist
+}
+
+// pruneSignageStills removes the stills that are older than keep
+func pruneSignageStills(now time.Time) {
+	stills, _ := filepath.Glob(filepath.Join(signageDir(), "*.jpg"))
+	for _, still := range stills {
+		t, err := time.ParseInLocation(signageStillLayout, strings.TrimSuffix(filepath.Base(still), ".jpg"), time.Local)
+		if err != nil || now.Sub(t) <= signage.Keep {
+			continue
+		}
+		if err := os.Remove(still); err != nil && !os.IsNotExist(err) {
+			consoleWarn("Could not remove the signage still %s: %v", still, err)
+		}
+	}
+}
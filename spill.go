@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// How often the copy looks for new data in the spill file
+	spillCopyInterval = 500 * time.Millisecond
+	// Size of the reads and writes of the copy
+	spillChunkSize = 4 * 1024 * 1024
+	// Start of the file that the muxer rewrites when it finalizes the
+	// segment (segment size, seek head, duration), copied again at the end
+	spillHeadSize = 1024 * 1024
+	// Backlog at which the destination counts as too slow
+	spillBacklogWarning = 256 * 1024 * 1024
+)
+
+// spillDir is a fast local or memory-backed directory ffmpeg records into,
+// the segments are copied to the output directory while they are recorded
+var spillDir string
+
+// spillStats tells how far the copy to the output directory fell behind
+type spillStats struct {
+	MaxBacklog   int64   `json:"max_backlog"`   // bytes recorded but not copied yet
+	DrainSeconds float64 `json:"drain_seconds"` // time the copy needed after ffmpeg finished
+}
+
+// spillCopy copies a segment from the spill directory to its destination
+// while ffmpeg records it. ffmpeg never waits for the destination, a slow
+// disk only makes the backlog in the spill file grow.
+type spillCopy struct {
+	spill, dest string
+	finished    chan struct{} // closed when ffmpeg exited
+	done        chan error
+	stats       spillStats
+	log         *slog.Logger
+}
+
+// spillFile returns the file ffmpeg records the segment videoFile into
+func spillFile(videoFile string) string {
+	return filepath.Join(spillDir, filepath.Base(videoFile))
+}
+
+// startSpillCopy starts copying the spill file of videoFile to videoFile
+func startSpillCopy(videoFile string, log *slog.Logger) *spillCopy {
+	c := &spillCopy{
+		spill:    spillFile(videoFile),
+		dest:     videoFile,
+		finished: make(chan struct{}),
+		done:     make(chan error, 1),
+		log:      log,
+	}
+	go func() { c.done <- c.run() }()
+	return c
+}
+
+// run copies new data until ffmpeg exited and everything is copied
+func (c *spillCopy) run() error {
+	ticker := time.NewTicker(spillCopyInterval)
+	defer ticker.Stop()
+
+	// ffmpeg creates the spill file once the capture is open
+	var src *os.File
+	for src == nil {
+		// Opened for writing, which releasing copied blocks needs
+		f, err := os.OpenFile(c.spill, os.O_RDWR, 0)
+		switch {
+		case err == nil:
+			src = f
+			continue
+		case !errors.Is(err, os.ErrNotExist):
+			return err
+		}
+		select {
+		case <-c.finished:
+			return nil // ffmpeg did not get to write anything
+		case <-ticker.C:
+		}
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(c.dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	var copied int64
+	var drainStart time.Time // when ffmpeg exited
+	warned := false
+	for {
+		select {
+		case <-c.finished:
+			drainStart = time.Now()
+		case <-ticker.C:
+		}
+		info, err := src.Stat()
+		if err != nil {
+			return err
+		}
+		size := info.Size()
+		if backlog := size - copied; backlog > c.stats.MaxBacklog {
+			c.stats.MaxBacklog = backlog
+			if backlog >= spillBacklogWarning && !warned {
+				warned = true
+				c.log.Warn("The output directory is too slow, the spill file grows", "backlog", formatFileSize(backlog))
+				consoleWarn("Output directory too slow, %s waiting in %s", formatFileSize(backlog), spillDir)
+			}
+		}
+		if err := copyRange(dst, src, copied, size); err != nil {
+			return err
+		}
+		from := max(copied, spillHeadSize)
+		releaseSpilled(src, from, size-from)
+		copied = size
+		if drainStart.IsZero() {
+			continue
+		}
+
+		// ffmpeg is done, all it wrote is copied but the rewritten start
+		if err := copyRange(dst, src, 0, min(spillHeadSize, size)); err != nil {
+			return err
+		}
+		if err := dst.Sync(); err != nil {
+			return err
+		}
+		c.stats.DrainSeconds = time.Since(drainStart).Seconds()
+		return nil
+	}
+}
+
+// copyRange copies the bytes from start to end of src to the same place in
+// dst
+func copyRange(dst, src *os.File, start, end int64) error {
+	buf := make([]byte, min(spillChunkSize, max(end-start, 0)))
+	for off := start; off < end; {
+		n, err := src.ReadAt(buf[:min(int64(len(buf)), end-off)], off)
+		if n > 0 {
+			if _, err := dst.WriteAt(buf[:n], off); err != nil {
+				return err
+			}
+			off += int64(n)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finish waits until the segment is copied after ffmpeg exited and removes
+// the spill file. On errors the spill file is kept, it holds the only full
+// copy of the segment.
+func (c *spillCopy) finish() (*spillStats, error) {
+	close(c.finished)
+	if err := <-c.done; err != nil {
+		return &c.stats, fmt.Errorf("could not copy %s to %s: %w", c.spill, c.dest, err)
+	}
+	os.Remove(c.spill)
+	return &c.stats, nil
+}
+
+// checkSpillDir creates the spill directory and warns about segments a
+// previous run did not finish copying
+func checkSpillDir() error {
+	if err := os.MkdirAll(spillDir, 0700); err != nil {
+		return err
+	}
+	left, _ := filepath.Glob(filepath.Join(spillDir, "*.mkv"))
+	if len(left) > 0 {
+		consoleWarn("%d segments in %s were not copied to the output directory, e.g. %s", len(left), spillDir, left[0])
+	}
+	return nil
+}
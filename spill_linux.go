@@ -0,0 +1,20 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// FALLOC_FL_KEEP_SIZE | FALLOC_FL_PUNCH_HOLE
+const fallocPunchHole = 0x01 | 0x02
+
+// releaseSpilled frees the blocks of a spill file that were copied already,
+// so a spill directory on tmpfs only holds the backlog. The file keeps its
+// size and ffmpeg can still seek in it.
+func releaseSpilled(f *os.File, off, length int64) {
+	if length > 0 {
+		syscall.Fallocate(int(f.Fd()), fallocPunchHole, off, length)
+	}
+}
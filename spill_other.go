@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+// releaseSpilled is only implemented on Linux, elsewhere the spill file
+// keeps the whole segment until it is copied
+func releaseSpilled(f *os.File, off, length int64) {}
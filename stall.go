@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"sync/atomic"
+	"time"
+)
+
+// Time ffmpeg gets to finish the file after a stall before it is killed
+const stallStopTimeout = 5 * time.Second
+
+// stallTimeout is how long the encoded frame count may stand still before
+// ffmpeg is restarted, 0 to never restart it
+var stallTimeout time.Duration
+
+// watchStall restarts ffmpeg when it is still running but its frame count
+// stopped advancing, like on a driver hang or a capture that stopped
+// delivering frames. Nothing is recorded in that state, so the segment is
+// finished and the session loop starts a new one. Progress lines only start
+// with the first encoded frame, so the watch starts with the first one too.
+func watchStall(cmd *exec.Cmd, stdin io.Writer, progress *segmentProgress, stalled *atomic.Bool, finished chan struct{}, log *slog.Logger) {
+	if stallTimeout <= 0 {
+		return
+	}
+	// A static screen with -dedupe only writes the keepalive frames
+	timeout := stallTimeout
+	if dedupeFrames {
+		timeout = max(timeout, 2*dedupeKeepalive)
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	lastFrame := int64(-1)
+	var advanced time.Time
+	for {
+		select {
+		case <-finished:
+			return
+		case <-ticker.C:
+		}
+		p, updated := progress.snapshot()
+		if updated.IsZero() {
+			continue
+		}
+		// The monotonic clock stops while the system is suspended, so a
+		// suspend does not count as a stall
+		if p.frame != lastFrame {
+			lastFrame, advanced = p.frame, time.Now()
+			continue
+		}
+		if time.Since(advanced) < timeout {
+			continue
+		}
+
+		stalled.Store(true)
+		log.Error("ffmpeg stopped encoding frames, restarting it", "frame", p.frame, "stalledFor", time.Since(advanced).Round(time.Second))
+		consoleError("ffmpeg encoded no frames for %s, restarting the capture", timeout)
+		alertFailure(fmt.Sprintf("ffmpeg stalled at frame %d for %s while recording, restarted the capture", p.frame, timeout))
+
+		// A q may still finalize the file if only the capture hangs
+		if stdin != nil {
+			io.WriteString(stdin, "q\n")
+		}
+		select {
+		case <-finished:
+		case <-time.After(stallStopTimeout):
+			log.Warn("Killing stalled ffmpeg")
+			cmd.Process.Kill()
+		}
+		return
+	}
+}
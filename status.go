@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Global variables for the JSON status stream
+var statusJSON bool
+var statusInterval time.Duration
+
+// statusEvent is a line of the JSON status stream written with -status-json
+type statusEvent struct {
+	Event    string    `json:"event"` // started, progress, rotated, marker, meeting, idle, active, redacted, unredacted, deviated, restored, suspend, resume, limit, stopped or error
+	Time     time.Time `json:"time"`
+	File     string    `json:"file,omitempty"`
+	Log      string    `json:"log,omitempty"`
+	Display  string    `json:"display,omitempty"`
+	Encoder  string    `json:"encoder,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Label    string    `json:"label,omitempty"`
+	Offset   float64   `json:"offset_seconds,omitempty"`
+	Message  string    `json:"message,omitempty"`
+	Size     int64     `json:"size,omitempty"`
+	Duration float64   `json:"duration_seconds,omitempty"`
+	Frame    int64     `json:"frame,omitempty"`
+	FPS      float64   `json:"fps,omitempty"`
+	Bitrate  float64   `json:"bitrate_kbps,omitempty"`
+	Speed    float64   `json:"speed,omitempty"`
+	Dropped  int64     `json:"dropped,omitempty"`
+}
+
+// statusMu keeps events from interleaving on stdout
+var statusMu sync.Mutex
+
+// emitStatus writes an event to the status stream if it is enabled and
+// passes it to the -policy script
+func emitStatus(ev statusEvent) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	sendPolicyEvent(ev)
+	if !statusJSON {
+		return
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	os.Stdout.Write(append(data, '\n'))
+}
+
+// reportProgress emits a progress event for the segment every status
+// interval until finished is closed
+func reportProgress(file string, start time.Time, progress *segmentProgress, finished chan struct{}) {
+	if !statusJSON || statusInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-finished:
+			return
+		case <-ticker.C:
+			p, _ := progress.snapshot()
+			ev := statusEvent{
+				Event:    "progress",
+				File:     file,
+				Duration: time.Since(start).Seconds(),
+				Frame:    p.frame,
+				FPS:      p.fps,
+				Bitrate:  p.bitrate,
+				Speed:    p.speed,
+				Dropped:  p.drop,
+			}
+			ev.Size = p.size
+			if fileInfo, err := os.Stat(file); err == nil {
+				ev.Size = fileInfo.Size()
+			}
+			emitStatus(ev)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// How often the status file is rewritten while nothing changes
+const statusFileInterval = 30 * time.Second
+
+// statusFilePath is where the recorder keeps its status file, "" for none
+var statusFilePath string
+
+// lastFailure is the last failure reported by alertFailure
+var lastFailure atomic.Pointer[failureRecord]
+
+// failureRecord is a failure in the status file
+type failureRecord struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// statusFile is the content of the status file. It is rewritten on every
+// state change and every statusFileInterval, so a check can also tell from
+// updated that the recorder still runs.
+type statusFile struct {
+	recorderStatus
+	PID        int            `json:"pid"`
+	ConfigHash string         `json:"config_hash"`
+	Running    time.Time      `json:"running_since"`
+	Updated    time.Time      `json:"updated"`
+	LastError  *failureRecord `json:"last_error,omitempty"`
+}
+
+// statusFileState keeps writes to the status file in order
+var statusFileState struct {
+	sync.Mutex
+	configHash string
+	running    time.Time
+}
+
+// configHash returns a short hash of the effective recorder flags, wherever
+// they were set, so configuration management can tell whether a change
+// has been applied
+func configHash() string {
+	h := sha256.New()
+	flag.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(h, "%s=%s\n", f.Name, f.Value.String())
+	})
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// startStatusFile writes the status file now, on every state change and
+// periodically until the recorder exits
+func startStatusFile() error {
+	statusFileState.configHash = configHash()
+	statusFileState.running = time.Now()
+	if err := writeStatusFile(currentStatus()); err != nil {
+		return err
+	}
+	stateHooks = append(stateHooks, func(status recorderStatus) {
+		if err := writeStatusFile(status); err != nil {
+			currentLog().Warn("Could not write the status file", "error", err)
+		}
+	})
+	// Stops before the exited state is written
+	goBackground(func() {
+		for sleepOrShutdown(statusFileInterval) {
+			if err := writeStatusFile(currentStatus()); err != nil {
+				currentLog().Warn("Could not write the status file", "error", err)
+			}
+		}
+	})
+	return nil
+}
+
+// writeStatusFile replaces the status file, readers never see half of it
+func writeStatusFile(status recorderStatus) error {
+	statusFileState.Lock()
+	defer statusFileState.Unlock()
+	data, err := json.MarshalIndent(statusFile{
+		recorderStatus: status,
+		PID:            os.Getpid(),
+		ConfigHash:     statusFileState.configHash,
+		Running:        statusFileState.running,
+		Updated:        time.Now(),
+		LastError:      lastFailure.Load(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := statusFilePath + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, statusFilePath)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// stdinCommands is set when the recorder reads commands from its stdin, so
+// wrapping scripts can annotate and steer the recording without a socket
+var stdinCommands bool
+
+// readStdinCommands runs the commands read from stdin until it is closed:
+// "marker <label>", "rotate", "pause", "resume" and "copy"
+func readStdinCommands() {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		command, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+
+		var err error
+		switch command {
+		case "marker":
+			if arg == "" {
+				consoleWarn("Ignoring marker without a label")
+				continue
+			}
+			addMarker(arg)
+		case "rotate":
+			requestRotation("requested on stdin")
+		case "pause":
+			err = controlRecording("pause")
+		case "resume":
+			err = controlRecording("start")
+		case "copy":
+			if err := copyLastSegment(); err != nil {
+				consoleWarn("Could not copy the last segment: %v", err)
+			}
+		default:
+			consoleWarn("Ignoring unknown input %q, use marker <label>, rotate, pause, resume or copy", line)
+		}
+		if err != nil {
+			consoleWarn("Could not %s recording: %v", command, err)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// Default wait before a pipeline that exited is started again
+	defaultRestartDelay = 10 * time.Second
+	// Time pipelines get to finish their segments when the supervisor stops
+	pipelineStopTimeout = 30 * time.Second
+)
+
+// fleetConfig is the configuration file of the supervisor
+type fleetConfig struct {
+	Pipelines []pipelineConfig `yaml:"pipelines"`
+}
+
+// pipelineConfig is a recorder run by the supervisor. Flags are recorder
+// flags without the leading dash, the name is used as instance name.
+type pipelineConfig struct {
+	Name         string            `yaml:"name"`
+	Flags        map[string]string `yaml:"flags"`
+	Env          map[string]string `yaml:"env"`
+	RestartDelay time.Duration     `yaml:"restart_delay"`
+}
+
+// loadFleetConfig reads and checks a supervisor configuration file
+func loadFleetConfig(path string) (*fleetConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// Unknown keys are mistakes, like a misspelled restart_delay
+	var config fleetConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(config.Pipelines) == 0 {
+		return nil, fmt.Errorf("%s defines no pipelines", path)
+	}
+	names := map[string]bool{}
+	for i, p := range config.Pipelines {
+		switch {
+		case p.Name == "":
+			return nil, fmt.Errorf("%s: pipeline %d has no name", path, i+1)
+		case names[p.Name]:
+			return nil, fmt.Errorf("%s: pipeline %q is defined twice", path, p.Name)
+		case p.Flags["instance"] != "":
+			return nil, fmt.Errorf("%s: pipeline %q sets the instance flag, its name is the instance name", path, p.Name)
+		}
+		names[p.Name] = true
+		if p.RestartDelay <= 0 {
+			config.Pipelines[i].RestartDelay = defaultRestartDelay
+		}
+	}
+	return &config, nil
+}
+
+// flag returns a recorder flag of the pipeline, from its flags or else its
+// environment, like the recorder reads it
+func (p pipelineConfig) flag(name string) string {
+	if value, ok := p.Flags[name]; ok {
+		return value
+	}
+	return p.env(flagEnvName(name))
+}
+
+// env returns a variable of the environment the recorder of the pipeline
+// gets
+func (p pipelineConfig) env(name string) string {
+	if value, ok := p.Env[name]; ok {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// args returns the recorder command line of a pipeline
+func (p pipelineConfig) args() []string {
+	names := make([]string, 0, len(p.Flags))
+	for name := range p.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	args := []string{"-instance=" + p.Name}
+	for _, name := range names {
+		args = append(args, "-"+name+"="+p.Flags[name])
+	}
+	return args
+}
+
+// pipeline is a running recorder of the supervisor
+type pipeline struct {
+	config pipelineConfig
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	// Set by stop, a recorder is not started after it
+	stopped bool
+	// Starts after the first, for the API and metrics
+	restarts int
+	// Segments the janitor of the supervisor deleted, when the recorder
+	// leaves them to it
+	janitor bool
+	expired int
+	// prepare adjusts the command before each start, like to run it in
+	// another session, and returns what to release after the start
+	prepare func(cmd *exec.Cmd) (release func(), err error)
+}
+
+// errPipelineStopped is the start of a recorder after its pipeline stopped
+var errPipelineStopped = errors.New("the pipeline stopped")
+
+// run starts the recorder and starts it again whenever it exits, until
+// stopping is closed
+func (p *pipeline) run(program string, stopping chan struct{}) {
+	for {
+		cmd := exec.Command(program, p.config.args()...)
+		cmd.Env = os.Environ()
+		for k, v := range p.config.Env {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+		if p.janitor {
+			cmd.Env = append(cmd.Env, supervisorJanitorEnv+"=1")
+		}
+		out, err := cmd.StdoutPipe()
+		release := func() {}
+		if err == nil && p.prepare != nil {
+			release, err = p.prepare(cmd)
+		}
+		if err == nil {
+			cmd.Stderr = cmd.Stdout
+			// stop either sees the recorder or keeps it from starting
+			p.mu.Lock()
+			if p.stopped {
+				err = errPipelineStopped
+			} else if err = cmd.Start(); err == nil {
+				p.cmd = cmd
+			}
+			p.mu.Unlock()
+			release()
+		}
+		if errors.Is(err, errPipelineStopped) {
+			return
+		}
+		if err != nil {
+			consoleError("[%s] Could not start the recorder: %v", p.config.Name, err)
+		} else {
+			consoleEvent("[%s] Recorder started (pid %d)", p.config.Name, cmd.Process.Pid)
+			p.copyOutput(out)
+			err = cmd.Wait()
+			p.mu.Lock()
+			p.cmd = nil
+			p.mu.Unlock()
+		}
+
+		select {
+		case <-stopping:
+			return
+		default:
+		}
+		// The same flags would fail again
+		if cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == exitConfigError {
+			consoleError("[%s] Recorder rejected its configuration, not restarting it", p.config.Name)
+			return
+		}
+		consoleWarn("[%s] Recorder exited (%v), restarting in %s", p.config.Name, err, p.config.RestartDelay)
+		select {
+		case <-stopping:
+			return
+		case <-time.After(p.config.RestartDelay):
+		}
+		p.mu.Lock()
+		p.restarts++
+		p.mu.Unlock()
+	}
+}
+
+// copyOutput prints the console output of the recorder, prefixed with the
+// pipeline name
+func (p *pipeline) copyOutput(out io.Reader) {
+	scanner := bufio.NewScanner(out)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fmt.Fprintf(consoleOut, "[%s] %s\n", p.config.Name, scanner.Text())
+	}
+}
+
+// stop asks the recorder to finish its segment and exit. Windows cannot
+// send it an interrupt, there it gets the quit control command.
+func (p *pipeline) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopped = true
+	if p.cmd != nil && p.cmd.Process.Signal(os.Interrupt) != nil {
+		go sendControlCommand(p.config.Name, "quit", io.Discard)
+	}
+}
+
+// kill ends a recorder that did not stop in time
+func (p *pipeline) kill() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cmd != nil {
+		consoleWarn("[%s] Recorder did not stop in time, killing it", p.config.Name)
+		p.cmd.Process.Kill()
+	}
+}
+
+// runSupervisorCommand runs the recorders of a fleet configuration as child
+// processes, restarts them when they exit and stops them together
+func runSupervisorCommand(args []string) int {
+	fs := flag.NewFlagSet("supervisor", flag.ExitOnError)
+	configFlag := fs.String("config", "", "YAML file with the pipelines to run")
+	seatsFlag := fs.String("seats", "", "YAML file to record every graphical session of this machine")
+	listenFlag := fs.String("listen", "", "Serve the HTTP API of all pipelines on this address, like 127.0.0.1:8090: GET /pipelines and /metrics, POST /pipelines/<name>/start, stop and pause (password in "+listenPasswordEnv+")")
+	fs.Parse(args)
+
+	if (*configFlag == "") == (*seatsFlag == "") {
+		consoleError("Usage: screen-vibe supervisor -config fleet.yaml [-listen addr] | -seats seats.yaml")
+		return 2
+	}
+	if *listenFlag != "" && *seatsFlag != "" {
+		consoleError("-listen works with -config, the recorders of -seats come and go with the sessions")
+		return 2
+	}
+	program, err := os.Executable()
+	if err != nil {
+		consoleError("Could not find the screen-vibe executable: %v", err)
+		return 1
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	if *seatsFlag != "" {
+		config, err := loadSeatsConfig(*seatsFlag)
+		if err != nil {
+			consoleError("%v", err)
+			return 1
+		}
+		return runSeats(program, config, sigs)
+	}
+	config, err := loadFleetConfig(*configFlag)
+	if err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+
+	stopping := make(chan struct{})
+	var wg sync.WaitGroup
+	pipelines := make([]*pipeline, len(config.Pipelines))
+	for i, c := range config.Pipelines {
+		// The janitor of the supervisor deletes the expired segments of
+		// all pipelines, instead of one in every recorder
+		pipelines[i] = &pipeline{config: c, janitor: c.flag("retention") != ""}
+	}
+	var server *http.Server
+	if *listenFlag != "" {
+		if server, err = startSupervisorAPI(*listenFlag, pipelines); err != nil {
+			consoleError("%v", err)
+			return 1
+		}
+	}
+	for _, p := range pipelines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.run(program, stopping)
+		}()
+	}
+	goBackground(func() { runJanitor(pipelines) })
+	consoleInfo("Supervising %d pipelines, control them with screen-vibe ctl -instance <name>", len(pipelines))
+
+	sig := <-sigs
+	consoleInfo("Received signal %v, stopping all pipelines...", sig)
+	cancelShutdown()
+	close(stopping)
+	for _, p := range pipelines {
+		p.stop()
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(pipelineStopTimeout):
+		for _, p := range pipelines {
+			p.kill()
+		}
+		<-stopped
+	}
+	// A pass of the janitor finishes its catalog update
+	backgroundJobs.Wait()
+	if server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), viewShutdownTimeout)
+		defer cancel()
+		server.Shutdown(ctx)
+	}
+	consoleInfo("All pipelines stopped")
+	return 0
+}
+
+// startSupervisorAPI serves the API of the pipelines on addr
+func startSupervisorAPI(addr string, pipelines []*pipeline) (*http.Server, error) {
+	password := os.Getenv(listenPasswordEnv)
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -listen address %q: %v", addr, err)
+	}
+	if ip := net.ParseIP(host); password == "" && (ip == nil || !ip.IsLoopback()) {
+		consoleWarn("Anyone who can reach %s can control the pipelines, set a password in %s", addr, listenPasswordEnv)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not listen on %s: %v", addr, err)
+	}
+	server := &http.Server{Handler: newSupervisorHandler(pipelines, password, addr), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			consoleWarn("HTTP API stopped: %v", err)
+		}
+	}()
+	consoleInfo("HTTP API of the pipelines on http://%s: GET /pipelines, /metrics, POST /pipelines/<name>/start, stop, pause", listener.Addr())
+	return server, nil
+}
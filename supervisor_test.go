@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSupervisorAPI(t *testing.T) {
+	pipelines := []*pipeline{
+		{config: pipelineConfig{Name: "front"}, restarts: 2},
+		{config: pipelineConfig{Name: "back"}, expired: 3},
+	}
+	handler := newSupervisorHandler(pipelines, "", "127.0.0.1:8090")
+	request := func(method, path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		r.Host = "127.0.0.1:8090"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("GET", "/pipelines")
+	var statuses []pipelineStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &statuses); err != nil || len(statuses) != 2 {
+		t.Fatalf("GET /pipelines: %d %s", w.Code, w.Body)
+	}
+	if s := statuses[0]; s.Name != "front" || s.Running || s.Restarts != 2 || s.Status != nil {
+		t.Errorf("status of a stopped pipeline: %+v", s)
+	}
+	if w := request("GET", "/pipelines/side"); w.Code != http.StatusNotFound {
+		t.Errorf("GET of an unknown pipeline: %d", w.Code)
+	}
+	if w := request("POST", "/pipelines/front/record"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown action: %d", w.Code)
+	}
+
+	metrics := request("GET", "/metrics").Body.String()
+	for _, line := range []string{
+		"# TYPE screen_vibe_pipeline_up gauge",
+		`screen_vibe_pipeline_up{pipeline="front"} 0`,
+		`screen_vibe_pipeline_restarts_total{pipeline="front"} 2`,
+		`screen_vibe_pipeline_expired_segments_total{pipeline="back"} 3`,
+	} {
+		if !strings.Contains(metrics, line+"\n") {
+			t.Errorf("/metrics lacks %q:\n%s", line, metrics)
+		}
+	}
+	// Recorders that do not run have no status to report
+	if strings.Contains(metrics, "screen_vibe_pipeline_fps{") {
+		t.Errorf("/metrics reports the fps of stopped recorders:\n%s", metrics)
+	}
+}
+
+// A pipeline stopped before its recorder started does not start it
+func TestPipelineStoppedBeforeStart(t *testing.T) {
+	p := &pipeline{config: pipelineConfig{Name: "front"}}
+	p.stop()
+	p.run("/nonexistent/screen-vibe", make(chan struct{}))
+	if p.cmd != nil || p.restarts != 0 {
+		t.Errorf("the stopped pipeline started its recorder %d times", p.restarts+1)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// pipelineStatus is a pipeline in the API of the supervisor, with the
+// status its recorder returns to ctl status
+type pipelineStatus struct {
+	Name     string          `json:"name"`
+	Running  bool            `json:"running"`
+	PID      int             `json:"pid,omitempty"`
+	Restarts int             `json:"restarts"`
+	Expired  int             `json:"expired_segments,omitempty"`
+	Status   *recorderStatus `json:"status,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// status returns the state of the pipeline and asks its recorder for its
+// status over the control socket
+func (p *pipeline) status() pipelineStatus {
+	p.mu.Lock()
+	s := pipelineStatus{Name: p.config.Name, Running: p.cmd != nil, Restarts: p.restarts, Expired: p.expired}
+	if p.cmd != nil {
+		s.PID = p.cmd.Process.Pid
+	}
+	p.mu.Unlock()
+	if !s.Running {
+		return s
+	}
+	var out bytes.Buffer
+	var status recorderStatus
+	if err := sendControlCommand(p.config.Name, "status", &out); err != nil {
+		s.Error = err.Error()
+	} else if err := json.Unmarshal(out.Bytes(), &status); err != nil {
+		s.Error = fmt.Sprintf("invalid status: %v", err)
+	} else {
+		s.Status = &status
+	}
+	return s
+}
+
+// newSupervisorHandler returns the handler of the -listen API of the
+// supervisor on listen: GET /pipelines returns the status of every
+// pipeline, /pipelines/<name> of one, POST /pipelines/<name>/start, stop and
+// pause control its recorder like ctl, and GET /metrics returns the status
+// of all of them for Prometheus
+func newSupervisorHandler(pipelines []*pipeline, password, listen string) http.Handler {
+	byName := map[string]*pipeline{}
+	for _, p := range pipelines {
+		byName[p.config.Name] = p
+	}
+	find := func(w http.ResponseWriter, r *http.Request) *pipeline {
+		p := byName[r.PathValue("name")]
+		if p == nil {
+			http.Error(w, fmt.Sprintf("No pipeline %q", r.PathValue("name")), http.StatusNotFound)
+		}
+		return p
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /pipelines", func(w http.ResponseWriter, r *http.Request) {
+		statuses := make([]pipelineStatus, len(pipelines))
+		for i, p := range pipelines {
+			statuses[i] = p.status()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(statuses)
+	})
+	mux.HandleFunc("GET /pipelines/{name}", func(w http.ResponseWriter, r *http.Request) {
+		if p := find(w, r); p != nil {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(p.status())
+		}
+	})
+	mux.HandleFunc("POST /pipelines/{name}/{action}", func(w http.ResponseWriter, r *http.Request) {
+		if crossOrigin(r) {
+			http.Error(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+			return
+		}
+		p := find(w, r)
+		if p == nil {
+			return
+		}
+		action := r.PathValue("action")
+		if action != "start" && action != "stop" && action != "pause" {
+			http.Error(w, "Unknown action, use start, stop or pause", http.StatusNotFound)
+			return
+		}
+		var out bytes.Buffer
+		err := sendControlCommand(p.config.Name, action, &out)
+		if reply := strings.TrimSpace(out.String()); err == nil && reply != "ok" {
+			err = fmt.Errorf("%s", strings.TrimPrefix(reply, "error: "))
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, "ok\n")
+	})
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		statuses := make([]pipelineStatus, len(pipelines))
+		for i, p := range pipelines {
+			statuses[i] = p.status()
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, statuses)
+	})
+	auth := &viewHandler{password: password}
+	return restrictHost(listen, auth.authenticate(mux))
+}
+
+// pipelineMetric is a metric of the supervisor with a value per pipeline
+type pipelineMetric struct {
+	name, kind, help string
+	value            func(s pipelineStatus) (float64, bool)
+}
+
+// pipelineMetrics are the metrics of /metrics, the ones from the status of
+// a recorder are left out while it does not answer
+var pipelineMetrics = []pipelineMetric{
+	{"screen_vibe_pipeline_up", "gauge", "Whether the recorder of the pipeline runs",
+		func(s pipelineStatus) (float64, bool) { return boolMetric(s.Running), true }},
+	{"screen_vibe_pipeline_restarts_total", "counter", "Times the recorder was started again after it exited",
+		func(s pipelineStatus) (float64, bool) { return float64(s.Restarts), true }},
+	{"screen_vibe_pipeline_expired_segments_total", "counter", "Segments the janitor of the supervisor deleted after the retention period",
+		func(s pipelineStatus) (float64, bool) { return float64(s.Expired), true }},
+	{"screen_vibe_pipeline_recording", "gauge", "Whether the recorder records a segment",
+		func(s pipelineStatus) (float64, bool) {
+			return boolMetric(s.Status != nil && s.Status.State == "recording"), s.Status != nil
+		}},
+	{"screen_vibe_pipeline_segment_bytes", "gauge", "Size of the segment being recorded",
+		func(s pipelineStatus) (float64, bool) {
+			return statusMetric(s, func(r *recorderStatus) int64 { return r.Size })
+		}},
+	{"screen_vibe_pipeline_segment_seconds", "gauge", "Time the segment being recorded runs",
+		func(s pipelineStatus) (float64, bool) {
+			return statusMetric(s, func(r *recorderStatus) int64 { return r.Elapsed })
+		}},
+	{"screen_vibe_pipeline_fps", "gauge", "Frames per second ffmpeg captures",
+		func(s pipelineStatus) (float64, bool) {
+			if s.Status == nil {
+				return 0, false
+			}
+			return s.Status.FPS, true
+		}},
+	{"screen_vibe_pipeline_disk_free_bytes", "gauge", "Free space in the output directory",
+		func(s pipelineStatus) (float64, bool) {
+			return statusMetric(s, func(r *recorderStatus) int64 { return r.DiskFree })
+		}},
+	{"screen_vibe_pipeline_live_viewers", "gauge", "Viewers of the live view",
+		func(s pipelineStatus) (float64, bool) {
+			return statusMetric(s, func(r *recorderStatus) int64 { return int64(r.LiveViewers) })
+		}},
+}
+
+// boolMetric returns 1 for true
+func boolMetric(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// statusMetric returns a value of the status of the recorder, if it
+// answered
+func statusMetric(s pipelineStatus, value func(*recorderStatus) int64) (float64, bool) {
+	if s.Status == nil {
+		return 0, false
+	}
+	return float64(value(s.Status)), true
+}
+
+// writeMetrics writes the metrics of the pipelines in the text format of
+// Prometheus
+func writeMetrics(w io.Writer, statuses []pipelineStatus) {
+	for _, m := range pipelineMetrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, s := range statuses {
+			if v, ok := m.value(s); ok {
+				fmt.Fprintf(w, "%s{pipeline=%q} %g\n", m.name, s.Name, v)
+			}
+		}
+	}
+}
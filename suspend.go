@@ -0,0 +1,76 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Forward wall clock jumps at least this long are treated as the system
+// resuming from suspend, since the monotonic clock stops while suspended
+const suspendMinGap = 30 * time.Second
+
+// Time to wait for the segment to be finalized before the system sleeps
+const suspendFinalizeTimeout = 4 * time.Second
+
+// suspendState tracks what the recorder did around a suspend
+var suspendState struct {
+	sync.Mutex
+	paused  bool      // recording was paused before sleeping
+	resumed time.Time // last resume reported by the OS
+}
+
+// resumeRecovery is set while the segment that was recording across a
+// suspend is stopped, ffmpeg is killed if it hangs on a stale capture
+var resumeRecovery atomic.Bool
+
+// prepareForSleep finishes the current segment before the system sleeps,
+// so the file is finalized even if the system never wakes up again
+func prepareForSleep() {
+	consoleEvent("System is going to sleep, finishing the current segment")
+	currentLog().Info("System is going to sleep")
+	emitStatus(statusEvent{Event: "suspend"})
+
+	suspendState.Lock()
+	if recorderHold() == "" {
+		suspendState.paused = controlRecording("pause") == nil
+	}
+	suspendState.Unlock()
+
+	deadline := time.Now().Add(suspendFinalizeTimeout)
+	for activeSegment.Load() != nil && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// resumedFromSleep resumes recording paused by prepareForSleep
+func resumedFromSleep() {
+	suspendState.Lock()
+	defer suspendState.Unlock()
+	suspendState.resumed = time.Now()
+	consoleEvent("System resumed, restarting the capture")
+	emitStatus(statusEvent{Event: "resume"})
+
+	if suspendState.paused && recorderHold() == "paused" {
+		controlRecording("start")
+	}
+	suspendState.paused = false
+}
+
+// systemResumed restarts the capture after a suspend the recorder was not
+// told about, since ffmpeg may be attached to a stale capture handle. The
+// new segment detects the displays again.
+func systemResumed(gap time.Duration) {
+	suspendState.Lock()
+	handled := time.Since(suspendState.resumed) < gap
+	suspendState.Unlock()
+	if handled {
+		return
+	}
+
+	consoleEvent("System resumed after about %s, restarting the capture", gap.Round(time.Second))
+	currentLog().Warn("System resumed from suspend", "gap", gap)
+	emitStatus(statusEvent{Event: "resume"})
+	resumeRecovery.Store(true)
+	requestRotation("system resumed from suspend")
+}
@@ -0,0 +1,69 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// watchSleep takes a delay inhibitor lock from systemd-logind, so the
+// current segment can be finalized when the system is about to sleep, and
+// restarts recording when it wakes up
+func watchSleep() error {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return fmt.Errorf("could not connect to the system bus: %w", err)
+	}
+	login := conn.Object("org.freedesktop.login1", "/org/freedesktop/login1")
+	inhibit := func() (int, error) {
+		var fd dbus.UnixFD
+		err := login.Call("org.freedesktop.login1.Manager.Inhibit", 0,
+			"sleep", "screen-vibe", "Finalize the recording", "delay").Store(&fd)
+		return int(fd), err
+	}
+
+	fd, err := inhibit()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("could not take a sleep inhibitor lock: %w", err)
+	}
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchInterface("org.freedesktop.login1.Manager"),
+		dbus.WithMatchMember("PrepareForSleep"),
+	); err != nil {
+		syscall.Close(fd)
+		conn.Close()
+		return err
+	}
+	signals := make(chan *dbus.Signal, 4)
+	conn.Signal(signals)
+
+	go func() {
+		for sig := range signals {
+			if sig.Name != "org.freedesktop.login1.Manager.PrepareForSleep" || len(sig.Body) == 0 {
+				continue
+			}
+			sleeping, _ := sig.Body[0].(bool)
+			if sleeping {
+				prepareForSleep()
+				// Releasing the lock lets the system go to sleep
+				if fd >= 0 {
+					syscall.Close(fd)
+					fd = -1
+				}
+				continue
+			}
+			resumedFromSleep()
+			if fd < 0 {
+				if fd, err = inhibit(); err != nil {
+					consoleWarn("Could not take a sleep inhibitor lock: %v", err)
+					fd = -1
+				}
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+// watchSleep is only implemented on Linux, elsewhere watchClock finds
+// resumes from suspend after the fact
+func watchSleep() error {
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// Interval between two measurements of the shared clock
+	syncCheckInterval = time.Minute
+	// Measurements kept, a day's worth covers the longest segments
+	syncMaxSamples = 24 * 60
+)
+
+// syncClockServer is the NTP server whose time the recorders of a group
+// share, "" without -sync-clock
+var syncClockServer string
+
+// syncSample is the offset of the shared clock from the local clock, shared
+// time minus local time, at a local time
+type syncSample struct {
+	local  time.Time
+	offset time.Duration
+}
+
+// syncSamples holds the measurements of the shared clock, oldest first
+var syncSamples struct {
+	sync.Mutex
+	list []syncSample
+}
+
+// syncInfo places a segment on the shared clock, so the segments of several
+// recorders can be aligned frame by frame in review
+type syncInfo struct {
+	Clock string `json:"clock"`
+	// Shared clock time of the first frame
+	FirstFrame time.Time `json:"first_frame"`
+	// One marker per measurement during the segment
+	Markers []syncMarker `json:"markers"`
+}
+
+// syncMarker ties a media time of a segment to the shared clock
+type syncMarker struct {
+	Media  float64   `json:"media_seconds"`
+	Time   time.Time `json:"time"`
+	Offset float64   `json:"offset_seconds"`
+}
+
+// startSyncClock measures the shared clock now and every syncCheckInterval
+// until the recorder exits
+func startSyncClock() error {
+	if err := measureSyncClock(); err != nil {
+		return err
+	}
+	go func() {
+		for range time.Tick(syncCheckInterval) {
+			if err := measureSyncClock(); err != nil {
+				currentLog().Warn("Could not measure the shared clock", "server", syncClockServer, "error", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// measureSyncClock adds a measurement of the shared clock
+func measureSyncClock() error {
+	offset, err := queryNTPOffset(syncClockServer)
+	if err != nil {
+		return err
+	}
+	syncSamples.Lock()
+	defer syncSamples.Unlock()
+	syncSamples.list = append(syncSamples.list, syncSample{local: time.Now(), offset: offset})
+	if len(syncSamples.list) > syncMaxSamples {
+		syncSamples.list = syncSamples.list[len(syncSamples.list)-syncMaxSamples:]
+	}
+	currentLog().Debug("Shared clock offset", "server", syncClockServer, "offset", offset)
+	return nil
+}
+
+// segmentSync returns the shared clock times of a segment whose first frame
+// was captured at the local time first. With wall clock timestamps the media
+// time of a frame is its capture time since the first frame, so every
+// measurement up to end becomes a marker.
+func segmentSync(first, end time.Time) *syncInfo {
+	syncSamples.Lock()
+	defer syncSamples.Unlock()
+	if len(syncSamples.list) == 0 {
+		return nil
+	}
+	// The last measurement before the first frame applies to it
+	info := &syncInfo{Clock: syncClockServer}
+	offset := syncSamples.list[0].offset
+	for _, s := range syncSamples.list {
+		if s.local.After(first) {
+			break
+		}
+		offset = s.offset
+	}
+	info.FirstFrame = first.Add(offset).UTC()
+	info.Markers = append(info.Markers, syncMarker{Time: info.FirstFrame, Offset: offset.Seconds()})
+	for _, s := range syncSamples.list {
+		if s.local.After(first) && !s.local.After(end) {
+			info.Markers = append(info.Markers, syncMarker{
+				Media:  s.local.Sub(first).Seconds(),
+				Time:   s.local.Add(s.offset).UTC(),
+				Offset: s.offset.Seconds(),
+			})
+		}
+	}
+	return info
+}
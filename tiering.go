@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"screen-vibe/extension"
+)
+
+// Interval between two passes that move old segments to cold storage
+const tierInterval = 10 * time.Minute
+
+// tierAfter is the age at which finished segments move to cold storage, 0
+// to keep them all local
+var tierAfter time.Duration
+
+// coldStorage keeps the segments moved off the machine, nil without
+// -tier-after
+var (
+	coldStorage     extension.ColdStorage
+	coldStorageName string
+)
+
+// hasColdStorage reports whether an extension compiled in can keep the
+// segments of -tier-after
+func hasColdStorage() bool {
+	for _, ext := range extension.Registered() {
+		if _, ok := ext.(extension.ColdStorage); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// startTiering picks the first cold storage extension that initialized and
+// moves old segments to it from now on
+func startTiering() error {
+	for _, ext := range activeExtensions {
+		if cs, ok := ext.(extension.ColdStorage); ok {
+			coldStorage, coldStorageName = cs, ext.Name()
+			break
+		}
+	}
+	if coldStorage == nil {
+		return errors.New("no cold storage extension initialized")
+	}
+	goBackground(func() {
+		for {
+			tierSegments()
+			if !sleepOrShutdown(tierInterval) {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// tierSegments moves the video files of segments older than -tier-after to
+// cold storage and leaves their catalog entries as stubs pointing there.
+// Files fetched back are removed again once they were local for as long.
+// Segments under legal hold stay where they are until released.
+func tierSegments() {
+	entries, err := readAnnotatedCatalog()
+	if err != nil {
+		consoleWarn("Could not read the catalog for tiering: %v", err)
+		return
+	}
+	cutoff := time.Now().Add(-tierAfter)
+	for _, e := range entries {
+		if shutdownCtx.Err() != nil {
+			return
+		}
+		if e.File == "" || e.End.After(cutoff) || e.Hold != nil {
+			continue
+		}
+		file := filepath.Join(outputDir, filepath.FromSlash(e.File))
+		info, err := os.Stat(file)
+		if err != nil {
+			// Moved already or deleted
+			continue
+		}
+		if e.Remote != "" {
+			if info.ModTime().Before(cutoff) {
+				if err := os.Remove(file); err == nil {
+					logAccess("remove", "fetched copy, the file stays in cold storage", e.File)
+					consoleEvent("Removed the fetched copy of %s", e.File)
+				}
+			}
+			continue
+		}
+
+		// A store cut off by the shutdown leaves the file local
+		ctx, cancel := context.WithTimeout(shutdownCtx, extensionUploadTimeout)
+		location, err := coldStorage.Store(ctx, file)
+		cancel()
+		if err != nil {
+			consoleWarn("Extension %s could not move %s to cold storage: %v", coldStorageName, e.File, err)
+			continue
+		}
+		// The file is only removed once the catalog knows where it went
+		err = updateCatalog(func(entries []catalogEntry) []catalogEntry {
+			for i := range entries {
+				if entries[i].File == e.File {
+					entries[i].Remote = location
+				}
+			}
+			return entries
+		})
+		if err != nil {
+			consoleError("Could not update catalog: %v", err)
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			consoleWarn("Could not remove %s after moving it to cold storage: %v", e.File, err)
+			continue
+		}
+		logAccess("tier", "moved to "+location, e.File)
+		consoleEvent("Moved %s to cold storage (%s)", e.File, location)
+	}
+}
+
+// fetchSegment copies a segment back from cold storage to its place in the
+// output directory and returns its path. name is the path of the file as
+// listed in the catalog, or relative to the working directory.
+func fetchSegment(name string) (string, error) {
+	if coldStorage == nil {
+		return "", errors.New("no cold storage, the recorder runs without -tier-after")
+	}
+	entries, err := readCatalog()
+	if err != nil {
+		return "", fmt.Errorf("could not read catalog: %v", err)
+	}
+	for _, e := range entries {
+		if e.File != filepath.ToSlash(name) && e.File != relativeToOutput(name) {
+			continue
+		}
+		file := filepath.Join(outputDir, filepath.FromSlash(e.File))
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		}
+		if e.Storage != "" {
+			return "", fmt.Errorf("%s was recorded to %s, it is not in cold storage", e.File, e.Storage)
+		}
+		if e.Remote == "" {
+			return "", fmt.Errorf("%s is not in cold storage", e.File)
+		}
+
+		// Fetch next to the file, so a broken download is never taken for it
+		part := file + ".part"
+		ctx, cancel := context.WithTimeout(context.Background(), extensionUploadTimeout)
+		defer cancel()
+		if err := coldStorage.Retrieve(ctx, e.Remote, part); err != nil {
+			os.Remove(part)
+			return "", fmt.Errorf("extension %s could not fetch %s: %v", coldStorageName, e.Remote, err)
+		}
+		if err := os.Rename(part, file); err != nil {
+			return "", err
+		}
+		// The copy stays local for -tier-after from now on
+		now := time.Now()
+		os.Chtimes(file, now, now)
+		logAccess("fetch", "from "+e.Remote, e.File)
+		consoleEvent("Fetched %s from cold storage", e.File)
+		return file, nil
+	}
+	return "", fmt.Errorf("%s is not in the catalog", name)
+}
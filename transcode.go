@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Video files transcode-watch picks up, by extension
+var transcodeExtensions = []string{".mkv", ".mp4", ".mov", ".avi", ".webm", ".ts", ".flv", ".wmv", ".m4v"}
+
+// Number of ffmpeg output lines kept to explain a failed transcode
+const transcodeErrorLines = 5
+
+// transcodeFile is a file seen in the watched directory, it is picked up
+// once its size and modification time stopped changing
+type transcodeFile struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+}
+
+// transcodeEncoder returns the encoder for transcoding: the hardware
+// encoder the recorder would pick on this machine if ffmpeg has it, the
+// CPU encoder otherwise
+func transcodeEncoder(log *slog.Logger) string {
+	codec, cpu := "hevc", "libx265"
+	if useH264 {
+		codec, cpu = "h264", "libx264"
+	}
+	encoder := cpu
+	switch {
+	case runtime.GOOS == "darwin":
+		encoder = codec + "_videotoolbox"
+	case hasNvidiaGPU():
+		encoder = codec + "_nvenc"
+	case hasIntelGPU():
+		encoder = codec + "_qsv"
+	case hasAMDGPU():
+		encoder = codec + "_amf"
+	}
+	encoder = encoderFallback(encoder, log)
+	if info := ffmpegCapabilities(); info != nil && !slices.Contains(info.Encoders, encoder) {
+		log.Warn("ffmpeg lacks the hardware encoder, using the CPU", "encoder", encoder, "fallback", cpu)
+		return cpu
+	}
+	return encoder
+}
+
+// transcode re-encodes src into dst with the recorder's encoder settings.
+// The result is written next to dst first, so a cut off file is never
+// taken for a finished one.
+func transcode(ctx context.Context, src, dst string, log *slog.Logger) (string, error) {
+	encoder := transcodeEncoder(log)
+	part := dst + ".part"
+	args := []string{"-hide_banner", "-nostdin", "-nostats", "-loglevel", "error", "-i", src, "-map", "0:v:0"}
+	args = append(args, encoderOptions(encoder, fps, bitrate, log)...)
+	args = append(args, "-f", "matroska", "-y", part)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return encoder, err
+	}
+	if err := cmd.Start(); err != nil {
+		return encoder, err
+	}
+	var last []string
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		line := scanner.Text()
+		log.Debug(line)
+		checkEncoderError(line, log)
+		last = append(last, line)
+		if len(last) > transcodeErrorLines {
+			last = last[1:]
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		os.Remove(part)
+		if ctx.Err() != nil {
+			return encoder, ctx.Err()
+		}
+		if len(last) > 0 {
+			return encoder, fmt.Errorf("%v: %s", err, strings.Join(last, " / "))
+		}
+		return encoder, err
+	}
+	return encoder, os.Rename(part, dst)
+}
+
+// moveAside moves a processed original into a subdirectory of the watched
+// directory, so it is not picked up again
+func moveAside(dir, sub, file string) error {
+	target := filepath.Join(dir, sub)
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return err
+	}
+	return os.Rename(file, filepath.Join(target, filepath.Base(file)))
+}
+
+// runTranscodeWatchCommand re-encodes the videos dropped into a directory
+// with the encoder detection and settings of the recorder, e.g. recordings
+// of other tools or of older releases with other settings
+func runTranscodeWatchCommand(args []string) int {
+	fs := flag.NewFlagSet("transcode-watch", flag.ExitOnError)
+	outputDirFlag := fs.String("output", "", "Directory for the transcoded files (default: transcoded in the watched directory)")
+	h264Flag := fs.Bool("h264", false, "Encode H.264 instead of H.265")
+	fpsFlag := fs.Int("fps", 5, "Frame rate of the transcoded files (default: 5)")
+	bitrateFlag := fs.Int("bitrate", 700, "Video bitrate of the transcoded files in kbit/s (default: 700)")
+	presetFlag := fs.String("preset", "medium", "Speed/quality preset, from ultrafast to veryslow (default: medium)")
+	intervalFlag := fs.Duration("interval", 10*time.Second, "Time between two looks at the directory (default: 10s)")
+	settleFlag := fs.Duration("settle", 30*time.Second, "Only pick up files that did not change for this long, so files still being copied are left alone (default: 30s)")
+	onceFlag := fs.Bool("once", false, "Transcode the files in the directory and exit instead of watching it")
+	envUsage(fs)
+	if err := applyFlagEnv(fs); err != nil {
+		consoleError("%v", err)
+		return 2
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		consoleInfo("Usage: screen-vibe transcode-watch [flags] <dir>")
+		return 2
+	}
+	dir := fs.Arg(0)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		consoleError("%s is not a directory", dir)
+		return 2
+	}
+	out := *outputDirFlag
+	if out == "" {
+		out = filepath.Join(dir, "transcoded")
+	}
+	useH264, fps, bitrate, preset = *h264Flag, *fpsFlag, *bitrateFlag, *presetFlag
+	for _, err := range []error{checkFPS(fps), checkBitrate(bitrate), checkPreset(preset)} {
+		if err != nil {
+			consoleError("%v", err)
+			return 2
+		}
+	}
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		consoleError("ffmpeg is not installed or not in PATH.")
+		return exitFFmpegMissing
+	}
+	if err := os.MkdirAll(out, 0755); err != nil {
+		consoleError("Could not create output directory: %v", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if logFile, err := os.OpenFile(filepath.Join(out, "transcode-watch.log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err == nil {
+		defer logFile.Close()
+		log = slog.New(slog.NewTextHandler(logFile, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+
+	if !*onceFlag {
+		consoleInfo("Watching %s, transcoded files go to %s", dir, out)
+	}
+	seen := map[string]*transcodeFile{}
+	failed := 0
+	for {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			consoleError("Could not read %s: %v", dir, err)
+			return 1
+		}
+		now := time.Now()
+		for _, e := range entries {
+			if e.IsDir() || !slices.Contains(transcodeExtensions, strings.ToLower(filepath.Ext(e.Name()))) {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			src := filepath.Join(dir, e.Name())
+			f := seen[src]
+			if f == nil || f.size != info.Size() || !f.modTime.Equal(info.ModTime()) {
+				seen[src] = &transcodeFile{size: info.Size(), modTime: info.ModTime(), since: now}
+				if !*onceFlag {
+					continue
+				}
+			} else if now.Sub(f.since) < *settleFlag {
+				continue
+			}
+			delete(seen, src)
+
+			dst := filepath.Join(out, strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))+".mkv")
+			if _, err := os.Stat(dst); err == nil {
+				failed++
+				consoleError("Could not transcode %s: %s already exists", e.Name(), dst)
+				if err := moveAside(dir, "failed", src); err != nil {
+					consoleWarn("Could not move %s aside: %v", e.Name(), err)
+				}
+				continue
+			}
+			consoleEvent("Transcoding %s (%s)", e.Name(), formatFileSize(info.Size()))
+			start := time.Now()
+			encoder, err := transcode(ctx, src, dst, log)
+			if err != nil && strings.HasSuffix(encoder, "_nvenc") && nvencUnavailable.Load() {
+				// Out of NVENC sessions, the next try uses the fallback encoder
+				encoder, err = transcode(ctx, src, dst, log)
+			}
+			if errors.Is(err, context.Canceled) {
+				consoleInfo("Stopped, %s is left for the next run", e.Name())
+				return 0
+			}
+			if err != nil {
+				failed++
+				log.Error("Transcode failed", "file", src, "encoder", encoder, "error", err)
+				consoleError("Could not transcode %s: %v", e.Name(), err)
+				if err := moveAside(dir, "failed", src); err != nil {
+					consoleWarn("Could not move %s aside: %v", e.Name(), err)
+				}
+				continue
+			}
+			var size int64
+			if info, err := os.Stat(dst); err == nil {
+				size = info.Size()
+			}
+			log.Info("Transcoded", "file", src, "output", dst, "encoder", encoder, "duration", time.Since(start).Round(time.Second), "size", size)
+			consoleEvent("Transcoded %s with %s in %s: %s -> %s", e.Name(), encoder, time.Since(start).Round(time.Second),
+				formatFileSize(info.Size()), formatFileSize(size))
+			if err := moveAside(dir, "done", src); err != nil {
+				consoleWarn("Could not move %s aside: %v", e.Name(), err)
+			}
+		}
+
+		if *onceFlag {
+			if failed > 0 {
+				return 1
+			}
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-time.After(*intervalFlag):
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// transcribeCommand is the speech-to-text command run on finished segments,
+// {audio} is replaced by a 16 kHz mono WAV file of the segment's audio and
+// {output} by the segment path without extension
+var transcribeCommand string
+
+// errNoAudio is returned for segments recorded without audio
+var errNoAudio = errors.New("the segment has no audio")
+
+// transcribeSegment runs the transcription command on the audio of a
+// finished segment and returns the .vtt or .srt transcript it wrote
+func transcribeSegment(videoFile string) (string, error) {
+	// ffmpeg prints the streams of its input and fails without an output
+	probe, _ := exec.Command("ffmpeg", "-hide_banner", "-i", videoFile).CombinedOutput()
+	if !strings.Contains(string(probe), "Audio:") {
+		return "", errNoAudio
+	}
+
+	wav, err := os.CreateTemp("", "screen-vibe-*.wav")
+	if err != nil {
+		return "", err
+	}
+	wav.Close()
+	defer os.Remove(wav.Name())
+	extract := exec.Command("ffmpeg", "-hide_banner", "-loglevel", "error", "-y", "-i", videoFile,
+		"-map", "0:a:0", "-ac", "1", "-ar", "16000", "-c:a", "pcm_s16le", wav.Name())
+	if out, err := extract.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("could not extract the audio: %v %s", err, strings.TrimSpace(string(out)))
+	}
+
+	base := strings.TrimSuffix(videoFile, filepath.Ext(videoFile))
+	fields := strings.Fields(transcribeCommand)
+	for i, f := range fields {
+		f = strings.ReplaceAll(f, "{audio}", wav.Name())
+		fields[i] = strings.ReplaceAll(f, "{output}", base)
+	}
+	if out, err := exec.Command(fields[0], fields[1:]...).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("%s: %v %s", fields[0], err, strings.TrimSpace(string(out)))
+	}
+
+	for _, ext := range []string{".vtt", ".srt"} {
+		if _, err := os.Stat(base + ext); err == nil {
+			return base + ext, nil
+		}
+	}
+	return "", fmt.Errorf("%s wrote no %s.vtt or %s.srt", fields[0], base, base)
+}
+
+// subtitleCue is a line of a transcript with its start time
+type subtitleCue struct {
+	start string
+	text  string
+}
+
+// readSubtitleCues reads the cues of a WebVTT or SRT file
+func readSubtitleCues(path string) ([]subtitleCue, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cues []subtitleCue
+	var cue *subtitleCue
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.Contains(line, "-->"):
+			start, _, _ := strings.Cut(line, "-->")
+			cues = append(cues, subtitleCue{start: strings.TrimSpace(start)})
+			cue = &cues[len(cues)-1]
+		case line == "":
+			cue = nil
+		case cue != nil:
+			cue.text = strings.TrimSpace(cue.text + " " + line)
+		}
+	}
+	return cues, scanner.Err()
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"log/slog"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Still of the screen that ffmpeg replaces at every -ui-check, beside
+	// the catalog
+	uiStillName = ".ui-check.png"
+	// Directory the stills of deviating screens are kept in
+	uiAlertsDirName = "ui-alerts"
+	// Width of the still, enough for the hash and small to decode
+	uiStillWidth = 320
+	// Consecutive deviating stills before an alert, so a screen in the
+	// middle of a transition does not raise one
+	uiDeviationStills = 2
+	// Brightness range of a screen that shows nothing, out of 255
+	uiBlankRange = 8
+	// Difference hash grid: every cell is compared with its right neighbor,
+	// than which it has to be this much brighter to count
+	uiHashWidth  = 16
+	uiHashHeight = 16
+	uiHashMargin = 2
+)
+
+// Global variables for the UI diff alerts
+var uiReferences []uiReference
+var uiCheckInterval time.Duration
+var uiDiffPercent int
+
+// uiReference is an image of what the screen should show
+type uiReference struct {
+	path string
+	hash uiHash
+}
+
+// uiHash is the difference hash of a picture, with the brightness range of
+// its grid to tell a blank screen
+type uiHash struct {
+	bits  [uiHashWidth * uiHashHeight / 64]uint64
+	blank bool
+}
+
+// uiWatchState is what the last stills showed, kept over segments so a
+// deviation is reported once until the screen is restored
+var uiWatchState struct {
+	sync.Mutex
+	deviating int       // consecutive deviating stills
+	since     time.Time // time of the first of them
+	alerted   bool      // an alert was sent and the screen was not restored since
+}
+
+// loadUIReference reads a reference image for -ui-reference, a PNG or JPEG
+// screenshot of the expected screen
+func loadUIReference(path string) (uiReference, error) {
+	hash, err := hashImageFile(path)
+	if err != nil {
+		return uiReference{}, err
+	}
+	if hash.blank {
+		return uiReference{}, fmt.Errorf("%s shows a blank screen", path)
+	}
+	return uiReference{path: path, hash: hash}, nil
+}
+
+// hashImageFile decodes an image and returns its difference hash
+func hashImageFile(path string) (uiHash, error) {
+	img, err := decodeImage(path)
+	if err != nil {
+		return uiHash{}, err
+	}
+	return hashImage(img), nil
+}
+
+// decodeImage reads a PNG or JPEG image
+func decodeImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", path, err)
+	}
+	return img, nil
+}
+
+// luma returns the brightness of a pixel, read from the luma plane of
+// JPEG images instead of converting their colors
+func luma(img image.Image, x, y int) uint8 {
+	if yc, ok := img.(*image.YCbCr); ok {
+		return yc.Y[yc.YOffset(x, y)]
+	}
+	return color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+}
+
+// hashImage averages the brightness of a grid of cells over the picture
+// and sets a bit for every cell that is brighter than its right neighbor.
+// Pictures that look the same get the same bits, whatever their size and
+// however they were compressed.
+func hashImage(img image.Image) uiHash {
+	b := img.Bounds()
+	var sums [uiHashHeight][uiHashWidth + 1]uint64
+	var counts [uiHashHeight][uiHashWidth + 1]uint64
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := (y - b.Min.Y) * uiHashHeight / b.Dy()
+		for x := b.Min.X; x < b.Max.X; x++ {
+			col := (x - b.Min.X) * (uiHashWidth + 1) / b.Dx()
+			sums[row][col] += uint64(luma(img, x, y))
+			counts[row][col]++
+		}
+	}
+
+	var h uiHash
+	lowest, highest := uint64(255), uint64(0)
+	for row := range uiHashHeight {
+		for col := range uiHashWidth + 1 {
+			if counts[row][col] == 0 {
+				continue
+			}
+			sums[row][col] /= counts[row][col]
+			lowest, highest = min(lowest, sums[row][col]), max(highest, sums[row][col])
+		}
+		for col := range uiHashWidth {
+			if sums[row][col] > sums[row][col+1]+uiHashMargin {
+				i := row*uiHashWidth + col
+				h.bits[i/64] |= 1 << (i % 64)
+			}
+		}
+	}
+	h.blank = highest-lowest < uiBlankRange
+	return h
+}
+
+// diffPercent returns the share of the bits in which two hashes differ
+func (h uiHash) diffPercent(other uiHash) int {
+	n := 0
+	for i := range h.bits {
+		n += bits.OnesCount64(h.bits[i] ^ other.bits[i])
+	}
+	return n * 100 / (uiHashWidth * uiHashHeight)
+}
+
+// watchesUI reports whether the screen is compared against -ui-reference
+// images or verified for -signage
+func watchesUI() bool {
+	return len(uiReferences) > 0 || signage != nil
+}
+
+// uiStillPath returns the still ffmpeg writes for the UI diff alerts
+func uiStillPath() string {
+	return filepath.Join(outputDir, uiStillName)
+}
+
+// uiWatchArgs returns the ffmpeg output of the stills for -ui-reference and
+// -signage and splits the video of the filter graph for it, the same way
+// reviewArgs does. The still of -ui-reference is replaced in place, one
+// every -ui-check; -signage keeps the stills at the size of the screen,
+// named after the time they were taken.
+func uiWatchArgs(a *ffmpegArgs) []string {
+	still := fmt.Sprintf("fps=1/%g,scale=%d:-2", uiCheckInterval.Seconds(), uiStillWidth)
+	target := []string{"-update", "1", "-atomic_writing", "1", uiStillPath()}
+	if signage != nil {
+		still = fmt.Sprintf("fps=1/%g", uiCheckInterval.Seconds())
+		target = []string{"-strftime", "1", "-atomic_writing", "1", "-q:v", "3",
+			filepath.Join(signageDir(), "%Y-%m-%d_%H-%M-%S.jpg")}
+	}
+	args := []string{"-map", "0:v", "-vf", still}
+	if len(a.filter) >= 4 && a.filter[0] == "-filter_complex" && a.filter[2] == "-map" {
+		a.filter[1] += fmt.Sprintf(";%ssplit[sv_ui_record][sv_ui_in];[sv_ui_in]%s[sv_ui]", a.filter[3], still)
+		a.filter[3] = "[sv_ui_record]"
+		args = []string{"-map", "[sv_ui]"}
+	}
+	args = append(args, "-an", "-f", "image2")
+	return append(args, target...)
+}
+
+// currentUIStill returns the latest still ffmpeg wrote and when
+func currentUIStill() (string, time.Time, error) {
+	if signage != nil {
+		return latestSignageStill()
+	}
+	info, err := os.Stat(uiStillPath())
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return uiStillPath(), info.ModTime(), nil
+}
+
+// watchUI compares the stills of a segment against the -ui-reference
+// images and the -signage markers until finished is closed. A screen that
+// matches none of the references or misses a marker for uiDeviationStills
+// stills in a row, like a crash dialog or a blank screen, raises an alert;
+// the still is kept in output/ui-alerts.
+func watchUI(segmentStart time.Time, finished chan struct{}, log *slog.Logger) {
+	ticker := time.NewTicker(checkInterval * time.Second)
+	defer ticker.Stop()
+	var checked time.Time
+	for {
+		select {
+		case <-finished:
+			return
+		case <-ticker.C:
+		}
+		// Stills of an earlier segment were removed when it started, a
+		// still older than the segment is left from a crash. Signage stills
+		// are named to the second.
+		still, taken, err := currentUIStill()
+		if err != nil || taken.Before(segmentStart.Truncate(time.Second)) || !taken.After(checked) {
+			continue
+		}
+		checked = taken
+		img, err := decodeImage(still)
+		if err != nil {
+			log.Debug("Could not check the screen", "error", err)
+			continue
+		}
+		checkUIStill(still, img, taken, log)
+		if signage != nil {
+			pruneSignageStills(taken)
+		}
+	}
+}
+
+// checkUIStill compares a still taken at t against the references and
+// markers and alerts or reports the restored screen
+func checkUIStill(still string, img image.Image, t time.Time, log *slog.Logger) {
+	hash := hashImage(img)
+	closest, diff := "", 0
+	if len(uiReferences) > 0 {
+		diff = 100
+	}
+	for _, ref := range uiReferences {
+		if d := ref.hash.diffPercent(hash); d < diff {
+			closest, diff = ref.path, d
+		}
+	}
+	var missing []string
+	if signage != nil && !hash.blank {
+		missing = missingMarkers(still, img)
+	}
+	deviation := ""
+	switch {
+	case hash.blank:
+		deviation = "the screen is blank"
+	case diff > uiDiffPercent:
+		deviation = fmt.Sprintf("the screen differs by %d%% from %s", diff, filepath.Base(closest))
+	case len(missing) > 0:
+		deviation = "the screen does not show " + strings.Join(missing, ", ")
+		closest = strings.Join(missing, ",")
+	}
+	log.Debug("Checked the screen", "reference", closest, "diff", diff, "blank", hash.blank, "missing", missing)
+
+	uiWatchState.Lock()
+	defer uiWatchState.Unlock()
+	if deviation == "" {
+		uiWatchState.deviating = 0
+		if uiWatchState.alerted {
+			uiWatchState.alerted = false
+			expected := "the expected content"
+			if closest != "" {
+				expected = filepath.Base(closest)
+			}
+			consoleEvent("The screen shows %s again", expected)
+			emitStatus(statusEvent{Event: "restored", Time: t, Label: closest})
+			notifyUI(fmt.Sprintf("[screen-vibe] Screen restored on %s", machineName()),
+				fmt.Sprintf("The screen of %s shows %s again since %s.", machineName(), expected, t.Format("2006-01-02 15:04:05")))
+		}
+		return
+	}
+	if uiWatchState.deviating == 0 {
+		uiWatchState.since = t
+	}
+	uiWatchState.deviating++
+	if uiWatchState.alerted || uiWatchState.deviating < uiDeviationStills {
+		return
+	}
+	uiWatchState.alerted = true
+
+	message := fmt.Sprintf("Since %s %s", uiWatchState.since.Format("2006-01-02 15:04:05"), deviation)
+	if signage != nil {
+		message += ", the still is " + still
+	} else if kept, err := keepUIStill(t); err != nil {
+		log.Warn("Could not keep the still of the screen", "error", err)
+	} else {
+		message += ", the still is " + kept
+	}
+	consoleWarn("%s", message)
+	log.Warn("The screen deviates from what it should show", "reason", deviation, "diff", diff)
+	emitStatus(statusEvent{Event: "deviated", Time: t, Label: closest, Message: deviation})
+	notifyUI(fmt.Sprintf("[screen-vibe] Unexpected screen on %s", machineName()),
+		fmt.Sprintf("The screen of %s does not show what it should: %s.", machineName(), message))
+}
+
+// keepUIStill copies the current still to output/ui-alerts, named after t
+func keepUIStill(t time.Time) (string, error) {
+	data, err := os.ReadFile(uiStillPath())
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(outputDir, uiAlertsDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	kept := filepath.Join(dir, t.Format("2006-01-02_15-04-05")+".png")
+	return kept, os.WriteFile(kept, data, 0644)
+}
+
+// notifyUI sends a UI diff alert to the extensions and by email
+func notifyUI(subject, message string) {
+	extensionsNotify(subject, message)
+	if !emailEnabled() {
+		return
+	}
+	go func() {
+		if err := sendEmail(subject, message+"\n"); err != nil {
+			consoleWarn("Could not send alert email: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// Environment variable that hands the recorder state to the new binary
+const upgradeStateEnv = "SCREEN_VIBE_UPGRADE_STATE"
+
+// upgradeRequests asks the recording session to finish the segment and
+// restart the recorder from its binary
+var upgradeRequests = make(chan struct{}, 1)
+
+// upgradeRequested is set once the recorder stops to upgrade
+var upgradeRequested atomic.Bool
+
+// upgradeBlocker names what keeps the recorder from upgrading in place,
+// like a recorded command that would lose its recorder
+var upgradeBlocker string
+
+// upgradeState is the recorder state kept across an upgrade
+type upgradeState struct {
+	Hold     string `json:"hold,omitempty"`
+	LastFile string `json:"last_file,omitempty"`
+	FPS      int32  `json:"policy_fps,omitempty"`
+}
+
+// requestUpgrade finishes the current segment and restarts the recorder
+// from its binary, which may have been replaced by a new version
+func requestUpgrade() error {
+	if upgradeBlocker != "" {
+		return fmt.Errorf("cannot upgrade while recording %s, restart the recorder instead", upgradeBlocker)
+	}
+	if !upgradeSupported {
+		return errors.New("upgrading in place is not supported on this system, restart the recorder instead")
+	}
+	select {
+	case upgradeRequests <- struct{}{}:
+		return nil
+	default:
+		return errors.New("an upgrade is already pending")
+	}
+}
+
+// execUpgrade replaces the recorder with its binary, started with the same
+// arguments and process ID, so service managers do not notice the upgrade
+func execUpgrade() error {
+	program, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	state := upgradeState{Hold: recorderHold(), FPS: policyFPS.Load()}
+	if last := lastSegmentFile.Load(); last != nil {
+		state.LastFile = *last
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	os.Setenv(upgradeStateEnv, string(data))
+
+	consoleInfo("Starting %s", program)
+	stopControlServer()
+	return execProgram(program, os.Args, os.Environ())
+}
+
+// restoreUpgradeState takes over the state of the recorder that upgraded
+// to this binary, if any
+func restoreUpgradeState() {
+	data, ok := os.LookupEnv(upgradeStateEnv)
+	if !ok {
+		return
+	}
+	os.Unsetenv(upgradeStateEnv)
+	var state upgradeState
+	if err := json.Unmarshal([]byte(data), &state); err != nil {
+		consoleWarn("Could not restore the state from before the upgrade: %v", err)
+		return
+	}
+	holdState.Store(state.Hold)
+	if state.LastFile != "" {
+		lastSegmentFile.Store(&state.LastFile)
+	}
+	policyFPS.Store(state.FPS)
+	consoleInfo("Upgraded in place, recording continues")
+	if state.Hold != "" {
+		consoleInfo("Recording stays %s until it is started again (ctl start)", state.Hold)
+	}
+}
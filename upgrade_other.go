@@ -0,0 +1,30 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// upgradeSupported is set when the recorder can replace itself in place
+const upgradeSupported = true
+
+// watchUpgradeSignal upgrades the recorder on SIGUSR2
+func watchUpgradeSignal() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR2)
+	go func() {
+		for range sigs {
+			if err := requestUpgrade(); err != nil {
+				consoleWarn("Ignoring SIGUSR2: %v", err)
+			}
+		}
+	}()
+}
+
+// execProgram replaces the process with program
+func execProgram(program string, args, env []string) error {
+	return syscall.Exec(program, args, env)
+}
@@ -0,0 +1,16 @@
+package main
+
+import "errors"
+
+// upgradeSupported is set when the recorder can replace itself in place.
+// Windows cannot replace a running process, service managers like NSSM
+// restart the recorder instead.
+const upgradeSupported = false
+
+// watchUpgradeSignal does nothing, Windows has no SIGUSR2
+func watchUpgradeSignal() {}
+
+// execProgram is not available on Windows
+func execProgram(program string, args, env []string) error {
+	return errors.New("not supported on Windows")
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Name of the focus log inside the output directory
+const focusLogFileName = "focus.jsonl"
+
+// focusPeriod is a time an application had the focus, one line of the
+// focus log
+type focusPeriod struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	App   string    `json:"app"`
+	Title string    `json:"title,omitempty"`
+}
+
+// focusLogMu serializes writes to the focus log
+var focusLogMu sync.Mutex
+
+// appendFocusPeriod adds a finished focus period to the focus log
+func appendFocusPeriod(p focusPeriod) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	focusLogMu.Lock()
+	defer focusLogMu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(outputDir, focusLogFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// readFocusLog returns all focus periods of the focus log
+func readFocusLog() ([]focusPeriod, error) {
+	path := filepath.Join(outputDir, focusLogFileName)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var periods []focusPeriod
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var p focusPeriod
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil {
+			return periods, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		periods = append(periods, p)
+	}
+	return periods, scanner.Err()
+}
+
+// appUsage is the time an application had the focus on a day
+type appUsage struct {
+	Date    string  `json:"date"`
+	App     string  `json:"app"`
+	Seconds float64 `json:"seconds"`
+}
+
+// summarizeUsage sums up the focus time per application and local day,
+// splitting periods at midnight. Days are sorted, applications by time.
+func summarizeUsage(periods []focusPeriod, since time.Time) []appUsage {
+	totals := map[[2]string]time.Duration{}
+	for _, p := range periods {
+		start, end := p.Start.Local(), p.End.Local()
+		if start.Before(since) {
+			start = since
+		}
+		app := p.App
+		if app == "" {
+			app = "(unknown)"
+		}
+		for start.Before(end) {
+			y, m, d := start.Date()
+			midnight := time.Date(y, m, d+1, 0, 0, 0, 0, start.Location())
+			to := end
+			if midnight.Before(end) {
+				to = midnight
+			}
+			totals[[2]string{start.Format("2006-01-02"), app}] += to.Sub(start)
+			start = to
+		}
+	}
+
+	usage := make([]appUsage, 0, len(totals))
+	for k, d := range totals {
+		usage = append(usage, appUsage{Date: k[0], App: k[1], Seconds: d.Round(time.Second).Seconds()})
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Date != usage[j].Date {
+			return usage[i].Date < usage[j].Date
+		}
+		if usage[i].Seconds != usage[j].Seconds {
+			return usage[i].Seconds > usage[j].Seconds
+		}
+		return usage[i].App < usage[j].App
+	})
+	return usage
+}
+
+// runUsageCommand prints the time per application and day from the focus
+// log written with -focus-subtitles
+func runUsageCommand(args []string) int {
+	fs := flag.NewFlagSet("usage", flag.ExitOnError)
+	formatFlag := fs.String("format", "table", "Output format: table, json or csv")
+	daysFlag := fs.Int("days", 0, "Only include the last N days (default: all)")
+	outputDirFlag := fs.String("output", outputDir, "Directory that holds the focus log")
+	envUsage(fs)
+	if err := applyFlagEnv(fs); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	fs.Parse(args)
+	outputDir = *outputDirFlag
+
+	periods, err := readFocusLog()
+	if err != nil {
+		if os.IsNotExist(err) {
+			consoleError("No focus log in %s, record with -focus-subtitles first", outputDir)
+		} else {
+			consoleError("Could not read the focus log: %v", err)
+		}
+		return 1
+	}
+	var since time.Time
+	if *daysFlag > 0 {
+		y, m, d := time.Now().Date()
+		since = time.Date(y, m, d-*daysFlag+1, 0, 0, 0, 0, time.Local)
+	}
+	usage := summarizeUsage(periods, since)
+
+	switch *formatFlag {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(usage)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"date", "app", "seconds"})
+		for _, u := range usage {
+			w.Write([]string{u.Date, u.App, strconv.FormatFloat(u.Seconds, 'f', 0, 64)})
+		}
+		w.Flush()
+	case "table":
+		date := ""
+		for _, u := range usage {
+			if u.Date != date {
+				date = u.Date
+				fmt.Println(date)
+			}
+			fmt.Printf("  %10s  %s\n", time.Duration(u.Seconds)*time.Second, u.App)
+		}
+	default:
+		consoleError("Unknown format %q, use table, json or csv", *formatFlag)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Timeout of the connection checks of validate -network
+const validateDialTimeout = 5 * time.Second
+
+// checkPipeline runs the recorder of a pipeline with -check, which checks
+// its flags like at startup without recording, and returns the problems
+func checkPipeline(program string, p pipelineConfig) []string {
+	// English messages, so the errors can be told from other output
+	cmd := exec.Command(program, append(p.args(), "-check", "-lang=en")...)
+	cmd.Env = os.Environ()
+	for k, v := range p.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+
+	// The recorder prints an error, or the flag package a usage message
+	var problems []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if msg, ok := strings.CutPrefix(line, "Error: "); ok {
+			problems = append(problems, msg)
+		} else if strings.HasPrefix(line, "invalid value") || strings.HasPrefix(line, "flag provided but not defined") {
+			problems = append(problems, line)
+		}
+	}
+	if len(problems) == 0 {
+		problems = append(problems, fmt.Sprintf("the recorder rejected the flags: %v", err))
+	}
+	return problems
+}
+
+// checkPipelineNetwork checks that the SMTP server of a pipeline accepts
+// connections
+func checkPipelineNetwork(p pipelineConfig) []string {
+	server := p.Flags["smtp"]
+	if server == "" {
+		return nil
+	}
+	conn, err := net.DialTimeout("tcp", server, validateDialTimeout)
+	if err != nil {
+		return []string{fmt.Sprintf("SMTP server %s is not reachable: %v", server, err)}
+	}
+	conn.Close()
+	return nil
+}
+
+// runValidateCommand checks a supervisor configuration: unknown keys,
+// invalid or incompatible recorder flags and, with -network, whether the
+// servers the pipelines send to are reachable. It exits non-zero if there
+// are problems, for CI of configuration repositories.
+func runValidateCommand(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	configFlag := fs.String("config", "", "YAML file with the pipelines, as used by the supervisor command")
+	networkFlag := fs.Bool("network", false, "Also check that SMTP servers accept connections")
+	fs.Parse(args)
+
+	if *configFlag == "" {
+		consoleError("Usage: screen-vibe validate [-network] -config fleet.yaml")
+		return 2
+	}
+	config, err := loadFleetConfig(*configFlag)
+	if err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	program, err := os.Executable()
+	if err != nil {
+		consoleError("Could not find the screen-vibe executable: %v", err)
+		return 1
+	}
+
+	failed := 0
+	for _, p := range config.Pipelines {
+		problems := checkPipeline(program, p)
+		if *networkFlag {
+			problems = append(problems, checkPipelineNetwork(p)...)
+		}
+		if len(problems) == 0 {
+			fmt.Printf("%s: ok\n", p.Name)
+			continue
+		}
+		failed++
+		var b bytes.Buffer
+		for _, problem := range problems {
+			fmt.Fprintf(&b, "  %s\n", problem)
+		}
+		fmt.Printf("%s: invalid\n%s", p.Name, b.String())
+	}
+	if failed > 0 {
+		consoleError("%d of %d pipelines in %s are invalid", failed, len(config.Pipelines), *configFlag)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+
+	"screen-vibe/extension"
+)
+
+// Encoders and muxers the recorder can use, reported if ffmpeg has them
+var (
+	knownEncoders = []string{
+		"libx264", "libx265",
+		"h264_nvenc", "hevc_nvenc",
+		"h264_qsv", "hevc_qsv",
+		"h264_amf", "hevc_amf",
+		"h264_videotoolbox", "hevc_videotoolbox",
+		"h264_vaapi", "hevc_vaapi",
+	}
+	knownMuxers = []string{"matroska", "mpegts", "rtp_mpegts", "rtp", "tee", "v4l2"}
+)
+
+// versionInfo is the output of the version command
+type versionInfo struct {
+	Version    string            `json:"version"`
+	Commit     string            `json:"commit,omitempty"`
+	CommitTime string            `json:"commit_time,omitempty"`
+	Modified   bool              `json:"modified,omitempty"`
+	GoVersion  string            `json:"go_version"`
+	Platform   string            `json:"platform"`
+	Backends   map[string]string `json:"backends"`
+	Features   []string          `json:"features"`
+	Extensions []string          `json:"extensions"`
+	FFmpeg     *ffmpegInfo       `json:"ffmpeg"` // null without ffmpeg
+}
+
+// ffmpegInfo describes the capabilities of the ffmpeg in the PATH
+type ffmpegInfo struct {
+	Path     string   `json:"path"`
+	Version  string   `json:"version"`
+	Encoders []string `json:"encoders"`
+	Muxers   []string `json:"muxers"`
+	GPUs     []string `json:"gpus"`
+}
+
+// platformBackends returns how this build reads the system state on the
+// current platform
+func platformBackends() map[string]string {
+	switch runtime.GOOS {
+	case "windows":
+		return map[string]string{"capture": "gdigrab", "idle": "GetLastInputInfo", "focus": "GetForegroundWindow", "session": "WTS", "control": "named pipe"}
+	case "darwin":
+		return map[string]string{"capture": "avfoundation", "idle": "ioreg HIDIdleTime", "focus": "osascript", "control": "unix socket"}
+	case "linux":
+		return map[string]string{"capture": "x11grab, screen cast portal, kmsgrab", "idle": "xprintidle, Mutter IdleMonitor", "focus": "xprop", "suspend": "logind", "dbus": "session bus", "control": "unix socket"}
+	}
+	return map[string]string{"capture": "x11grab", "focus": "xprop", "control": "unix socket"}
+}
+
+// buildFeatures returns the optional features of this build
+func buildFeatures() []string {
+	features := []string{"policy", "supervisor", "catalog-encryption", "status-json"}
+	if upgradeSupported {
+		features = append(features, "upgrade")
+	}
+	if updateURL != "" && updatePublicKey != "" {
+		features = append(features, "self-update")
+	}
+	return features
+}
+
+// ffmpegCapabilities asks ffmpeg for its version and the encoders and
+// muxers the recorder can use, nil if there is no ffmpeg
+func ffmpegCapabilities() *ffmpegInfo {
+	path, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return nil
+	}
+	info := &ffmpegInfo{Path: path, Encoders: []string{}, Muxers: []string{}, GPUs: []string{}}
+	if out, err := exec.Command("ffmpeg", "-hide_banner", "-version").Output(); err == nil {
+		info.Version, _, _ = strings.Cut(string(out), "\n")
+		info.Version = strings.TrimSpace(info.Version)
+	}
+
+	// Lines look like " V....D libx264   description" and " E  matroska  description"
+	listed := func(flag string, known []string) []string {
+		found := []string{}
+		out, err := exec.Command("ffmpeg", "-hide_banner", flag).Output()
+		if err != nil {
+			return found
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 && slices.Contains(known, fields[1]) && !slices.Contains(found, fields[1]) {
+				found = append(found, fields[1])
+			}
+		}
+		return found
+	}
+	info.Encoders = listed("-encoders", knownEncoders)
+	info.Muxers = listed("-muxers", knownMuxers)
+
+	if hasNvidiaGPU() {
+		info.GPUs = append(info.GPUs, "nvidia")
+	}
+	if hasIntelGPU() {
+		info.GPUs = append(info.GPUs, "intel")
+	}
+	if hasAMDGPU() {
+		info.GPUs = append(info.GPUs, "amd")
+	}
+	return info
+}
+
+// currentVersionInfo collects the build information and capabilities
+func currentVersionInfo() versionInfo {
+	info := versionInfo{
+		Version:    version,
+		GoVersion:  runtime.Version(),
+		Platform:   runtime.GOOS + "/" + runtime.GOARCH,
+		Backends:   platformBackends(),
+		Features:   buildFeatures(),
+		Extensions: []string{},
+		FFmpeg:     ffmpegCapabilities(),
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range build.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Commit = s.Value
+			case "vcs.time":
+				info.CommitTime = s.Value
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	for _, ext := range extension.Registered() {
+		info.Extensions = append(info.Extensions, ext.Name())
+	}
+	return info
+}
+
+// runVersionCommand prints the build information and capabilities, as
+// JSON for inventory tools and bug reports
+func runVersionCommand(args []string) int {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	jsonFlag := fs.Bool("json", false, "Print the version information as JSON")
+	fs.Parse(args)
+
+	info := currentVersionInfo()
+	if *jsonFlag {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(info)
+		return 0
+	}
+
+	fmt.Printf("screen-vibe %s (%s, %s)\n", info.Version, info.GoVersion, info.Platform)
+	if info.Commit != "" {
+		modified := ""
+		if info.Modified {
+			modified = ", modified"
+		}
+		fmt.Printf("Commit:     %s (%s%s)\n", info.Commit, info.CommitTime, modified)
+	}
+	backends := make([]string, 0, len(info.Backends))
+	for name, backend := range info.Backends {
+		backends = append(backends, name+": "+backend)
+	}
+	slices.Sort(backends)
+	fmt.Printf("Backends:   %s\n", strings.Join(backends, "; "))
+	fmt.Printf("Features:   %s\n", strings.Join(info.Features, ", "))
+	if len(info.Extensions) > 0 {
+		fmt.Printf("Extensions: %s\n", strings.Join(info.Extensions, ", "))
+	}
+	if info.FFmpeg == nil {
+		fmt.Println("ffmpeg:     not found in PATH")
+		return 0
+	}
+	fmt.Printf("ffmpeg:     %s (%s)\n", info.FFmpeg.Version, info.FFmpeg.Path)
+	fmt.Printf("Encoders:   %s\n", strings.Join(info.FFmpeg.Encoders, ", "))
+	fmt.Printf("Muxers:     %s\n", strings.Join(info.FFmpeg.Muxers, ", "))
+	if len(info.FFmpeg.GPUs) > 0 {
+		fmt.Printf("GPUs:       %s\n", strings.Join(info.FFmpeg.GPUs, ", "))
+	}
+	return 0
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// Environment variable with the password of the view command, reviewers
+	// log in with any user name, which goes to the access log
+	viewPasswordEnv = "SCREEN_VIBE_VIEW_PASSWORD"
+	// Time open requests get when the view command stops
+	viewShutdownTimeout = 5 * time.Second
+)
+
+// viewPage lists the segments of the catalog with links to their files, in
+// the language of the reader
+var viewPage = template.Must(template.New("view").Funcs(template.FuncMap{
+	"size":     formatFileSize,
+	"time":     func(t time.Time) string { return t.Local().Format("2006-01-02 15:04:05") },
+	"duration": func(e catalogEntry) time.Duration { return e.End.Sub(e.Start).Round(time.Second) },
+	"join":     strings.Join,
+	"inactive": activitySpans,
+}).Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<title>screen-vibe: {{.Dir}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+table { border-collapse: collapse; }
+th, td { padding: 0.2em 0.6em; text-align: left; vertical-align: top; border-bottom: 1px solid #ddd; }
+td.note { color: #555; font-size: 0.9em; }
+form.tag { display: inline; }
+svg.activity { width: 10em; height: 0.8em; vertical-align: middle; }
+svg.activity .active { fill: #3a3; }
+svg.activity .inactive { fill: #ccc; }
+</style>
+</head>
+<body>
+<h1>{{.Dir}}</h1>
+<p>{{if .Annotate}}{{printf (.T "%d segments") (len .Entries)}}{{.T ", tags and notes go to the annotation log"}}{{else}}{{printf (.T "%d segments, read-only") (len .Entries)}}{{end}}{{if .AccessLog}}{{.T ", downloads go to the access log"}}{{end}} · <a href="/coverage">{{.T "Coverage"}}</a></p>
+<table>
+<tr><th>{{.T "Start"}}</th><th>{{.T "Duration"}}</th><th>{{.T "Size"}}</th><th>{{.T "User"}}</th><th>{{.T "Display"}}</th><th>{{.T "Activity"}}</th><th>{{.T "File"}}</th><th>{{.T "Tags"}}</th></tr>
+{{range .Entries}}<tr>
+<td>{{time .Start}}</td><td>{{duration .}}</td><td>{{size .Size}}</td><td>{{.User}}</td><td>{{.Display}}</td>
+<td>{{if .Activity}}<svg class="activity" viewBox="0 0 100 1" preserveAspectRatio="none"><rect class="active" width="100" height="1"/>
+{{range inactive .}}<rect class="inactive" x="{{.From}}" width="{{.Width}}" height="1"><title>{{printf ($.T "inactive from %s to %s") .Start .End}}</title></rect>
+{{end}}</svg> {{printf ($.T "%.0f%% active") .Activity.ActivePercent}}{{end}}</td>
+<td>{{if .Storage}}{{.File}} {{printf ($.T "(recorded to %s)") .Storage}}{{else if .Lost}}{{.File}} {{$.T "(lost)"}}{{else}}<a href="/files/{{.File}}">{{.File}}</a>{{if .Remote}} {{$.T "(in cold storage)"}}{{end}}{{end}}
+{{if .Log}} <a href="/files/{{.Log}}">{{$.T "log"}}</a>{{end}}{{if .Transcript}} <a href="/files/{{.Transcript}}">{{$.T "transcript"}}</a>{{end}}</td>
+<td>{{if $.Annotate}}{{$file := .File}}{{range .Tags}}<form class="tag" method="post" action="/annotate"><input type="hidden" name="file" value="{{$file}}"><input type="hidden" name="return" value="{{$.Query}}">{{.}} <button name="untag" value="{{.}}" title="{{$.T "Remove the tag"}}">×</button></form> {{end}}
+<form method="post" action="/annotate"><input type="hidden" name="file" value="{{.File}}"><input type="hidden" name="return" value="{{$.Query}}">
+<input name="tag" size="8" placeholder="{{$.T "tag"}}"> <input name="note" size="16" placeholder="{{$.T "note"}}"> <button>{{$.T "Add"}}</button></form>
+{{else}}{{join .Tags ", "}}{{end}}{{if .Hold}} <b>{{$.T "legal hold"}}</b>{{end}}</td>
+</tr>
+{{range .Notes}}<tr><td></td><td class="note" colspan="7">{{time .Time}} {{.User}}: {{.Text}}</td></tr>
+{{end}}{{end}}</table>
+</body>
+</html>
+`))
+
+// coveragePage shows the recorded time per day and hour as a calendar, each
+// hour links to its segments
+var coveragePage = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<title>screen-vibe: {{.Dir}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+table { border-collapse: collapse; }
+th { font-weight: normal; font-size: 0.8em; color: #555; padding: 0 0.4em; text-align: left; }
+td { padding: 0; border: 2px solid #fff; }
+td a { display: block; width: 1.4em; height: 1.4em; }
+td.total { padding-left: 0.6em; font-size: 0.9em; }
+.l0 { background: #eee; } .l1 { background: #c6e48b; } .l2 { background: #7bc96f; } .l3 { background: #239a3b; }
+</style>
+</head>
+<body>
+<h1>{{.Dir}}</h1>
+<p>{{printf (.T "Recorded time per hour of the last %d days") (len .Days)}} · <a href="/">{{.T "Segments"}}</a></p>
+<table>
+<tr><th></th>{{range $h, $_ := (index .Days 0).Hours}}<th>{{printf "%02d" $h}}</th>{{end}}<th></th></tr>
+{{range .Days}}{{$day := .Day.Format "2006-01-02"}}<tr><th><a href="/?day={{$day}}">{{$.T .Weekday}} {{$day}}</a></th>
+{{range .Hours}}<td class="l{{.Level}}"><a href="/?day={{$day}}&amp;hour={{.Hour}}" title="{{printf "%02d:00" .Hour}} {{printf ($.T "%s recorded") .Recorded}}"></a></td>{{end}}
+<td class="total">{{.Total}}</td></tr>
+{{end}}</table>
+<p><span class="l0">&nbsp;&nbsp;&nbsp;</span> {{.T "none"}} <span class="l1">&nbsp;&nbsp;&nbsp;</span> {{.T "less than half"}} <span class="l2">&nbsp;&nbsp;&nbsp;</span> {{.T "more than half"}} <span class="l3">&nbsp;&nbsp;&nbsp;</span> {{.T "full"}}</p>
+</body>
+</html>
+`))
+
+// viewHandler serves the catalog and the files of an output directory
+// without any way to change them. Downloads are added to the access log
+// unless noAccessLog is set. With annotations, the page has a form to tag
+// segments and add notes to them.
+type viewHandler struct {
+	password    string
+	noAccessLog bool
+	annotations bool
+}
+
+// newViewHandler returns the read-only handler of the view command, at /
+// the catalog page, at /coverage the coverage calendar, at /recordings the
+// catalog as JSON and at /files/ the files the catalog lists. With
+// annotate, POST /annotate tags segments and adds notes to them. It refuses
+// requests for other host names than the one of listen, like the -listen
+// API.
+func newViewHandler(password, listen string, accessLog, annotate bool) http.Handler {
+	h := &viewHandler{password: password, noAccessLog: !accessLog, annotations: annotate}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", h.page)
+	mux.HandleFunc("GET /coverage", h.coverage)
+	mux.HandleFunc("GET /recordings", h.recordings)
+	mux.HandleFunc("GET /files/{file...}", h.file)
+	if annotate {
+		mux.HandleFunc("POST /annotate", h.annotate)
+	}
+	return restrictHost(listen, h.authenticate(mux))
+}
+
+// authenticate asks for the password with HTTP basic authentication, if
+// there is one
+func (h *viewHandler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.password != "" {
+			_, password, ok := r.BasicAuth()
+			if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(h.password)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="screen-vibe"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// entries reads the catalog with its annotations and applies the filters
+// of the query: days, user, tag and held, like the catalog command, and the
+// day and hour of the coverage page
+func (h *viewHandler) entries(r *http.Request) ([]catalogEntry, error) {
+	entries, err := readAnnotatedCatalog()
+	if err != nil {
+		return nil, err
+	}
+	q := r.URL.Query()
+	var since time.Time
+	if days, err := strconv.Atoi(q.Get("days")); err == nil && days > 0 {
+		y, m, d := time.Now().Date()
+		since = time.Date(y, m, d-days+1, 0, 0, 0, 0, time.Local)
+	}
+	// A day or an hour of it, from the coverage page
+	var from, to time.Time
+	if day, err := time.ParseInLocation("2006-01-02", q.Get("day"), time.Local); err == nil {
+		from, to = day, day.AddDate(0, 0, 1)
+		if hour, err := strconv.Atoi(q.Get("hour")); err == nil && hour >= 0 && hour < 24 {
+			from = time.Date(day.Year(), day.Month(), day.Day(), hour, 0, 0, 0, time.Local)
+			to = from.Add(time.Hour)
+		}
+	}
+	user, tag, held := q.Get("user"), q.Get("tag"), q.Has("held")
+	filtered := entries[:0]
+	for _, e := range entries {
+		if e.End.Before(since) || user != "" && e.User != user || tag != "" && !e.hasTag(tag) || held && e.Hold == nil {
+			continue
+		}
+		if !from.IsZero() && (!e.End.After(from) || !e.Start.Before(to)) {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+	return filtered, nil
+}
+
+// page shows the catalog, newest segments first
+func (h *viewHandler) page(w http.ResponseWriter, r *http.Request) {
+	text := requestText(r)
+	entries, err := h.entries(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(text.T("Could not read catalog: %v"), err), http.StatusInternalServerError)
+		return
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := viewPage.Execute(w, struct {
+		pageText
+		Dir       string
+		Entries   []catalogEntry
+		AccessLog bool
+		Annotate  bool
+		Query     string
+	}{text, outputDir, entries, !h.noAccessLog, h.annotations, r.URL.RawQuery}); err != nil {
+		consoleWarn("Could not show the catalog: %v", err)
+	}
+}
+
+// coverage shows the recorded time per day and hour of the last days, 7 or
+// the days of the query
+func (h *viewHandler) coverage(w http.ResponseWriter, r *http.Request) {
+	text := requestText(r)
+	entries, err := h.entries(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(text.T("Could not read catalog: %v"), err), http.StatusInternalServerError)
+		return
+	}
+	days, err := strconv.Atoi(r.URL.Query().Get("days"))
+	if err != nil || days <= 0 {
+		days = defaultCoverageDays
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := coveragePage.Execute(w, struct {
+		pageText
+		Dir  string
+		Days []coverageDay
+	}{text, outputDir, coverageCalendar(entries, min(days, maxCoverageDays))}); err != nil {
+		consoleWarn("Could not show the catalog: %v", err)
+	}
+}
+
+// recordings returns the catalog as a JSON array, in the order of the
+// catalog
+func (h *viewHandler) recordings(w http.ResponseWriter, r *http.Request) {
+	entries, err := h.entries(r)
+	if err != nil {
+		http.Error(w, "Could not read catalog: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []catalogEntry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// file serves a segment, log or transcript the catalog lists, with range
+// requests for players. Downloads are added to the access log, the ranges a
+// player requests after the first are not. This is the only write of the
+// view command.
+func (h *viewHandler) file(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("file")
+	entries, err := readCatalog()
+	if err != nil {
+		http.Error(w, "Could not read catalog: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	listed := false
+	for _, e := range entries {
+		if name != "" && (name == e.File || name == e.Log || name == e.Transcript) {
+			listed = true
+			break
+		}
+	}
+	if !listed {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(filepath.Join(outputDir, filepath.FromSlash(name)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, name+" is not in the output directory, it may be in cold storage", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rng := r.Header.Get("Range"); !h.noAccessLog && (rng == "" || strings.HasPrefix(rng, "bytes=0-")) {
+		user, _, _ := r.BasicAuth()
+		if user == "" {
+			user = "anonymous"
+		}
+		logAccessAs(user, "view", "over HTTP from "+r.RemoteAddr, name)
+	}
+	http.ServeContent(w, r, filepath.Base(name), info.ModTime(), f)
+}
+
+// runViewCommand serves the catalog and recordings of an output directory
+// read-only over HTTP, for reviewers on a machine that does not record,
+// like a NAS with the archive
+func runViewCommand(args []string) int {
+	fs := flag.NewFlagSet("view", flag.ExitOnError)
+	listenFlag := fs.String("listen", "127.0.0.1:8080", "Address to serve the catalog on")
+	outputDirFlag := fs.String("output", outputDir, "Directory that holds the recordings and the catalog")
+	accessLogFlag := fs.Bool("access-log", true, "Add downloads to the access log of the output directory, -access-log=false for a read-only mount")
+	annotateFlag := fs.Bool("annotate", false, "Let reviewers tag segments and add notes to them on the page, in the annotation log of the output directory")
+	envUsage(fs)
+	if err := applyFlagEnv(fs); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	fs.Parse(args)
+	outputDir = *outputDirFlag
+
+	if err := openCatalog(); err != nil {
+		consoleError("%v", err)
+		return 1
+	}
+	if _, err := os.Stat(catalogPath()); err != nil {
+		consoleError("No catalog in %s: %v", outputDir, err)
+		return 1
+	}
+	password := os.Getenv(viewPasswordEnv)
+	host, _, err := net.SplitHostPort(*listenFlag)
+	if err != nil {
+		consoleError("Invalid -listen address %q: %v", *listenFlag, err)
+		return 1
+	}
+	if ip := net.ParseIP(host); password == "" && (ip == nil || !ip.IsLoopback()) {
+		consoleWarn("Anyone who can reach %s can watch the recordings, set a password in %s", *listenFlag, viewPasswordEnv)
+	}
+
+	listener, err := net.Listen("tcp", *listenFlag)
+	if err != nil {
+		consoleError("Could not listen on %s: %v", *listenFlag, err)
+		return 1
+	}
+	server := &http.Server{Handler: newViewHandler(password, *listenFlag, *accessLogFlag, *annotateFlag), ReadHeaderTimeout: 10 * time.Second}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		ctx, cancel := context.WithTimeout(context.Background(), viewShutdownTimeout)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	consoleInfo("Serving the recordings of %s read-only on http://%s", outputDir, listener.Addr())
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		consoleError("%v", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestViewActivityBar(t *testing.T) {
+	setGlobal(t, &outputDir, t.TempDir())
+	setGlobal(t, &anonymize, false)
+	start := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+	activity := &segmentActivity{ActivePercent: 75, Inactive: []inactivePeriod{{Start: 30, End: 60}, {Start: 100, End: 130}}}
+	for _, e := range []catalogEntry{
+		{File: "a.mkv", Start: start, End: start.Add(2 * time.Minute), Size: 100, Activity: activity},
+		{File: "b.mkv", Start: start.Add(time.Hour), End: start.Add(time.Hour + time.Minute), Size: 100},
+	} {
+		if err := appendCatalogEntry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Host = "127.0.0.1:8080"
+	w := httptest.NewRecorder()
+	newViewHandler("", "127.0.0.1:8080", false, false).ServeHTTP(w, r)
+	page := w.Body.String()
+	// The second period runs past the end of the segment, the bar ends with it
+	for _, want := range []string{
+		`x="25" width="25"`, `inactive from 30s to 1m0s`,
+		`x="83.3" width="16.7"`, `inactive from 1m40s to 2m0s`,
+		`75% active`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("the page lacks %q:\n%s", want, page)
+		}
+	}
+	if n := strings.Count(page, `<svg class="activity"`); n != 1 {
+		t.Errorf("%d activity bars for one analyzed segment", n)
+	}
+}
+
+func TestViewCoverage(t *testing.T) {
+	setGlobal(t, &outputDir, t.TempDir())
+	setGlobal(t, &anonymize, false)
+	y, m, d := time.Now().Date()
+	at := func(hour, minute int) time.Time { return time.Date(y, m, d-1, hour, minute, 0, 0, time.Local) }
+	for _, e := range []catalogEntry{
+		// The whole hour from 9, and a quarter of the one from 10
+		{File: "a.mkv", Start: at(9, 0), End: at(10, 15), Size: 100},
+		{File: "b.mkv", Start: at(14, 0), End: at(14, 5), Size: 100},
+	} {
+		if err := appendCatalogEntry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := newViewHandler("", "127.0.0.1:8080", false, false)
+	get := func(path string) string {
+		r := httptest.NewRequest("GET", path, nil)
+		r.Host = "127.0.0.1:8080"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Body.String()
+	}
+
+	day := at(0, 0).Format("2006-01-02")
+	page := get("/coverage")
+	if n := strings.Count(page, "<tr><th><a href="); n != defaultCoverageDays {
+		t.Errorf("%d days on the coverage page", n)
+	}
+	for _, want := range []string{
+		`<td class="l3"><a href="/?day=` + day + `&amp;hour=9"`,
+		`<td class="l1"><a href="/?day=` + day + `&amp;hour=10"`,
+		`1h20m`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("the coverage page lacks %q:\n%s", want, page)
+		}
+	}
+	if n := strings.Count(page, `class="l0"><a`); n != defaultCoverageDays*24-3 {
+		t.Errorf("%d hours without recordings, want %d", n, defaultCoverageDays*24-3)
+	}
+
+	// An hour links to the segments that overlap it
+	if page := get("/?day=" + day + "&hour=10"); !strings.Contains(page, "a.mkv") || strings.Contains(page, "b.mkv") {
+		t.Errorf("segments of the hour from 10:\n%s", page)
+	}
+	if page := get("/?day=" + day); !strings.Contains(page, "a.mkv") || !strings.Contains(page, "b.mkv") {
+		t.Errorf("segments of the day:\n%s", page)
+	}
+}
+
+func TestViewAnnotate(t *testing.T) {
+	setGlobal(t, &outputDir, t.TempDir())
+	setGlobal(t, &anonymize, false)
+	start := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+	if err := appendCatalogEntry(catalogEntry{File: "a.mkv", Start: start, End: start.Add(time.Minute), Size: 100}); err != nil {
+		t.Fatal(err)
+	}
+	post := func(handler http.Handler, form url.Values, origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/annotate", strings.NewReader(form.Encode()))
+		r.Host = "127.0.0.1:8080"
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Origin", origin)
+		r.SetBasicAuth("alice", "secret")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// view stays read-only without -annotate
+	if w := post(newViewHandler("secret", "127.0.0.1:8080", false, false), url.Values{"file": {"a.mkv"}, "tag": {"incident"}}, ""); w.Code != http.StatusNotFound {
+		t.Errorf("annotated without -annotate: %d", w.Code)
+	}
+	handler := newViewHandler("secret", "127.0.0.1:8080", false, true)
+	for _, c := range []struct {
+		form   url.Values
+		origin string
+		want   int
+	}{
+		{url.Values{"file": {"a.mkv"}, "tag": {"incident"}}, "http://evil.example", http.StatusForbidden},
+		{url.Values{"file": {"b.mkv"}, "tag": {"incident"}}, "", http.StatusNotFound},
+		{url.Values{"file": {"a.mkv"}, "tag": {" "}}, "", http.StatusBadRequest},
+	} {
+		if w := post(handler, c.form, c.origin); w.Code != c.want {
+			t.Errorf("%v from %q: got %d, want %d", c.form, c.origin, w.Code, c.want)
+		}
+	}
+
+	// A client of the API gets the annotated segment
+	w := post(handler, url.Values{"file": {"a.mkv"}, "tag": {"incident", "reviewed"}, "note": {"Checkout froze"}}, "")
+	var e catalogEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil || len(e.Tags) != 2 || len(e.Notes) != 1 || e.Notes[0].User != "alice" {
+		t.Fatalf("annotated segment: %d %s", w.Code, w.Body)
+	}
+	// The form of the page goes back to it
+	w = post(handler, url.Values{"file": {"a.mkv"}, "untag": {"reviewed"}, "return": {"tag=incident"}}, "http://127.0.0.1:8080")
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/?tag=incident" {
+		t.Errorf("the form was answered with %d to %q", w.Code, w.Header().Get("Location"))
+	}
+	entries, err := readAnnotatedCatalog()
+	if err != nil || len(entries) != 1 || strings.Join(entries[0].Tags, ",") != "incident" {
+		t.Fatalf("tags after the annotations: %+v, %v", entries, err)
+	}
+
+	r := httptest.NewRequest("GET", "/?tag=incident", nil)
+	r.Host = "127.0.0.1:8080"
+	r.SetBasicAuth("alice", "secret")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	for _, want := range []string{`name="untag" value="incident"`, `name="return" value="tag=incident"`, `Checkout froze`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("the page lacks %q:\n%s", want, w.Body)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Screen size of virtual displays started for an existing display number
+const defaultVirtualDisplaySize = "1920x1080"
+
+// Time to wait for a virtual display server to accept clients
+const virtualDisplayTimeout = 10 * time.Second
+
+var virtualDisplaySizeRe = regexp.MustCompile(`^([0-9]+)x([0-9]+)$`)
+
+// virtualDisplay is an X display the recorder started or attached to, or a
+// monitor it added to the desktop
+type virtualDisplay struct {
+	display string
+	server  *exec.Cmd       // nil when attached to a running display
+	monitor *virtualMonitor // set for -virtual-display-server monitor
+}
+
+// startVirtualDisplay starts an Xvfb or Xephyr server, or attaches to a
+// running one. spec is either a screen size like 1920x1080, for which a free
+// display number is picked, or a display like :99. The monitor server adds a
+// monitor of that size to the desktop instead.
+func startVirtualDisplay(spec, server string) (*virtualDisplay, error) {
+	if server == "monitor" {
+		return startVirtualMonitor(spec)
+	}
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("virtual displays are only supported on Linux")
+	}
+
+	size := defaultVirtualDisplaySize
+	display := ""
+	if strings.HasPrefix(spec, ":") {
+		n, err := strconv.Atoi(strings.TrimPrefix(spec, ":"))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid virtual display %q, use a size like 1920x1080 or a display like :99", spec)
+		}
+		display = spec
+		if _, err := os.Stat(fmt.Sprintf("/tmp/.X11-unix/X%d", n)); err == nil {
+			return &virtualDisplay{display: display}, nil
+		}
+	} else if virtualDisplaySizeRe.MatchString(spec) {
+		size = spec
+	} else {
+		return nil, fmt.Errorf("invalid virtual display %q, use a size like 1920x1080 or a display like :99", spec)
+	}
+
+	var name string
+	var args []string
+	switch server {
+	case "xvfb":
+		name, args = "Xvfb", []string{"-screen", "0", size + "x24"}
+	case "xephyr":
+		name, args = "Xephyr", []string{"-screen", size}
+	default:
+		return nil, fmt.Errorf("unknown virtual display server %q, use xvfb, xephyr or monitor", server)
+	}
+	args = append(args, "-nolisten", "tcp")
+	if display != "" {
+		args = append([]string{display}, args...)
+	}
+
+	// The server writes its display number to -displayfd once it accepts
+	// clients, which also lets it pick a free display number
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	args = append(args, "-displayfd", "3")
+	cmd := exec.Command(name, args...)
+	cmd.ExtraFiles = []*os.File{w}
+	if err := cmd.Start(); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("could not start %s: %w", name, err)
+	}
+	w.Close()
+
+	ready := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(r).ReadString('\n')
+		ready <- strings.TrimSpace(line)
+	}()
+	select {
+	case n := <-ready:
+		if n == "" {
+			cmd.Wait()
+			return nil, fmt.Errorf("%s exited before accepting clients", name)
+		}
+		return &virtualDisplay{display: ":" + n, server: cmd}, nil
+	case <-time.After(virtualDisplayTimeout):
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, fmt.Errorf("%s did not start within %s", name, virtualDisplayTimeout)
+	}
+}
+
+// stop terminates the display server if the recorder started it, or
+// removes the monitor it added
+func (vd *virtualDisplay) stop() {
+	if vd != nil && vd.monitor != nil {
+		vd.monitor.remove()
+		return
+	}
+	if vd == nil || vd.server == nil {
+		return
+	}
+	vd.server.Process.Signal(syscall.SIGTERM)
+	vd.server.Wait()
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// virtualMonitorSize is the capture size of a virtual monitor on X11, the
+// capture starts at its offset on the desktop
+var virtualMonitorSize string
+
+// virtualDisplayDevice is the device instance ID of the virtual display
+// driver -virtual-display-server monitor enables on Windows
+var virtualDisplayDevice string
+
+// parseVirtualMonitorSize returns the width and height of a size like
+// 1920x1080
+func parseVirtualMonitorSize(spec string) (int, int, error) {
+	m := virtualDisplaySizeRe.FindStringSubmatch(spec)
+	if m == nil {
+		return 0, 0, fmt.Errorf("invalid virtual monitor %q, use a size like 1920x1080", spec)
+	}
+	width, _ := strconv.Atoi(m[1])
+	height, _ := strconv.Atoi(m[2])
+	return width, height, nil
+}
@@ -0,0 +1,102 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Position of an output in xrandr --query, like 1920x1080+0+0
+var xrandrGeometryRe = regexp.MustCompile(`^([0-9]+)x([0-9]+)\+([0-9]+)\+([0-9]+)$`)
+
+// virtualMonitor is an output of the X server the recorder turned on
+type virtualMonitor struct {
+	output string
+	mode   string
+}
+
+// startVirtualMonitor turns on a virtual output of the X server, like the
+// VIRTUAL1 of the intel driver or an output of the evdi module, right of
+// all monitors, and captures it
+func startVirtualMonitor(spec string) (*virtualDisplay, error) {
+	width, height, err := parseVirtualMonitorSize(spec)
+	if err != nil {
+		return nil, err
+	}
+	out, err := exec.Command("xrandr", "--query").Output()
+	if err != nil {
+		return nil, fmt.Errorf("xrandr: %v", err)
+	}
+	output, right := "", 0
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(line, " ") {
+			continue
+		}
+		switch fields[1] {
+		case "connected":
+			for _, f := range fields[2:] {
+				if m := xrandrGeometryRe.FindStringSubmatch(f); m != nil {
+					w, _ := strconv.Atoi(m[1])
+					x, _ := strconv.Atoi(m[3])
+					right = max(right, x+w)
+				}
+			}
+		case "disconnected":
+			if output == "" && (strings.HasPrefix(fields[0], "VIRTUAL") || strings.HasPrefix(fields[0], "DVI-I-")) {
+				output = fields[0]
+			}
+		}
+	}
+	if output == "" {
+		return nil, fmt.Errorf("the X server has no virtual output, the intel driver provides VIRTUAL1 and the evdi module DVI-I outputs")
+	}
+
+	// cvt computes the timings of the mode, which a virtual output accepts
+	// like any other
+	out, err = exec.Command("cvt", strconv.Itoa(width), strconv.Itoa(height), "60").Output()
+	if err != nil {
+		return nil, fmt.Errorf("cvt: %v", err)
+	}
+	var timings []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Fields(line); len(fields) > 2 && fields[0] == "Modeline" {
+			timings = fields[2:]
+		}
+	}
+	if timings == nil {
+		return nil, fmt.Errorf("cvt printed no mode for %dx%d", width, height)
+	}
+
+	vm := &virtualMonitor{output: output, mode: fmt.Sprintf("screen-vibe-%dx%d", width, height)}
+	vm.remove() // left over by a recorder that did not exit cleanly
+	for _, args := range [][]string{
+		append([]string{"--newmode", vm.mode}, timings...),
+		{"--addmode", output, vm.mode},
+		{"--output", output, "--mode", vm.mode, "--pos", fmt.Sprintf("%dx0", right)},
+	} {
+		if out, err := exec.Command("xrandr", args...).CombinedOutput(); err != nil {
+			vm.remove()
+			return nil, fmt.Errorf("xrandr %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	virtualMonitorSize = fmt.Sprintf("%dx%d", width, height)
+	display := os.Getenv("DISPLAY")
+	if display == "" {
+		display = ":0"
+	}
+	return &virtualDisplay{display: fmt.Sprintf("%s+%d,0", display, right), monitor: vm}, nil
+}
+
+// remove turns the output off again and forgets its mode
+func (vm *virtualMonitor) remove() {
+	exec.Command("xrandr", "--output", vm.output, "--off").Run()
+	exec.Command("xrandr", "--delmode", vm.output, vm.mode).Run()
+	exec.Command("xrandr", "--rmmode", vm.mode).Run()
+}
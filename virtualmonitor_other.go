@@ -0,0 +1,16 @@
+//go:build !linux && !windows
+
+package main
+
+import "errors"
+
+// virtualMonitor is a monitor added to the desktop, not supported here
+type virtualMonitor struct{}
+
+// startVirtualMonitor is only implemented on Linux and Windows, macOS has
+// no public interface to add a monitor
+func startVirtualMonitor(spec string) (*virtualDisplay, error) {
+	return nil, errors.New("virtual monitors are only supported on Linux and Windows")
+}
+
+func (vm *virtualMonitor) remove() {}
@@ -0,0 +1,121 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var procChangeDisplaySettingsExW = moduser32.NewProc("ChangeDisplaySettingsExW")
+
+const (
+	// DEVMODE fields of the screen size
+	dmPelsWidth  = 0x00080000
+	dmPelsHeight = 0x00100000
+	// ChangeDisplaySettingsEx result on success
+	dispChangeSuccessful = 0
+)
+
+// devModeW mirrors DEVMODEW for displays
+type devModeW struct {
+	dmDeviceName       [32]uint16
+	dmSpecVersion      uint16
+	dmDriverVersion    uint16
+	dmSize             uint16
+	dmDriverExtra      uint16
+	dmFields           uint32
+	dmPosition         [2]int32
+	dmOrientation      uint32
+	dmFixedOutput      uint32
+	dmColor            int16
+	dmDuplex           int16
+	dmYResolution      int16
+	dmTTOption         int16
+	dmCollate          int16
+	dmFormName         [32]uint16
+	dmLogPixels        uint16
+	dmBitsPerPel       uint32
+	dmPelsWidth        uint32
+	dmPelsHeight       uint32
+	dmDisplayFlags     uint32
+	dmDisplayFrequency uint32
+	dmReserved         [8]uint32
+}
+
+// virtualMonitor is the device of a virtual display driver the recorder
+// enabled
+type virtualMonitor struct {
+	device string
+}
+
+// startVirtualMonitor enables the device of an installed virtual display
+// driver, like the Virtual Display Driver or usbmmidd, waits for its
+// monitor, sets its size and captures it
+func startVirtualMonitor(spec string) (*virtualDisplay, error) {
+	if virtualDisplayDevice == "" {
+		return nil, fmt.Errorf("-virtual-display-server monitor needs the -virtual-display-device of a virtual display driver on Windows")
+	}
+	width, height, err := parseVirtualMonitorSize(spec)
+	if err != nil {
+		return nil, err
+	}
+	before, err := listMonitors()
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, m := range before {
+		known[m.name] = true
+	}
+
+	vm := &virtualMonitor{device: virtualDisplayDevice}
+	if out, err := exec.Command("pnputil", "/enable-device", vm.device).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("could not enable %s (the recorder needs to run as administrator): %v: %s", vm.device, err, strings.TrimSpace(string(out)))
+	}
+	name := ""
+	for deadline := time.Now().Add(virtualDisplayTimeout); name == "" && time.Now().Before(deadline); {
+		time.Sleep(500 * time.Millisecond)
+		monitors, _ := listMonitors()
+		for _, m := range monitors {
+			if !known[m.name] {
+				name = m.name
+			}
+		}
+	}
+	if name == "" {
+		vm.remove()
+		return nil, fmt.Errorf("%s added no monitor within %s", vm.device, virtualDisplayTimeout)
+	}
+
+	mode := devModeW{dmFields: dmPelsWidth | dmPelsHeight, dmPelsWidth: uint32(width), dmPelsHeight: uint32(height)}
+	mode.dmSize = uint16(unsafe.Sizeof(mode))
+	deviceName, _ := syscall.UTF16PtrFromString(name)
+	if r, _, _ := procChangeDisplaySettingsExW.Call(uintptr(unsafe.Pointer(deviceName)), uintptr(unsafe.Pointer(&mode)), 0, 0, 0); r != dispChangeSuccessful {
+		vm.remove()
+		return nil, fmt.Errorf("the virtual display driver does not offer %dx%d", width, height)
+	}
+
+	// Look the monitor up again, its size changed the numbering
+	monitors, err := listMonitors()
+	if err != nil {
+		vm.remove()
+		return nil, err
+	}
+	for i, m := range monitors {
+		if m.name == name {
+			return &virtualDisplay{display: fmt.Sprintf("monitor:%d", i), monitor: vm}, nil
+		}
+	}
+	vm.remove()
+	return nil, fmt.Errorf("monitor %s disappeared", name)
+}
+
+// remove disables the device again, which removes its monitor
+func (vm *virtualMonitor) remove() {
+	exec.Command("pnputil", "/disable-device", vm.device).Run()
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Global variables for watermark settings
+var watermarkImage *imageWatermark
+var watermarkText string
+
+// imageWatermark is an image overlaid on the recording
+type imageWatermark struct {
+	path    string
+	x, y    int // negative values are measured from the right/bottom edge
+	opacity float64
+}
+
+// parseWatermark parses an image watermark of the form path[@x,y][:opacity],
+// e.g. "logo.png@10,10:0.5"
+func parseWatermark(spec string) (*imageWatermark, error) {
+	wm := &imageWatermark{path: spec, x: 10, y: 10, opacity: 1}
+
+	if at := strings.LastIndex(spec, "@"); at >= 0 {
+		wm.path = spec[:at]
+		pos := spec[at+1:]
+
+		if colon := strings.Index(pos, ":"); colon >= 0 {
+			opacity, err := strconv.ParseFloat(pos[colon+1:], 64)
+			if err != nil || opacity < 0 || opacity > 1 {
+				return nil, fmt.Errorf("invalid watermark opacity %q, expected 0.0-1.0", pos[colon+1:])
+			}
+			wm.opacity = opacity
+			pos = pos[:colon]
+		}
+
+		x, y, found := strings.Cut(pos, ",")
+		if !found {
+			return nil, fmt.Errorf("invalid watermark position %q, expected x,y", pos)
+		}
+		var errX, errY error
+		wm.x, errX = strconv.Atoi(strings.TrimSpace(x))
+		wm.y, errY = strconv.Atoi(strings.TrimSpace(y))
+		if errX != nil || errY != nil {
+			return nil, fmt.Errorf("invalid watermark position %q, expected x,y", pos)
+		}
+	}
+
+	if _, err := os.Stat(wm.path); err != nil {
+		return nil, fmt.Errorf("watermark image: %w", err)
+	}
+	return wm, nil
+}
+
+// watermarkArgs returns the extra ffmpeg inputs and the filter graph
+// arguments for the configured watermarks, drawn over the output label of
+// graph, or over the capture input [0:v] if graph is empty. firstInput is
+// the index the first extra input will get on the ffmpeg command line.
+func watermarkArgs(firstInput int, graph []string, label string) (inputs []string, filterArgs []string) {
+	if watermarkImage == nil && watermarkText == "" && len(graph) == 0 {
+		return nil, nil
+	}
+
+	if watermarkImage != nil {
+		inputs = append(inputs, "-i", watermarkImage.path)
+		graph = append(graph, fmt.Sprintf("[%d:v]format=rgba,colorchannelmixer=aa=%.2f[wm]", firstInput, watermarkImage.opacity))
+
+		x := strconv.Itoa(watermarkImage.x)
+		if watermarkImage.x < 0 {
+			x = fmt.Sprintf("main_w-overlay_w-%d", -watermarkImage.x)
+		}
+		y := strconv.Itoa(watermarkImage.y)
+		if watermarkImage.y < 0 {
+			y = fmt.Sprintf("main_h-overlay_h-%d", -watermarkImage.y)
+		}
+		graph = append(graph, fmt.Sprintf("%s[wm]overlay=%s:%s[wmo]", label, x, y))
+		label = "[wmo]"
+	}
+
+	if watermarkText != "" {
+		graph = append(graph, fmt.Sprintf("%sdrawtext=text=%s:fontsize=24:fontcolor=white@0.8:box=1:boxcolor=black@0.4:boxborderw=6:x=10:y=h-th-10[wmt]",
+			label, escapeFilterValue(expandWatermarkText(watermarkText))))
+		label = "[wmt]"
+	}
+
+	return inputs, []string{"-filter_complex", strings.Join(graph, ";"), "-map", label}
+}
+
+// expandWatermarkText replaces the {user}, {time} and {date} placeholders and
+// escapes everything else for drawtext text expansion. {time} and {date} are
+// rendered by ffmpeg for every frame.
+func expandWatermarkText(template string) string {
+	escape := strings.NewReplacer(`\`, `\\`, `%`, `\%`)
+
+	user := currentSessionTag()
+	if user == "" || user == "locked" {
+		user = loginUser()
+	}
+
+	var b strings.Builder
+	for len(template) > 0 {
+		open := strings.Index(template, "{")
+		if open < 0 {
+			break
+		}
+		end := strings.Index(template[open:], "}")
+		if end < 0 {
+			break
+		}
+		b.WriteString(escape.Replace(template[:open]))
+
+		switch placeholder := template[open : open+end+1]; placeholder {
+		case "{user}":
+			b.WriteString(escape.Replace(user))
+		case "{time}":
+			b.WriteString(`%{localtime:%Y-%m-%d %H\:%M\:%S}`)
+		case "{date}":
+			b.WriteString(`%{localtime:%Y-%m-%d}`)
+		default:
+			b.WriteString(escape.Replace(placeholder))
+		}
+		template = template[open+end+1:]
+	}
+	b.WriteString(escape.Replace(template))
+	return b.String()
+}
+
+// escapeFilterValue escapes a filter option value for both the option
+// parser and the filter graph parser of ffmpeg
+func escapeFilterValue(v string) string {
+	v = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`).Replace(v)
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`).Replace(v)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// linuxCapture is how Linux desktops are captured: "" for x11grab,
+// "portal" for the PipeWire stream of the screen cast portal or "kmsgrab"
+// for the DRM plane, both of which also see Wayland desktops
+var linuxCapture string
+
+// screenCastSession is the screen cast portal session of "portal", opened
+// once at startup so the user picks the screen only once
+var screenCastSession *screenCast
+
+// waylandSession reports whether the recorder runs in a Wayland session,
+// where x11grab only sees the windows of XWayland and records the rest of
+// the desktop black
+func waylandSession() bool {
+	return os.Getenv("XDG_SESSION_TYPE") == "wayland" || os.Getenv("WAYLAND_DISPLAY") != ""
+}
+
+// pipewireSupport returns why the portal capture is not possible, "" if it
+// is. ffmpeg has no PipeWire input, GStreamer reads the stream and hands the
+// frames to ffmpeg.
+func pipewireSupport() string {
+	if _, err := exec.LookPath("gst-launch-1.0"); err != nil {
+		return "gst-launch-1.0 is not installed"
+	}
+	for _, element := range []string{"pipewiresrc", "y4menc"} {
+		if exec.Command("gst-inspect-1.0", "--exists", element).Run() != nil {
+			return "GStreamer lacks " + element + " (gstreamer1.0-pipewire, gstreamer1.0-plugins-bad)"
+		}
+	}
+	return ""
+}
+
+// kmsgrabSupport returns why the kmsgrab capture is not possible, "" if it
+// is. ffmpeg also needs CAP_SYS_ADMIN, which only shows once it runs.
+func kmsgrabSupport() string {
+	if !strings.Contains(zeroCopySources(), "kmsgrab") {
+		return "ffmpeg lacks the kmsgrab source"
+	}
+	if _, err := os.Stat(kmsDevice); err != nil {
+		return fmt.Sprintf("%s not found", kmsDevice)
+	}
+	return ""
+}
+
+// selectLinuxCapture returns the capture of -wayland-capture: portal or
+// kmsgrab as asked, or with auto in a Wayland session the portal, else
+// kmsgrab, else x11grab with a warning
+func selectLinuxCapture(mode string) (string, error) {
+	switch mode {
+	case "x11":
+		return "", nil
+	case "portal", "kmsgrab":
+		reason := pipewireSupport()
+		if mode == "kmsgrab" {
+			reason = kmsgrabSupport()
+		}
+		if reason != "" {
+			return "", errors.New(reason)
+		}
+		return mode, nil
+	case "auto":
+	default:
+		return "", fmt.Errorf("unknown capture %q, use auto, portal, kmsgrab or x11", mode)
+	}
+	if !waylandSession() {
+		return "", nil
+	}
+	portal, kms := pipewireSupport(), kmsgrabSupport()
+	switch {
+	case portal == "":
+		return "portal", nil
+	case kms == "":
+		return "kmsgrab", nil
+	}
+	consoleWarn("Wayland session, but no capture sees it: %s, and %s; x11grab only records the windows of XWayland, the rest stays black", portal, kms)
+	return "", nil
+}
+
+// screenCastTokenPath returns the file with the restore token of the portal,
+// which lets the next start of the instance record the same screen without
+// asking again
+func screenCastTokenPath() string {
+	return filepath.Join(outputDir, ".screencast-"+instanceName+".token")
+}
+
+// openScreenCast starts the screen cast session, with the screen picked
+// before if the portal still has it
+func openScreenCast() error {
+	tokenFile := screenCastTokenPath()
+	token, _ := os.ReadFile(tokenFile)
+	if len(token) == 0 {
+		consoleInfo("Choose the screen to record in the screen sharing dialog")
+	}
+	s, newToken, err := startScreenCast(strings.TrimSpace(string(token)))
+	if err != nil {
+		return err
+	}
+	screenCastSession = s
+	if newToken != "" {
+		if err := os.MkdirAll(outputDir, 0755); err == nil {
+			os.WriteFile(tokenFile, []byte(newToken+"\n"), 0600)
+		}
+	}
+	return nil
+}
+
+// waylandInputArgs returns the capture input of linuxCapture: the raw
+// frames GStreamer writes to fd 3, or kmsgrab, whose DRM frames
+// captureFilters downloads
+func waylandInputArgs(fps int) []string {
+	if linuxCapture == "kmsgrab" {
+		return []string{"-device", kmsDevice, "-f", "kmsgrab", "-framerate", fmt.Sprint(fps), "-i", "-"}
+	}
+	return []string{"-f", "yuv4mpegpipe", "-i", "pipe:3"}
+}
+
+// pipewireCapture is the GStreamer process that reads the screen cast
+// stream of a segment and writes it to ffmpeg
+type pipewireCapture struct {
+	cmd     *exec.Cmd
+	frames  *os.File // read end of the pipe, ffmpeg's fd 3
+	stopped atomic.Bool
+	exited  chan struct{}
+}
+
+// startPipeWireCapture connects a GStreamer pipeline to the screen cast
+// stream and hands its frames to cmd on fd 3, at fps frames per second
+func startPipeWireCapture(cmd *exec.Cmd, fps int, log *slog.Logger) (*pipewireCapture, error) {
+	if screenCastSession == nil {
+		return nil, errors.New("no screen cast session")
+	}
+	remote, err := screenCastSession.openRemote()
+	if err != nil {
+		return nil, err
+	}
+	defer remote.Close()
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer w.Close()
+
+	// The PipeWire connection of the portal is fd 3 of GStreamer
+	gst := exec.Command("gst-launch-1.0", "-q",
+		"pipewiresrc", "fd=3", fmt.Sprintf("path=%d", screenCastSession.node), "do-timestamp=true", "keepalive-time=1000", "always-copy=true",
+		"!", "videoconvert", "!", "videorate", "!", fmt.Sprintf("video/x-raw,format=I420,framerate=%d/1", fps),
+		"!", "y4menc", "!", "fdsink", "fd=1")
+	gst.ExtraFiles = []*os.File{remote}
+	gst.Stdout = w
+	stderr, _ := gst.StderrPipe()
+	log.Info("Running GStreamer for the screen cast", "node", screenCastSession.node, "cmd", gst.String())
+	if err := gst.Start(); err != nil {
+		r.Close()
+		return nil, fmt.Errorf("gst-launch-1.0: %v", err)
+	}
+	c := &pipewireCapture{cmd: gst, frames: r, exited: make(chan struct{})}
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			log.Warn("GStreamer", "output", scanner.Text())
+		}
+	}()
+	go func() {
+		if err := gst.Wait(); err != nil && !c.stopped.Load() {
+			log.Warn("Screen cast stream ended", "error", err)
+		}
+		close(c.exited)
+	}()
+	cmd.ExtraFiles = []*os.File{r}
+	return c, nil
+}
+
+// stop ends GStreamer once ffmpeg exited, it would wait for a reader
+func (c *pipewireCapture) stop() {
+	c.stopped.Store(true)
+	c.frames.Close()
+	select {
+	case <-c.exited:
+	default:
+		c.cmd.Process.Kill()
+		<-c.exited
+	}
+}
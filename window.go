@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// Window recorded into its own files next to every segment with -window,
+// at its own frame rate and bitrate
+var (
+	windowTitle   string // "" without -window
+	windowFPS     int
+	windowBitrate int
+)
+
+// xwininfo prints the id of the window it found as "Window id: 0x3a00007"
+var x11WindowIDRe = regexp.MustCompile(`Window id: (0x[0-9a-fA-F]+)`)
+
+// windowInputArgs returns the capture input of the window titled title on
+// goos. gdigrab finds the window by its title, x11grab needs its id.
+func windowInputArgs(goos, title string, fps int) ([]string, error) {
+	fpsStr := strconv.Itoa(fps)
+	switch goos {
+	case "windows":
+		return []string{"-f", "gdigrab", "-framerate", fpsStr, "-i", "title=" + title}, nil
+	case "darwin":
+		return nil, errors.New("avfoundation cannot capture single windows")
+	}
+	out, err := exec.Command("xwininfo", "-name", title).Output()
+	if err != nil {
+		return nil, fmt.Errorf("no window titled %q (xwininfo: %v)", title, err)
+	}
+	m := x11WindowIDRe.FindSubmatch(out)
+	if m == nil {
+		return nil, fmt.Errorf("no window titled %q", title)
+	}
+	return []string{"-f", "x11grab", "-framerate", fpsStr, "-window_id", string(m[1]), "-i", x11DisplayInput()}, nil
+}
+
+// windowRecording is the ffmpeg recording the -window window during a
+// segment
+type windowRecording struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	file    string
+	encoder string
+	start   time.Time
+	end     time.Time
+	exited  chan struct{}
+}
+
+// startWindowRecording starts recording the -window window into file, nil
+// if the window cannot be recorded. The segment is recorded without it then.
+func startWindowRecording(encoder, file string, log *slog.Logger) *windowRecording {
+	input, err := windowInputArgs(runtime.GOOS, windowTitle, windowFPS)
+	if err != nil {
+		consoleWarn("Not recording the window this segment: %v", err)
+		log.Warn("Not recording the window", "window", windowTitle, "error", err)
+		return nil
+	}
+	var a ffmpegArgs
+	// Only errors, the screen recording already shows the progress
+	a.input = append([]string{"-hide_banner", "-loglevel", "error"}, input...)
+	if wallclockTimestamps {
+		a.input = append([]string{"-use_wallclock_as_timestamps", "1"}, a.input...)
+	}
+	a.extraInputs, a.filter = watermarkArgs(1, nil, "[0:v]")
+	a.codec = encoderOptions(encoder, windowFPS, windowBitrate, log)
+	a.output = []string{"-f", "matroska", file}
+
+	cmd := recorderFFmpeg.command(a.list()...)
+	cmd.Env = dpiAwareEnv(os.Environ())
+	log.Info("Running ffmpeg for the window", "window", windowTitle, "cmd", cmd.String())
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		log.Error("Failed to get stdin pipe for the window ffmpeg", "error", err)
+		return nil
+	}
+	stderr, _ := cmd.StderrPipe()
+	if err := cmd.Start(); err != nil {
+		log.Error("Failed to start ffmpeg for the window", "error", err)
+		consoleWarn("Could not record the window: %v", err)
+		return nil
+	}
+	w := &windowRecording{cmd: cmd, stdin: stdin, file: file, encoder: encoder, start: time.Now(), exited: make(chan struct{})}
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			log.Warn("Window ffmpeg", "output", scanner.Text())
+		}
+	}()
+	go func() {
+		err := cmd.Wait()
+		w.end = time.Now()
+		if err != nil {
+			log.Warn("Window recording ended", "error", err)
+		}
+		close(w.exited)
+	}()
+	consoleEvent("Recording window %q to %s", windowTitle, file)
+	return w
+}
+
+// stop finishes the window recording with the segment, ffmpeg gets the
+// same 10 seconds to finalize the file as for the screen
+func (w *windowRecording) stop(log *slog.Logger) {
+	select {
+	case <-w.exited:
+		// The window was closed during the segment
+		return
+	default:
+	}
+	w.stdin.Write([]byte("q\n"))
+	select {
+	case <-w.exited:
+	case <-time.After(10 * time.Second):
+		log.Warn("Window recording did not finish in time, killing ffmpeg")
+		w.cmd.Process.Kill()
+		<-w.exited
+	}
+}
+
+// finish registers the window recording in the catalog next to the segment
+// entry and hands it to the extensions, so it is kept and uploaded like the
+// screen recording
+func (w *windowRecording) finish(segment catalogEntry, logFile string, log *slog.Logger) {
+	info, err := os.Stat(w.file)
+	if err != nil {
+		log.Warn("Window recording has no file", "file", w.file, "error", err)
+		return
+	}
+	entry := catalogEntry{
+		File:     relativeToOutput(w.file),
+		Log:      segment.Log,
+		Start:    w.start,
+		End:      w.end,
+		Size:     info.Size(),
+		User:     segment.User,
+		Session:  segment.Session,
+		Tag:      segment.Tag,
+		Encoder:  w.encoder,
+		Window:   windowTitle,
+		Command:  segment.Command,
+		ExitCode: segment.ExitCode,
+	}
+	if err := appendCatalogEntry(entry); err != nil {
+		log.Error("Failed to update catalog", "error", err)
+	}
+	extensionsSegmentFinished(extensionSegment(entry, w.file, logFile))
+}
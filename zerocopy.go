@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DRM device kmsgrab captures from on Linux
+const kmsDevice = "/dev/dri/card0"
+
+// zeroCopy keeps the captured frames on the GPU until they are encoded,
+// where the OS, GPU and ffmpeg allow it
+var zeroCopy bool
+
+// zeroCopyFailed is set once a zero-copy segment failed before its first
+// frame, later segments then use the regular capture
+var zeroCopyFailed atomic.Bool
+
+// zeroCopySources tells which GPU capture sources ffmpeg has, asked once
+var zeroCopySources = sync.OnceValue(func() string {
+	var sources []string
+	if out, err := exec.Command("ffmpeg", "-hide_banner", "-filters").Output(); err == nil && strings.Contains(string(out), " ddagrab ") {
+		sources = append(sources, "ddagrab")
+	}
+	if out, err := exec.Command("ffmpeg", "-hide_banner", "-devices").Output(); err == nil && strings.Contains(string(out), " kmsgrab ") {
+		sources = append(sources, "kmsgrab")
+	}
+	return strings.Join(sources, ",")
+})
+
+// zeroCopySupport returns why there is no zero-copy path on goos, "" if
+// there is one for some segments
+func zeroCopySupport(goos string) string {
+	switch goos {
+	case "windows":
+		if !strings.Contains(zeroCopySources(), "ddagrab") {
+			return "ffmpeg lacks the ddagrab source (needs ffmpeg 6)"
+		}
+		if !hasNvidiaGPU() && !hasIntelGPU() && !hasAMDGPU() {
+			return "no NVIDIA, Intel or AMD GPU found"
+		}
+	case "darwin":
+		return "ffmpeg has no ScreenCaptureKit source, avfoundation copies every frame"
+	default:
+		if !strings.Contains(zeroCopySources(), "kmsgrab") {
+			return "ffmpeg lacks the kmsgrab source"
+		}
+		if _, err := os.Stat(kmsDevice); err != nil {
+			return fmt.Sprintf("%s not found", kmsDevice)
+		}
+		if !hasIntelGPU() && !hasAMDGPU() {
+			return "VAAPI needs an Intel or AMD GPU"
+		}
+	}
+	return ""
+}
+
+// cpuFilters lists the options of a segment on goos that need the frames
+// in main memory, each rules out zero-copy
+func cpuFilters(goos string, blurs []*blurRegion) []string {
+	var filters []string
+	if len(blurs) > 0 {
+		filters = append(filters, "-blur-window")
+	}
+	if watermarkImage != nil || watermarkText != "" {
+		filters = append(filters, "-watermark")
+	}
+	if dedupeFrames {
+		filters = append(filters, "-dedupe")
+	}
+	if captureRegion != nil {
+		filters = append(filters, "-region")
+	}
+	if profileCrop() != "" {
+		filters = append(filters, "the region of -app-profiles")
+	}
+	if virtualCamera != "" {
+		filters = append(filters, "-virtual-camera")
+	}
+	if cameraSource != "" {
+		filters = append(filters, "-camera")
+	}
+	if privateBlurFilter() != "" {
+		filters = append(filters, "-do-not-record-action blur")
+	}
+	if remoteReview {
+		filters = append(filters, "-remote-review")
+	}
+	if signage != nil {
+		filters = append(filters, "-signage")
+	} else if len(uiReferences) > 0 {
+		filters = append(filters, "-ui-reference")
+	}
+	if len(audioTracks()) > 0 {
+		filters = append(filters, "the audio tracks")
+	}
+	return filters
+}
+
+// zeroCopyEncoder returns the encoder of a zero-copy pipeline for a
+// segment, which is VAAPI on Linux, and whether the segment can use one.
+// Anything that rules it out falls back to the regular capture.
+func zeroCopyEncoder(goos, encoder, device string, blurs []*blurRegion, log *slog.Logger) (string, bool) {
+	if !zeroCopy || zeroCopyFailed.Load() {
+		return encoder, false
+	}
+	if filters := cpuFilters(goos, blurs); len(filters) > 0 {
+		log.Info("Zero-copy capture is off for this segment", "reason", strings.Join(filters, ", ")+" need the frames in main memory")
+		return encoder, false
+	}
+	codec := "hevc"
+	if useH264 {
+		codec = "h264"
+	}
+	switch goos {
+	case "windows":
+		// ddagrab captures a single output, not the whole desktop or a window
+		if _, ok := parseMonitorDisplay(device); !ok {
+			if monitors, err := listMonitors(); device != "desktop" || err != nil || len(monitors) != 1 {
+				log.Info("Zero-copy capture is off for this segment", "reason", "ddagrab captures one monitor, use -display monitor:N")
+				return encoder, false
+			}
+		}
+		if !strings.HasSuffix(encoder, "_nvenc") && !strings.HasSuffix(encoder, "_qsv") && !strings.HasSuffix(encoder, "_amf") {
+			return encoder, false
+		}
+		return encoder, true
+	case "darwin":
+		return encoder, false
+	}
+	vaapi := codec + "_vaapi"
+	if info := ffmpegCapabilities(); info == nil || !slices.Contains(info.Encoders, vaapi) {
+		log.Info("Zero-copy capture is off for this segment", "reason", "ffmpeg lacks "+vaapi)
+		return encoder, false
+	}
+	return vaapi, true
+}
+
+// zeroCopyInputArgs returns the GPU capture input of goos: ddagrab on
+// Windows, which hands D3D11 frames to the encoder, and kmsgrab on Linux,
+// whose DRM frames are mapped to VAAPI
+func zeroCopyInputArgs(goos, device string, fps int) []string {
+	if goos == "windows" {
+		idx, _ := parseMonitorDisplay(device)
+		return []string{"-f", "lavfi", "-i", fmt.Sprintf("ddagrab=output_idx=%d:framerate=%d:draw_mouse=1", idx, fps)}
+	}
+	return []string{"-device", kmsDevice, "-f", "kmsgrab", "-framerate", fmt.Sprint(fps), "-i", "-"}
+}
+
+// zeroCopyFilter returns the filter that moves the captured frames to the
+// encoder's device without a copy to main memory, nil if the encoder takes
+// them as they are
+func zeroCopyFilter(goos, encoder string) []string {
+	switch {
+	case goos != "windows":
+		return []string{"-vf", "hwmap=derive_device=vaapi,scale_vaapi=format=nv12"}
+	case strings.HasSuffix(encoder, "_qsv"):
+		return []string{"-vf", "hwmap=derive_device=qsv,format=qsv"}
+	}
+	return nil
+}
+
+// withoutPixFmt drops the -pix_fmt option, a software pixel format would
+// pull the frames off the GPU again
+func withoutPixFmt(args []string) []string {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == "-pix_fmt" {
+			return append(args[:i:i], args[i+2:]...)
+		}
+	}
+	return args
+}